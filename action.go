@@ -0,0 +1,248 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// chainKey is the context key of the chain running a rule.
+type chainKey struct{}
+
+// chainFrom returns the chain running the rule whose action has the given
+// context, or nil if there is none.
+func chainFrom(ctx context.Context) *Chain {
+	c, _ := ctx.Value(chainKey{}).(*Chain)
+	return c
+}
+
+// stepKey is the context key of the stepSlot in which NamedAction reports the
+// name of the step run by a combinator such as Timeout.
+type stepKey struct{}
+
+// stepSlot holds the name of the first step reported to a combinator.
+type stepSlot struct {
+	once sync.Once
+	name string
+}
+
+// NamedAction returns an action that runs fn as a step with the given name,
+// which identifies it in the errors of combinators such as Timeout and in the
+// logs of its actions.
+func NamedAction(name string, fn Action) Action {
+	return writesOf(func(ctx context.Context) {
+		fn(namedStep(ctx, name))
+	}, fn)
+}
+
+// NamedActionE is like NamedAction, for an action that can fail.
+func NamedActionE(name string, fn ActionE) ActionE {
+	return func(ctx context.Context) error {
+		return fn(namedStep(ctx, name))
+	}
+}
+
+// namedStep reports the name of the step to the enclosing combinator, and
+// returns ctx with the logger enriched with the step.
+func namedStep(ctx context.Context, name string) context.Context {
+	if slot, ok := ctx.Value(stepKey{}).(*stepSlot); ok {
+		slot.once.Do(func() { slot.name = name })
+	}
+	return log.IntoContext(ctx, log.FromContext(ctx).WithValues("step", name))
+}
+
+// StepTimeoutError is the error of a step that did not finish within the
+// timeout set by Timeout. It wraps context.DeadlineExceeded.
+type StepTimeoutError struct {
+	// Step is the name of the step given by NamedAction, if any.
+	Step string
+	// Timeout is the timeout of the step.
+	Timeout time.Duration
+}
+
+// Error returns the step and its timeout.
+func (e *StepTimeoutError) Error() string {
+	if e.Step == "" {
+		return fmt.Sprintf("step timed out after %s", e.Timeout)
+	}
+	return fmt.Sprintf("step %s timed out after %s", e.Step, e.Timeout)
+}
+
+// Unwrap returns context.DeadlineExceeded.
+func (e *StepTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// Timeout returns an action that runs fn with a context whose deadline is d
+// from now, or the deadline of the enclosing context if that is sooner. If the
+// deadline of Timeout passes before fn returns, a StepTimeoutError naming the
+// step becomes the error of the chain running the rule. fn must return once
+// its context is done.
+func Timeout(d time.Duration, fn Action) Action {
+	return writesOf(func(ctx context.Context) {
+		if err := TimeoutE(d, func(ctx context.Context) error {
+			fn(ctx)
+			return nil
+		})(ctx); err != nil {
+			if c := chainFrom(ctx); c != nil {
+				c.fail(ctx, err)
+			}
+		}
+	}, fn)
+}
+
+// TimeoutE is like Timeout, for an action that can fail: it returns the
+// StepTimeoutError if its own deadline passed, and otherwise the error of fn.
+// It composes with Retry, e.g. to bound each attempt.
+func TimeoutE(d time.Duration, fn ActionE) ActionE {
+	return func(ctx context.Context) error {
+		step := &stepSlot{}
+		inner, cancel := context.WithTimeout(context.WithValue(ctx, stepKey{}, step), d)
+		defer cancel()
+		err := fn(inner)
+		// When the enclosing deadline passes first, it is for the enclosing
+		// Timeout to report.
+		if errors.Is(inner.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return &StepTimeoutError{Step: step.name, Timeout: d}
+		}
+		return err
+	}
+}
+
+// If returns an action that runs then if p is true when the action runs. p is
+// evaluated through the cache of the chain running the rule, so it sees the
+// invalidations made by earlier actions, e.g. in the same Sequential. A nil
+// action does nothing.
+func If(p *predicate, then Action) Action {
+	return IfElse(p, then, nil)
+}
+
+// IfElse returns an action that runs then if p is true when the action runs,
+// and els otherwise, evaluating p as If does.
+func IfElse(p *predicate, then, els Action) Action {
+	return writesOf(func(ctx context.Context) {
+		branch := els
+		if evalIn(ctx, p) {
+			branch = then
+		}
+		if branch != nil {
+			branch(ctx)
+		}
+	}, then, els)
+}
+
+// evalIn evaluates p through the cache of the chain running the rule whose
+// action has the given context, or a new cache if there is none.
+func evalIn(ctx context.Context, p *predicate) bool {
+	if c := chainFrom(ctx); c != nil {
+		return p.Eval(c.cache)
+	}
+	return p.Eval(pcache.New())
+}
+
+// Case is a case of Switch.
+type Case struct {
+	// When is the predicate of the case. A case without one always matches.
+	When *predicate
+	// Do is the action to run when the case matches. If nil, the case does
+	// nothing.
+	Do Action
+}
+
+// Default returns a case that always matches, for the end of a Switch.
+func Default(do Action) Case {
+	return Case{Do: do}
+}
+
+// Switch returns an action that runs the action of the first of the cases
+// whose predicate is true when the action runs. Predicates are evaluated in
+// order, as If evaluates them, until one is true. If none is, Switch does
+// nothing, and logs so at verbosity level 1.
+func Switch(cases ...Case) Action {
+	actions := make([]Action, len(cases))
+	for i, cs := range cases {
+		actions[i] = cs.Do
+	}
+	return writesOf(func(ctx context.Context) {
+		for _, cs := range cases {
+			if cs.When == nil || evalIn(ctx, cs.When) {
+				if cs.Do != nil {
+					cs.Do(ctx)
+				}
+				return
+			}
+		}
+		log.FromContext(ctx).V(1).Info("no case of switch matched")
+	}, actions...)
+}
+
+// RollbackStep is a step of SequentialWithRollback.
+type RollbackStep struct {
+	// Do performs the step.
+	Do ActionE
+	// Undo reverts the step once it has completed, if a later step fails. If
+	// nil, the step is not reverted.
+	Undo ActionE
+}
+
+// SequentialWithRollback returns an action that runs the steps in sequence as
+// SequentialWithRollbackE does, and makes its error the error of the chain
+// running the rule.
+func SequentialWithRollback(steps ...RollbackStep) Action {
+	return func(ctx context.Context) {
+		if err := SequentialWithRollbackE(steps...)(ctx); err != nil {
+			if c := chainFrom(ctx); c != nil {
+				c.fail(ctx, err)
+			}
+		}
+	}
+}
+
+// SequentialWithRollbackE returns an action that runs the steps in sequence,
+// as Sequential does, until one fails. It then runs the Undo of the steps that
+// completed, in reverse order, even if ctx is done, and returns the error of
+// the failed step joined with those of the Undo actions, which are also
+// logged.
+func SequentialWithRollbackE(steps ...RollbackStep) ActionE {
+	return func(ctx context.Context) error {
+		skip := &atomic.Bool{}
+		ctx = context.WithValue(ctx, skipKey{}, skip)
+		for i, step := range steps {
+			if err := step.Do(ctx); err != nil {
+				return rollback(ctx, steps[:i], err)
+			}
+			if skip.Load() {
+				return nil
+			}
+		}
+		return nil
+	}
+}
+
+// rollback runs the Undo of the completed steps in reverse order and returns
+// err joined with their errors.
+func rollback(ctx context.Context, completed []RollbackStep, err error) error {
+	ctx = context.WithoutCancel(ctx)
+	errs := []error{err}
+	for i := len(completed) - 1; i >= 0; i-- {
+		if completed[i].Undo == nil {
+			continue
+		}
+		if undoErr := completed[i].Undo(ctx); undoErr != nil {
+			undoErr = fmt.Errorf("undo step %d: %w", i+1, undoErr)
+			log.FromContext(ctx).Error(undoErr, "rollback failed")
+			errs = append(errs, undoErr)
+		}
+	}
+	if len(errs) == 1 {
+		return err
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,186 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_Timeout_Names_The_Slow_Step tests that a step which outlives its
+// Timeout fails the Run with an error naming it, while the enclosing
+// Sequential carries on.
+func Test_If_Timeout_Names_The_Slow_Step(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+	}
+	fast := false
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: Sequential(
+			Timeout(10*time.Millisecond, NamedAction("slow", func(ctx context.Context) { <-ctx.Done() })),
+			Timeout(time.Minute, func(context.Context) { fast = true }),
+		)},
+	})
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	var timeout *StepTimeoutError
+	if assert.True(t, errors.As(err, &timeout), "slow step did not time out") {
+		assert.Equal(t, "slow", timeout.Step, "error did not name the step")
+	}
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "error did not wrap DeadlineExceeded")
+	assert.True(t, fast, "step after the timeout did not run")
+}
+
+// Test_If_Retry_Bounds_Each_Attempt_With_TimeoutE tests that Retry of TimeoutE
+// retries an attempt that timed out, and that the innermost deadline wins.
+func Test_If_Retry_Bounds_Each_Attempt_With_TimeoutE(t *testing.T) {
+	c := &Chain{}
+	attempts := 0
+	attempt := TimeoutE(10*time.Millisecond, NamedActionE("fetch", func(ctx context.Context) error {
+		if attempts++; attempts == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}))
+	timedOut := func(err error) bool { return errors.Is(err, context.DeadlineExceeded) }
+	err := c.RetryE(3, wait.Backoff{Duration: time.Millisecond}, attempt, RetryIf(timedOut))(context.Background())
+	assert.NoError(t, err, "attempt that timed out was not retried")
+	assert.Equal(t, 2, attempts, "attempts were not retried once")
+
+	// The outer Timeout is shorter, so the inner one does not report.
+	outer := TimeoutE(10*time.Millisecond, TimeoutE(time.Minute, NamedActionE("inner", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})))
+	var timeout *StepTimeoutError
+	if assert.True(t, errors.As(outer(context.Background()), &timeout), "outer deadline did not apply") {
+		assert.Equal(t, 10*time.Millisecond, timeout.Timeout, "inner Timeout reported the outer deadline")
+	}
+}
+
+// Test_If_If_Sees_Invalidations_Of_Earlier_Steps tests that If evaluates its
+// predicate when it runs, so that it takes the new branch after an earlier
+// step in the same Sequential changed what the predicate reads.
+func Test_If_If_Sees_Invalidations_Of_Earlier_Steps(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+	}
+	var branches []string
+	record := func(branch string) Action {
+		return func(context.Context) { branches = append(branches, branch) }
+	}
+	c := &Chain{}
+	marked := Predicate(func() bool { return res.Widget.Labels["example.com/marked"] == "true" })
+	c.InitializeChain(cl, &res, []Rule{
+		{When: Not(marked), Do: Sequential(
+			IfElse(marked, record("marked"), record("unmarked")),
+			c.SetLabel(&res.Widget, "example.com/marked", "true"),
+			IfElse(marked, record("marked"), record("unmarked")),
+			If(Not(marked), record("unreachable")),
+			If(marked, nil),
+		)},
+	})
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, []string{"unmarked", "marked"}, branches, "If did not see the change of an earlier step")
+}
+
+// Test_If_Switch_Runs_The_First_Matching_Case tests that Switch runs only the
+// first matching case, falls back to its default, and does nothing when no case
+// matches.
+func Test_If_Switch_Runs_The_First_Matching_Case(t *testing.T) {
+	backend := ""
+	var ran []string
+	record := func(name string) Action {
+		return func(context.Context) { ran = append(ran, name) }
+	}
+	is := func(name string) *predicate {
+		return Named(name, Predicate(func() bool { return backend == name }))
+	}
+	s3 := is("s3")
+	cases := []Case{
+		{When: s3, Do: record("s3")},
+		{When: Or(s3, is("gcs")), Do: record("s3 or gcs")},
+		{When: is("azure"), Do: record("azure")},
+	}
+	withDefault := Switch(append(cases, Default(record("default")))...)
+	withoutDefault := Switch(cases...)
+	for _, backend = range []string{"s3", "gcs", "other"} {
+		withDefault(context.Background())
+	}
+	withoutDefault(context.Background())
+	assert.Equal(t, []string{"s3", "s3 or gcs", "default"}, ran, "Switch did not run the first matching case")
+}
+
+// rollbackSteps returns four steps recording what they do and undo in log, of
+// which the one at failAt fails, and whose second Undo fails if undoFails.
+func rollbackSteps(log *[]string, failAt int, undoFails bool) []RollbackStep {
+	steps := make([]RollbackStep, 4)
+	for i := range steps {
+		n := strconv.Itoa(i + 1)
+		steps[i] = RollbackStep{
+			Do: func(ctx context.Context) error {
+				*log = append(*log, "do "+n)
+				if n == strconv.Itoa(failAt) {
+					return errors.New("step " + n + " failed")
+				}
+				return nil
+			},
+			Undo: func(ctx context.Context) error {
+				*log = append(*log, "undo "+n)
+				if n == "2" && undoFails {
+					return errors.New("cannot undo")
+				}
+				return nil
+			},
+		}
+	}
+	return steps
+}
+
+// Test_If_SequentialWithRollback_Undoes_Completed_Steps tests that a failure at
+// each position undoes exactly the completed steps, in reverse order, and
+// returns the failure.
+func Test_If_SequentialWithRollback_Undoes_Completed_Steps(t *testing.T) {
+	for failAt, want := range map[int][]string{
+		1: {"do 1"},
+		2: {"do 1", "do 2", "undo 1"},
+		3: {"do 1", "do 2", "do 3", "undo 2", "undo 1"},
+		4: {"do 1", "do 2", "do 3", "do 4", "undo 3", "undo 2", "undo 1"},
+	} {
+		var log []string
+		err := SequentialWithRollbackE(rollbackSteps(&log, failAt, false)...)(context.Background())
+		assert.EqualError(t, err, "step "+strconv.Itoa(failAt)+" failed", "wrong error for a failure at %d", failAt)
+		assert.Equal(t, want, log, "wrong rollback for a failure at %d", failAt)
+	}
+	var log []string
+	assert.NoError(t, SequentialWithRollbackE(rollbackSteps(&log, 0, false)...)(context.Background()), "steps failed")
+	assert.Equal(t, []string{"do 1", "do 2", "do 3", "do 4"}, log, "steps were undone without a failure")
+}
+
+// Test_If_SequentialWithRollback_Keeps_The_Failure_When_Undo_Fails tests that
+// a failing Undo does not stop the rollback, and that its error joins the
+// failure of the chain rather than replacing it.
+func Test_If_SequentialWithRollback_Keeps_The_Failure_When_Undo_Fails(t *testing.T) {
+	var log []string
+	c := &Chain{Client: fake.NewClientBuilder().WithScheme(newTestScheme()).Build(), Resources: &struct{}{}}
+	c.Rules = []Rule{{Do: SequentialWithRollback(rollbackSteps(&log, 3, true)...)}}
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.EqualError(t, err, "step 3 failed\nundo step 2: cannot undo", "failure of the step was not kept")
+	assert.Equal(t, []string{"do 1", "do 2", "do 3", "undo 2", "undo 1"}, log, "rollback stopped at the failing Undo")
+}
@@ -0,0 +1,109 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Reasons of the conditions set by AggregateCondition.
+const (
+	// ReasonAllConditionsMet means that every source condition is healthy.
+	ReasonAllConditionsMet = "AllConditionsMet"
+	// ReasonConditionsNotMet means that a source condition is unhealthy.
+	ReasonConditionsNotMet = "ConditionsNotMet"
+	// ReasonConditionsUnknown means that no source condition is unhealthy,
+	// but some are Unknown or missing.
+	ReasonConditionsUnknown = "ConditionsUnknown"
+)
+
+// aggregateOptions holds the options of AggregateCondition.
+type aggregateOptions struct {
+	abnormalTrue map[string]bool
+}
+
+// AggregateOption configures AggregateCondition.
+type AggregateOption func(o *aggregateOptions)
+
+// AbnormalTrue makes the source conditions of the given types healthy when
+// they are False, for conditions such as Degraded that are True when something
+// is wrong.
+func AbnormalTrue(condTypes ...string) AggregateOption {
+	return func(o *aggregateOptions) {
+		for _, condType := range condTypes {
+			o.abnormalTrue[condType] = true
+		}
+	}
+}
+
+// AggregateCondition returns an action that sets the condition of the given
+// type on the object in the given resource field from the source conditions of
+// the same object, typically in the chain's Finally rules. The condition is
+// True when every source is healthy: True, or False if it is AbnormalTrue. It
+// is False when a source is unhealthy, and Unknown when the others are
+// Unknown or missing. Its reason is ReasonAllConditionsMet,
+// ReasonConditionsNotMet, or ReasonConditionsUnknown, and its message lists the
+// sources that are not healthy, with their messages. The sources are read when
+// the status is written, so those set earlier in the Run count even if the
+// chain batches status writes, as SetCondition does.
+func (c *Chain) AggregateCondition(fieldPtr interface{}, condType string, sources []string, opts ...AggregateOption) Action {
+	checkField(fieldPtr)
+	o := &aggregateOptions{abnormalTrue: map[string]bool{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return writes(c.Try(func(ctx context.Context) error {
+		now := metav1.NewTime(c.now())
+		return c.updateStatusLater(ctx, fieldPtr, func(obj client.Object) error {
+			_, err := updateConditions(obj, func(conditions *[]metav1.Condition) bool {
+				cond := o.aggregate(*conditions, condType, sources)
+				cond.ObservedGeneration = obj.GetGeneration()
+				cond.LastTransitionTime = now
+				return meta.SetStatusCondition(conditions, cond)
+			})
+			return err
+		})
+	}), fieldTarget(fieldPtr, "status/conditions/"+condType))
+}
+
+// aggregate returns the condition of the given type aggregating the sources
+// among conditions.
+func (o *aggregateOptions) aggregate(conditions []metav1.Condition, condType string, sources []string) metav1.Condition {
+	var notMet, unknown []string
+	for _, source := range sources {
+		healthy := metav1.ConditionTrue
+		if o.abnormalTrue[source] {
+			healthy = metav1.ConditionFalse
+		}
+		cond := meta.FindStatusCondition(conditions, source)
+		switch {
+		case cond == nil:
+			unknown = append(unknown, source+" is missing")
+		case cond.Status == healthy:
+		case cond.Status == metav1.ConditionUnknown:
+			unknown = append(unknown, describeCondition(cond))
+		default:
+			notMet = append(notMet, describeCondition(cond))
+		}
+	}
+	switch {
+	case len(notMet) > 0:
+		return metav1.Condition{Type: condType, Status: metav1.ConditionFalse, Reason: ReasonConditionsNotMet, Message: strings.Join(append(notMet, unknown...), "; ")}
+	case len(unknown) > 0:
+		return metav1.Condition{Type: condType, Status: metav1.ConditionUnknown, Reason: ReasonConditionsUnknown, Message: strings.Join(unknown, "; ")}
+	}
+	return metav1.Condition{Type: condType, Status: metav1.ConditionTrue, Reason: ReasonAllConditionsMet}
+}
+
+// describeCondition returns the type and status of the condition, with its
+// message if it has one.
+func describeCondition(cond *metav1.Condition) string {
+	if cond.Message == "" {
+		return fmt.Sprintf("%s is %s", cond.Type, cond.Status)
+	}
+	return fmt.Sprintf("%s is %s: %s", cond.Type, cond.Status, cond.Message)
+}
@@ -0,0 +1,78 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// aggregatedReady runs a batching chain setting the given conditions and
+// aggregating Ready from DeploymentReady, SecretSynced, and Degraded, and
+// returns the stored Ready condition.
+func aggregatedReady(t *testing.T, conditions ...metav1.Condition) metav1.Condition {
+	c, cl, writes := conditionChain(true, func(c *Chain, widget **Widget) []Rule {
+		var rules []Rule
+		for _, cond := range conditions {
+			rules = append(rules, Rule{Do: c.SetCondition(widget, cond)})
+		}
+		return append(rules, Rule{Do: c.AggregateCondition(widget, "Ready", []string{"DeploymentReady", "SecretSynced", "Degraded"}, AbnormalTrue("Degraded"))})
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 1, *writes, "the aggregated condition was not batched with its sources")
+	w := &Widget{}
+	assert.NoError(t, cl.Get(context.Background(), req.NamespacedName, w))
+	ready := meta.FindStatusCondition(w.Status.Conditions, "Ready")
+	if !assert.NotNil(t, ready, "Ready was not set") {
+		return metav1.Condition{}
+	}
+	assert.Equal(t, int64(2), ready.ObservedGeneration, "observed generation was not set")
+	return *ready
+}
+
+// Test_If_AggregateCondition_Is_True_When_All_Sources_Are_Healthy tests that
+// the aggregated condition is True when every source is healthy, including a
+// False abnormal-true source.
+func Test_If_AggregateCondition_Is_True_When_All_Sources_Are_Healthy(t *testing.T) {
+	ready := aggregatedReady(t,
+		metav1.Condition{Type: "DeploymentReady", Status: metav1.ConditionTrue, Reason: "Available"},
+		metav1.Condition{Type: "SecretSynced", Status: metav1.ConditionTrue, Reason: "Synced"},
+		metav1.Condition{Type: "Degraded", Status: metav1.ConditionFalse, Reason: "AsExpected"},
+	)
+	assert.Equal(t, metav1.ConditionTrue, ready.Status, "Ready was not True")
+	assert.Equal(t, ReasonAllConditionsMet, ready.Reason, "reason was wrong")
+	assert.Empty(t, ready.Message, "message was not empty")
+}
+
+// Test_If_AggregateCondition_Is_False_When_A_Source_Is_Unhealthy tests that
+// the aggregated condition is False when a source is False or an
+// abnormal-true source is True, and lists them with their messages.
+func Test_If_AggregateCondition_Is_False_When_A_Source_Is_Unhealthy(t *testing.T) {
+	ready := aggregatedReady(t,
+		metav1.Condition{Type: "DeploymentReady", Status: metav1.ConditionFalse, Reason: "Progressing", Message: "1 of 3 replicas available"},
+		metav1.Condition{Type: "SecretSynced", Status: metav1.ConditionTrue, Reason: "Synced"},
+		metav1.Condition{Type: "Degraded", Status: metav1.ConditionTrue, Reason: "Failing"},
+	)
+	assert.Equal(t, metav1.ConditionFalse, ready.Status, "Ready was not False")
+	assert.Equal(t, ReasonConditionsNotMet, ready.Reason, "reason was wrong")
+	assert.Equal(t, "DeploymentReady is False: 1 of 3 replicas available; Degraded is True", ready.Message, "message did not list the unhealthy sources")
+}
+
+// Test_If_AggregateCondition_Is_Unknown_When_A_Source_Is_Missing tests that
+// the aggregated condition is Unknown when a source is missing and none is
+// unhealthy.
+func Test_If_AggregateCondition_Is_Unknown_When_A_Source_Is_Missing(t *testing.T) {
+	ready := aggregatedReady(t,
+		metav1.Condition{Type: "DeploymentReady", Status: metav1.ConditionTrue, Reason: "Available"},
+		metav1.Condition{Type: "Degraded", Status: metav1.ConditionFalse, Reason: "AsExpected"},
+	)
+	assert.Equal(t, metav1.ConditionUnknown, ready.Status, "Ready was not Unknown")
+	assert.Equal(t, ReasonConditionsUnknown, ready.Reason, "reason was wrong")
+	assert.Equal(t, "SecretSynced is missing", ready.Message, "message did not list the missing source")
+}
@@ -0,0 +1,130 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultFieldOwner is the field manager of server-side apply patches when
+// neither the Chain nor the call sets one.
+const DefaultFieldOwner = "operchain"
+
+// applyOptions holds the options of Apply.
+type applyOptions struct {
+	fieldOwner string
+	force      bool
+}
+
+// ApplyOption configures Apply.
+type ApplyOption func(o *applyOptions)
+
+// ApplyFieldOwner sets the field manager of the patch, overriding the Chain's
+// FieldOwner.
+func ApplyFieldOwner(owner string) ApplyOption {
+	return func(o *applyOptions) {
+		o.fieldOwner = owner
+	}
+}
+
+// ApplyForce sets whether the patch takes ownership of fields managed by
+// others. It is true by default; when false, a conflict with another field
+// manager fails the action with an ApplyConflictError.
+func ApplyForce(force bool) ApplyOption {
+	return func(o *applyOptions) {
+		o.force = force
+	}
+}
+
+// ApplyConflictError is the error of an Apply that conflicted with another
+// field manager.
+type ApplyConflictError struct {
+	// Namespace and Name identify the object.
+	Namespace, Name string
+	// Err is the error returned by the API server.
+	Err error
+}
+
+// Error returns the object and the conflict.
+func (e *ApplyConflictError) Error() string {
+	return fmt.Sprintf("apply %s/%s: %s", e.Namespace, e.Name, e.Err)
+}
+
+// Unwrap returns the error returned by the API server.
+func (e *ApplyConflictError) Unwrap() error {
+	return e.Err
+}
+
+// Apply returns an action that server-side applies obj, which holds the fields
+// the chain manages. The object's kind is set from the scheme if it is not set.
+// If the chain tracks its objects, obj is labeled for PruneTracked.
+// On success, obj holds the object returned by the API server.
+func (c *Chain) Apply(obj client.Object, opts ...ApplyOption) Action {
+	return writes(c.Try(c.ApplyE(obj, opts...)), objectOrFieldTarget(obj, ""))
+}
+
+// ApplyE is like Apply, but returns the error.
+func (c *Chain) ApplyE(obj client.Object, opts ...ApplyOption) ActionE {
+	o := &applyOptions{force: true}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(ctx context.Context) error {
+		if err := c.track(obj); err != nil {
+			return err
+		}
+		rendered := c.renderApplyDiff(ctx, obj)
+		if err := c.sendApply(ctx, obj, o); err != nil {
+			return err
+		}
+		c.recordWrite(obj, OperationResultApplied, "", rendered)
+		return nil
+	}
+}
+
+// renderApplyDiff returns the diff from the live object to the applied obj, or
+// nil if the chain does not render diffs.
+func (c *Chain) renderApplyDiff(ctx context.Context, obj client.Object) *ObjectDiff {
+	if !c.rendersDiffs(ctx) {
+		return nil
+	}
+	live := obj.DeepCopyObject().(client.Object)
+	if err := c.reader().Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+		live = nil
+	}
+	return c.renderDiff(ctx, live, obj)
+}
+
+// sendApply sends obj as an apply patch.
+func (c *Chain) sendApply(ctx context.Context, obj client.Object, o *applyOptions) error {
+	gvk, err := c.gvkFor(obj)
+	if err != nil {
+		return fmt.Errorf("apply %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	obj.SetManagedFields(nil)
+	patchOpts := []client.PatchOption{client.FieldOwner(c.fieldOwner(o))}
+	if o.force {
+		patchOpts = append(patchOpts, client.ForceOwnership)
+	}
+	if err := c.Patch(ctx, obj, client.Apply, patchOpts...); err != nil {
+		if apierrors.IsConflict(err) {
+			return &ApplyConflictError{Namespace: obj.GetNamespace(), Name: obj.GetName(), Err: err}
+		}
+		return fmt.Errorf("apply %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	return nil
+}
+
+// fieldOwner returns the field manager for an apply patch.
+func (c *Chain) fieldOwner(o *applyOptions) string {
+	switch {
+	case o.fieldOwner != "":
+		return o.fieldOwner
+	case c.FieldOwner != "":
+		return c.FieldOwner
+	}
+	return DefaultFieldOwner
+}
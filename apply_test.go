@@ -0,0 +1,80 @@
+package operchain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// recordedPatch is a patch recorded by patchRecorder.
+type recordedPatch struct {
+	Type    types.PatchType
+	Data    string
+	Payload map[string]interface{}
+	Options *client.PatchOptions
+}
+
+// patchRecorder returns a client that records patches instead of applying
+// them, failing them with err if it is not nil.
+func patchRecorder(patches *[]recordedPatch, err error) client.Client {
+	return fake.NewClientBuilder().WithScheme(newTestScheme()).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, _ client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			data, dataErr := patch.Data(obj)
+			if dataErr != nil {
+				return dataErr
+			}
+			recorded := recordedPatch{Type: patch.Type(), Data: string(data), Options: (&client.PatchOptions{}).ApplyOptions(opts)}
+			// JSON patches are arrays, which have no Payload.
+			_ = json.Unmarshal(data, &recorded.Payload)
+			*patches = append(*patches, recorded)
+			return err
+		},
+	}).Build()
+}
+
+// Test_If_Apply_Sends_An_Apply_Patch tests that Apply sends the object as an
+// apply patch with its kind, the field owner, and forced ownership.
+func Test_If_Apply_Sends_An_Apply_Patch(t *testing.T) {
+	var patches []recordedPatch
+	c := &Chain{Client: patchRecorder(&patches, nil), FieldOwner: "widget-controller"}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Data:       map[string]string{"key": "value"},
+	}
+	assert.NoError(t, c.ApplyE(cm)(context.Background()))
+	assert.NoError(t, c.ApplyE(cm, ApplyFieldOwner("override"), ApplyForce(false))(context.Background()))
+	if assert.Len(t, patches, 2) {
+		assert.Equal(t, types.ApplyPatchType, patches[0].Type, "patch type was not apply")
+		assert.Equal(t, "widget-controller", patches[0].Options.FieldManager, "chain field owner was not used")
+		assert.True(t, *patches[0].Options.Force, "ownership was not forced")
+		assert.Equal(t, "v1", patches[0].Payload["apiVersion"], "kind was not set")
+		assert.Equal(t, "ConfigMap", patches[0].Payload["kind"], "kind was not set")
+		assert.Equal(t, map[string]interface{}{"key": "value"}, patches[0].Payload["data"], "payload was wrong")
+		assert.Equal(t, "override", patches[1].Options.FieldManager, "field owner was not overridden")
+		assert.Nil(t, patches[1].Options.Force, "ownership was forced")
+	}
+}
+
+// Test_If_Apply_Conflicts_Are_Typed tests that a conflicting apply fails with
+// an ApplyConflictError.
+func Test_If_Apply_Conflicts_Are_Typed(t *testing.T) {
+	var patches []recordedPatch
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "demo", assert.AnError)
+	c := &Chain{Client: patchRecorder(&patches, conflict)}
+	err := c.ApplyE(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}, ApplyForce(false))(context.Background())
+	var conflictErr *ApplyConflictError
+	assert.True(t, errors.As(err, &conflictErr), "conflict was not an ApplyConflictError")
+	assert.True(t, apierrors.IsConflict(err), "conflict was not wrapped")
+	assert.Equal(t, DefaultFieldOwner, patches[0].Options.FieldManager, "default field owner was not used")
+}
@@ -0,0 +1,241 @@
+package operchain
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxAuditDiff is the size beyond which the patch recorded in an AuditEntry is
+// truncated.
+const maxAuditDiff = 1024
+
+// AuditEntry records a write issued through the chain's Client during a Run,
+// whether by the chain's actions or by user actions calling the Client.
+type AuditEntry struct {
+	// Time is when the write was issued, by the chain's Clock.
+	Time time.Time `json:"time"`
+	// RunID is the ID of the Run.
+	RunID string `json:"runID"`
+	// Rule is the rule that issued the write.
+	Rule string `json:"rule"`
+	// Verb is the verb of the write: create, update, patch, delete, or
+	// deletecollection.
+	Verb string `json:"verb"`
+	// Subresource is the subresource written, e.g. status, if any.
+	Subresource string `json:"subresource,omitempty"`
+	// GroupVersionKind is the kind of the object, if known.
+	GroupVersionKind schema.GroupVersionKind `json:"groupVersionKind"`
+	// Namespace is the namespace of the object.
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the name of the object, empty for deletecollection.
+	Name string `json:"name,omitempty"`
+	// FieldOwner is the field manager of the write, if given.
+	FieldOwner string `json:"fieldOwner,omitempty"`
+	// Diff is the body of a patch, truncated to 1KiB, if known.
+	Diff string `json:"diff,omitempty"`
+	// Error is the message of the error of the write, if it failed.
+	Error string `json:"error,omitempty"`
+}
+
+// auditClient is the Client of a chain during a Run, recording its writes.
+type auditClient struct {
+	client.Client
+	chain *Chain
+}
+
+// record records a write of obj in the audit trail of the Run.
+func (a *auditClient) record(verb, subresource string, obj client.Object, fieldOwner, diff string, err error) {
+	c := a.chain
+	entry := c.auditEntry(verb, subresource, obj, fieldOwner, diff, err)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.audit = append(c.audit, entry)
+}
+
+// auditEntry returns the AuditEntry of a write of obj by the current rule.
+func (c *Chain) auditEntry(verb, subresource string, obj client.Object, fieldOwner, diff string, err error) AuditEntry {
+	entry := AuditEntry{
+		Time:        c.now(),
+		RunID:       c.runLog.id,
+		Rule:        c.currentRule(),
+		Verb:        verb,
+		Subresource: subresource,
+		Namespace:   obj.GetNamespace(),
+		Name:        obj.GetName(),
+		FieldOwner:  fieldOwner,
+	}
+	if gvk, gvkErr := c.gvkFor(obj); gvkErr == nil {
+		entry.GroupVersionKind = gvk
+	}
+	if len(diff) > maxAuditDiff {
+		diff = diff[:maxAuditDiff] + "..."
+	}
+	entry.Diff = diff
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// patchDiff returns the body of patch for obj, before it is sent. The values
+// of the data and stringData of a Secret are redacted, as by DiffObjects; a
+// patch of a Secret that cannot be redacted is not returned at all.
+func patchDiff(patch client.Patch, obj client.Object) string {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return ""
+	}
+	if isSecret(obj) {
+		return redactSecretPatch(data)
+	}
+	return string(data)
+}
+
+// redactSecretPatch returns the JSON patch or merge patch of a Secret with
+// the values of its data and stringData redacted, or "" if it is neither.
+func redactSecretPatch(data []byte) string {
+	var body interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return ""
+	}
+	switch b := body.(type) {
+	case map[string]interface{}:
+		for _, field := range []string{"data", "stringData"} {
+			redactValues(b[field])
+		}
+	case []interface{}:
+		for _, op := range b {
+			op, ok := op.(map[string]interface{})
+			if !ok {
+				return ""
+			}
+			path, _ := op["path"].(string)
+			for _, field := range []string{"/data", "/stringData"} {
+				switch {
+				case path == field:
+					redactValues(op["value"])
+				case strings.HasPrefix(path, field+"/") && op["value"] != nil:
+					op["value"] = redactedValue
+				}
+			}
+		}
+	default:
+		return ""
+	}
+	redacted, err := json.Marshal(body)
+	if err != nil {
+		return ""
+	}
+	return string(redacted)
+}
+
+// redactValues replaces the non-null values of the map content, if it is one.
+func redactValues(content interface{}) {
+	m, _ := content.(map[string]interface{})
+	for k, v := range m {
+		if v != nil {
+			m[k] = redactedValue
+		}
+	}
+}
+
+// Create creates obj and records it.
+func (a *auditClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	err := a.Client.Create(ctx, obj, opts...)
+	a.record("create", "", obj, (&client.CreateOptions{}).ApplyOptions(opts).FieldManager, "", err)
+	return err
+}
+
+// Update updates obj and records it.
+func (a *auditClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	err := a.Client.Update(ctx, obj, opts...)
+	a.record("update", "", obj, (&client.UpdateOptions{}).ApplyOptions(opts).FieldManager, "", err)
+	return err
+}
+
+// Patch patches obj and records it.
+func (a *auditClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	diff := patchDiff(patch, obj)
+	err := a.Client.Patch(ctx, obj, patch, opts...)
+	a.record("patch", "", obj, (&client.PatchOptions{}).ApplyOptions(opts).FieldManager, diff, err)
+	return err
+}
+
+// Delete deletes obj and records it.
+func (a *auditClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	err := a.Client.Delete(ctx, obj, opts...)
+	a.record("delete", "", obj, "", "", err)
+	return err
+}
+
+// DeleteAllOf deletes the objects of the type of obj and records it.
+func (a *auditClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	err := a.Client.DeleteAllOf(ctx, obj, opts...)
+	a.record("deletecollection", "", obj, "", "", err)
+	return err
+}
+
+// Status returns a writer of the status subresource recording its writes.
+func (a *auditClient) Status() client.SubResourceWriter {
+	return a.SubResource("status")
+}
+
+// SubResource returns a client of the subresource recording its writes.
+func (a *auditClient) SubResource(subresource string) client.SubResourceClient {
+	return &auditSubResourceClient{SubResourceClient: a.Client.SubResource(subresource), audit: a, subresource: subresource}
+}
+
+// auditSubResourceClient is a subresource client of an auditClient.
+type auditSubResourceClient struct {
+	client.SubResourceClient
+	audit       *auditClient
+	subresource string
+}
+
+// Create creates the subresource of obj and records it.
+func (s *auditSubResourceClient) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	err := s.SubResourceClient.Create(ctx, obj, subResource, opts...)
+	s.audit.record("create", s.subresource, obj, (&client.SubResourceCreateOptions{}).ApplyOptions(opts).FieldManager, "", err)
+	return err
+}
+
+// Update updates the subresource of obj and records it.
+func (s *auditSubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	err := s.SubResourceClient.Update(ctx, obj, opts...)
+	s.audit.record("update", s.subresource, obj, (&client.SubResourceUpdateOptions{}).ApplyOptions(opts).FieldManager, "", err)
+	return err
+}
+
+// Patch patches the subresource of obj and records it.
+func (s *auditSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	diff := patchDiff(patch, obj)
+	err := s.SubResourceClient.Patch(ctx, obj, patch, opts...)
+	s.audit.record("patch", s.subresource, obj, (&client.SubResourcePatchOptions{}).ApplyOptions(opts).FieldManager, diff, err)
+	return err
+}
+
+// startAudit makes the chain's Client record the writes of the Run, and
+// returns a function restoring it.
+func (c *Chain) startAudit() func() {
+	c.audit = nil
+	if c.Client == nil {
+		return func() {}
+	}
+	base := c.Client
+	c.Client = &auditClient{Client: base, chain: c}
+	return func() {
+		c.Client = base
+	}
+}
+
+// finishAudit sends the audit trail of the Run to the chain's AuditSink.
+func (c *Chain) finishAudit(ctx context.Context, entries []AuditEntry) {
+	if c.AuditSink != nil && len(entries) > 0 {
+		c.AuditSink(ctx, entries)
+	}
+}
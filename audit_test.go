@@ -0,0 +1,89 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_Writes_Are_Audited tests that the writes issued through the chain's
+// Client, by the chain's actions and by raw calls of user actions, are
+// recorded in the report and sent to the AuditSink.
+func Test_If_Writes_Are_Audited(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+	}
+	var sent []AuditEntry
+	c := &Chain{AuditSink: func(ctx context.Context, entries []AuditEntry) {
+		sent = append(sent, entries...)
+	}}
+	c.InitializeChain(cl, &res, []Rule{
+		{Name: "create", Do: c.Try(func(ctx context.Context) error {
+			cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"}}
+			return c.Create(ctx, cm, client.FieldOwner("widgets"))
+		})},
+		{Name: "stamp", Do: c.StampHash(&res.Widget, "example.com/hash", "abc")},
+	})
+	report, err := c.RunWithReport(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run failed")
+	assert.Len(t, report.Audit, 2, "writes were not audited")
+	assert.Equal(t, report.Audit, sent, "audit trail was not sent to the sink")
+	created, patched := report.Audit[0], report.Audit[1]
+	assert.Equal(t, "create", created.Verb, "create was not recorded")
+	assert.Equal(t, "ConfigMap", created.GroupVersionKind.Kind, "kind of created object was not recorded")
+	assert.Equal(t, "default", created.Namespace, "namespace of created object was not recorded")
+	assert.Equal(t, "settings", created.Name, "name of created object was not recorded")
+	assert.Equal(t, "widgets", created.FieldOwner, "field owner was not recorded")
+	assert.Equal(t, "create", created.Rule, "rule of create was not recorded")
+	assert.Equal(t, report.RunID, created.RunID, "run ID was not recorded")
+	assert.Equal(t, "patch", patched.Verb, "patch was not recorded")
+	assert.Equal(t, "Widget", patched.GroupVersionKind.Kind, "kind of patched object was not recorded")
+	assert.Equal(t, "demo", patched.Name, "name of patched object was not recorded")
+	assert.Equal(t, "stamp", patched.Rule, "rule of patch was not recorded")
+	assert.Contains(t, patched.Diff, `"example.com/hash":"abc"`, "patch was not recorded")
+	assert.Empty(t, patched.Error, "successful patch recorded an error")
+	assert.Same(t, cl, c.Client, "client was not restored after the Run")
+}
+
+// Test_If_Audited_Secret_Patches_Are_Redacted tests that the values of a
+// Secret do not appear in the audit entry of a patch of the Secret.
+func Test_If_Audited_Secret_Patches_Are_Redacted(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{Name: "merge", Do: c.Try(func(ctx context.Context) error {
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"}}
+			patch := client.RawPatch(types.MergePatchType, []byte(`{"data":{"password":"aHVudGVyMg=="},"stringData":{"token":"hunter2"}}`))
+			return c.Patch(ctx, secret, patch)
+		})},
+		{Name: "json", Do: c.Try(func(ctx context.Context) error {
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"}}
+			patch := client.RawPatch(types.JSONPatchType, []byte(`[{"op":"add","path":"/data/password","value":"aHVudGVyMg=="}]`))
+			return c.Patch(ctx, secret, patch)
+		})},
+	})
+	report, err := c.RunWithReport(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run failed")
+	assert.Len(t, report.Audit, 2, "patches were not audited")
+	for _, entry := range report.Audit {
+		assert.NotContains(t, entry.Diff, "hunter2", "secret value was audited")
+		assert.NotContains(t, entry.Diff, "aHVudGVyMg==", "encoded secret value was audited")
+		assert.Contains(t, entry.Diff, "password", "secret keys were not audited")
+	}
+}
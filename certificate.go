@@ -0,0 +1,44 @@
+package operchain
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CertificateExpiry returns a function, for RequeueBefore, that returns the
+// earliest expiry of the PEM-encoded x509 certificates in the given key of
+// the Secret in the given resource field, e.g. "tls.crt". The expiry is
+// unknown if the Secret is not loaded or the key holds no certificate that can
+// be parsed.
+func (c *Chain) CertificateExpiry(fieldPtr interface{}, key string) func() (time.Time, bool) {
+	checkField(fieldPtr)
+	return func() (time.Time, bool) {
+		secret, ok := objectAt(fieldPtr).(*corev1.Secret)
+		if !ok {
+			return time.Time{}, false
+		}
+		var expiry time.Time
+		rest := secret.Data[key]
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				continue
+			}
+			if expiry.IsZero() || cert.NotAfter.Before(expiry) {
+				expiry = cert.NotAfter
+			}
+		}
+		return expiry, !expiry.IsZero()
+	}
+}
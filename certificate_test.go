@@ -0,0 +1,67 @@
+package operchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+// testCertificate returns a PEM-encoded self-signed certificate expiring at
+// notAfter.
+func testCertificate(t *testing.T, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "demo"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// Test_If_RequeueBefore_Wakes_Up_Before_Certificate_Expiry tests that
+// RequeueBefore requeues the margin before a certificate expires, at once
+// within the margin or after expiry, and not at all without a certificate.
+func Test_If_RequeueBefore_Wakes_Up_Before_Certificate_Expiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var res struct {
+		Secret *corev1.Secret
+	}
+	c := &Chain{Resources: &res, Clock: clocktesting.NewFakeClock(now)}
+	action := c.RequeueBefore(c.CertificateExpiry(&res.Secret, corev1.TLSCertKey), 30*24*time.Hour)
+	for name, tc := range map[string]struct {
+		data map[string][]byte
+		want time.Duration
+	}{
+		"not loaded":      {want: 0},
+		"no certificate":  {data: map[string][]byte{corev1.TLSCertKey: []byte("garbage")}, want: 0},
+		"far away":        {data: map[string][]byte{corev1.TLSCertKey: testCertificate(t, now.Add(90*24*time.Hour))}, want: 60 * 24 * time.Hour},
+		"inside margin":   {data: map[string][]byte{corev1.TLSCertKey: testCertificate(t, now.Add(24*time.Hour))}, want: time.Nanosecond},
+		"already expired": {data: map[string][]byte{corev1.TLSCertKey: testCertificate(t, now.Add(-time.Hour))}, want: time.Nanosecond},
+		"chain": {data: map[string][]byte{corev1.TLSCertKey: append(
+			testCertificate(t, now.Add(90*24*time.Hour)), testCertificate(t, now.Add(40*24*time.Hour))...,
+		)}, want: 10 * 24 * time.Hour},
+	} {
+		res.Secret = nil
+		if tc.data != nil {
+			res.Secret = &corev1.Secret{Data: tc.data}
+		}
+		c.interval = 0
+		action(context.Background())
+		assert.Equal(t, tc.want, c.interval, "wrong requeue for %s", name)
+	}
+}
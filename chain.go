@@ -2,48 +2,342 @@ package operchain
 
 import (
 	"context"
+	"errors"
+	"math"
+	"math/rand"
 	"reflect"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	"github.com/smxlong/operchain/internal/pcache"
+	"github.com/smxlong/operchain/internal/store"
 )
 
 // Chain is a chain of operchain Rules.
 type Chain struct {
 	client.Client
 
+	// Name identifies the chain in logs. It is optional, except for
+	// InitializeFromManager, which also names the chain's event source after
+	// it.
+	Name string
+	// APIReader reads from the API server without going through the cache of
+	// the Client, for reloads that must see the latest version of an object,
+	// e.g. after a conflict. If nil, the Client is used.
+	APIReader client.Reader
 	// Rules is the list of rules in the chain.
 	Rules []Rule
-	// Resources are the resources to load before running the chain.
+	// Finally are rules run after Rules, even if the chain was stopped or
+	// failed, e.g. to record status. They stop when one of them stops the
+	// chain or makes a successful Run fail.
+	Finally []Rule
+	// Resources are the resources to load before running the chain. The
+	// field tagged `operchain:"primary"`, or else the first pointer field, is
+	// the primary resource, normally the object being reconciled. If several
+	// fields are tagged, the chain serves several kinds, and each Run loads
+	// only the primary resource of its kind; see KindResolver.
 	Resources interface{}
+	// Clock is the source of the current time for everything the chain
+	// times: time-based predicates and actions, requeues, cooldowns, backoff,
+	// caches, and metrics. If nil, the real clock is used.
+	Clock clock.Clock
+	// FieldOwner is the field manager of server-side apply patches made by
+	// Apply, unless overridden per call. If empty, DefaultFieldOwner is used.
+	FieldOwner string
+	// Registry holds predicate and action constructors specific to this chain.
+	// It is consulted before the DefaultRegistry.
+	Registry *Registry
+	// MaxStoreEntries is the maximum number of objects for which values are
+	// kept across runs; the least recently run are forgotten first. If zero,
+	// DefaultMaxStoreEntries is used.
+	MaxStoreEntries int
+	// LeaderCheck reports whether this process is the elected leader, for
+	// IsLeader and rules that are LeaderOnly. If nil, the process is always
+	// considered the leader.
+	LeaderCheck func() bool
+	// Log is the logger of the chain's Runs. If it is not set, the logger of
+	// the Run's context is used. Either way, Run enriches it with the
+	// request, the ID of the Run, the chain's name, and the rule being run, and
+	// passes it to actions in their context, for log.FromContext.
+	Log logr.Logger
+	// Recorder records events on the primary resource. If nil, no events are
+	// recorded. InitializeFromManager sets it from the manager.
+	Recorder record.EventRecorder
+	// EventInterval, if not zero, suppresses events recorded by the event
+	// actions that repeat an event with the same type and reason on the same
+	// object, and the same message, within the interval. Such an event is
+	// recorded the first time, then at most once per interval while it
+	// repeats, and immediately when its message changes. EventAlways is never
+	// suppressed.
+	EventInterval time.Duration
+	// BatchStatus defers the status writes of SetCondition and RemoveCondition
+	// to a single update per object at the end of the Run, which happens even
+	// if the Run fails. Otherwise each action writes the status immediately.
+	BatchStatus bool
+	// RecoverPanics recovers panics raised by predicates and actions, making
+	// them errors of the Run. A predicate that panics evaluates to false.
+	RecoverPanics bool
+	// ForceSequentialParallel makes Parallel and ForEachParallel run their
+	// branches one at a time, in order, so that tests and golden traces see
+	// the same order every time. Every branch still runs.
+	ForceSequentialParallel bool
+	// Tracking enables the tracking of the objects written by the chain, for
+	// PruneTracked. If nil, objects are not tracked.
+	Tracking *Tracking
+	// Trace enables recording of a trace of predicate evaluations, which is
+	// available from LastTrace after the chain runs.
+	Trace bool
+	// DefaultRequeue, if not zero, is the requeue interval of a Run in which
+	// nothing requests an earlier one, e.g. for periodic resyncs.
+	DefaultRequeue time.Duration
+	// DefaultRequeueJitter randomly lengthens or shortens DefaultRequeue by
+	// up to this fraction of it, as RequeueJitter does, so that objects
+	// created together do not resync in lockstep.
+	DefaultRequeueJitter float64
+	// Rand is the source of randomness for jitter. If nil, the global source
+	// is used; tests may set a seeded one.
+	Rand *rand.Rand
+	// State keeps the durable state of the primary resource for StateSet and
+	// the state predicates. If nil, an AnnotationState is used.
+	State StateStore
+	// HonorRetryAfter makes a Run that fails with an error asking to be
+	// retried later, as recognized by RequeueFromError, requeue after exactly
+	// that delay and return no error, so that the workqueue's backoff does
+	// not add to it. The error is logged and kept in the report.
+	HonorRetryAfter bool
+	// EventRunID says how the events recorded by the chain carry the ID of
+	// the Run that recorded them. Each Run has a short random ID, which is
+	// also in its logs and report; the ID of a chain run by a rule of another
+	// chain extends the other chain's.
+	EventRunID EventRunID
+	// WrapErrorsWithRunID makes the error of a Run a RunError, carrying its
+	// ID. The errors of chains run by rules of other chains are not wrapped.
+	WrapErrorsWithRunID bool
+	// AuditSink, if not nil, receives the audit trail of each Run that wrote
+	// through the chain's Client, e.g. to ship it to an external system. The
+	// trail is also in the Run's report.
+	AuditSink func(ctx context.Context, entries []AuditEntry)
+	// ReportHistory is the number of reports of recent Runs kept for
+	// RecentReports and DebugHandler. If zero, DefaultReportHistory is used;
+	// if negative, none are kept.
+	ReportHistory int
+	// DryRun, if set, runs the chain in observe-only mode: predicates are
+	// evaluated and actions run, but the writes issued through the chain's
+	// Client, by the chain's actions or user actions, are sent with the
+	// server-side DryRun option or suppressed, as the mode says, and recorded
+	// in the DryRun of the Run's report. Reads and events are not affected.
+	DryRun DryRunMode
+	// DryRunStatus, if set, is the dry-run mode of the writes of the status
+	// subresource, e.g. to suppress them while sending the other writes with
+	// the server-side DryRun option. It applies even if DryRun is not set.
+	DryRunStatus DryRunMode
+	// RenderDiffs renders the diff from the live object to the object
+	// written by Ensure, Apply, and CreateOrUpdate, like kubectl diff, in the
+	// ObjectDiff of the Run's report, and logs it at verbosity level 1. The
+	// diffs are also rendered in dry-run mode, and when the Run's logger is
+	// at verbosity level 1. Rendering costs a read for Apply.
+	RenderDiffs bool
+	// LeaderPolicy says how the chain runs depending on whether this process
+	// is the elected leader, according to LeaderCheck. If empty, the chain
+	// always runs, on the replicas where its controller runs.
+	LeaderPolicy LeaderPolicy
+	// HealthStaleness is how long HealthCheck tolerates failing Runs without
+	// a successful one. If zero, DefaultHealthStaleness is used.
+	HealthStaleness time.Duration
+	// HealthFailureStreak, if positive, makes HealthCheck fail while the Runs
+	// for an object have failed at least this many times in a row, as counted
+	// by FailureStreak.
+	HealthFailureStreak int
+	// KindResolver, if not nil, returns the kind of the primary resource of
+	// a request, for chains serving several kinds, when the context of the
+	// Run does not carry one, as set by WithKind.
+	KindResolver func(ctx context.Context, req ctrl.Request) (string, error)
+	// VersionedRules, if not empty, are rule sets run instead of Rules for
+	// the primary resources of the versions they are keyed by, as returned
+	// by VersionSelector, e.g. during an API migration. A Run for a primary
+	// resource of another version, or for none, runs Rules. JoinRules builds
+	// sets sharing rules.
+	VersionedRules map[string][]Rule
+	// VersionSelector returns the version of the primary resource, selecting
+	// among VersionedRules, e.g. from a spec field or an annotation. If nil,
+	// the apiVersion of the primary resource is used, such as
+	// example.com/v1beta1, and a set may also be keyed by the version alone,
+	// such as v1beta1.
+	VersionSelector func(obj client.Object) string
+	// ErrorConditionPolicy maps the errors of Runs to conditions of the
+	// primary resource. When a Run fails, the condition of the first rule
+	// matching its error is set, and when a Run succeeds, the conditions set
+	// by the policy are removed; either way at the end of the Run, with its
+	// batched status writes if BatchStatus is set.
+	ErrorConditionPolicy []ErrorConditionRule
+	// PredicateOverrides forces the values of the named predicates, without
+	// calling their functions, e.g. to test a chain in a state that is hard
+	// to arrange.
+	PredicateOverrides map[string]bool
 
 	// Reconciler state
-	lock     sync.Mutex
-	req      ctrl.Request
-	cache    *pcache.Cache
-	stop     bool
-	err      error
-	interval time.Duration
+	reconcileLock sync.Mutex // serializes Reconcile; see there
+	lock          sync.Mutex
+	ctx           context.Context
+	req           ctrl.Request
+	cache         *pcache.Cache
+	stop          bool
+	err           error
+	interval      time.Duration
+	report        *RunReport
+	// kind is the kind of the primary resource of the Run, and primaryIndex
+	// the index of its field plus one, zero if the chain has one primary.
+	kind         string
+	primaryIndex int
+	// logName is the name Log was named with by useManagerLogger, so that
+	// Runs do not name it again.
+	logName string
+	// ruleSet is the key of the VersionedRules run by the Run, if any.
+	ruleSet string
+	// requeueReason is the reason of the requeue interval.
+	requeueReason string
+	// operations are the writes performed by the Run.
+	operations []Operation
+	// audit are the writes issued through the Client in the Run.
+	audit []AuditEntry
+	// dryRun are the writes intercepted by dry-run mode in the Run.
+	dryRun []AuditEntry
+	// dryRunMode and dryRunStatusMode are the dry-run modes of the Run.
+	dryRunMode, dryRunStatusMode DryRunMode
+	// history are the reports of recent Runs, oldest first.
+	history []*RunReport
+	// pendingStatus are the batched status mutations, by resource field.
+	pendingStatus []*pendingStatus
+	// breakerLock guards the state of circuit breakers.
+	breakerLock sync.Mutex
+	// breakers are the states of the circuit breakers shared by all objects,
+	// by rule.
+	breakers map[string]*breaker
+	// skipped are the rules skipped by the Run.
+	skipped []SkippedRule
+	// health is the state reported by HealthCheck.
+	health health
+	// streakHooks are the hooks registered by OnFailureStreak.
+	streakHooks []failureStreakHook
+	// fired are the rules whose actions ran in the Run, in order.
+	fired []string
+	// ruleReports are the reports of the rules evaluated by the Run, in
+	// order.
+	ruleReports []RuleReport
+	// subReports are the reports of the chains run by the current rule.
+	subReports []*RunReport
+	// simulating is true during Simulate.
+	simulating bool
+	// deferred are called at the end of the Run, as deferred by atEnd.
+	deferred []func(ctx context.Context) error
+	// onSuccess are called at the end of a Run that returns no error.
+	onSuccess []func()
+	// rule is the name of the rule being run.
+	rule string
+	// subRuns counts the chains run by the rules of the Run.
+	subRuns atomic.Int64
+	// runLog is the logging state of the Run.
+	runLog runLog
+	// produced are the tracked objects written by the Run.
+	produced map[trackedKey]bool
+	// drifted are the resource fields found drifted by Ensure in the Run.
+	drifted map[interface{}]bool
+	// scales are the scale subresources read in the Run, by resource field.
+	scales map[interface{}]*autoscalingv1.Scale
+	// values are the outputs of pipelines in the Run, by slot.
+	values map[string]interface{}
+	// state is the state of the primary resource, once loaded in the Run.
+	state map[string]string
+
+	// Values kept across runs
+	storeOnce sync.Once
+	crossRun  *store.Store
+
+	// Metrics of rules and Runs, set by WithMetrics
+	metrics *chainMetrics
+
+	// Tracer set by WithTracing, and the tracer of the current Run
+	tracer    trace.Tracer
+	runTracer trace.Tracer
+
+	// Whether actions run under pprof labels, set by WithProfileLabels
+	profileLabels bool
+
+	// Finalizers managed by WithFinalizer, in order
+	finalizers []string
+
+	// Chains run by the rules, in the order their actions were constructed
+	subchains []subchain
+
+	// Predicates resolved by name
+	resolved map[string]*predicate
+
+	// Errors found while constructing rules, for Validate
+	invalid []error
 }
 
 // Action is an action to take in an operchain.
 type Action func(context.Context)
 
+// ActionE is an action that can fail. Try converts it to an Action.
+type ActionE func(context.Context) error
+
 // predicate is a private alias for the pcache predicate type to hide it from
 // the public API.
 type predicate = pcache.Predicate
 
+// Option configures a Chain when it is initialized.
+type Option func(c *Chain)
+
 // Rule is a rule for the operchain.
 type Rule struct {
+	// Name identifies the rule in errors. If empty, the rule is identified by
+	// its index in the chain.
+	Name string
 	// When is the predicate for the rule.
 	When *predicate
 	// Do is the action to take when the predicate is true.
 	Do Action
+	// LeaderOnly skips the rule, without evaluating its predicate, when this
+	// process is not the elected leader.
+	LeaderOnly bool
+	// Kinds, if not empty, skips the rule, without evaluating its predicate,
+	// in Runs for primary resources of other kinds.
+	Kinds []string
+	// EmitTransitionEvents records a Normal event on the primary resource
+	// when the value of the rule's predicate for it changes from one Run to
+	// the next, naming the rule and the predicate. The value is kept across
+	// runs; the first Run for an object records none.
+	EmitTransitionEvents bool
+	// CircuitBreaker, if not nil, skips the rule while its action keeps
+	// making Runs fail.
+	CircuitBreaker *CircuitBreaker
+	// ExclusiveGroup, if not empty, skips the rule, without evaluating its
+	// predicate, once a rule of the same group has fired in the Run, so that
+	// at most one rule of the group fires. AnalyzeConflicts does not report
+	// conflicts between rules of the same group.
+	ExclusiveGroup string
+
+	// spec is the spec the rule was built from, in the ChainSpec source, if
+	// any.
+	spec   *RuleSpec
+	source *ChainSpec
 }
 
 // Predicate returns a predicate for the given function.
@@ -51,6 +345,41 @@ func Predicate(f func() bool) *predicate {
 	return pcache.NewPredicate(f)
 }
 
+// PredicateWithRetry returns a predicate for the given function, which also
+// returns when to check again if the predicate is false. While the predicate is
+// false, Run requeues after at most that interval. The interval is ignored when
+// the predicate is true, or when it is part of a composed predicate that is
+// true regardless of its value.
+func PredicateWithRetry(f func() (bool, time.Duration)) *predicate {
+	return pcache.NewLeaf("", func(e *pcache.Evaluation) bool {
+		ok, retry := f()
+		if !ok {
+			e.SuggestRequeue(retry)
+		}
+		return ok
+	})
+}
+
+// Named sets the name of the given Predicate, as shown in traces, and returns
+// it.
+var Named = pcache.Named
+
+// WithKey sets a key identifying the given Predicate and returns it. Within a
+// Run, predicates are cached by identity, so one constructed anew each time it
+// is needed, e.g. inside an action or per element of a list, is evaluated again
+// each time unless it has a key; the trace flags such anonymous predicates.
+// Predicates with the same key share their value, so the key must be unique to
+// what the predicate computes.
+var WithKey = pcache.WithKey
+
+// WithTags adds tags to the given Predicate and returns it. Tags group
+// predicates for invalidation with Chain.InvalidateTag. A predicate composed
+// with And, Or, or Not carries the tags of its parts.
+var WithTags = pcache.WithTags
+
+// TraceEntry records the evaluation of a single predicate during a Run.
+type TraceEntry = pcache.TraceEntry
+
 // And returns a new Predicate that is the logical AND of the given Predicates.
 var And = pcache.And
 
@@ -68,37 +397,286 @@ var False = pcache.False
 
 // Run runs an operchain.
 func (c *Chain) Run(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	report, err := c.RunWithReport(ctx, req)
+	return report.Result, err
+}
+
+// Reconcile runs the chain as Run does, so that a chain is a
+// reconcile.Reconciler and can be passed straight to a controller builder's
+// Complete. The chain keeps the state of a Run, such as its request, log,
+// tracer and audited Client, in itself, so calls are serialized: a chain
+// reconciles one object at a time, however many workers its controller has.
+// Running calls concurrently is not supported.
+func (c *Chain) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	c.reconcileLock.Lock()
+	defer c.reconcileLock.Unlock()
+	return c.Run(ctx, req)
+}
+
+// RunWithReport runs an operchain and returns a report of the run, which is
+// also available from LastReport until the next run.
+func (c *Chain) RunWithReport(ctx context.Context, req ctrl.Request) (*RunReport, error) {
+	if c.LeaderPolicy == LeaderPolicyLeaderOnly && !c.isLeader() {
+		return &RunReport{Request: req}, nil
+	}
+	ctx, span := c.startRunSpan(ctx, req)
+	report, err := c.run(ctx, req)
+	endSpan(span, report.Err)
+	return report, err
+}
+
+// run runs the chain for RunWithReport.
+func (c *Chain) run(ctx context.Context, req ctrl.Request) (*RunReport, error) {
+	c.req = req
+	c.subRuns.Store(0)
+	defer c.startDryRun()()
+	defer c.startAudit()()
+	_, nested := ctx.Value(runLogKey{}).(runLog)
+	ctx = c.startRunLog(ctx)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("operchain.run_id", c.runLog.id))
+	wrap := c.WrapErrorsWithRunID && !nested
+	c.ctx = ctx
 	c.stop = false
 	c.err = nil
 	c.interval = 0
-	c.cache = pcache.New()
-	if err := c.loadResources(ctx, req.NamespacedName); err != nil {
-		return ctrl.Result{}, err
-	}
-	for _, rule := range c.Rules {
-		if rule.When == nil || rule.When.Eval(c.cache) {
-			rule.Do(ctx)
-			if c.stop || c.err != nil {
-				return ctrl.Result{Requeue: true, RequeueAfter: c.interval}, c.err
+	c.requeueReason = ""
+	c.onSuccess = nil
+	c.pendingStatus = nil
+	c.operations = nil
+	c.skipped = nil
+	c.fired = nil
+	c.ruleReports = nil
+	c.deferred = nil
+	c.produced = nil
+	c.drifted = nil
+	c.scales = nil
+	c.values = nil
+	c.state = nil
+	cache := pcache.New()
+	if c.Trace {
+		cache.EnableTrace()
+	}
+	if c.RecoverPanics {
+		cache.RecoverPanics(c.predicatePanicked)
+	}
+	for name, value := range c.PredicateOverrides {
+		cache.Override(name, value)
+	}
+	c.lock.Lock()
+	c.cache = cache
+	c.lock.Unlock()
+	if err := c.resolveKind(ctx, req); err != nil {
+		err = c.runError(err, wrap)
+		return c.finishReport(ctrl.Result{}, err), err
+	}
+	loadCtx, loadSpan := c.startSpan(ctx, "loadResources")
+	err := c.loadResources(loadCtx, req.NamespacedName)
+	endSpan(loadSpan, err)
+	if err != nil {
+		err = c.runError(err, wrap)
+		return c.finishReport(ctrl.Result{}, err), err
+	}
+	if !c.simulating {
+		c.forgetDeletedPrimary()
+	}
+	c.runRules(ctx, c.selectRules(ctx), "rule")
+	c.runRules(ctx, c.Finally, "finally rule")
+	// Predicates which evaluated false may suggest when to check them again.
+	c.doRequeueFor(RequeueReasonPredicate, c.cache.SuggestedRequeue())
+	c.doRequeueFor(RequeueReasonDefault, c.jitter(c.DefaultRequeue, c.DefaultRequeueJitter))
+	c.applyErrorConditions(ctx)
+	if err := c.flushStatus(ctx); err != nil && c.err == nil {
+		c.doError(err)
+	}
+	c.runDeferred(ctx)
+	if c.err == nil && !c.simulating {
+		for _, f := range c.onSuccess {
+			f()
+		}
+	}
+	err = c.runError(c.err, wrap)
+	if err != nil && c.HonorRetryAfter {
+		if delay, ok := RequeueFromError(err); ok {
+			log.FromContext(ctx).Info("requeueing as asked by error", "after", delay, "error", err.Error())
+			return c.finishReport(ctrl.Result{RequeueAfter: delay}, err), nil
+		}
+	}
+	return c.finishReport(ctrl.Result{Requeue: true, RequeueAfter: c.interval}, err), err
+}
+
+// runError returns the error of the Run, wrapped in a RunError if wrap is
+// true.
+func (c *Chain) runError(err error, wrap bool) error {
+	if err == nil || !wrap {
+		return err
+	}
+	return &RunError{RunID: c.runLog.id, Err: err}
+}
+
+// runRules runs the rules in order until one stops the chain or fails. Rules
+// without names are identified by the prefix and their index.
+func (c *Chain) runRules(ctx context.Context, rules []Rule, prefix string) {
+	stopped, failed := c.stopped(), c.failed()
+	firedGroups := map[string]bool{}
+	for i, rule := range rules {
+		if rule.LeaderOnly && !c.isLeader() || !c.appliesToKind(rule) || firedGroups[rule.ExclusiveGroup] {
+			continue
+		}
+		c.setRule(rule.Name, prefix, i)
+		c.startRuleReport()
+		c.ruleEvaluated()
+		ruleCtx, span := c.startSpan(ctx, c.currentRule(), attribute.String("operchain.rule", c.currentRule()))
+		when := rule.When == nil || rule.When.Eval(c.cache)
+		if c.simulating {
+			span.SetAttributes(attribute.Bool("operchain.rule.would_fire", when))
+			endSpan(span, nil)
+			c.recordRuleReport(rule, when, false, nil)
+			if when && rule.ExclusiveGroup != "" {
+				firedGroups[rule.ExclusiveGroup] = true
 			}
+			continue
+		}
+		if rule.EmitTransitionEvents {
+			c.recordTransition(rule, when)
+		}
+		fired := when && c.failed() == failed
+		if fired {
+			var done func(failed bool)
+			if fired, done = c.breakerAllows(c.ruleContext(ruleCtx), rule.CircuitBreaker); !fired {
+				span.SetAttributes(attribute.Bool("operchain.rule.skipped", true))
+			} else {
+				start := c.now()
+				c.do(c.ruleContext(ruleCtx), rule.Do)
+				c.ruleFired(c.since(start))
+				c.recordFired()
+				done(c.failed() != failed)
+			}
+		}
+		span.SetAttributes(attribute.Bool("operchain.rule.fired", fired))
+		if fired && rule.ExclusiveGroup != "" {
+			firedGroups[rule.ExclusiveGroup] = true
 		}
+		var err error
+		if c.failed() != failed {
+			c.ruleFailed()
+			err = c.err
+		}
+		endSpan(span, err)
+		c.recordRuleReport(rule, when, fired, err)
+		if c.stopped() != stopped || c.failed() != failed {
+			break
+		}
+	}
+}
+
+// stopped returns true if the current Run was stopped.
+func (c *Chain) stopped() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.stop
+}
+
+// failed returns true if the current Run has an error.
+func (c *Chain) failed() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.err != nil
+}
+
+// LastTrace returns the predicate evaluations recorded by the most recent Run,
+// or nil if tracing is disabled.
+func (c *Chain) LastTrace() []TraceEntry {
+	if c.cache == nil || !c.Trace {
+		return nil
 	}
-	return ctrl.Result{Requeue: true, RequeueAfter: c.interval}, nil
+	return c.cache.Trace()
 }
 
+// Reasons of requeues not given one by their action.
+const (
+	// RequeueReasonUnspecified is the reason of the requeues of Requeue and
+	// of the actions of the chain.
+	RequeueReasonUnspecified = "unspecified"
+	// RequeueReasonPredicate is the reason of the requeues suggested by
+	// predicates which evaluated false.
+	RequeueReasonPredicate = "predicate"
+	// RequeueReasonDefault is the reason of the chain's DefaultRequeue.
+	RequeueReasonDefault = "default"
+)
+
 // Requeue returns an action to set the requeue interval, if it is less than the
-// current requeue interval.
+// current requeue interval. Its reason is RequeueReasonUnspecified.
 func (c *Chain) Requeue(interval time.Duration) Action {
+	return c.RequeueReason(RequeueReasonUnspecified, interval)
+}
+
+// RequeueReason returns an action that requeues as Requeue does, for the given
+// reason. The reason of the shortest interval requested in a Run is its
+// report's RequeueReason, and every requested reason is counted by the chain's
+// metrics, so that the rules responsible for requeues can be told apart. The
+// reason should be one of a few constants, as it labels a metric.
+func (c *Chain) RequeueReason(reason string, interval time.Duration) Action {
 	return func(ctx context.Context) {
-		c.doRequeue(interval)
+		c.doRequeueFor(reason, interval)
 	}
 }
 
+// RequeueJitter returns an action that requeues as Requeue does, after base
+// randomly lengthened or shortened by up to jitterFraction of it, so that
+// objects created together do not requeue in lockstep. The fraction is
+// limited to below 1, so the interval is always positive.
+func (c *Chain) RequeueJitter(base time.Duration, jitterFraction float64) Action {
+	return func(ctx context.Context) {
+		c.doRequeue(c.jitter(base, jitterFraction))
+	}
+}
+
+// maxJitter is the largest fraction by which jitter changes an interval.
+const maxJitter = 0.99
+
+// jitter returns base randomly changed by up to fraction of it, or 0 if base
+// is not positive.
+func (c *Chain) jitter(base time.Duration, fraction float64) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	fraction = math.Max(0, math.Min(fraction, maxJitter))
+	if fraction == 0 {
+		return base
+	}
+	c.lock.Lock()
+	var r float64
+	if c.Rand != nil {
+		r = c.Rand.Float64()
+	} else {
+		r = rand.Float64()
+	}
+	c.lock.Unlock()
+	jittered := time.Duration(float64(base) * (1 + fraction*(2*r-1)))
+	if jittered <= 0 {
+		return 1
+	}
+	return jittered
+}
+
+// doRequeue requeues after interval, if it is less than the current requeue
+// interval, for an unspecified reason.
 func (c *Chain) doRequeue(interval time.Duration) {
+	c.doRequeueFor(RequeueReasonUnspecified, interval)
+}
+
+// doRequeueFor requeues after interval, if it is less than the current requeue
+// interval, for the given reason.
+func (c *Chain) doRequeueFor(reason string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	c.requeueRequested(reason)
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	if interval > 0 && (c.interval == 0 || interval < c.interval) {
+	if c.interval == 0 || interval < c.interval {
 		c.interval = interval
+		c.requeueReason = reason
 	}
 }
 
@@ -109,6 +687,16 @@ func (c *Chain) Stop() Action {
 	}
 }
 
+// StopAndForget returns an action to stop the operchain and forget the values
+// kept across runs for the request's object, so that they are evaluated afresh
+// when the object is next reconciled.
+func (c *Chain) StopAndForget() Action {
+	return func(ctx context.Context) {
+		c.doStop()
+		c.Forget(c.req.NamespacedName)
+	}
+}
+
 func (c *Chain) doStop() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -118,7 +706,7 @@ func (c *Chain) doStop() {
 // Error returns an action to set the error for the operchain.
 func (c *Chain) Error(err error) Action {
 	return func(ctx context.Context) {
-		c.doError(err)
+		c.fail(ctx, err)
 	}
 }
 
@@ -128,37 +716,126 @@ func (c *Chain) doError(err error) {
 	c.err = err
 }
 
-// Sequential returns an action that runs the given actions in sequence.
-func Sequential(fns ...Action) Action {
+// fail sets the error of an action with the given context. Within an action
+// run per item by ForEach, the error is collected for the item; otherwise it
+// becomes the error of the operchain.
+func (c *Chain) fail(ctx context.Context, err error) {
+	if sink, ok := ctx.Value(errorSinkKey{}).(*errorSink); ok && sink.chain == c {
+		sink.add(err)
+		return
+	}
+	c.doError(err)
+}
+
+// errorSinkKey is the context key of the errorSink collecting the errors of
+// an action.
+type errorSinkKey struct{}
+
+// errorSink collects the errors of an action of the chain.
+type errorSink struct {
+	chain *Chain
+	lock  sync.Mutex
+	errs  []error
+}
+
+// add collects err.
+func (s *errorSink) add(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.errs = append(s.errs, err)
+}
+
+// err returns the collected errors, joined.
+func (s *errorSink) err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return errors.Join(s.errs...)
+}
+
+// Try returns an action that runs fn and makes its error, if any, the error of
+// the operchain.
+func (c *Chain) Try(fn ActionE) Action {
 	return func(ctx context.Context) {
+		if err := fn(ctx); err != nil {
+			c.fail(ctx, err)
+		}
+	}
+}
+
+// afterSuccess arranges for f to be called at the end of the current Run if it
+// returns no error.
+func (c *Chain) afterSuccess(f func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.onSuccess = append(c.onSuccess, f)
+}
+
+// Sequential returns an action that runs the given actions in sequence. An
+// action such as WaitUntil may skip the rest of the sequence.
+func Sequential(fns ...Action) Action {
+	return writesOf(func(ctx context.Context) {
+		skip := &atomic.Bool{}
+		ctx = context.WithValue(ctx, skipKey{}, skip)
 		for _, fn := range fns {
 			fn(ctx)
+			if skip.Load() {
+				return
+			}
 		}
+	}, fns...)
+}
+
+// skipKey is the context key of the flag that skips the rest of the innermost
+// Sequential.
+type skipKey struct{}
+
+// skipSequence skips the rest of the innermost Sequential running the action
+// with the given context, if any.
+func skipSequence(ctx context.Context) {
+	if skip, ok := ctx.Value(skipKey{}).(*atomic.Bool); ok {
+		skip.Store(true)
 	}
 }
 
-// Parallel returns an action that runs the given actions in parallel.
+// Parallel returns an action that runs the given actions in parallel, or in
+// order if the chain has ForceSequentialParallel set. Under the pprof labels
+// of WithProfileLabels, each action is also labeled with the index of its
+// branch.
 func Parallel(fns ...Action) Action {
-	return func(ctx context.Context) {
+	return writesOf(func(ctx context.Context) {
+		if c := chainFrom(ctx); c != nil && c.ForceSequentialParallel {
+			for i, fn := range fns {
+				refineLabels(ctx, fn, "branch", strconv.Itoa(i))
+			}
+			return
+		}
 		var wg sync.WaitGroup
 		wg.Add(len(fns))
-		for _, fn := range fns {
-			go func(fn Action) {
+		for i, fn := range fns {
+			go func(i int, fn Action) {
 				defer wg.Done()
-				fn(ctx)
-			}(fn)
+				refineLabels(ctx, fn, "branch", strconv.Itoa(i))
+			}(i, fn)
 		}
 		wg.Wait()
-	}
+	}, fns...)
 }
 
 // Subchain returns an action that runs the given chain. Any requeue or error
 // actions in the subchain will be propagated to the parent chain.
 func (c *Chain) Subchain(sub *Chain) Action {
+	c.addSubchain("", sub)
+	return c.runSubchain(sub)
+}
+
+// runSubchain returns an action that runs the given chain as Subchain does,
+// without recording that the chain runs it.
+func (c *Chain) runSubchain(sub *Chain) Action {
 	return func(ctx context.Context) {
 		result, err := sub.Run(ctx, c.req)
+		c.recordSubReport(sub.LastReport())
 		if err != nil {
-			c.doError(err)
+			c.fail(ctx, err)
 		}
 		if result.RequeueAfter > 0 {
 			c.doRequeue(result.RequeueAfter)
@@ -166,11 +843,49 @@ func (c *Chain) Subchain(sub *Chain) Action {
 	}
 }
 
-// Initialize initializes a chain with the given resources and rules.
-func (c *Chain) InitializeChain(client client.Client, resources interface{}, rules []Rule) {
+// Initialize initializes a chain with the given resources and rules, then
+// applies the given options in order.
+func (c *Chain) InitializeChain(client client.Client, resources interface{}, rules []Rule, opts ...Option) {
 	c.Client = client
 	c.Resources = resources
 	c.Rules = rules
+	for _, opt := range opts {
+		opt(c)
+	}
+}
+
+// Validate returns the errors found while constructing the chain's actions,
+// e.g. templates that do not parse, including those of the
+// ErrorConditionPolicy, and names of PredicateOverrides that no predicate has,
+// so that they can be reported at startup rather than when the chain runs.
+func (c *Chain) Validate() error {
+	errs := append(c.invalid[:len(c.invalid):len(c.invalid)], c.validateErrorConditions()...)
+	return errors.Join(append(errs, c.validatePredicateOverrides()...)...)
+}
+
+// InitializeFromManager initializes a chain as InitializeChain does, with the
+// manager's client, which carries its scheme, and wires the chain to the
+// manager: the chain reads afresh through the manager's API reader, logs
+// through the manager's logger named after the chain's Name, records events as
+// the component named after it, and runs rules that are LeaderOnly once the
+// manager is elected leader.
+func (c *Chain) InitializeFromManager(mgr manager.Manager, resources interface{}, rules []Rule, opts ...Option) {
+	if c.Name == "" {
+		panic("InitializeFromManager requires a chain with a Name")
+	}
+	c.APIReader = mgr.GetAPIReader()
+	c.useManagerLogger(mgr)
+	c.Recorder = mgr.GetEventRecorderFor(c.Name)
+	c.LeaderCheck = ElectedLeader(mgr)
+	c.InitializeChain(mgr.GetClient(), resources, rules, opts...)
+}
+
+// reader returns the reader for reads that must not come from a cache.
+func (c *Chain) reader() client.Reader {
+	if c.APIReader != nil {
+		return c.APIReader
+	}
+	return c.Client
 }
 
 // loadResources loads the resources for the chain.
@@ -190,13 +905,17 @@ func (c *Chain) loadResources(ctx context.Context, name types.NamespacedName) er
 			field.Set(reflect.Zero(field.Type()))
 		}
 	}
-	// Load the resources.
+	// Load the resources, but not the primary resources of other kinds.
 	for i := 0; i < res.NumField(); i++ {
 		field := res.Field(i)
-		if !field.CanSet() {
+		if !field.CanSet() || !c.loadsField(i) {
 			continue
 		}
-		if err := c.loadResource(ctx, name, field); err != nil {
+		load := c.loadResource
+		if field.Kind() == reflect.Slice {
+			load = c.loadList
+		}
+		if err := load(ctx, name, field); err != nil {
 			return err
 		}
 	}
@@ -206,15 +925,11 @@ func (c *Chain) loadResources(ctx context.Context, name types.NamespacedName) er
 // loadResource loads the resource for the given field.
 func (c *Chain) loadResource(ctx context.Context, name types.NamespacedName, field reflect.Value) error {
 	// The field should be a pointer to a struct.
-	if field.Kind() != reflect.Ptr {
-		panic("Resource fields must be pointers to structs")
-	}
-	field = field.Elem()
-	if field.Kind() != reflect.Struct {
+	if field.Kind() != reflect.Ptr || field.Type().Elem().Kind() != reflect.Struct {
 		panic("Resource fields must be pointers to structs")
 	}
 	// Load the resource.
-	obj := reflect.New(field.Type()).Interface().(client.Object)
+	obj := reflect.New(field.Type().Elem()).Interface().(client.Object)
 	if err := c.Get(ctx, name, obj); err != nil {
 		if client.IgnoreNotFound(err) != nil {
 			return err
@@ -224,3 +939,42 @@ func (c *Chain) loadResource(ctx context.Context, name types.NamespacedName, fie
 	}
 	return nil
 }
+
+// loadList loads every object of the field's element type in the request's
+// namespace into the given slice field. The elements may be structs or
+// pointers to structs.
+func (c *Chain) loadList(ctx context.Context, name types.NamespacedName, field reflect.Value) error {
+	elem := field.Type().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		panic("Resource slice fields must be slices of structs or pointers to structs")
+	}
+	gvk, err := apiutil.GVKForObject(reflect.New(elem).Interface().(client.Object), c.Scheme())
+	if err != nil {
+		return err
+	}
+	obj, err := c.Scheme().New(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err != nil {
+		return err
+	}
+	list := obj.(client.ObjectList)
+	if err := c.List(ctx, list, client.InNamespace(name.Namespace)); err != nil {
+		return err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	out := reflect.MakeSlice(field.Type(), 0, len(items))
+	for _, item := range items {
+		v := reflect.ValueOf(item)
+		if field.Type().Elem().Kind() != reflect.Ptr {
+			v = v.Elem()
+		}
+		out = reflect.Append(out, v)
+	}
+	field.Set(out)
+	return nil
+}
@@ -0,0 +1,166 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Test_If_Run_Loads_Resources tests that Run loads the request's object into
+// each pointer field, leaving fields nil when the object does not exist.
+func Test_If_Run_Loads_Resources(t *testing.T) {
+	cl := fake.NewClientBuilder().WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+		Secret    *corev1.Secret
+	}
+	res.Secret = &corev1.Secret{}
+	c := &Chain{}
+	c.InitializeChain(cl, &res, nil)
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run returned an error")
+	if assert.NotNil(t, res.ConfigMap, "ConfigMap was not loaded") {
+		assert.Equal(t, "demo", res.ConfigMap.Name, "wrong ConfigMap was loaded")
+	}
+	assert.Nil(t, res.Secret, "missing Secret was not cleared")
+}
+
+// Test_If_RequeueJitter_Stays_Within_Its_Fraction tests that jittered
+// intervals vary, stay within the fraction of the base, and stay positive even
+// for an excessive fraction.
+func Test_If_RequeueJitter_Stays_Within_Its_Fraction(t *testing.T) {
+	c := &Chain{Rand: rand.New(rand.NewSource(1))}
+	base := 10 * time.Minute
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 1000; i++ {
+		c.interval = 0
+		c.RequeueJitter(base, 0.2)(context.Background())
+		assert.GreaterOrEqual(t, c.interval, 8*time.Minute, "interval was shortened too much")
+		assert.LessOrEqual(t, c.interval, 12*time.Minute, "interval was lengthened too much")
+		seen[c.interval] = true
+		c.interval = 0
+		c.RequeueJitter(time.Nanosecond, 5)(context.Background())
+		assert.Equal(t, time.Nanosecond, c.interval, "interval was not positive")
+	}
+	assert.Greater(t, len(seen), 900, "intervals were not jittered")
+}
+
+// Test_If_DefaultRequeue_Is_Jittered tests that a Run requeues after the
+// jittered DefaultRequeue unless a rule requests an earlier requeue.
+func Test_If_DefaultRequeue_Is_Jittered(t *testing.T) {
+	var res struct{}
+	c := &Chain{Resources: &res, DefaultRequeue: time.Hour, DefaultRequeueJitter: 0.1, Rand: rand.New(rand.NewSource(1))}
+	result, err := c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err, "Run failed")
+	assert.InDelta(t, time.Hour, result.RequeueAfter, float64(6*time.Minute), "default requeue was not jittered within its fraction")
+	assert.NotEqual(t, time.Hour, result.RequeueAfter, "default requeue was not jittered")
+	c.Rules = []Rule{{Do: c.Requeue(time.Minute)}}
+	result, err = c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err, "Run failed")
+	assert.Equal(t, time.Minute, result.RequeueAfter, "earlier requeue was not kept")
+}
+
+// Test_If_Chain_Is_A_Reconciler tests that a chain drives reconciles as a
+// reconcile.Reconciler, serializing concurrent ones.
+func Test_If_Chain_Is_A_Reconciler(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+	}
+	var running, overlapped atomic.Int32
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{{When: c.Exists(&res.Widget), Do: func(context.Context) {
+		if running.Add(1) > 1 {
+			overlapped.Add(1)
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+	}}, {Do: c.Requeue(time.Minute)}})
+	var r reconcile.Reconciler = c
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+			assert.NoError(t, err, "reconcile failed")
+			assert.Equal(t, time.Minute, result.RequeueAfter, "reconcile did not return the chain's result")
+		}()
+	}
+	wg.Wait()
+	assert.Zero(t, overlapped.Load(), "concurrent reconciles overlapped")
+}
+
+// Test_If_ForceSequentialParallel_Runs_Branches_In_Order tests that with
+// ForceSequentialParallel, the branches of Parallel and the items of
+// ForEachParallel run one at a time in declaration order, even when earlier
+// ones are the slowest, and that every branch still runs after one fails.
+// Without it, the recorded order follows completion and varies.
+func Test_If_ForceSequentialParallel_Runs_Branches_In_Order(t *testing.T) {
+	var res struct {
+		Namespaces []corev1.Namespace
+	}
+	cl := fake.NewClientBuilder().WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns-0"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns-1"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns-2"}},
+	).Build()
+	delays := map[string]time.Duration{"ns-0": 3 * time.Millisecond, "ns-1": time.Millisecond}
+	var lock sync.Mutex
+	var order []string
+	var running, highWater atomic.Int32
+	record := func(name string, delay time.Duration) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			if h := highWater.Load(); n <= h || highWater.CompareAndSwap(h, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+		lock.Lock()
+		defer lock.Unlock()
+		order = append(order, name)
+	}
+	branch := func(name string, delay time.Duration) Action {
+		return func(context.Context) { record(name, delay) }
+	}
+	c := &Chain{ForceSequentialParallel: true}
+	c.InitializeChain(cl, &res, []Rule{
+		{Name: "fanout", Do: Parallel(branch("slow", 3*time.Millisecond), c.Error(errors.New("boom")), branch("fast", 0))},
+		{Name: "items", Do: c.ForEachParallel(&res.Namespaces, 3, func(item client.Object) Action {
+			return branch(item.GetName(), delays[item.GetName()])
+		})},
+	})
+	for i := 0; i < 10; i++ {
+		order = nil
+		_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo"}})
+		assert.EqualError(t, err, "boom")
+		assert.Equal(t, []string{"slow", "fast"}, order, "branches did not run in declaration order")
+	}
+	c.Rules = c.Rules[1:]
+	for i := 0; i < 10; i++ {
+		order = nil
+		_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"ns-0", "ns-1", "ns-2"}, order, "items did not run in order")
+	}
+	assert.Equal(t, int32(1), highWater.Load(), "branches ran concurrently")
+}
@@ -0,0 +1,207 @@
+// Package chaintest runs operchain chains against a fake client, with a fake
+// clock, and asserts on the outcome of their Runs, so that the tests of an
+// operator read as what its chain should do rather than how to set it up.
+package chaintest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/smxlong/operchain"
+)
+
+// DefaultTime is the time of the fake clock of a Runner, unless given one.
+var DefaultTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Runner runs a chain against a fake client holding the given objects.
+type Runner struct {
+	chain      *operchain.Chain
+	scheme     *runtime.Scheme
+	objects    []client.Object
+	clock      *clocktesting.FakeClock
+	predicates map[string]bool
+	client     client.Client
+	recorder   *Recorder
+}
+
+// NewRunner returns a Runner for the chain, whose rules must already be set.
+// Its scheme has the types of client-go, and its clock is a fake clock at
+// DefaultTime.
+func NewRunner(chain *operchain.Chain) *Runner {
+	return &Runner{
+		chain:      chain,
+		scheme:     clientgoscheme.Scheme,
+		clock:      clocktesting.NewFakeClock(DefaultTime),
+		predicates: map[string]bool{},
+		recorder:   &Recorder{scheme: clientgoscheme.Scheme},
+	}
+}
+
+// WithScheme makes the fake client use the scheme, e.g. for custom
+// resources. The types of client-go are added to it.
+func (r *Runner) WithScheme(scheme *runtime.Scheme) *Runner {
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	r.scheme = scheme
+	r.recorder.scheme = scheme
+	return r
+}
+
+// WithObjects adds objects to the fake client. Their status is a
+// subresource, as on a real API server.
+func (r *Runner) WithObjects(objs ...client.Object) *Runner {
+	r.objects = append(r.objects, objs...)
+	return r
+}
+
+// WithClock makes the chain use the fake clock, e.g. to step it between
+// Runs.
+func (r *Runner) WithClock(clock *clocktesting.FakeClock) *Runner {
+	r.clock = clock
+	return r
+}
+
+// WithPredicate forces the value of the predicates with the given name, e.g.
+// "IsLeader" or "Exists(ConfigMap)", without evaluating them, as
+// OverridePredicates does.
+func (r *Runner) WithPredicate(name string, value bool) *Runner {
+	r.predicates[name] = value
+	return r
+}
+
+// Clock returns the fake clock of the chain.
+func (r *Runner) Clock() *clocktesting.FakeClock {
+	return r.clock
+}
+
+// Recorder returns the Recorder of the calls to the fake client of the chain.
+func (r *Runner) Recorder() *Recorder {
+	return r.recorder
+}
+
+// Client returns the fake client of the chain, building it with the objects
+// given so far on first use. Objects given afterwards are ignored.
+func (r *Runner) Client() client.Client {
+	if r.client == nil {
+		r.client = fake.NewClientBuilder().
+			WithScheme(r.scheme).
+			WithObjects(r.objects...).
+			WithStatusSubresource(r.objects...).
+			WithInterceptorFuncs(r.recorder.funcs()).
+			Build()
+	}
+	return r.client
+}
+
+// Run runs the chain once for the object with the given key and returns its
+// Result. Runs of the same Runner share the fake client and clock, so that a
+// test can run the chain again on what the previous Run wrote.
+func (r *Runner) Run(t testing.TB, key types.NamespacedName) *Result {
+	t.Helper()
+	r.chain.Client = r.Client()
+	r.chain.APIReader = r.chain.Client
+	r.chain.Clock = r.clock
+	OverridePredicates(t, r.chain, r.predicates)
+	report, err := r.chain.RunWithReport(context.Background(), ctrl.Request{NamespacedName: key})
+	report.Err = err
+	return &Result{RunReport: report, t: t, client: r.chain.Client}
+}
+
+// Result is the outcome of a Run. Its assertions report failures to the test
+// that ran it and return the Result, so that they can be chained.
+type Result struct {
+	*operchain.RunReport
+	t      testing.TB
+	client client.Client
+}
+
+// AssertNoError asserts that the Run succeeded.
+func (r *Result) AssertNoError() *Result {
+	r.t.Helper()
+	assert.NoError(r.t, r.Err, "Run returned an error")
+	return r
+}
+
+// AssertErrorContains asserts that the Run failed with an error containing
+// the text.
+func (r *Result) AssertErrorContains(text string) *Result {
+	r.t.Helper()
+	if assert.Error(r.t, r.Err, "Run did not return an error") {
+		assert.Contains(r.t, r.Err.Error(), text, "Run returned the wrong error")
+	}
+	return r
+}
+
+// AssertRuleFired asserts that the actions of the named rules ran. Unnamed
+// rules are named by their phase and index, e.g. "rule 0".
+func (r *Result) AssertRuleFired(names ...string) *Result {
+	r.t.Helper()
+	for _, name := range names {
+		assert.True(r.t, slices.Contains(r.Fired, name), "rule %q did not fire; fired: %s", name, strings.Join(r.Fired, ", "))
+	}
+	return r
+}
+
+// AssertRuleNotFired asserts that the actions of the named rules did not run.
+func (r *Result) AssertRuleNotFired(names ...string) *Result {
+	r.t.Helper()
+	for _, name := range names {
+		assert.False(r.t, slices.Contains(r.Fired, name), "rule %q fired", name)
+	}
+	return r
+}
+
+// AssertRequeueWithin asserts that the Run asked to be requeued after at
+// most d.
+func (r *Result) AssertRequeueWithin(d time.Duration) *Result {
+	r.t.Helper()
+	after := r.Result.RequeueAfter
+	assert.True(r.t, after > 0 && after <= d, "Run requeued after %s, not within %s", after, d)
+	return r
+}
+
+// AssertNoRequeue asserts that the Run did not ask to be requeued after an
+// interval.
+func (r *Result) AssertNoRequeue() *Result {
+	r.t.Helper()
+	assert.Zero(r.t, r.Result.RequeueAfter, "Run requeued after %s (%s)", r.Result.RequeueAfter, r.RequeueReason)
+	return r
+}
+
+// AssertStopped asserts that a rule stopped the Run.
+func (r *Result) AssertStopped() *Result {
+	r.t.Helper()
+	assert.True(r.t, r.Stopped, "Run was not stopped")
+	return r
+}
+
+// AssertObjectExists asserts that the fake client has the object with the
+// key, and reads it into obj for further assertions.
+func (r *Result) AssertObjectExists(key types.NamespacedName, obj client.Object) *Result {
+	r.t.Helper()
+	assert.NoError(r.t, r.client.Get(context.Background(), key, obj), "object %s does not exist", key)
+	return r
+}
+
+// AssertObjectNotExists asserts that the fake client does not have an object
+// of the type of obj with the key.
+func (r *Result) AssertObjectNotExists(key types.NamespacedName, obj client.Object) *Result {
+	r.t.Helper()
+	err := r.client.Get(context.Background(), key, obj)
+	assert.True(r.t, apierrors.IsNotFound(err), "object %s exists, or cannot be read: %v", key, err)
+	return r
+}
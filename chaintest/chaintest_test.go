@@ -0,0 +1,102 @@
+package chaintest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/smxlong/operchain"
+	"github.com/smxlong/operchain/chaintest"
+)
+
+// demoApp returns the app ConfigMap with appKey.
+func demoApp() *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: appKey.Name, Namespace: appKey.Namespace},
+		Data:       map[string]string{"app": "demo"},
+	}
+}
+
+// Test_If_Runner_Runs_The_Chain_On_Its_Objects tests that a Run sees the
+// objects of the Runner, and that its writes are seen by the next Run.
+func Test_If_Runner_Runs_The_Chain_On_Its_Objects(t *testing.T) {
+	runner := chaintest.NewRunner(appChain()).WithObjects(demoApp())
+	var secret corev1.Secret
+	runner.Run(t, appKey).
+		AssertNoError().
+		AssertRuleFired("create secret", "check again").
+		AssertRequeueWithin(time.Minute).
+		AssertObjectExists(appKey, &secret)
+	assert.Equal(t, "demo", secret.StringData["app"], "Secret has the wrong data")
+	runner.Run(t, appKey).
+		AssertNoError().
+		AssertRuleNotFired("create secret").
+		AssertRuleFired("check again")
+}
+
+// Test_If_Runner_Runs_Without_Objects tests that a Run for a missing primary
+// fires no rules, and that AssertObjectNotExists sees it is missing.
+func Test_If_Runner_Runs_Without_Objects(t *testing.T) {
+	chaintest.NewRunner(appChain()).Run(t, appKey).
+		AssertNoError().
+		AssertRuleNotFired("create secret", "check again").
+		AssertNoRequeue().
+		AssertObjectNotExists(appKey, &corev1.Secret{})
+}
+
+// Test_If_WithPredicate_Overrides_Named_Predicates tests that a predicate
+// forced by WithPredicate is not evaluated.
+func Test_If_WithPredicate_Overrides_Named_Predicates(t *testing.T) {
+	runner := chaintest.NewRunner(appChain()).
+		WithObjects(demoApp()).
+		WithPredicate("Exists(Secret)", true)
+	result := runner.Run(t, appKey).AssertNoError().AssertRuleNotFired("create secret")
+	assert.True(t, result.Predicates["Exists(Secret)"], "override is not in the report")
+	result.AssertObjectNotExists(appKey, &corev1.Secret{})
+}
+
+// Test_If_Runner_Uses_The_Fake_Clock tests that the chain's time is the one
+// of the Runner's fake clock, and that stepping it affects the next Run.
+func Test_If_Runner_Uses_The_Fake_Clock(t *testing.T) {
+	var seen []time.Time
+	c := &operchain.Chain{}
+	c.InitializeChain(nil, &struct{}{}, []operchain.Rule{
+		{Name: "look", Do: func(context.Context) { seen = append(seen, c.Clock.Now()) }},
+	})
+	clock := clocktesting.NewFakeClock(chaintest.DefaultTime)
+	runner := chaintest.NewRunner(c).WithClock(clock)
+	runner.Run(t, appKey).AssertNoError()
+	runner.Clock().Step(time.Hour)
+	runner.Run(t, appKey).AssertNoError()
+	assert.Equal(t, []time.Time{chaintest.DefaultTime, chaintest.DefaultTime.Add(time.Hour)}, seen)
+}
+
+// Test_If_Result_Reports_Errors_And_Stops tests the assertions on the error
+// and stop of a Run.
+func Test_If_Result_Reports_Errors_And_Stops(t *testing.T) {
+	c := &operchain.Chain{}
+	c.InitializeChain(nil, &struct{}{}, []operchain.Rule{
+		{Name: "fail", Do: c.Error(errors.New("boom"))},
+	})
+	chaintest.NewRunner(c).Run(t, appKey).AssertErrorContains("boom").AssertRuleFired("fail")
+	c = &operchain.Chain{}
+	c.InitializeChain(nil, &struct{}{}, []operchain.Rule{
+		{Name: "stop", Do: c.Stop()},
+		{Name: "after"},
+	})
+	chaintest.NewRunner(c).Run(t, appKey).AssertNoError().AssertStopped().AssertRuleNotFired("after")
+}
+
+// Test_If_WithScheme_Keeps_The_Client_Go_Types tests that a custom scheme
+// still has the types of client-go.
+func Test_If_WithScheme_Keeps_The_Client_Go_Types(t *testing.T) {
+	runner := chaintest.NewRunner(appChain()).WithScheme(runtime.NewScheme()).WithObjects(demoApp())
+	runner.Run(t, appKey).AssertNoError().AssertObjectExists(appKey, &corev1.Secret{})
+}
@@ -0,0 +1,28 @@
+package chaintest
+
+import (
+	"testing"
+	"time"
+
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/smxlong/operchain"
+)
+
+// WithFakeClock installs a fake clock at the given time, or at DefaultTime if
+// zero, as the chain's Clock until the end of the test, and returns it, so
+// that the test can step it between Runs to drive requeues, cooldowns,
+// backoff and caches.
+func WithFakeClock(t testing.TB, chain *operchain.Chain, at time.Time) *clocktesting.FakeClock {
+	t.Helper()
+	if at.IsZero() {
+		at = DefaultTime
+	}
+	clock := clocktesting.NewFakeClock(at)
+	previous := chain.Clock
+	chain.Clock = clock
+	t.Cleanup(func() {
+		chain.Clock = previous
+	})
+	return clock
+}
@@ -0,0 +1,36 @@
+package chaintest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/smxlong/operchain"
+	"github.com/smxlong/operchain/chaintest"
+)
+
+// Test_If_WithFakeClock_Drives_Cooldowns tests that a cooldown of a chain
+// with a fake clock ends only when the clock is stepped past its period, and
+// that the clock is removed at the end of the test.
+func Test_If_WithFakeClock_Drives_Cooldowns(t *testing.T) {
+	runs := 0
+	c := &operchain.Chain{}
+	c.InitializeChain(nil, &struct{}{}, []operchain.Rule{
+		{Name: "cool", Do: c.Cooldown("cool", time.Hour, func(context.Context) { runs++ })},
+	})
+	t.Run("fake clock", func(t *testing.T) {
+		clock := chaintest.WithFakeClock(t, c, time.Time{})
+		assert.Equal(t, chaintest.DefaultTime, clock.Now(), "clock is not at DefaultTime")
+		req := ctrl.Request{NamespacedName: appKey}
+		for _, step := range []time.Duration{0, 59 * time.Minute, time.Minute} {
+			clock.Step(step)
+			_, err := c.Run(context.Background(), req)
+			assert.NoError(t, err)
+		}
+	})
+	assert.Equal(t, 2, runs, "cooldown did not follow the fake clock")
+	assert.Nil(t, c.Clock, "fake clock outlived the test")
+}
@@ -0,0 +1,64 @@
+package chaintest_test
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain"
+	"github.com/smxlong/operchain/chaintest"
+)
+
+// appResources are the resources of appChain.
+type appResources struct {
+	App    *corev1.ConfigMap `operchain:"primary"`
+	Secret *corev1.Secret
+}
+
+// appChain returns a chain creating a Secret for each app ConfigMap, and
+// checking on it again in a minute.
+func appChain() *operchain.Chain {
+	var res appResources
+	c := &operchain.Chain{}
+	c.InitializeChain(nil, &res, []operchain.Rule{
+		{
+			Name: "create secret",
+			When: operchain.And(c.Exists(&res.App), operchain.Not(c.Exists(&res.Secret))),
+			Do: c.Ensure(&res.Secret, func() (client.Object, error) {
+				return &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: res.App.Name, Namespace: res.App.Namespace},
+					StringData: map[string]string{"app": res.App.Data["app"]},
+				}, nil
+			}),
+		},
+		{
+			Name: "check again",
+			When: c.Exists(&res.App),
+			Do:   c.Requeue(time.Minute),
+		},
+	})
+	return c
+}
+
+// appKey is the key of the app ConfigMap of the example.
+var appKey = types.NamespacedName{Namespace: "default", Name: "demo"}
+
+// Example tests that the chain creates the Secret of an app and checks on it
+// again within a minute. In a test function, t is its *testing.T.
+func Example() {
+	var t *testing.T
+	chaintest.NewRunner(appChain()).
+		WithObjects(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+			Data:       map[string]string{"app": "demo"},
+		}).
+		Run(t, appKey).
+		AssertNoError().
+		AssertRuleFired("create secret", "check again").
+		AssertRequeueWithin(time.Minute).
+		AssertObjectExists(appKey, &corev1.Secret{})
+}
@@ -0,0 +1,269 @@
+package chaintest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/smxlong/operchain"
+)
+
+// GoldenFile is the name of the golden file of the execution trace in the
+// fixtures directory of Golden.
+const GoldenFile = "golden.yaml"
+
+// update makes Golden write the golden files instead of comparing with them.
+// Packages whose tests use Golden must not define a flag of the same name.
+var update = flag.Bool("update", false, "write the golden files of chaintest.Golden instead of comparing with them")
+
+// redactedValue replaces the values of the data of Secrets in golden files.
+const redactedValue = "***"
+
+// GoldenTrace is the execution trace of a Run, as written to golden files.
+type GoldenTrace struct {
+	// Request is the namespace and name of the object the chain ran for.
+	Request string `json:"request"`
+	// Rules are the lines of the ExecutionTrace of the Run.
+	Rules []string `json:"rules,omitempty"`
+	// Mutations are the writes the Run issued, in order.
+	Mutations []GoldenMutation `json:"mutations,omitempty"`
+	// Result is the outcome of the Run.
+	Result GoldenResult `json:"result"`
+}
+
+// GoldenMutation is a write issued by a Run.
+type GoldenMutation struct {
+	// Verb is the kind of the write, e.g. "create" or "update status".
+	Verb string `json:"verb"`
+	// Kind is the kind of the object written.
+	Kind string `json:"kind"`
+	// Namespace is the namespace of the object, if any.
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the name of the object.
+	Name string `json:"name"`
+	// Object is the object as written, without the fields set by the API
+	// server, and with the data of Secrets redacted. Deletions have none.
+	Object map[string]interface{} `json:"object,omitempty"`
+}
+
+// GoldenResult is the outcome of a Run, as written to golden files.
+type GoldenResult struct {
+	// RequeueAfter is the requeue interval of the Run, if any.
+	RequeueAfter string `json:"requeueAfter,omitempty"`
+	// RequeueReason is the reason of the requeue interval, if any.
+	RequeueReason string `json:"requeueReason,omitempty"`
+	// Stopped is true if a rule stopped the Run.
+	Stopped bool `json:"stopped,omitempty"`
+	// Error is the message of the error of the Run, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// goldenOptions holds the options of Golden.
+type goldenOptions struct {
+	scheme *runtime.Scheme
+}
+
+// GoldenOption configures Golden.
+type GoldenOption func(o *goldenOptions)
+
+// GoldenScheme decodes the fixtures and runs the chain with the scheme, e.g.
+// for custom resources. The types of client-go are added to it.
+func GoldenScheme(scheme *runtime.Scheme) GoldenOption {
+	return func(o *goldenOptions) {
+		o.scheme = scheme
+	}
+}
+
+// Golden runs the chain once against the objects of the YAML files of the
+// fixtures directory, and compares the GoldenTrace of the Run with the
+// GoldenFile in it, failing the test with a diff if they differ. The files
+// are read in order of their names, and the first object is the one the
+// chain runs for. With the -update flag, Golden writes the GoldenFile
+// instead. The trace depends only on what the chain does: the chain runs
+// with a fake clock at DefaultTime and with ForceSequentialParallel, the ID of
+// the Run and the fields set by the API server are left out, and the data of
+// Secrets is redacted.
+func Golden(t testing.TB, chain *operchain.Chain, fixturesDir string, opts ...GoldenOption) {
+	t.Helper()
+	o := &goldenOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	ForceSequentialParallel(t, chain)
+	runner := NewRunner(chain)
+	if o.scheme != nil {
+		runner.WithScheme(o.scheme)
+	}
+	objs, err := readFixtures(fixturesDir, runner.scheme)
+	if err != nil {
+		t.Fatalf("read fixtures: %s", err)
+	}
+	if len(objs) == 0 {
+		t.Fatalf("read fixtures: no objects in %s", fixturesDir)
+	}
+	runner.WithObjects(objs...)
+	result := runner.Run(t, client.ObjectKeyFromObject(objs[0]))
+	trace := GoldenTrace{
+		Request:   result.Request.NamespacedName.String(),
+		Rules:     strings.Split(strings.TrimSuffix(result.ExecutionTrace(), "\n"), "\n"),
+		Mutations: goldenMutations(runner.Recorder().Calls()),
+		Result: GoldenResult{
+			RequeueReason: result.RequeueReason,
+			Stopped:       result.Stopped,
+			Error:         result.Error,
+		},
+	}
+	if len(result.Rules) == 0 {
+		trace.Rules = nil
+	}
+	if after := result.Result.RequeueAfter; after > 0 {
+		trace.Result.RequeueAfter = after.String()
+	}
+	data, err := yaml.Marshal(trace)
+	if err != nil {
+		t.Fatalf("marshal execution trace: %s", err)
+	}
+	if result.RunID != "" {
+		data = bytes.ReplaceAll(data, []byte(result.RunID), []byte("<run-id>"))
+	}
+	path := filepath.Join(fixturesDir, GoldenFile)
+	if *update {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("write golden file: %s", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %s; run the test with -update to write it", err)
+	}
+	assert.Equal(t, string(want), string(data), "execution trace differs from %s; run the test with -update to accept it", path)
+}
+
+// readFixtures decodes the objects of the YAML files of the directory, in
+// order of their names, except the GoldenFile.
+func readFixtures(dir string, scheme *runtime.Scheme) ([]client.Object, error) {
+	files, err := yamlFiles(dir, GoldenFile)
+	if err != nil {
+		return nil, err
+	}
+	var objs []client.Object
+	for _, file := range files {
+		fileObjs, err := readObjects(file, scheme)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, fileObjs...)
+	}
+	return objs, nil
+}
+
+// yamlFiles returns the paths of the YAML files of the directory, in order of
+// their names, except those with the excluded names.
+func yamlFiles(dir string, excluded ...string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	var files []string
+	for _, file := range matches {
+		if !slices.Contains(excluded, filepath.Base(file)) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// readObjects decodes the objects of the YAML file. Its errors name the file.
+func readObjects(file string, scheme *runtime.Scheme) ([]client.Object, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(f))
+	var objs []client.Object
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return objs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		objs = append(objs, obj.(client.Object))
+	}
+}
+
+// goldenMutations returns the successful writes among the calls, in order.
+func goldenMutations(calls []Call) []GoldenMutation {
+	var mutations []GoldenMutation
+	for _, c := range calls {
+		if c.Err != nil || (c.Object == nil && c.Verb != VerbDelete) {
+			continue
+		}
+		m := GoldenMutation{Verb: c.Verb, Kind: c.GVK.Kind, Namespace: c.Key.Namespace, Name: c.Key.Name}
+		if c.Object != nil {
+			m.Object = normalizeObject(c.Object, m.Kind == "Secret")
+		}
+		mutations = append(mutations, m)
+	}
+	return mutations
+}
+
+// normalizeObject returns the content of the object without its type and the
+// fields set by the API server, with the data of a Secret redacted.
+func normalizeObject(obj client.Object, secret bool) map[string]interface{} {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	delete(content, "apiVersion")
+	delete(content, "kind")
+	stripServerFields(content)
+	if secret {
+		for _, field := range []string{"data", "stringData"} {
+			if data, ok := content[field].(map[string]interface{}); ok {
+				for k := range data {
+					data[k] = redactedValue
+				}
+			}
+		}
+	}
+	return content
+}
+
+// stripServerFields removes the metadata fields set by the API server from the
+// content of an object.
+func stripServerFields(content map[string]interface{}) {
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		for _, field := range []string{"uid", "resourceVersion", "creationTimestamp", "managedFields"} {
+			delete(metadata, field)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package chaintest_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smxlong/operchain/chaintest"
+)
+
+// Test_If_Golden_Matches_The_App_Chain is the reference golden test: it
+// checks the execution trace of the example chain, with the data of the
+// Secret it creates redacted, against testdata/app/golden.yaml.
+func Test_If_Golden_Matches_The_App_Chain(t *testing.T) {
+	chaintest.Golden(t, appChain(), filepath.Join("testdata", "app"))
+}
+
+// Test_If_Golden_Reports_A_Changed_Trace tests that Golden fails the test
+// with a diff when the execution trace differs from the golden file.
+func Test_If_Golden_Reports_A_Changed_Trace(t *testing.T) {
+	dir := t.TempDir()
+	fixtures, err := os.ReadFile(filepath.Join("testdata", "app", "objects.yaml"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "objects.yaml"), fixtures, 0o644))
+	golden, err := os.ReadFile(filepath.Join("testdata", "app", chaintest.GoldenFile))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, chaintest.GoldenFile), append(golden, "# changed\n"...), 0o644))
+	recorder := &fatalRecorder{TB: t}
+	chaintest.Golden(recorder, appChain(), dir)
+	assert.Contains(t, recorder.errors, "execution trace differs from", "mismatch was not reported")
+	assert.Contains(t, recorder.errors, "-# changed", "mismatch has no diff")
+}
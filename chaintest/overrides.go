@@ -0,0 +1,43 @@
+package chaintest
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/smxlong/operchain"
+)
+
+// OverridePredicates forces the values of the chain's predicates with the
+// given names in its Runs until the end of the test, e.g. to pretend that an
+// external check passed. Each Run starts from a fresh predicate cache seeded
+// with the overrides; overridden predicates are not evaluated, so nothing
+// they would keep across Runs, such as the results of ExternalCheck, is
+// kept. The test fails at once if a name is not the name of a predicate of
+// the chain's rules.
+func OverridePredicates(t testing.TB, chain *operchain.Chain, overrides map[string]bool) {
+	t.Helper()
+	known := chain.PredicateNames()
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !slices.Contains(known, name) {
+			t.Fatalf("cannot override predicate %q: the chain has no predicate of this name; it has: %s", name, strings.Join(known, ", "))
+		}
+	}
+	previous := chain.PredicateOverrides
+	merged := maps.Clone(previous)
+	if merged == nil {
+		merged = map[string]bool{}
+	}
+	maps.Copy(merged, overrides)
+	chain.PredicateOverrides = merged
+	t.Cleanup(func() {
+		chain.PredicateOverrides = previous
+	})
+}
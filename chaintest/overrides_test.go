@@ -0,0 +1,95 @@
+package chaintest_test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smxlong/operchain"
+	"github.com/smxlong/operchain/chaintest"
+)
+
+// licenseChain returns a chain with a rule that runs if the external
+// license check passes, and the number of calls of the check, which fails.
+func licenseChain() (*operchain.Chain, *int) {
+	calls := 0
+	c := &operchain.Chain{}
+	c.InitializeChain(nil, &struct{}{}, []operchain.Rule{
+		{
+			Name: "licensed",
+			When: c.ExternalCheck("license-valid", time.Second, func(context.Context) (bool, error) {
+				calls++
+				return false, nil
+			}, operchain.ExternalCheckCache(time.Hour)),
+			Do: func(context.Context) {},
+		},
+	})
+	return c, &calls
+}
+
+// Test_If_OverridePredicates_Makes_Rules_Fire tests that a rule fires purely
+// because of an override, without the check being made or cached, and that
+// the override ends with the test.
+func Test_If_OverridePredicates_Makes_Rules_Fire(t *testing.T) {
+	c, calls := licenseChain()
+	runner := chaintest.NewRunner(c)
+	t.Run("overridden", func(t *testing.T) {
+		chaintest.OverridePredicates(t, c, map[string]bool{"license-valid": true})
+		runner.Run(t, appKey).AssertNoError().AssertRuleFired("licensed")
+		runner.Run(t, appKey).AssertNoError().AssertRuleFired("licensed")
+	})
+	assert.Zero(t, *calls, "overridden check was made")
+	assert.Empty(t, c.PredicateOverrides, "override leaked out of the test")
+	runner.Run(t, appKey).AssertNoError().AssertRuleNotFired("licensed")
+	assert.Equal(t, 1, *calls, "check was not made once the override ended")
+}
+
+// fatalRecorder is a testing.TB recording the messages of Fatalf, Errorf and
+// Logf.
+type fatalRecorder struct {
+	testing.TB
+	fatal  string
+	errors string
+	logs   string
+}
+
+// Errorf records the message.
+func (r *fatalRecorder) Errorf(format string, args ...interface{}) {
+	r.errors += fmt.Sprintf(format, args...)
+}
+
+// Logf records the message.
+func (r *fatalRecorder) Logf(format string, args ...interface{}) {
+	r.logs += fmt.Sprintf(format, args...)
+}
+
+// Failed returns true if a failure was recorded.
+func (r *fatalRecorder) Failed() bool {
+	return r.fatal != "" || r.errors != ""
+}
+
+// Fatalf records the message and stops the goroutine, as testing.T does.
+func (r *fatalRecorder) Fatalf(format string, args ...interface{}) {
+	r.fatal = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+// Test_If_OverridePredicates_Fails_On_Unknown_Names tests that overriding a
+// predicate the chain does not have, e.g. because of a typo, fails the test
+// before the chain runs.
+func Test_If_OverridePredicates_Fails_On_Unknown_Names(t *testing.T) {
+	c, _ := licenseChain()
+	recorder := &fatalRecorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		chaintest.OverridePredicates(recorder, c, map[string]bool{"licence-valid": true})
+	}()
+	<-done
+	assert.Equal(t, `cannot override predicate "licence-valid": the chain has no predicate of this name; it has: license-valid`, recorder.fatal)
+	assert.Empty(t, c.PredicateOverrides, "unknown override was applied")
+}
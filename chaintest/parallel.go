@@ -0,0 +1,19 @@
+package chaintest
+
+import (
+	"testing"
+
+	"github.com/smxlong/operchain"
+)
+
+// ForceSequentialParallel sets the chain's ForceSequentialParallel until the
+// end of the test, so that Parallel and ForEachParallel run their branches in
+// order and the outcome of the test does not depend on scheduling.
+func ForceSequentialParallel(t testing.TB, chain *operchain.Chain) {
+	t.Helper()
+	previous := chain.ForceSequentialParallel
+	chain.ForceSequentialParallel = true
+	t.Cleanup(func() {
+		chain.ForceSequentialParallel = previous
+	})
+}
@@ -0,0 +1,39 @@
+package chaintest_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smxlong/operchain"
+	"github.com/smxlong/operchain/chaintest"
+)
+
+// Test_If_ForceSequentialParallel_Orders_Branches_For_The_Test tests that
+// the branches of Parallel run in declaration order while the toggle is set,
+// and that it is unset at the end of the test.
+func Test_If_ForceSequentialParallel_Orders_Branches_For_The_Test(t *testing.T) {
+	var lock sync.Mutex
+	var order []string
+	branch := func(name string, delay time.Duration) operchain.Action {
+		return func(context.Context) {
+			time.Sleep(delay)
+			lock.Lock()
+			defer lock.Unlock()
+			order = append(order, name)
+		}
+	}
+	c := &operchain.Chain{}
+	c.InitializeChain(nil, &struct{}{}, []operchain.Rule{
+		{Name: "fanout", Do: operchain.Parallel(branch("slow", 2*time.Millisecond), branch("fast", 0))},
+	})
+	t.Run("sequential", func(t *testing.T) {
+		chaintest.ForceSequentialParallel(t, c)
+		chaintest.NewRunner(c).Run(t, appKey).AssertNoError().AssertRuleFired("fanout")
+		assert.Equal(t, []string{"slow", "fast"}, order)
+	})
+	assert.False(t, c.ForceSequentialParallel, "toggle outlived the test")
+}
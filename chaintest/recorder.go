@@ -0,0 +1,237 @@
+package chaintest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// Verbs of the calls recorded by a Recorder. The calls to subresources have
+// the verb followed by the name of the subresource, e.g. "update status".
+const (
+	VerbGet         = "get"
+	VerbList        = "list"
+	VerbCreate      = "create"
+	VerbUpdate      = "update"
+	VerbPatch       = "patch"
+	VerbDelete      = "delete"
+	VerbDeleteAllOf = "deleteallof"
+)
+
+// Call is a call to the client of a Runner.
+type Call struct {
+	// Verb is what the call did, e.g. VerbUpdate or "update status".
+	Verb string
+	// Key is the key of the object, or the namespace of a list.
+	Key types.NamespacedName
+	// GVK is the group, version and kind of the object, or of the items of a
+	// list.
+	GVK schema.GroupVersionKind
+	// Object is a copy of the object sent by a write, as it was sent, or nil.
+	Object client.Object
+	// Err is the error the call returned.
+	Err error
+}
+
+// String returns the call as its verb, kind and key, e.g.
+// "update apps/v1, Kind=Deployment default/web".
+func (c Call) String() string {
+	return fmt.Sprintf("%s %s %s", c.Verb, c.GVK, c.Key)
+}
+
+// CallPattern matches calls. Its zero fields match anything; e.g. a pattern
+// with only a Verb matches the calls with that verb to objects of any kind.
+type CallPattern struct {
+	Verb string
+	GVK  schema.GroupVersionKind
+	Key  types.NamespacedName
+}
+
+// matches returns true if the call matches the pattern.
+func (p CallPattern) matches(c Call) bool {
+	return (p.Verb == "" || p.Verb == c.Verb) &&
+		(p.GVK.Empty() || p.GVK == c.GVK) &&
+		(p.Key.Name == "" || p.Key.Name == c.Key.Name) &&
+		(p.Key.Namespace == "" || p.Key.Namespace == c.Key.Namespace)
+}
+
+// Recorder records the calls to the client of a Runner. It is safe for
+// concurrent use, e.g. by the branches of Parallel.
+type Recorder struct {
+	scheme *runtime.Scheme
+	lock   sync.Mutex
+	calls  []Call
+}
+
+// Calls returns the calls recorded so far, in order.
+func (r *Recorder) Calls() []Call {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Reset forgets the calls recorded so far, e.g. between Runs.
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.calls = nil
+}
+
+// Matching returns the calls recorded so far matching the pattern, in order.
+func (r *Recorder) Matching(pattern CallPattern) []Call {
+	var calls []Call
+	for _, c := range r.Calls() {
+		if pattern.matches(c) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// AssertCalls asserts that count calls with the verb were made to objects of
+// the GVK, or of any kind if it is empty.
+func (r *Recorder) AssertCalls(t testing.TB, verb string, gvk schema.GroupVersionKind, count int) bool {
+	t.Helper()
+	calls := r.Matching(CallPattern{Verb: verb, GVK: gvk})
+	return assert.Len(t, calls, count, "wrong number of %s calls to %s; calls:\n%s", verb, kindOrAny(gvk), r.describe())
+}
+
+// AssertNoCall asserts that no call with the verb was made to objects of the
+// GVK, or of any kind if it is empty.
+func (r *Recorder) AssertNoCall(t testing.TB, verb string, gvk schema.GroupVersionKind) bool {
+	t.Helper()
+	calls := r.Matching(CallPattern{Verb: verb, GVK: gvk})
+	return assert.Empty(t, calls, "unexpected %s calls to %s; calls:\n%s", verb, kindOrAny(gvk), r.describe())
+}
+
+// AssertCallsInOrder asserts that calls matching the patterns were made in
+// the order of the patterns, e.g. that a Deployment was updated only after
+// its ConfigMap. Other calls may come before, between and after them.
+func (r *Recorder) AssertCallsInOrder(t testing.TB, patterns ...CallPattern) bool {
+	t.Helper()
+	next := 0
+	for _, c := range r.Calls() {
+		if next < len(patterns) && patterns[next].matches(c) {
+			next++
+		}
+	}
+	if next == len(patterns) {
+		return true
+	}
+	p := patterns[next]
+	return assert.Fail(t, "calls were not made in order", "no %s call to %s %s after the calls matching the previous patterns; calls:\n%s", p.Verb, kindOrAny(p.GVK), p.Key, r.describe())
+}
+
+// describe returns the calls recorded so far, one per line.
+func (r *Recorder) describe() string {
+	var sb strings.Builder
+	for _, c := range r.Calls() {
+		fmt.Fprintf(&sb, "  %s\n", c)
+	}
+	return sb.String()
+}
+
+// kindOrAny returns the GVK as a string, or "any kind" if it is empty.
+func kindOrAny(gvk schema.GroupVersionKind) string {
+	if gvk.Empty() {
+		return "any kind"
+	}
+	return gvk.String()
+}
+
+// record records a call to the object, with the copy of the object it sent
+// if it is a write.
+func (r *Recorder) record(verb string, key types.NamespacedName, obj runtime.Object, payload client.Object, err error) {
+	c := Call{Verb: verb, Key: key, Object: payload, Err: err}
+	if gvk, gvkErr := apiutil.GVKForObject(obj, r.scheme); gvkErr == nil {
+		c.GVK = gvk
+	}
+	r.append(c)
+}
+
+// append records the call.
+func (r *Recorder) append(c Call) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.calls = append(r.calls, c)
+}
+
+// listGVK returns the GVK of the items of the list.
+func (r *Recorder) listGVK(list client.ObjectList) schema.GroupVersionKind {
+	gvk, err := apiutil.GVKForObject(list, r.scheme)
+	if err != nil {
+		return schema.GroupVersionKind{}
+	}
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	return gvk
+}
+
+// funcs returns the interceptor functions of a fake client recording its
+// calls.
+func (r *Recorder) funcs() interceptor.Funcs {
+	write := func(verb string, obj client.Object, call func() error) error {
+		payload := obj.DeepCopyObject().(client.Object)
+		err := call()
+		r.record(verb, client.ObjectKeyFromObject(payload), payload, payload, err)
+		return err
+	}
+	return interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			err := c.Get(ctx, key, obj, opts...)
+			r.record(VerbGet, key, obj, nil, err)
+			return err
+		},
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			err := c.List(ctx, list, opts...)
+			lo := (&client.ListOptions{}).ApplyOptions(opts)
+			r.append(Call{Verb: VerbList, Key: types.NamespacedName{Namespace: lo.Namespace}, GVK: r.listGVK(list), Err: err})
+			return err
+		},
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			return write(VerbCreate, obj, func() error {
+				return c.Create(ctx, obj, opts...)
+			})
+		},
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			return write(VerbUpdate, obj, func() error {
+				return c.Update(ctx, obj, opts...)
+			})
+		},
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			return write(VerbPatch, obj, func() error {
+				return c.Patch(ctx, obj, patch, opts...)
+			})
+		},
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			err := c.Delete(ctx, obj, opts...)
+			r.record(VerbDelete, client.ObjectKeyFromObject(obj), obj, nil, err)
+			return err
+		},
+		DeleteAllOf: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteAllOfOption) error {
+			err := c.DeleteAllOf(ctx, obj, opts...)
+			lo := (&client.DeleteAllOfOptions{}).ApplyOptions(opts)
+			r.record(VerbDeleteAllOf, types.NamespacedName{Namespace: lo.Namespace}, obj, nil, err)
+			return err
+		},
+		SubResourceUpdate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+			return write(VerbUpdate+" "+subResource, obj, func() error {
+				return c.SubResource(subResource).Update(ctx, obj, opts...)
+			})
+		},
+		SubResourcePatch: func(ctx context.Context, c client.Client, subResource string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+			return write(VerbPatch+" "+subResource, obj, func() error {
+				return c.SubResource(subResource).Patch(ctx, obj, patch, opts...)
+			})
+		},
+	}
+}
@@ -0,0 +1,97 @@
+package chaintest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/smxlong/operchain"
+	"github.com/smxlong/operchain/chaintest"
+)
+
+var (
+	configMapGVK = corev1.SchemeGroupVersion.WithKind("ConfigMap")
+	secretGVK    = corev1.SchemeGroupVersion.WithKind("Secret")
+)
+
+// Test_If_Recorder_Counts_Calls_By_Verb_And_Kind tests that the Recorder of
+// a Runner sees the calls of the chain, with a copy of what they sent.
+func Test_If_Recorder_Counts_Calls_By_Verb_And_Kind(t *testing.T) {
+	runner := chaintest.NewRunner(appChain()).WithObjects(demoApp())
+	runner.Run(t, appKey).AssertNoError().AssertRuleFired("create secret")
+	recorder := runner.Recorder()
+	recorder.AssertCalls(t, chaintest.VerbCreate, secretGVK, 1)
+	recorder.AssertCalls(t, chaintest.VerbCreate, schema.GroupVersionKind{}, 1)
+	recorder.AssertNoCall(t, chaintest.VerbCreate, configMapGVK)
+	recorder.AssertNoCall(t, chaintest.VerbDelete, schema.GroupVersionKind{})
+	creates := recorder.Matching(chaintest.CallPattern{Verb: chaintest.VerbCreate})
+	if assert.Len(t, creates, 1) {
+		assert.Equal(t, appKey, creates[0].Key)
+		assert.NoError(t, creates[0].Err)
+		secret, ok := creates[0].Object.(*corev1.Secret)
+		if assert.True(t, ok, "payload is not a Secret") {
+			assert.Equal(t, "demo", secret.StringData["app"], "payload has the wrong data")
+			assert.Empty(t, secret.ResourceVersion, "payload was not copied before the call")
+		}
+	}
+
+	recorder.Reset()
+	runner.Run(t, appKey).AssertNoError().AssertRuleNotFired("create secret")
+	recorder.AssertNoCall(t, chaintest.VerbCreate, secretGVK)
+}
+
+// Test_If_Recorder_Asserts_The_Order_Of_Calls tests that AssertCallsInOrder
+// accepts calls made in order with others in between, and reports calls made
+// out of order.
+func Test_If_Recorder_Asserts_The_Order_Of_Calls(t *testing.T) {
+	c := &operchain.Chain{}
+	c.InitializeChain(nil, &struct{}{}, []operchain.Rule{
+		{Name: "config", Do: createConfigMap(c, "config")},
+		{Name: "other", Do: createConfigMap(c, "other")},
+		{Name: "app", Do: createConfigMap(c, "app")},
+	})
+	runner := chaintest.NewRunner(c)
+	runner.Run(t, appKey).AssertNoError()
+	config := chaintest.CallPattern{Verb: chaintest.VerbCreate, Key: appKey}
+	config.Key.Name = "config"
+	app := config
+	app.Key.Name = "app"
+	runner.Recorder().AssertCallsInOrder(t, config, app)
+
+	recorder := &fatalRecorder{TB: t}
+	assert.False(t, runner.Recorder().AssertCallsInOrder(recorder, app, config), "calls out of order were accepted")
+	assert.Contains(t, recorder.errors, "calls were not made in order")
+	assert.Contains(t, recorder.errors, "create /v1, Kind=ConfigMap default/app", "message does not list the calls")
+}
+
+// Test_If_Recorder_Records_Parallel_Calls tests that the Recorder sees every
+// call made by the branches of Parallel. Run with -race.
+func Test_If_Recorder_Records_Parallel_Calls(t *testing.T) {
+	c := &operchain.Chain{}
+	var branches []operchain.Action
+	for i := 0; i < 20; i++ {
+		branches = append(branches, createConfigMap(c, fmt.Sprintf("cm-%d", i)))
+	}
+	c.InitializeChain(nil, &struct{}{}, []operchain.Rule{
+		{Name: "fanout", Do: operchain.Parallel(branches...)},
+	})
+	runner := chaintest.NewRunner(c)
+	runner.Run(t, appKey).AssertNoError().AssertRuleFired("fanout")
+	runner.Recorder().AssertCalls(t, chaintest.VerbCreate, configMapGVK, len(branches))
+}
+
+// createConfigMap returns an action creating an empty ConfigMap with the name
+// in the default namespace.
+func createConfigMap(c *operchain.Chain, name string) operchain.Action {
+	return func(ctx context.Context) {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: appKey.Namespace}}
+		if err := c.Client.Create(ctx, cm); err != nil {
+			c.Error(err)(ctx)
+		}
+	}
+}
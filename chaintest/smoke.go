@@ -0,0 +1,215 @@
+package chaintest
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	"github.com/smxlong/operchain"
+)
+
+// DefaultSmokeIterations is the number of Runs of a sample by
+// SmokeFromSamples, unless given SmokeIterations.
+const DefaultSmokeIterations = 5
+
+// KustomizationFile is the name of the kustomization of a samples directory,
+// which SmokeFromSamples skips.
+const KustomizationFile = "kustomization.yaml"
+
+// smokeOptions holds the options of SmokeFromSamples.
+type smokeOptions struct {
+	scheme     *runtime.Scheme
+	objects    []client.Object
+	iterations int
+	conditions map[string][]expectedCondition
+}
+
+// expectedCondition is a condition a sample must have after its Runs.
+type expectedCondition struct {
+	condType string
+	status   metav1.ConditionStatus
+}
+
+// SmokeOption configures SmokeFromSamples.
+type SmokeOption func(o *smokeOptions)
+
+// SmokeScheme decodes the samples and runs the chain with the scheme, e.g.
+// for custom resources. The types of client-go are added to it.
+func SmokeScheme(scheme *runtime.Scheme) SmokeOption {
+	return func(o *smokeOptions) {
+		o.scheme = scheme
+	}
+}
+
+// SmokeObjects adds objects to the fake client of every sample, e.g. the
+// Secrets the chain reads.
+func SmokeObjects(objs ...client.Object) SmokeOption {
+	return func(o *smokeOptions) {
+		o.objects = append(o.objects, objs...)
+	}
+}
+
+// SmokeIterations runs the chain at most n times for each sample.
+func SmokeIterations(n int) SmokeOption {
+	return func(o *smokeOptions) {
+		o.iterations = n
+	}
+}
+
+// SmokeExpectCondition asserts that after its Runs, the objects of the
+// sample file with the given name have a condition of the type with the
+// status in status.conditions.
+func SmokeExpectCondition(sample, condType string, status metav1.ConditionStatus) SmokeOption {
+	return func(o *smokeOptions) {
+		o.conditions[sample] = append(o.conditions[sample], expectedCondition{condType: condType, status: status})
+	}
+}
+
+// SmokeFromSamples runs the chain for each object of the YAML files of the
+// samples directory, such as the config/samples of a kubebuilder project,
+// and asserts that its Runs neither fail nor panic, so that unusual shapes
+// of specs are tried without writing a test for each. Each object is run
+// against a fake client holding only it and the objects of SmokeObjects, as
+// a Runner runs it, until a Run writes nothing or for SmokeIterations Runs,
+// stepping the fake clock by the requeue interval between Runs. The chain
+// recovers panics while it runs. The files are read in order of their names,
+// except the KustomizationFile, and a sample that cannot be decoded fails the
+// test with the name of its file. Failures are prefixed with the name of the
+// sample file, e.g. `sample "widget-minimal.yaml":`.
+func SmokeFromSamples(t testing.TB, chain *operchain.Chain, samplesDir string, opts ...SmokeOption) {
+	t.Helper()
+	o := &smokeOptions{iterations: DefaultSmokeIterations, conditions: map[string][]expectedCondition{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	scheme := o.runner(chain).scheme
+	files, err := yamlFiles(samplesDir, KustomizationFile)
+	if err != nil {
+		t.Fatalf("read samples: %s", err)
+	}
+	samples := map[string][]client.Object{}
+	for _, file := range files {
+		objs, err := readObjects(file, scheme)
+		if err != nil {
+			t.Fatalf("read samples: %s", err)
+		}
+		samples[filepath.Base(file)] = objs
+	}
+	if len(samples) == 0 {
+		t.Fatalf("read samples: no samples in %s", samplesDir)
+	}
+	for sample := range o.conditions {
+		if _, ok := samples[sample]; !ok {
+			t.Fatalf("expected conditions of sample %q: no such sample in %s", sample, samplesDir)
+		}
+	}
+	recoverPanics := chain.RecoverPanics
+	chain.RecoverPanics = true
+	defer func() { chain.RecoverPanics = recoverPanics }()
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, obj := range samples[name] {
+			smokeSample(t, chain, scheme, name, obj, o)
+		}
+	}
+}
+
+// smokeSample runs the chain for the object of the sample as SmokeFromSamples
+// does.
+func smokeSample(t testing.TB, chain *operchain.Chain, scheme *runtime.Scheme, sample string, obj client.Object, o *smokeOptions) {
+	t.Helper()
+	key := client.ObjectKeyFromObject(obj)
+	runner := o.runner(chain).WithObjects(obj)
+	for i := 1; i <= o.iterations; i++ {
+		runner.Recorder().Reset()
+		result, panicked := smokeRun(t, runner, key)
+		if panicked != "" {
+			t.Errorf("sample %q: %s: Run %d panicked: %s", sample, key, i, panicked)
+			return
+		}
+		if result.Err != nil {
+			t.Errorf("sample %q: %s: Run %d failed: %s", sample, key, i, result.Err)
+			return
+		}
+		if len(goldenMutations(runner.Recorder().Calls())) == 0 {
+			break
+		}
+		runner.Clock().Step(result.Result.RequeueAfter)
+	}
+	expected := o.conditions[sample]
+	if len(expected) == 0 {
+		return
+	}
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		t.Errorf("sample %q: %s: %s", sample, key, err)
+		return
+	}
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(gvk)
+	if err := runner.Client().Get(context.Background(), key, live); err != nil {
+		t.Errorf("sample %q: %s: %s", sample, key, err)
+		return
+	}
+	conditions := conditionStatuses(live)
+	for _, want := range expected {
+		if got, ok := conditions[want.condType]; !ok {
+			t.Errorf("sample %q: %s: no condition %s; conditions: %v", sample, key, want.condType, conditions)
+		} else if got != string(want.status) {
+			t.Errorf("sample %q: %s: condition %s is %s, not %s", sample, key, want.condType, got, want.status)
+		}
+	}
+}
+
+// runner returns a Runner for the chain with the scheme and the objects of
+// the options.
+func (o *smokeOptions) runner(chain *operchain.Chain) *Runner {
+	runner := NewRunner(chain)
+	if o.scheme != nil {
+		runner.WithScheme(o.scheme)
+	}
+	for _, obj := range o.objects {
+		runner.WithObjects(obj.DeepCopyObject().(client.Object))
+	}
+	return runner
+}
+
+// smokeRun runs the chain once, returning the panic raised outside of its
+// rules, e.g. while loading resources, with its stack.
+func smokeRun(t testing.TB, runner *Runner, key client.ObjectKey) (result *Result, panicked string) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = fmt.Sprintf("%v\n%s", r, debug.Stack())
+		}
+	}()
+	return runner.Run(t, key), ""
+}
+
+// conditionStatuses returns the statuses of the conditions of the object, by
+// type.
+func conditionStatuses(obj *unstructured.Unstructured) map[string]string {
+	statuses := map[string]string{}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, cond := range conditions {
+		if m, ok := cond.(map[string]interface{}); ok {
+			condType, _ := m["type"].(string)
+			status, _ := m["status"].(string)
+			statuses[condType] = status
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,127 @@
+package chaintest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain"
+	"github.com/smxlong/operchain/chaintest"
+)
+
+// samplesDir holds the samples of the smoke tests.
+const samplesDir = "testdata/samples"
+
+// deploymentResources are the resources of availabilityChain.
+type deploymentResources struct {
+	Deployment *appsv1.Deployment
+	Secrets    []*corev1.Secret
+}
+
+// availabilityChain returns a chain setting the Available condition of a
+// Deployment from its replicas, and failing without credentials. If buggy, it
+// assumes that replicas is set, as samples that leave it unset show. runs
+// counts its Runs.
+func availabilityChain(buggy bool, runs *int) *operchain.Chain {
+	var res deploymentResources
+	var replicas int32
+	c := &operchain.Chain{}
+	c.InitializeChain(nil, &res, []operchain.Rule{
+		{Name: "count", Do: func(context.Context) { *runs++ }},
+		{
+			Name: "available",
+			When: c.Exists(&res.Deployment),
+			Do: operchain.Sequential(
+				func(context.Context) {
+					replicas = 0
+					if buggy || res.Deployment.Spec.Replicas != nil {
+						replicas = *res.Deployment.Spec.Replicas
+					}
+				},
+				c.UpdateStatus(&res.Deployment, func(obj client.Object) error {
+					status := corev1.ConditionFalse
+					if replicas > 0 {
+						status = corev1.ConditionTrue
+					}
+					d := obj.(*appsv1.Deployment)
+					d.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentAvailable, Status: status}}
+					return nil
+				}),
+			),
+		},
+		{
+			Name: "credentials",
+			When: operchain.Not(operchain.Predicate(func() bool { return len(res.Secrets) > 0 })),
+			Do:   c.Error(errors.New("no credentials")),
+		},
+	})
+	return c
+}
+
+// credentials is the Secret availabilityChain needs.
+func credentials() *corev1.Secret {
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"}}
+}
+
+// Test_If_SmokeFromSamples_Runs_Every_Sample_To_A_Fixpoint tests that each
+// sample is run until a Run writes nothing, with the extra objects, and that
+// the expected conditions are checked.
+func Test_If_SmokeFromSamples_Runs_Every_Sample_To_A_Fixpoint(t *testing.T) {
+	runs := 0
+	chaintest.SmokeFromSamples(t, availabilityChain(false, &runs), samplesDir,
+		chaintest.SmokeObjects(credentials()),
+		chaintest.SmokeExpectCondition("web.yaml", "Available", metav1.ConditionTrue),
+		chaintest.SmokeExpectCondition("idle.yaml", "Available", metav1.ConditionFalse),
+	)
+	assert.Equal(t, 4, runs, "each sample should take a Run writing its status and one writing nothing")
+
+	recorder := &fatalRecorder{TB: t}
+	chaintest.SmokeFromSamples(recorder, availabilityChain(false, &runs), samplesDir,
+		chaintest.SmokeObjects(credentials()),
+		chaintest.SmokeIterations(1),
+		chaintest.SmokeExpectCondition("web.yaml", "Available", metav1.ConditionFalse),
+		chaintest.SmokeExpectCondition("web.yaml", "Progressing", metav1.ConditionTrue),
+	)
+	assert.Contains(t, recorder.errors, `sample "web.yaml": default/web: condition Available is True, not False`)
+	assert.Contains(t, recorder.errors, `sample "web.yaml": default/web: no condition Progressing`)
+}
+
+// Test_If_SmokeFromSamples_Reports_Panics_And_Errors tests that a Run that
+// panics on a sample, or fails, fails the test naming the sample, and that the
+// chain recovers panics only during the smoke test.
+func Test_If_SmokeFromSamples_Reports_Panics_And_Errors(t *testing.T) {
+	runs := 0
+	c := availabilityChain(true, &runs)
+	recorder := &fatalRecorder{TB: t}
+	chaintest.SmokeFromSamples(recorder, c, samplesDir)
+	assert.Contains(t, recorder.errors, `sample "idle.yaml": default/idle: Run 1 failed: panic in action of available: runtime error: invalid memory address or nil pointer dereference`)
+	assert.Contains(t, recorder.errors, `sample "web.yaml": default/web: Run 1 failed: no credentials`)
+	assert.False(t, c.RecoverPanics, "RecoverPanics outlived the smoke test")
+}
+
+// Test_If_SmokeFromSamples_Fails_On_Bad_Samples tests that a sample that
+// cannot be decoded fails the test with the name of its file, and that
+// expecting conditions of a missing sample does too.
+func Test_If_SmokeFromSamples_Fails_On_Bad_Samples(t *testing.T) {
+	runs := 0
+	smoke := func(dir string, opts ...chaintest.SmokeOption) string {
+		recorder := &fatalRecorder{TB: t}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			chaintest.SmokeFromSamples(recorder, availabilityChain(false, &runs), dir, opts...)
+		}()
+		<-done
+		return recorder.fatal
+	}
+	assert.Contains(t, smoke("testdata/badsamples"), "read samples: testdata/badsamples/broken.yaml: ")
+	assert.Equal(t, `expected conditions of sample "missing.yaml": no such sample in testdata/samples`,
+		smoke(samplesDir, chaintest.SmokeExpectCondition("missing.yaml", "Available", metav1.ConditionTrue)))
+	assert.Zero(t, runs, "chain ran despite bad samples")
+}
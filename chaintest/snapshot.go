@@ -0,0 +1,138 @@
+package chaintest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// SnapshotDir is the directory of the snapshots of SnapshotChildren, relative
+// to the package of the test. The snapshots of a test are in the directory
+// named after it.
+const SnapshotDir = "testdata/snapshots"
+
+// SnapshotChildren compares the objects with the given keys that the Runs of
+// the Runner wrote, such as the Deployments and Services a chain renders from
+// its primary resource, with their snapshots, failing the test with a diff if
+// they differ. There is a snapshot per object, named after its kind,
+// namespace and name in the snapshot directory of the test, e.g.
+// testdata/snapshots/Test_Render/deployment_default_web.yaml; a key names
+// every object of that key the Runs wrote, of any kind. With the -update
+// flag, SnapshotChildren writes the snapshots instead. The snapshots hold the
+// whole objects as YAML, without their status and the fields set by the API
+// server, and with the values of the data of Secrets replaced by their
+// SHA-256 hashes.
+func SnapshotChildren(t testing.TB, runner *Runner, keys ...client.ObjectKey) {
+	t.Helper()
+	dir := filepath.Join(SnapshotDir, filepath.FromSlash(t.Name()))
+	for _, key := range keys {
+		gvks := runner.writtenKinds(key)
+		if len(gvks) == 0 {
+			t.Errorf("snapshot %s: the chain wrote no object with this key", key)
+			continue
+		}
+		for _, gvk := range gvks {
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(gvk)
+			if err := runner.Client().Get(context.Background(), key, obj); err != nil {
+				t.Errorf("snapshot %s %s: %s", gvk.Kind, key, err)
+				continue
+			}
+			data, err := yaml.Marshal(snapshotContent(obj))
+			if err != nil {
+				t.Errorf("snapshot %s %s: %s", gvk.Kind, key, err)
+				continue
+			}
+			compareSnapshot(t, filepath.Join(dir, snapshotFile(gvk, key)), data)
+		}
+	}
+}
+
+// writtenKinds returns the kinds of the objects with the key that the Runs of
+// the Runner created, updated or patched, in the order of their first write.
+func (r *Runner) writtenKinds(key client.ObjectKey) []schema.GroupVersionKind {
+	var gvks []schema.GroupVersionKind
+	seen := map[schema.GroupVersionKind]bool{}
+	for _, c := range r.Recorder().Calls() {
+		switch c.Verb {
+		case VerbCreate, VerbUpdate, VerbPatch:
+		default:
+			continue
+		}
+		if c.Err == nil && c.Key == key && !seen[c.GVK] {
+			seen[c.GVK] = true
+			gvks = append(gvks, c.GVK)
+		}
+	}
+	return gvks
+}
+
+// snapshotFile returns the name of the snapshot of the object of the kind with
+// the key.
+func snapshotFile(gvk schema.GroupVersionKind, key client.ObjectKey) string {
+	parts := []string{strings.ToLower(gvk.Kind)}
+	if key.Namespace != "" {
+		parts = append(parts, key.Namespace)
+	}
+	return strings.Join(append(parts, key.Name), "_") + ".yaml"
+}
+
+// snapshotContent returns the content of the object without its status and
+// the fields set by the API server, and with the data of a Secret hashed.
+func snapshotContent(obj *unstructured.Unstructured) map[string]interface{} {
+	content := obj.DeepCopy().Object
+	delete(content, "status")
+	stripServerFields(content)
+	if obj.GetKind() != "Secret" {
+		return content
+	}
+	for _, field := range []string{"data", "stringData"} {
+		data, ok := content[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for k, v := range data {
+			value, _ := v.(string)
+			if field == "data" {
+				if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+					value = string(decoded)
+				}
+			}
+			sum := sha256.Sum256([]byte(value))
+			data[k] = "sha256:" + hex.EncodeToString(sum[:])
+		}
+	}
+	return content
+}
+
+// compareSnapshot compares the data with the snapshot at the path, or writes
+// it there with the -update flag.
+func compareSnapshot(t testing.TB, path string, data []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("write snapshot: %s", err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("write snapshot: %s", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("read snapshot: %s; run the test with -update to write it", err)
+		return
+	}
+	assert.Equal(t, string(want), string(data), "object differs from %s; run the test with -update to accept it", path)
+}
@@ -0,0 +1,130 @@
+package chaintest_test
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain"
+	"github.com/smxlong/operchain/chaintest"
+)
+
+// webKey is the key of the web ConfigMap of renderChain and of its children.
+var webKey = types.NamespacedName{Namespace: "default", Name: "web"}
+
+// renderResources are the resources of renderChain.
+type renderResources struct {
+	Config     *corev1.ConfigMap
+	Deployment *appsv1.Deployment
+	Service    *corev1.Service
+	Secret     *corev1.Secret
+}
+
+// renderChain returns a chain rendering a Deployment, a Service and a Secret
+// from the image and token of a ConfigMap.
+func renderChain() *operchain.Chain {
+	var res renderResources
+	labels := map[string]string{"app": "web"}
+	meta := func() metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: res.Config.Name, Namespace: res.Config.Namespace, Labels: labels}
+	}
+	c := &operchain.Chain{}
+	c.InitializeChain(nil, &res, []operchain.Rule{
+		{
+			Name: "deployment",
+			When: c.Exists(&res.Config),
+			Do: c.Ensure(&res.Deployment, func() (client.Object, error) {
+				return &appsv1.Deployment{
+					ObjectMeta: meta(),
+					Spec: appsv1.DeploymentSpec{
+						Selector: &metav1.LabelSelector{MatchLabels: labels},
+						Template: corev1.PodTemplateSpec{
+							ObjectMeta: metav1.ObjectMeta{Labels: labels},
+							Spec: corev1.PodSpec{Containers: []corev1.Container{{
+								Name:  "web",
+								Image: res.Config.Data["image"],
+								Ports: []corev1.ContainerPort{{ContainerPort: 8080}},
+							}}},
+						},
+					},
+				}, nil
+			}),
+		},
+		{
+			Name: "service",
+			When: c.Exists(&res.Config),
+			Do: c.Ensure(&res.Service, func() (client.Object, error) {
+				return &corev1.Service{
+					ObjectMeta: meta(),
+					Spec: corev1.ServiceSpec{
+						Selector: labels,
+						Ports:    []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}},
+					},
+				}, nil
+			}),
+		},
+		{
+			Name: "secret",
+			When: c.Exists(&res.Config),
+			Do: c.Ensure(&res.Secret, func() (client.Object, error) {
+				return &corev1.Secret{ObjectMeta: meta(), StringData: map[string]string{"token": res.Config.Data["token"]}}, nil
+			}),
+		},
+	})
+	return c
+}
+
+// webConfig returns the web ConfigMap with the image.
+func webConfig(image string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: webKey.Name, Namespace: webKey.Namespace},
+		Data:       map[string]string{"image": image, "token": "s3cr3t"},
+	}
+}
+
+// Test_If_SnapshotChildren_Matches_The_Rendered_Children is the reference
+// snapshot test: it locks the manifests renderChain renders, one snapshot
+// per kind, with the token of the Secret hashed.
+func Test_If_SnapshotChildren_Matches_The_Rendered_Children(t *testing.T) {
+	runner := chaintest.NewRunner(renderChain()).WithObjects(webConfig("example.com/web:v1"))
+	runner.Run(t, webKey).AssertNoError().AssertRuleFired("deployment", "service", "secret")
+	chaintest.SnapshotChildren(t, runner, webKey)
+}
+
+// namedTB is a testing.TB with another name, so that a test can compare with
+// the snapshots of another.
+type namedTB struct {
+	testing.TB
+	name string
+}
+
+// Name returns the name.
+func (n namedTB) Name() string {
+	return n.name
+}
+
+// Test_If_SnapshotChildren_Reports_Changes tests that a change to a rendered
+// object fails the test with a diff, and that a key the chain did not write
+// fails it too.
+func Test_If_SnapshotChildren_Reports_Changes(t *testing.T) {
+	if f := flag.Lookup("update"); f != nil && f.Value.String() == "true" {
+		t.Skip("the snapshots are being updated")
+	}
+	runner := chaintest.NewRunner(renderChain()).WithObjects(webConfig("example.com/web:v2"))
+	runner.Run(t, webKey).AssertNoError()
+	recorder := &fatalRecorder{TB: t}
+	missing := types.NamespacedName{Namespace: "default", Name: "missing"}
+	chaintest.SnapshotChildren(namedTB{TB: recorder, name: "Test_If_SnapshotChildren_Matches_The_Rendered_Children"}, runner, webKey, missing)
+	assert.Contains(t, recorder.errors, "object differs from testdata/snapshots/Test_If_SnapshotChildren_Matches_The_Rendered_Children/deployment_default_web.yaml")
+	assert.Contains(t, recorder.errors, "-      - image: example.com/web:v1")
+	assert.Contains(t, recorder.errors, "+      - image: example.com/web:v2")
+	assert.NotContains(t, recorder.errors, "service_default_web.yaml", "unchanged Service was reported")
+	assert.Contains(t, recorder.errors, "snapshot default/missing: the chain wrote no object with this key")
+}
@@ -0,0 +1,115 @@
+package chaintest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain"
+)
+
+// Case is a case of RunTable: the objects a Run starts from, and what it is
+// expected to do.
+type Case struct {
+	// Name identifies the case in the test output.
+	Name string
+	// Objects are the objects of the fake client, e.g. the primary resource
+	// with the spec under test.
+	Objects []client.Object
+	// Request is the key of the object the chain runs for.
+	Request types.NamespacedName
+	// Predicates are forced as OverridePredicates does, if any.
+	Predicates map[string]bool
+	// ExpectFired are the rules expected to fire.
+	ExpectFired []string
+	// ExpectNotFired are the rules expected not to fire.
+	ExpectNotFired []string
+	// ExpectObjects are the objects expected to exist after the Run.
+	ExpectObjects []ExpectedObject
+	// ExpectRequeueBetween, if not nil, is the range the requeue interval of
+	// the Run is expected in.
+	ExpectRequeueBetween *RequeueRange
+	// ExpectErrorIs is the error the Run is expected to fail with, as
+	// errors.Is says. If nil, the Run is expected to succeed.
+	ExpectErrorIs error
+}
+
+// RequeueRange is a range of requeue intervals, bounds included.
+type RequeueRange struct {
+	Min, Max time.Duration
+}
+
+// ExpectedObject is an object expected to exist after the Run of a Case.
+type ExpectedObject struct {
+	// Key is the key of the object.
+	Key types.NamespacedName
+	// Object is an empty object of its type, which it is read into.
+	Object client.Object
+	// Assert, if not nil, makes further assertions on the object read.
+	Assert func(t testing.TB, obj client.Object)
+}
+
+// RunTable runs each case as a subtest with RunCase. The cases share the
+// chain, so state the chain keeps across Runs, such as cooldowns, is shared
+// too.
+func RunTable(t *testing.T, chain *operchain.Chain, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			RunCase(t, chain, c)
+		})
+	}
+}
+
+// RunCase runs the chain once with a new Runner for the objects of the case,
+// and asserts that the Run did what the case expects. If an assertion fails,
+// the report of the Run is logged for debugging.
+func RunCase(t testing.TB, chain *operchain.Chain, c Case) {
+	t.Helper()
+	runner := NewRunner(chain).WithObjects(c.Objects...)
+	for name, value := range c.Predicates {
+		runner.WithPredicate(name, value)
+	}
+	result := runner.Run(t, c.Request)
+	failed := false
+	check := func(ok bool) {
+		failed = failed || !ok
+	}
+	if c.ExpectErrorIs != nil {
+		check(assert.ErrorIs(t, result.Err, c.ExpectErrorIs, "case %q: Run returned the wrong error", c.Name))
+	} else {
+		check(assert.NoError(t, result.Err, "case %q: Run returned an error", c.Name))
+	}
+	for _, name := range c.ExpectFired {
+		check(assert.Contains(t, result.Fired, name, "case %q: rule %q did not fire", c.Name, name))
+	}
+	for _, name := range c.ExpectNotFired {
+		check(assert.NotContains(t, result.Fired, name, "case %q: rule %q fired", c.Name, name))
+	}
+	if r := c.ExpectRequeueBetween; r != nil {
+		after := result.Result.RequeueAfter
+		check(assert.True(t, after >= r.Min && after <= r.Max, "case %q: Run requeued after %s, not between %s and %s", c.Name, after, r.Min, r.Max))
+	}
+	for _, expected := range c.ExpectObjects {
+		ok := assert.NoError(t, result.client.Get(context.Background(), expected.Key, expected.Object), "case %q: object %s does not exist", c.Name, expected.Key)
+		check(ok)
+		if ok && expected.Assert != nil {
+			before := t.Failed()
+			expected.Assert(t, expected.Object)
+			check(before || !t.Failed())
+		}
+	}
+	if failed {
+		dump, err := json.MarshalIndent(result.RunReport, "", "  ")
+		if err != nil {
+			dump = []byte(err.Error())
+		}
+		t.Logf("case %q failed; report of the Run:\n%s", c.Name, dump)
+	}
+}
@@ -0,0 +1,106 @@
+package chaintest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain"
+	"github.com/smxlong/operchain/chaintest"
+)
+
+// Test_If_RunTable_Passes_Matching_Cases tests RunTable with cases whose
+// expectations hold.
+func Test_If_RunTable_Passes_Matching_Cases(t *testing.T) {
+	chaintest.RunTable(t, appChain(), []chaintest.Case{
+		{
+			Name:                 "app creates its secret",
+			Objects:              []client.Object{demoApp()},
+			Request:              appKey,
+			ExpectFired:          []string{"create secret", "check again"},
+			ExpectRequeueBetween: &chaintest.RequeueRange{Min: 30 * time.Second, Max: time.Minute},
+			ExpectObjects: []chaintest.ExpectedObject{{
+				Key:    appKey,
+				Object: &corev1.Secret{},
+				Assert: func(t testing.TB, obj client.Object) {
+					assert.Equal(t, "demo", obj.(*corev1.Secret).StringData["app"])
+				},
+			}},
+		},
+		{
+			Name:           "missing app does nothing",
+			Request:        appKey,
+			ExpectNotFired: []string{"create secret", "check again"},
+		},
+		{
+			Name:           "existing secret is kept",
+			Objects:        []client.Object{demoApp()},
+			Request:        appKey,
+			Predicates:     map[string]bool{"Exists(Secret)": true},
+			ExpectFired:    []string{"check again"},
+			ExpectNotFired: []string{"create secret"},
+		},
+	})
+}
+
+// Test_If_RunTable_Matches_Errors tests that ExpectErrorIs matches the error
+// of the Run.
+func Test_If_RunTable_Matches_Errors(t *testing.T) {
+	boom := errors.New("boom")
+	c := &operchain.Chain{}
+	c.InitializeChain(nil, &struct{}{}, []operchain.Rule{{Name: "fail", Do: c.Error(boom)}})
+	chaintest.RunTable(t, c, []chaintest.Case{
+		{Name: "fails", Request: appKey, ExpectFired: []string{"fail"}, ExpectErrorIs: boom},
+	})
+}
+
+// Test_If_RunCase_Reports_Failing_Cases tests that the failures of a case
+// name it, and that its run report is logged for debugging.
+func Test_If_RunCase_Reports_Failing_Cases(t *testing.T) {
+	recorder := &fatalRecorder{TB: t}
+	chaintest.RunCase(recorder, appChain(), chaintest.Case{
+		Name:                 "wrong expectations",
+		Objects:              []client.Object{demoApp()},
+		Request:              appKey,
+		ExpectFired:          []string{"missing rule"},
+		ExpectNotFired:       []string{"create secret"},
+		ExpectRequeueBetween: &chaintest.RequeueRange{Max: time.Second},
+		ExpectErrorIs:        errors.New("never"),
+		ExpectObjects: []chaintest.ExpectedObject{
+			{Key: appKey, Object: &corev1.Pod{}},
+			{Key: appKey, Object: &corev1.Secret{}, Assert: func(t testing.TB, obj client.Object) {
+				t.Errorf("object assertion failed")
+			}},
+		},
+	})
+	for _, expected := range []string{
+		`case "wrong expectations": Run returned the wrong error`,
+		`case "wrong expectations": rule "missing rule" did not fire`,
+		`case "wrong expectations": rule "create secret" fired`,
+		`case "wrong expectations": Run requeued after 1m0s, not between 0s and 1s`,
+		`case "wrong expectations": object default/demo does not exist`,
+		"object assertion failed",
+	} {
+		assert.Contains(t, recorder.errors, expected)
+	}
+	assert.Contains(t, recorder.logs, `case "wrong expectations" failed; report of the Run:`)
+	assert.Contains(t, recorder.logs, `"fired": [`, "run report was not dumped")
+}
+
+// Test_If_RunCase_Logs_Nothing_For_Passing_Cases tests that a passing case
+// does not dump its run report.
+func Test_If_RunCase_Logs_Nothing_For_Passing_Cases(t *testing.T) {
+	recorder := &fatalRecorder{TB: t}
+	chaintest.RunCase(recorder, appChain(), chaintest.Case{
+		Name:        "passes",
+		Objects:     []client.Object{demoApp()},
+		Request:     appKey,
+		ExpectFired: []string{"create secret"},
+	})
+	assert.Empty(t, recorder.errors)
+	assert.Empty(t, recorder.logs)
+}
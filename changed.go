@@ -0,0 +1,87 @@
+package operchain
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// changeDetector holds the options of ChangedSinceLastRun.
+type changeDetector struct {
+	byHash bool
+}
+
+// ChangeOption configures ChangedSinceLastRun.
+type ChangeOption func(o *changeDetector)
+
+// ByContentHash makes ChangedSinceLastRun compare a hash of the object's
+// content instead of its resourceVersion, so that writes which only update its
+// status are not seen as changes. The resourceVersion and managedFields are
+// excluded from the hash, as is the status.
+func ByContentHash() ChangeOption {
+	return func(o *changeDetector) {
+		o.byHash = true
+	}
+}
+
+// ChangedSinceLastRun returns a predicate that is true when the object in the
+// given resource field changed since the last successful Run for the request's
+// object, or when there was no such Run. The object's version is recorded at
+// the end of each Run that returns no error, so a change is seen again by the
+// next Run after a failed one. An object that is not loaded has no version.
+func (c *Chain) ChangedSinceLastRun(fieldPtr interface{}, opts ...ChangeOption) *predicate {
+	checkField(fieldPtr)
+	o := &changeDetector{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	field := c.fieldName(fieldPtr)
+	key := "changed:" + field
+	return c.reactsTo(pcache.NewLeaf(fmt.Sprintf("ChangedSinceLastRun(%s)", field), func(e *pcache.Evaluation) bool {
+		current, err := o.version(objectAt(fieldPtr))
+		if err != nil {
+			e.Notef("cannot hash object: %s", err)
+			return true
+		}
+		last, seen := c.storeGet(key)
+		c.afterSuccess(func() {
+			c.storeSet(key, current)
+		})
+		if !seen {
+			e.Notef("first run")
+			return true
+		}
+		return last != current
+	}), fieldPtr, o.reactsTo()...)
+}
+
+// reactsTo returns the ReactsTo tags of the changes the detector sees besides
+// those of the spec.
+func (o *changeDetector) reactsTo() []string {
+	if o.byHash {
+		return []string{ReactsToAnnotations, ReactsToLabels}
+	}
+	return []string{ReactsToStatus}
+}
+
+// version returns the version of the object to compare between runs.
+func (o *changeDetector) version(obj client.Object) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+	if !o.byHash {
+		return obj.GetResourceVersion(), nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj.DeepCopyObject())
+	if err != nil {
+		return "", err
+	}
+	delete(content, "status")
+	unstructured.RemoveNestedField(content, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(content, "metadata", "managedFields")
+	return HashOf(content)
+}
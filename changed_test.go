@@ -0,0 +1,76 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_ChangedSinceLastRun_Sees_Out_Of_Band_Edits tests that
+// ChangedSinceLastRun is true on the first Run, false on an unchanged Run, true
+// after an edit, and true again after a failed Run.
+func Test_If_ChangedSinceLastRun_Sees_Out_Of_Band_Edits(t *testing.T) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget).WithStatusSubresource(widget).Build()
+	var res struct {
+		Widget *Widget
+	}
+	changed, fail := false, false
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{When: c.ChangedSinceLastRun(&res.Widget), Do: func(context.Context) { changed = true }},
+		{When: Predicate(func() bool { return fail }), Do: c.Error(assert.AnError)},
+	})
+	run := func() bool {
+		changed = false
+		_, _ = c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+		return changed
+	}
+	edit := func() {
+		w := &Widget{}
+		assert.NoError(t, cl.Get(context.Background(), client.ObjectKeyFromObject(widget), w))
+		w.Spec.Size++
+		assert.NoError(t, cl.Update(context.Background(), w))
+	}
+	assert.True(t, run(), "predicate was false on the first run")
+	assert.False(t, run(), "predicate was true for an unchanged object")
+	edit()
+	fail = true
+	assert.True(t, run(), "predicate was false after an edit")
+	fail = false
+	assert.True(t, run(), "change was not seen again after a failed run")
+	assert.False(t, run(), "predicate was true for an unchanged object")
+}
+
+// Test_If_ByContentHash_Ignores_Status_Updates tests that ChangedSinceLastRun
+// with ByContentHash ignores status-only updates.
+func Test_If_ByContentHash_Ignores_Status_Updates(t *testing.T) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget).WithStatusSubresource(widget).Build()
+	var res struct {
+		Widget *Widget
+	}
+	changed := false
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{When: c.ChangedSinceLastRun(&res.Widget, ByContentHash()), Do: func(context.Context) { changed = true }},
+		{Do: func(ctx context.Context) {
+			res.Widget.Status.ObservedGeneration++
+			assert.NoError(t, cl.Status().Update(ctx, res.Widget))
+		}},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.True(t, changed, "predicate was false on the first run")
+	changed = false
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.False(t, changed, "predicate was true after a status update")
+}
@@ -0,0 +1,169 @@
+package operchain
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefaultBreakerCooldown is the cooldown of a CircuitBreaker without one.
+const DefaultBreakerCooldown = 30 * time.Second
+
+// RequeueReasonCircuitOpen is the reason of the requeues of rules skipped by
+// an open CircuitBreaker.
+const RequeueReasonCircuitOpen = "circuit-open"
+
+// SkipReasonCircuitOpen is the reason of a SkippedRule whose CircuitBreaker
+// was open.
+const SkipReasonCircuitOpen = "CircuitOpen"
+
+// CircuitBreaker stops running a rule whose action keeps failing, e.g. because
+// it calls a fragile external dependency, so that it does not slow down the
+// Runs for every object. The breaker is closed at first, letting the rule run.
+// When the rule has made Failures Runs fail within Window, the breaker opens:
+// the rule is skipped, its Run requeued for when the breaker cools down, and
+// the skip recorded in the Run's report. Once Cooldown has elapsed, the
+// breaker is half-open and lets the rule run once, as a probe: the breaker
+// closes if the probe succeeds and opens again if it fails. The rule's
+// predicate is evaluated either way, and Runs in which it is false do not
+// affect the breaker. The state of breakers is kept across runs, but not
+// across restarts of the process.
+type CircuitBreaker struct {
+	// Failures is the number of failures within Window that open the
+	// breaker. If less than 1, 1 is used.
+	Failures int
+	// Window is how long failures count toward opening the breaker. If
+	// zero, they count until the breaker opens.
+	Window time.Duration
+	// Cooldown is how long the breaker stays open before letting a probe
+	// through. If zero, DefaultBreakerCooldown is used.
+	Cooldown time.Duration
+	// PerObject keeps a breaker for each object, tripped only by the Runs
+	// for that object, instead of one for the rule shared by all objects.
+	PerObject bool
+}
+
+// breakerStatus is the state of a circuit breaker.
+type breakerStatus string
+
+// The states of a circuit breaker, as labeled in metrics.
+const (
+	breakerClosed   breakerStatus = "closed"
+	breakerOpen     breakerStatus = "open"
+	breakerHalfOpen breakerStatus = "half-open"
+)
+
+// breaker is the state of a circuit breaker of a rule, for an object or for
+// all objects. It is guarded by the chain's breakerLock.
+type breaker struct {
+	status breakerStatus
+	// failures are the times of the failures that count toward opening the
+	// breaker.
+	failures []time.Time
+	// openedAt is when the breaker last opened.
+	openedAt time.Time
+}
+
+// breakerFor returns the state of the breaker of the current rule, for the
+// current request if cb is PerObject. The breakerLock must be held.
+func (c *Chain) breakerFor(cb *CircuitBreaker) *breaker {
+	key := "breaker:" + c.currentRule()
+	if cb.PerObject {
+		if v, ok := c.storeGet(key); ok {
+			return v.(*breaker)
+		}
+		b := &breaker{status: breakerClosed}
+		c.storeSet(key, b)
+		return b
+	}
+	if c.breakers == nil {
+		c.breakers = map[string]*breaker{}
+	}
+	b, ok := c.breakers[key]
+	if !ok {
+		b = &breaker{status: breakerClosed}
+		c.breakers[key] = b
+	}
+	return b
+}
+
+// breakerAllows returns true if the circuit breaker lets the current rule run,
+// and a function to call with whether its action then made the Run fail. If
+// the breaker is open, it records the rule as skipped and requeues for when the
+// breaker cools down.
+func (c *Chain) breakerAllows(ctx context.Context, cb *CircuitBreaker) (bool, func(failed bool)) {
+	if cb == nil {
+		return true, func(bool) {}
+	}
+	cooldown := cb.Cooldown
+	if cooldown == 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	c.breakerLock.Lock()
+	defer c.breakerLock.Unlock()
+	b := c.breakerFor(cb)
+	now := c.now()
+	if b.status == breakerOpen {
+		if remaining := b.openedAt.Add(cooldown).Sub(now); remaining > 0 {
+			c.ruleSkipped(SkipReasonCircuitOpen)
+			c.doRequeueFor(RequeueReasonCircuitOpen, remaining)
+			return false, nil
+		}
+		c.breakerTransition(ctx, b, breakerHalfOpen)
+	}
+	return true, func(failed bool) {
+		c.breakerLock.Lock()
+		defer c.breakerLock.Unlock()
+		c.breakerDone(ctx, cb, b, failed)
+	}
+}
+
+// breakerDone updates the breaker after the rule ran, failing or not. The
+// breakerLock must be held.
+func (c *Chain) breakerDone(ctx context.Context, cb *CircuitBreaker, b *breaker, failed bool) {
+	now := c.now()
+	switch {
+	case b.status == breakerHalfOpen && failed:
+		b.openedAt = now
+		c.breakerTransition(ctx, b, breakerOpen)
+	case b.status == breakerHalfOpen:
+		b.failures = nil
+		c.breakerTransition(ctx, b, breakerClosed)
+	case failed:
+		if cb.Window > 0 {
+			kept := b.failures[:0]
+			for _, at := range b.failures {
+				if now.Sub(at) < cb.Window {
+					kept = append(kept, at)
+				}
+			}
+			b.failures = kept
+		}
+		b.failures = append(b.failures, now)
+		if len(b.failures) >= max(cb.Failures, 1) {
+			b.failures = nil
+			b.openedAt = now
+			c.breakerTransition(ctx, b, breakerOpen)
+		}
+	}
+}
+
+// breakerTransition changes the status of the breaker of the current rule,
+// logging and counting the transition.
+func (c *Chain) breakerTransition(ctx context.Context, b *breaker, status breakerStatus) {
+	b.status = status
+	log.FromContext(ctx).Info("circuit breaker " + string(status))
+	if c.metrics != nil {
+		c.metrics.breakerTransitions.WithLabelValues(c.Name, c.currentRule(), string(status)).Inc()
+	}
+}
+
+// ruleSkipped records in the report of the Run that the current rule was
+// skipped for the reason.
+func (c *Chain) ruleSkipped(reason string) {
+	rule := c.currentRule()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.skipped = append(c.skipped, SkippedRule{Rule: rule, Reason: reason})
+}
@@ -0,0 +1,116 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// breakerChain returns a chain over two Widgets whose rule "fetch" fails while
+// failing is true, counting its calls, guarded by cb.
+func breakerChain(cb *CircuitBreaker, failing *bool, calls *int) (*Chain, *clocktesting.FakeClock) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}},
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+	}
+	clk := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := &Chain{Name: "widgets", Clock: clk}
+	c.InitializeChain(cl, &res, []Rule{{
+		Name: "fetch",
+		Do: c.Try(func(context.Context) error {
+			*calls++
+			if *failing {
+				return errors.New("unavailable")
+			}
+			return nil
+		}),
+		CircuitBreaker: cb,
+	}}, WithMetrics(prometheus.NewRegistry()))
+	return c, clk
+}
+
+// Test_If_A_Circuit_Breaker_Opens_Probes_And_Closes tests that a breaker
+// shared by all objects opens after failures of the rule for different
+// objects, skips the rule while open, lets a probe through after the
+// cooldown, opens again when the probe fails, and closes when it succeeds.
+func Test_If_A_Circuit_Breaker_Opens_Probes_And_Closes(t *testing.T) {
+	failing, calls := true, 0
+	c, clk := breakerChain(&CircuitBreaker{Failures: 2, Window: time.Minute, Cooldown: time.Minute}, &failing, &calls)
+	a := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "a"}}
+	b := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "b"}}
+	run := func(req ctrl.Request) *RunReport {
+		report, _ := c.RunWithReport(context.Background(), req)
+		return report
+	}
+	run(a)
+	run(b)
+	assert.Equal(t, 2, calls, "the rule did not run while the breaker was closed")
+
+	clk.Step(10 * time.Second)
+	report := run(a)
+	assert.Equal(t, 2, calls, "the rule ran while the breaker was open")
+	assert.NoError(t, report.Err, "the skipped rule failed the Run")
+	assert.Equal(t, []SkippedRule{{Rule: "fetch", Reason: SkipReasonCircuitOpen}}, report.Skipped, "the skip was not reported")
+	assert.Equal(t, 50*time.Second, report.Result.RequeueAfter, "the Run did not requeue for the cooldown")
+	assert.Equal(t, RequeueReasonCircuitOpen, report.RequeueReason, "the requeue reason was wrong")
+
+	clk.Step(time.Minute)
+	report = run(a)
+	assert.Equal(t, 3, calls, "no probe was let through after the cooldown")
+	assert.Error(t, report.Err, "the failed probe did not fail the Run")
+	run(b)
+	assert.Equal(t, 3, calls, "the breaker did not open again after the failed probe")
+
+	clk.Step(time.Minute)
+	failing = false
+	assert.NoError(t, run(b).Err, "the probe failed")
+	assert.NoError(t, run(a).Err, "the rule failed")
+	assert.Equal(t, 5, calls, "the breaker did not close after the probe succeeded")
+
+	m := c.metrics.breakerTransitions
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.WithLabelValues("widgets", "fetch", "open")), "openings were not counted")
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.WithLabelValues("widgets", "fetch", "half-open")), "probes were not counted")
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.WithLabelValues("widgets", "fetch", "closed")), "closing was not counted")
+}
+
+// Test_If_Failures_Outside_The_Window_Do_Not_Open_A_Breaker tests that
+// failures older than the window do not count toward opening the breaker.
+func Test_If_Failures_Outside_The_Window_Do_Not_Open_A_Breaker(t *testing.T) {
+	failing, calls := true, 0
+	c, clk := breakerChain(&CircuitBreaker{Failures: 2, Window: time.Minute}, &failing, &calls)
+	a := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "a"}}
+	for i := 0; i < 3; i++ {
+		_, _ = c.Run(context.Background(), a)
+		clk.Step(2 * time.Minute)
+	}
+	assert.Equal(t, 3, calls, "failures outside the window opened the breaker")
+}
+
+// Test_If_A_Per_Object_Circuit_Breaker_Is_Tripped_By_Its_Object tests that a
+// PerObject breaker opened by the failures for one object does not skip the
+// rule for another.
+func Test_If_A_Per_Object_Circuit_Breaker_Is_Tripped_By_Its_Object(t *testing.T) {
+	failing, calls := true, 0
+	c, _ := breakerChain(&CircuitBreaker{Failures: 2, Cooldown: time.Minute, PerObject: true}, &failing, &calls)
+	a := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "a"}}
+	b := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "b"}}
+	for i := 0; i < 3; i++ {
+		_, _ = c.Run(context.Background(), a)
+	}
+	assert.Equal(t, 2, calls, "the breaker of the object did not open")
+	_, _ = c.Run(context.Background(), b)
+	assert.Equal(t, 3, calls, "the breaker of another object skipped the rule")
+}
@@ -0,0 +1,281 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// conditionView is the subset of a status condition the condition predicates
+// inspect, regardless of the condition's concrete type.
+type conditionView struct {
+	Status string
+	Reason string
+}
+
+// ConditionTrue returns a predicate that is true when the object in the given
+// resource field has a condition of the given type with status True.
+func (c *Chain) ConditionTrue(fieldPtr interface{}, condType string) *predicate {
+	return c.conditionPredicate("ConditionTrue", fieldPtr, condType, func(cond conditionView) bool {
+		return cond.Status == "True"
+	})
+}
+
+// ConditionFalse returns a predicate that is true when the object in the given
+// resource field has a condition of the given type with status False.
+func (c *Chain) ConditionFalse(fieldPtr interface{}, condType string) *predicate {
+	return c.conditionPredicate("ConditionFalse", fieldPtr, condType, func(cond conditionView) bool {
+		return cond.Status == "False"
+	})
+}
+
+// ConditionReason returns a predicate that is true when the object in the given
+// resource field has a condition of the given type with the given reason.
+func (c *Chain) ConditionReason(fieldPtr interface{}, condType, reason string) *predicate {
+	return c.conditionPredicate("ConditionReason", fieldPtr, condType, func(cond conditionView) bool {
+		return cond.Reason == reason
+	})
+}
+
+// conditionPredicate returns a predicate that applies match to the condition of
+// the given type. A missing object or a missing condition evaluates to false,
+// and the trace records which of the two it was.
+func (c *Chain) conditionPredicate(kind string, fieldPtr interface{}, condType string, match func(conditionView) bool) *predicate {
+	checkField(fieldPtr)
+	name := fmt.Sprintf("%s(%s, %s)", kind, c.fieldName(fieldPtr), condType)
+	return c.reactsTo(pcache.NewLeaf(name, func(e *pcache.Evaluation) bool {
+		obj := objectAt(fieldPtr)
+		if obj == nil {
+			e.Notef("object not loaded")
+			return false
+		}
+		cond, ok := findCondition(obj, condType)
+		if !ok {
+			e.Notef("condition %s not found", condType)
+			return false
+		}
+		return match(cond)
+	}), fieldPtr, ReactsToStatus)
+}
+
+// findCondition returns the condition of the given type on obj. It understands
+// unstructured objects and typed objects with a Status.Conditions slice whose
+// elements have string Type, Status, and Reason fields, which covers both
+// metav1.Condition and the older per-API condition types.
+func findCondition(obj client.Object, condType string) (conditionView, bool) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+		for _, item := range conditions {
+			cond, ok := item.(map[string]interface{})
+			if !ok || cond["type"] != condType {
+				continue
+			}
+			status, _ := cond["status"].(string)
+			reason, _ := cond["reason"].(string)
+			return conditionView{Status: status, Reason: reason}, true
+		}
+		return conditionView{}, false
+	}
+	status := statusOf(obj)
+	if !status.IsValid() {
+		return conditionView{}, false
+	}
+	conditions := status.FieldByName("Conditions")
+	if conditions.Kind() != reflect.Slice {
+		return conditionView{}, false
+	}
+	for i := 0; i < conditions.Len(); i++ {
+		cond := reflect.Indirect(conditions.Index(i))
+		if cond.Kind() != reflect.Struct || stringField(cond, "Type") != condType {
+			continue
+		}
+		return conditionView{Status: stringField(cond, "Status"), Reason: stringField(cond, "Reason")}, true
+	}
+	return conditionView{}, false
+}
+
+// stringField returns the value of the named field of v if it is a string kind,
+// or an empty string otherwise.
+func stringField(v reflect.Value, name string) string {
+	field := v.FieldByName(name)
+	if field.Kind() != reflect.String {
+		return ""
+	}
+	return field.String()
+}
+
+// conditionsType is the type of the Status.Conditions field that the condition
+// actions update.
+var conditionsType = reflect.TypeOf([]metav1.Condition(nil))
+
+// updateConditions applies update to the status conditions of the object and
+// reports whether update changed them. The conditions are accessed through
+// ConditionsAccessor if the object implements it, and otherwise found in
+// Status.Conditions, which must be a []metav1.Condition, or in
+// status.conditions for unstructured objects.
+func updateConditions(obj client.Object, update func(conditions *[]metav1.Condition) bool) (bool, error) {
+	if a, ok := obj.(ConditionsAccessor); ok {
+		conditions := a.GetConditions()
+		if !update(&conditions) {
+			return false, nil
+		}
+		a.SetConditions(conditions)
+		return true, nil
+	}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		items, _, err := unstructured.NestedSlice(u.Object, "status", "conditions")
+		if err != nil {
+			return false, err
+		}
+		conditions := make([]metav1.Condition, len(items))
+		for i, item := range items {
+			content, ok := item.(map[string]interface{})
+			if !ok {
+				return false, fmt.Errorf("status.conditions[%d] is not an object", i)
+			}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, &conditions[i]); err != nil {
+				return false, err
+			}
+		}
+		if !update(&conditions) {
+			return false, nil
+		}
+		items = make([]interface{}, len(conditions))
+		for i := range conditions {
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&conditions[i])
+			if err != nil {
+				return false, err
+			}
+			items[i] = content
+		}
+		return true, unstructured.SetNestedSlice(u.Object, items, "status", "conditions")
+	}
+	status := statusOf(obj)
+	conditions := reflect.Value{}
+	if status.IsValid() {
+		conditions = status.FieldByName("Conditions")
+	}
+	if !conditions.IsValid() || conditions.Type() != conditionsType || !conditions.CanSet() {
+		return false, fmt.Errorf("%T has no Status.Conditions of type []metav1.Condition", obj)
+	}
+	return update(conditions.Addr().Interface().(*[]metav1.Condition)), nil
+}
+
+// ConditionsAccessor is implemented by objects that expose their status
+// conditions through methods rather than a Status.Conditions field.
+type ConditionsAccessor interface {
+	GetConditions() []metav1.Condition
+	SetConditions(conditions []metav1.Condition)
+}
+
+// ConditionData is the data available to the templates in the Reason and
+// Message of a condition set by SetCondition.
+type ConditionData struct {
+	// Request is the request the chain is running for.
+	Request ctrl.Request
+	// Rule is the name of the rule being run.
+	Rule string
+	// FalsePredicates are the names of the named predicates evaluated false so
+	// far in the run, sorted.
+	FalsePredicates []string
+}
+
+// SetCondition returns an action that sets a condition on the object in the
+// given resource field, as meta.SetStatusCondition does: the transition time
+// is kept unless the status changes. The condition's ObservedGeneration is set
+// to the object's generation. Its Reason and Message may be text/template
+// templates of ConditionData, e.g. "waiting for {{.FalsePredicates}}". The
+// status is written as configured by the chain's BatchStatus, and not at all
+// if it did not change.
+func (c *Chain) SetCondition(fieldPtr interface{}, condition metav1.Condition) Action {
+	return writes(c.Try(c.setConditionE(fieldPtr, condition)), fieldTarget(fieldPtr, "status/conditions/"+condition.Type))
+}
+
+// setConditionE returns the action of SetCondition, returning the error.
+func (c *Chain) setConditionE(fieldPtr interface{}, condition metav1.Condition) ActionE {
+	checkField(fieldPtr)
+	reason := mustParseTemplate("reason", condition.Reason)
+	message := mustParseTemplate("message", condition.Message)
+	return func(ctx context.Context) error {
+		cond := condition
+		data := c.conditionData()
+		var err error
+		if cond.Reason, err = renderTemplate(reason, data); err != nil {
+			return err
+		}
+		if cond.Message, err = renderTemplate(message, data); err != nil {
+			return err
+		}
+		if cond.LastTransitionTime.IsZero() {
+			cond.LastTransitionTime = metav1.NewTime(c.now())
+		}
+		return c.updateStatusLater(ctx, fieldPtr, func(obj client.Object) error {
+			cond := cond
+			cond.ObservedGeneration = obj.GetGeneration()
+			_, err := updateConditions(obj, func(conditions *[]metav1.Condition) bool {
+				return meta.SetStatusCondition(conditions, cond)
+			})
+			return err
+		})
+	}
+}
+
+// RemoveCondition returns an action that removes the condition of the given
+// type from the object in the given resource field. The status is written as
+// configured by the chain's BatchStatus, and not at all if there was no such
+// condition.
+func (c *Chain) RemoveCondition(fieldPtr interface{}, condType string) Action {
+	checkField(fieldPtr)
+	return writes(c.Try(func(ctx context.Context) error {
+		return c.updateStatusLater(ctx, fieldPtr, func(obj client.Object) error {
+			_, err := updateConditions(obj, func(conditions *[]metav1.Condition) bool {
+				return meta.RemoveStatusCondition(conditions, condType)
+			})
+			return err
+		})
+	}), fieldTarget(fieldPtr, "status/conditions/"+condType))
+}
+
+// conditionData returns the run state available to condition templates.
+func (c *Chain) conditionData() ConditionData {
+	data := ConditionData{Request: c.req, Rule: c.currentRule()}
+	seen := map[string]bool{}
+	for name, value := range c.cache.Snapshot() {
+		// Strip the "#N" that identifies anonymous and duplicate names.
+		if i := strings.LastIndex(name, "#"); i >= 0 {
+			name = name[:i]
+		}
+		if !value && name != "" && !seen[name] {
+			seen[name] = true
+			data.FalsePredicates = append(data.FalsePredicates, name)
+		}
+	}
+	sort.Strings(data.FalsePredicates)
+	return data
+}
+
+// mustParseTemplate parses text as a template, panicking on error.
+func mustParseTemplate(name, text string) *template.Template {
+	return template.Must(template.New(name).Parse(text))
+}
+
+// renderTemplate executes the template with the given data.
+func renderTemplate(t *template.Template, data interface{}) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,200 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Test_If_Condition_Predicates_Read_Deployment_Conditions tests the condition
+// predicates against appsv1.DeploymentCondition.
+func Test_If_Condition_Predicates_Read_Deployment_Conditions(t *testing.T) {
+	var res struct {
+		Deployment *appsv1.Deployment
+	}
+	c := &Chain{Resources: &res}
+	available := c.ConditionTrue(&res.Deployment, "Available")
+	progressing := c.ConditionFalse(&res.Deployment, "Progressing")
+	reason := c.ConditionReason(&res.Deployment, "Progressing", "ProgressDeadlineExceeded")
+	res.Deployment = &appsv1.Deployment{
+		Status: appsv1.DeploymentStatus{
+			Conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+				{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded"},
+			},
+		},
+	}
+	cache := pcache.New()
+	assert.True(t, available.Eval(cache), "Available was not true")
+	assert.True(t, progressing.Eval(cache), "Progressing was not false")
+	assert.True(t, reason.Eval(cache), "Progressing reason did not match")
+}
+
+// Test_If_Condition_Predicates_Read_Metav1_Conditions tests the condition
+// predicates against a custom resource using metav1.Condition.
+func Test_If_Condition_Predicates_Read_Metav1_Conditions(t *testing.T) {
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{Resources: &res}
+	ready := c.ConditionTrue(&res.Widget, "Ready")
+	notReady := c.ConditionFalse(&res.Widget, "Ready")
+	reason := c.ConditionReason(&res.Widget, "Ready", "AllGood")
+	res.Widget = &Widget{
+		Status: WidgetStatus{
+			Conditions: []metav1.Condition{
+				{Type: "Ready", Status: metav1.ConditionTrue, Reason: "AllGood"},
+			},
+		},
+	}
+	cache := pcache.New()
+	assert.True(t, ready.Eval(cache), "Ready was not true")
+	assert.False(t, notReady.Eval(cache), "Ready was false")
+	assert.True(t, reason.Eval(cache), "Ready reason did not match")
+}
+
+// Test_If_Condition_Predicates_Read_Unstructured_Conditions tests the condition
+// predicates against an unstructured object.
+func Test_If_Condition_Predicates_Read_Unstructured_Conditions(t *testing.T) {
+	var res struct {
+		Object *unstructured.Unstructured
+	}
+	c := &Chain{Resources: &res}
+	ready := c.ConditionTrue(&res.Object, "Ready")
+	reason := c.ConditionReason(&res.Object, "Ready", "Waiting")
+	res.Object = &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "False", "reason": "Waiting"},
+			},
+		},
+	}}
+	cache := pcache.New()
+	assert.False(t, ready.Eval(cache), "Ready was true")
+	assert.True(t, reason.Eval(cache), "Ready reason did not match")
+}
+
+// Test_If_Condition_Predicates_Trace_Missing_Object_And_Condition tests that a
+// missing object and a missing condition both evaluate false, with distinct
+// trace notes.
+func Test_If_Condition_Predicates_Trace_Missing_Object_And_Condition(t *testing.T) {
+	var res struct {
+		Missing *Widget
+		Widget  *Widget
+	}
+	c := &Chain{Resources: &res}
+	missingObject := c.ConditionTrue(&res.Missing, "Ready")
+	missingCondition := c.ConditionTrue(&res.Widget, "Ready")
+	res.Widget = &Widget{}
+	cache := pcache.New()
+	cache.EnableTrace()
+	assert.False(t, missingObject.Eval(cache), "missing object was true")
+	assert.False(t, missingCondition.Eval(cache), "missing condition was true")
+	assert.Equal(t, []TraceEntry{
+		{Name: "ConditionTrue(Missing, Ready)", Value: false, Notes: []string{"object not loaded"}},
+		{Name: "ConditionTrue(Widget, Ready)", Value: false, Notes: []string{"condition Ready not found"}},
+	}, cache.Trace(), "trace did not distinguish the missing object and condition")
+}
+
+// conditionChain returns a chain over a stored Widget with the rules built by
+// rules, the client, and a counter of status writes.
+func conditionChain(batch bool, rules func(c *Chain, widget **Widget) []Rule) (*Chain, client.Client, *int) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", Generation: 2}}
+	writes := 0
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget).WithStatusSubresource(widget).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourceUpdate: func(ctx context.Context, cl client.Client, subResource string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+				writes++
+				return cl.SubResource(subResource).Update(ctx, obj, opts...)
+			},
+		}).Build()
+	res := &struct {
+		Widget *Widget
+	}{}
+	c := &Chain{BatchStatus: batch}
+	c.InitializeChain(cl, res, rules(c, &res.Widget))
+	return c, cl, &writes
+}
+
+// Test_If_SetCondition_Preserves_The_Transition_Time tests that SetCondition
+// keeps the transition time while the status is unchanged, renders templates,
+// and sets the observed generation.
+func Test_If_SetCondition_Preserves_The_Transition_Time(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clocktesting.NewFakeClock(start)
+	ready := false
+	c, cl, _ := conditionChain(false, func(c *Chain, widget **Widget) []Rule {
+		dbReady := Named("DatabaseReady", Predicate(func() bool { return ready }))
+		return []Rule{
+			{When: dbReady, Do: c.SetCondition(widget, metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Ready"})},
+			{When: Not(dbReady), Do: c.SetCondition(widget, metav1.Condition{
+				Type:    "Ready",
+				Status:  metav1.ConditionFalse,
+				Reason:  "Waiting",
+				Message: "waiting for {{range .FalsePredicates}}{{.}}{{end}}",
+			})},
+		}
+	})
+	c.Clock = clk
+	stored := func() metav1.Condition {
+		w := &Widget{}
+		assert.NoError(t, cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "demo"}, w))
+		return *meta.FindStatusCondition(w.Status.Conditions, "Ready")
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	cond := stored()
+	assert.Equal(t, "waiting for DatabaseReady", cond.Message, "message was not rendered")
+	assert.Equal(t, int64(2), cond.ObservedGeneration, "observed generation was not set")
+	assert.True(t, cond.LastTransitionTime.Time.Equal(start), "transition time was not set")
+
+	clk.Step(time.Minute)
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.True(t, stored().LastTransitionTime.Time.Equal(start), "transition time changed without a transition")
+
+	ready = true
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.True(t, stored().LastTransitionTime.Time.Equal(start.Add(time.Minute)), "transition time was not updated")
+}
+
+// Test_If_Batched_Conditions_Are_Written_Once tests that batched condition
+// changes are written in a single update at the end of the Run, and not at all
+// when nothing changed.
+func Test_If_Batched_Conditions_Are_Written_Once(t *testing.T) {
+	c, cl, writes := conditionChain(true, func(c *Chain, widget **Widget) []Rule {
+		return []Rule{
+			{Do: c.SetCondition(widget, metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Ready"})},
+			{Do: c.SetCondition(widget, metav1.Condition{Type: "Progressing", Status: metav1.ConditionFalse, Reason: "Done"})},
+			{Do: c.RemoveCondition(widget, "Degraded")},
+			{Do: c.Error(assert.AnError)},
+		}
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, err := c.Run(context.Background(), req)
+	assert.Equal(t, assert.AnError, err, "Run did not return the rule's error")
+	assert.Equal(t, 1, *writes, "batched conditions were not written once")
+	w := &Widget{}
+	assert.NoError(t, cl.Get(context.Background(), req.NamespacedName, w))
+	assert.Len(t, w.Status.Conditions, 2, "conditions were not written")
+
+	_, _ = c.Run(context.Background(), req)
+	assert.Equal(t, 1, *writes, "unchanged conditions were written")
+}
@@ -0,0 +1,89 @@
+package operchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PropagateConfigHash returns an action that annotates the pod template of the
+// workload in the given resource field, e.g. a Deployment or StatefulSet, with
+// a hash of the data of the given source resource fields, e.g. ConfigMaps and
+// Secrets, so that its pods are replaced when their configuration changes. The
+// hash covers data, binaryData, and stringData, in the order of the sources;
+// a source that is not loaded contributes nothing. The workload is patched
+// only if the annotation differs, and the action does nothing if the workload
+// is not loaded.
+func (c *Chain) PropagateConfigHash(workloadFieldPtr interface{}, annotationKey string, sources ...interface{}) Action {
+	return writes(c.Try(c.PropagateConfigHashE(workloadFieldPtr, annotationKey, sources...)), fieldTarget(workloadFieldPtr, "spec/template/metadata/annotations/"+annotationKey))
+}
+
+// PropagateConfigHashE is like PropagateConfigHash, but returns the error.
+func (c *Chain) PropagateConfigHashE(workloadFieldPtr interface{}, annotationKey string, sources ...interface{}) ActionE {
+	checkField(workloadFieldPtr)
+	for _, source := range sources {
+		checkField(source)
+	}
+	return func(ctx context.Context) error {
+		workload := objectAt(workloadFieldPtr)
+		if workload == nil {
+			return nil
+		}
+		hash, err := configHash(sources)
+		if err != nil {
+			return err
+		}
+		content, err := contentOf(workload)
+		if err != nil {
+			return err
+		}
+		if _, found, _ := unstructured.NestedMap(content, "spec", "template"); !found {
+			return fmt.Errorf("%s/%s has no pod template", workload.GetNamespace(), workload.GetName())
+		}
+		current, _, _ := unstructured.NestedString(content, "spec", "template", "metadata", "annotations", annotationKey)
+		if current == hash {
+			return nil
+		}
+		data, err := json.Marshal(map[string]interface{}{
+			"spec": map[string]interface{}{"template": map[string]interface{}{"metadata": map[string]interface{}{
+				"annotations": map[string]interface{}{annotationKey: hash},
+			}}},
+		})
+		if err != nil {
+			return err
+		}
+		if err := c.sendPatch(ctx, workload, workload.DeepCopyObject().(client.Object), client.RawPatch(types.MergePatchType, data)); err != nil {
+			return err
+		}
+		c.invalidateRun()
+		return nil
+	}
+}
+
+// configHash returns the hash of the data of the objects in the given resource
+// fields.
+func configHash(sources []interface{}) (string, error) {
+	data := make([]interface{}, len(sources))
+	for i, source := range sources {
+		obj := objectAt(source)
+		if obj == nil {
+			continue
+		}
+		content, err := contentOf(obj)
+		if err != nil {
+			return "", err
+		}
+		fields := map[string]interface{}{}
+		for _, k := range []string{"data", "binaryData", "stringData"} {
+			if v, ok := content[k]; ok {
+				fields[k] = v
+			}
+		}
+		data[i] = fields
+	}
+	return HashOf(data)
+}
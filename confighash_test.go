@@ -0,0 +1,64 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// Test_If_PropagateConfigHash_Writes_Only_On_Change tests that the config hash
+// annotation of a pod template is written once, left alone while the sources
+// are unchanged, and updated once when a Secret changes.
+func Test_If_PropagateConfigHash_Writes_Only_On_Change(t *testing.T) {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}, Data: map[string][]byte{"password": []byte("a")}}
+	patches := 0
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}, Data: map[string]string{"key": "value"}},
+		secret,
+	).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			patches++
+			return cl.Patch(ctx, obj, patch, opts...)
+		},
+	}).Build()
+	var res struct {
+		StatefulSet *appsv1.StatefulSet
+		ConfigMap   *corev1.ConfigMap
+		Secret      *corev1.Secret
+		Missing     *corev1.ServiceAccount
+	}
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: c.PropagateConfigHash(&res.StatefulSet, "example.com/config-hash", &res.ConfigMap, &res.Secret, &res.Missing)},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	hash := func() string {
+		sts := &appsv1.StatefulSet{}
+		assert.NoError(t, cl.Get(context.Background(), req.NamespacedName, sts))
+		return sts.Spec.Template.Annotations["example.com/config-hash"]
+	}
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	first := hash()
+	assert.NotEmpty(t, first, "hash was not written")
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 1, patches, "unchanged hash was written")
+
+	secret.Data["password"] = []byte("b")
+	assert.NoError(t, cl.Update(context.Background(), secret))
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 2, patches, "changed hash was not written once")
+	assert.NotEqual(t, first, hash(), "hash did not change")
+}
@@ -0,0 +1,384 @@
+package operchain
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Target is an object, or a part of an object, that an action writes, as
+// declared by the action helpers of the chain, such as Ensure or SetCondition.
+type Target struct {
+	// Field is the name of the resource field holding the object, if the
+	// action was given a field pointer.
+	Field string `json:"field,omitempty"`
+	// Kind is the kind of the object, or the name of its Go type.
+	Kind string `json:"kind"`
+	// Namespace is the namespace of the object, if known.
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the name of the object, or a pattern of names as path.Match
+	// matches them, if known.
+	Name string `json:"name,omitempty"`
+	// Part is the part of the object written, as a slash-separated path such
+	// as "status/conditions/Ready" or "metadata/labels/app", or empty if the
+	// action writes the whole object.
+	Part string `json:"part,omitempty"`
+}
+
+// String returns the target as its field or kind and name, followed by its
+// part, e.g. "Deployment spec/replicas" or "ConfigMap default/app-config".
+func (t Target) String() string {
+	s := t.Field
+	if s == "" {
+		s = t.Kind
+		if t.Name != "" {
+			s += " " + strings.TrimPrefix(t.Namespace+"/"+t.Name, "/")
+		}
+	}
+	if t.Part != "" {
+		s += " " + t.Part
+	}
+	return s
+}
+
+// sameObject returns true if the targets may be the same object: the same
+// resource field, or objects of the same kind whose namespaces and names may
+// be equal. An object given by a field pointer has no known name, so it may
+// be any object of its kind.
+func (t Target) sameObject(o Target) bool {
+	if t.Field != "" && o.Field != "" {
+		return t.Field == o.Field
+	}
+	return t.Kind == o.Kind && patternsOverlap(t.Namespace, o.Namespace) && patternsOverlap(t.Name, o.Name)
+}
+
+// overlaps returns true if the targets may write the same part of the same
+// object. A write of the whole object, as Ensure makes, covers its spec,
+// labels and annotations, but neither its status, which is a subresource, nor
+// its owner references, which comparators such as SemanticDiff ignore.
+func (t Target) overlaps(o Target) bool {
+	if !t.sameObject(o) {
+		return false
+	}
+	a, b := t.Part, o.Part
+	if a == "" && b == "" {
+		return true
+	}
+	if a == "" || b == "" {
+		part := a + b
+		return !pathUnder(part, "status") && !pathUnder(part, "metadata/ownerReferences")
+	}
+	return pathUnder(a, b) || pathUnder(b, a)
+}
+
+// pathUnder returns true if p is parent or a path below it.
+func pathUnder(p, parent string) bool {
+	return p == parent || strings.HasPrefix(p, parent+"/")
+}
+
+// patternsOverlap returns true if the names or patterns of names may be
+// equal. An empty pattern matches any name.
+func patternsOverlap(a, b string) bool {
+	if a == "" || b == "" || a == b {
+		return true
+	}
+	ab, _ := path.Match(a, b)
+	ba, _ := path.Match(b, a)
+	return ab || ba
+}
+
+// target is a Target as declared when the action is built, before the
+// resources of the chain are known.
+type target struct {
+	// field is the resource field pointer given to the action, if any.
+	field interface{}
+	// obj is the object given to the action, if any.
+	obj client.Object
+	// kind is the kind of the object, if neither field nor obj is known.
+	kind string
+	part string
+}
+
+// resolve returns the Target of the chain's action.
+func (t target) resolve(c *Chain) Target {
+	switch {
+	case t.field != nil:
+		return Target{Field: c.fieldName(t.field), Kind: typeName(reflect.TypeOf(t.field)), Part: t.part}
+	case t.obj != nil:
+		kind := t.obj.GetObjectKind().GroupVersionKind().Kind
+		if kind == "" {
+			kind = typeName(reflect.TypeOf(t.obj))
+		}
+		return Target{Kind: kind, Namespace: t.obj.GetNamespace(), Name: t.obj.GetName(), Part: t.part}
+	}
+	return Target{Kind: t.kind, Part: t.part}
+}
+
+// typeName returns the name of the type, or of the type its pointers and
+// slices lead to.
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// fieldTarget returns the target of an action writing the part of the object
+// in the resource field.
+func fieldTarget(fieldPtr interface{}, part string) target {
+	return target{field: fieldPtr, part: part}
+}
+
+// kindTarget returns the target of an action writing objects of the type of
+// the resource field, whose names are not known when it is built.
+func kindTarget(fieldPtr interface{}) target {
+	return target{kind: typeName(reflect.TypeOf(fieldPtr))}
+}
+
+// objectOrFieldTarget returns the target of an action writing the part of an
+// object given either as a client.Object or as a resource field pointer.
+func objectOrFieldTarget(obj interface{}, part string) target {
+	if o, ok := obj.(client.Object); ok {
+		return target{obj: o, part: part}
+	}
+	return fieldTarget(obj, part)
+}
+
+// declaredTargets holds the targets declared for actions, by the address of
+// their closures. Holding the address keeps the closure alive, so that it is
+// never reused by another action.
+var declaredTargets = struct {
+	lock    sync.Mutex
+	targets map[unsafe.Pointer][]target
+}{targets: map[unsafe.Pointer][]target{}}
+
+// actionID returns the address of the closure of the action, which identifies
+// it, since Go functions are not comparable.
+func actionID(fn Action) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&fn))
+}
+
+// writes declares that fn writes the targets, and returns it.
+func writes(fn Action, targets ...target) Action {
+	if len(targets) == 0 {
+		return fn
+	}
+	declaredTargets.lock.Lock()
+	defer declaredTargets.lock.Unlock()
+	id := actionID(fn)
+	declaredTargets.targets[id] = append(declaredTargets.targets[id], targets...)
+	return fn
+}
+
+// writesOf declares that fn writes the targets of the actions it runs, and
+// returns it, for combinators such as Sequential.
+func writesOf(fn Action, actions ...Action) Action {
+	var targets []target
+	for _, action := range actions {
+		targets = append(targets, targetsOf(action)...)
+	}
+	return writes(fn, targets...)
+}
+
+// targetsOf returns the targets declared for the action.
+func targetsOf(fn Action) []target {
+	if fn == nil {
+		return nil
+	}
+	declaredTargets.lock.Lock()
+	defer declaredTargets.lock.Unlock()
+	return declaredTargets.targets[actionID(fn)]
+}
+
+// Targets returns the objects the action of the rule writes, as declared by
+// the action helpers it is built from, in the terms of the chain's resource
+// fields. Actions written by hand declare nothing.
+func (c *Chain) Targets(rule Rule) []Target {
+	var targets []Target
+	for _, t := range targetsOf(rule.Do) {
+		targets = append(targets, t.resolve(c))
+	}
+	return targets
+}
+
+// Conflict is a pair of rules that may both fire in a Run and write the same
+// part of the same object, e.g. two rules updating a Deployment to different
+// desired states, which flap with every Run.
+type Conflict struct {
+	// Rules are the names of the rules, in the order they run.
+	Rules [2]string `json:"rules"`
+	// Targets are the overlapping targets of the rules.
+	Targets [2]Target `json:"targets"`
+	// Explanation says why the rules may conflict.
+	Explanation string `json:"explanation"`
+}
+
+// String returns the explanation of the conflict.
+func (c Conflict) String() string {
+	return c.Explanation
+}
+
+// AnalyzeConflicts returns the pairs of the chain's rules that write the same
+// part of the same object and whose predicates are not mutually exclusive by
+// construction, among Rules and Finally and among each of the VersionedRules
+// and Finally. Predicates are mutually exclusive by construction when one
+// requires a predicate that the other requires to be false, as with p and
+// Not(p), or And(p, q) and And(Not(p), r), or when the rules share an
+// ExclusiveGroup or are restricted to disjoint Kinds. The analysis knows only
+// the targets declared by the action helpers, and two writes of the same
+// field may be intended, so its results are warnings to review, not errors.
+func (c *Chain) AnalyzeConflicts() []Conflict {
+	type namedRule struct {
+		name string
+		rule Rule
+	}
+	named := func(rules []Rule, prefix string) []namedRule {
+		var named []namedRule
+		for i, rule := range rules {
+			name := rule.Name
+			if name == "" {
+				name = prefix + " " + strconv.Itoa(i)
+			}
+			named = append(named, namedRule{name: name, rule: rule})
+		}
+		return named
+	}
+	finally := named(c.Finally, "finally rule")
+	sets := [][]namedRule{append(named(c.Rules, "rule"), finally...)}
+	versions := make([]string, 0, len(c.VersionedRules))
+	for version := range c.VersionedRules {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	for _, version := range versions {
+		sets = append(sets, append(named(c.VersionedRules[version], "rule"), finally...))
+	}
+	var conflicts []Conflict
+	seen := map[string]bool{}
+	for _, set := range sets {
+		for i, a := range set {
+			for _, b := range set[i+1:] {
+				conflict, ok := c.conflictBetween(a.name, a.rule, b.name, b.rule)
+				if !ok || seen[conflict.Explanation] {
+					continue
+				}
+				seen[conflict.Explanation] = true
+				conflicts = append(conflicts, conflict)
+			}
+		}
+	}
+	return conflicts
+}
+
+// conflictBetween returns the conflict between the rules, if they write an
+// overlapping target and may both fire.
+func (c *Chain) conflictBetween(aName string, a Rule, bName string, b Rule) (Conflict, bool) {
+	if aName == bName || exclusiveRules(a, b) {
+		return Conflict{}, false
+	}
+	for _, at := range c.Targets(a) {
+		for _, bt := range c.Targets(b) {
+			if !at.overlaps(bt) {
+				continue
+			}
+			return Conflict{
+				Rules:   [2]string{aName, bName},
+				Targets: [2]Target{at, bt},
+				Explanation: fmt.Sprintf("rules %q and %q may both fire, as %s and %s are not mutually exclusive, and both write %s",
+					aName, bName, predicateText(a.When), predicateText(b.When), describeOverlap(at, bt)),
+			}, true
+		}
+	}
+	return Conflict{}, false
+}
+
+// describeOverlap describes the overlapping targets.
+func describeOverlap(a, b Target) string {
+	if a == b {
+		return a.String()
+	}
+	return a.String() + " and " + b.String()
+}
+
+// predicateText describes the predicate of a rule for a Conflict.
+func predicateText(p *predicate) string {
+	if p == nil {
+		return "always"
+	}
+	return describePredicate(p).String()
+}
+
+// exclusiveRules returns true if the rules cannot both fire in a Run, by
+// construction.
+func exclusiveRules(a, b Rule) bool {
+	if a.ExclusiveGroup != "" && a.ExclusiveGroup == b.ExclusiveGroup {
+		return true
+	}
+	if len(a.Kinds) > 0 && len(b.Kinds) > 0 && !kindsIntersect(a.Kinds, b.Kinds) {
+		return true
+	}
+	if a.When == nil || b.When == nil {
+		return false
+	}
+	required := requiredLiterals(a.When)
+	for literal, value := range requiredLiterals(b.When) {
+		if other, ok := required[literal]; ok && other != value {
+			return true
+		}
+	}
+	return false
+}
+
+// kindsIntersect returns true if the lists of kinds share a kind.
+func kindsIntersect(a, b []string) bool {
+	for _, kind := range a {
+		for _, other := range b {
+			if kind == other {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requiredLiterals returns the predicates that must have the given values for
+// p to be true, following And, Or and Not: e.g. for And(p, Not(Or(q, r))), p
+// must be true and q and r false. Predicates are identified by their
+// description, or by their address if they are anonymous.
+func requiredLiterals(p *predicate) map[string]bool {
+	literals := map[string]bool{}
+	var walk func(p *predicate, value bool)
+	walk = func(p *predicate, value bool) {
+		if p.Name() == "" {
+			switch op := p.Op(); {
+			case op == "Not":
+				walk(p.Children()[0], !value)
+				return
+			case op == "And" && value, op == "Or" && !value:
+				for _, child := range p.Children() {
+					walk(child, value)
+				}
+				return
+			}
+		}
+		literals[literalID(p)] = value
+	}
+	walk(p, true)
+	return literals
+}
+
+// literalID identifies the predicate in requiredLiterals.
+func literalID(p *predicate) string {
+	d := describePredicate(p).String()
+	if strings.Contains(d, "(anonymous)") {
+		return fmt.Sprintf("%p", p)
+	}
+	return d
+}
@@ -0,0 +1,103 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// conflictResources are the resources of the chains of the conflict tests.
+type conflictResources struct {
+	Widget     *Widget
+	Deployment *appsv1.Deployment
+	ConfigMap  *corev1.ConfigMap
+}
+
+// desiredDeployment is the generate function of the Ensure of the conflict
+// tests.
+func desiredDeployment() (client.Object, error) {
+	return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}, nil
+}
+
+// Test_If_AnalyzeConflicts_Reports_Rules_Writing_The_Same_Object tests that
+// rules that may both fire and write the same part of an object are reported,
+// through combinators, and that writes of different parts are not.
+func Test_If_AnalyzeConflicts_Reports_Rules_Writing_The_Same_Object(t *testing.T) {
+	var res conflictResources
+	c := &Chain{}
+	c.InitializeChain(nil, &res, []Rule{
+		{Name: "ensure", When: c.Exists(&res.Widget), Do: c.Ensure(&res.Deployment, desiredDeployment)},
+		{Name: "scale down", When: Named("idle", False()), Do: Sequential(
+			c.LogInfo("scaling down"),
+			c.Scale(&res.Deployment, func() int32 { return 0 }),
+		)},
+		{Name: "ready", Do: c.SetCondition(&res.Widget, metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Ok"})},
+		{Name: "degraded", Do: c.SetCondition(&res.Widget, metav1.Condition{Type: "Degraded", Status: metav1.ConditionFalse, Reason: "Ok"})},
+		{Name: "own", Do: c.SetControllerReference(&res.Deployment)},
+	})
+	conflicts := c.AnalyzeConflicts()
+	if assert.Len(t, conflicts, 1, "conflicts: %v", conflicts) {
+		assert.Equal(t, [2]string{"ensure", "scale down"}, conflicts[0].Rules)
+		assert.Equal(t, [2]Target{
+			{Field: "Deployment", Kind: "Deployment"},
+			{Field: "Deployment", Kind: "Deployment", Part: "spec/replicas"},
+		}, conflicts[0].Targets)
+		assert.Equal(t, `rules "ensure" and "scale down" may both fire, as Exists(Widget) and idle are not mutually exclusive, and both write Deployment and Deployment spec/replicas`, conflicts[0].String())
+	}
+	rules := c.Describe().Rules
+	assert.Equal(t, []string{"Deployment spec/replicas"}, rules[1].Targets)
+	assert.Equal(t, []string{"Widget status/conditions/Ready"}, rules[2].Targets)
+}
+
+// Test_If_AnalyzeConflicts_Accepts_Exclusive_Rules tests that rules writing
+// the same object are not reported when they cannot both fire by
+// construction.
+func Test_If_AnalyzeConflicts_Accepts_Exclusive_Rules(t *testing.T) {
+	var res conflictResources
+	c := &Chain{}
+	paused, idle := Named("paused", False()), Named("idle", False())
+	web := metav1.ObjectMeta{Name: "web", Namespace: "default"}
+	c.InitializeChain(nil, &res, []Rule{
+		{Name: "ensure", When: And(c.Exists(&res.Widget), Not(paused)), Do: c.Ensure(&res.Deployment, desiredDeployment)},
+		{Name: "scale down", When: paused, Do: c.Scale(&res.Deployment, func() int32 { return 0 })},
+		{Name: "label blue", ExclusiveGroup: "color", Do: c.SetLabel(&res.ConfigMap, "color", "blue")},
+		{Name: "label green", ExclusiveGroup: "color", Do: c.SetLabel(&res.ConfigMap, "color", "green")},
+		{Name: "widget secret", Kinds: []string{"Widget"}, Do: c.Apply(&corev1.Secret{ObjectMeta: web})},
+		{Name: "gadget secret", Kinds: []string{"Gadget"}, Do: c.Apply(&corev1.Secret{ObjectMeta: web})},
+		{Name: "expose", When: Not(Or(paused, idle)), Do: c.Apply(&corev1.Service{ObjectMeta: web})},
+		{Name: "unexpose", When: idle, Do: c.DeleteResource(&corev1.Service{ObjectMeta: web})},
+	})
+	c.Finally = []Rule{
+		{Name: "resume", When: paused, Do: c.RemoveAnnotation(&res.Deployment, "paused")},
+	}
+	assert.Empty(t, c.AnalyzeConflicts())
+}
+
+// Test_If_ExclusiveGroup_Fires_One_Rule tests that once a rule of an
+// exclusive group fires, the later rules of the group are skipped without
+// evaluating their predicates, while rules of other groups still fire.
+func Test_If_ExclusiveGroup_Fires_One_Rule(t *testing.T) {
+	var fired []string
+	evaluated := false
+	fire := func(name string) Action {
+		return func(context.Context) { fired = append(fired, name) }
+	}
+	c := &Chain{}
+	c.InitializeChain(nil, &struct{}{}, []Rule{
+		{Name: "first", ExclusiveGroup: "g", When: False(), Do: fire("first")},
+		{Name: "second", ExclusiveGroup: "g", Do: fire("second")},
+		{Name: "third", ExclusiveGroup: "g", When: Predicate(func() bool { evaluated = true; return true }), Do: fire("third")},
+		{Name: "other", ExclusiveGroup: "h", Do: fire("other")},
+	})
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"second", "other"}, fired)
+	assert.False(t, evaluated, "predicate of a skipped rule was evaluated")
+}
@@ -0,0 +1,184 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	ctrlpredicate "sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ControllerOptions configures the controller registered by SetupWithManager.
+type ControllerOptions struct {
+	// Name is the name of the controller. If empty, the chain's Name is used,
+	// or else the lowercased kind of the primary resource.
+	Name string
+	// MaxConcurrentReconciles is the number of reconciles the controller
+	// starts concurrently. It has no effect today, as a chain reconciles one
+	// object at a time (see Chain.Reconcile), so SetupWithManager rejects
+	// more than 1. If zero, 1 is used.
+	MaxConcurrentReconciles int
+	// RateLimiter limits how often requests are requeued. If nil, the
+	// controller's default is used.
+	RateLimiter workqueue.RateLimiter
+	// Predicates filter the events of every watch of the controller.
+	Predicates []ctrlpredicate.Predicate
+	// WatchPredicates, if not nil, returns the predicates that filter the
+	// events of the watch of the type of obj, an empty object, in addition to
+	// Predicates. Set it to the chain's RecommendedWatchPredicates to filter
+	// out the events the chain does not react to.
+	WatchPredicates func(obj client.Object) []ctrlpredicate.Predicate
+}
+
+// SetupWithManager validates the chain, wires it to the manager as
+// InitializeFromManager does for the fields that are not set yet, records its
+// metrics with controller-runtime's metrics.Registry unless WithMetrics was
+// given, and registers a controller running it. The controller watches the
+// primary resource, the objects of the other resource fields, which are loaded
+// by the request's name, and the objects of the resource slice fields that the
+// primary resource controls. The controller needs leader election as the
+// chain's LeaderPolicy says. It returns the controller, e.g. to add watches.
+//
+// For a chain serving several kinds, it registers a controller for each
+// kind, named after the kind, whose Runs are for that kind, as set by
+// WithKind, and returns the one of the first. The Runs of the controllers
+// are serialized, as they share the chain. The objects of the other resource
+// fields trigger the controllers of the kinds with an object of their name.
+func (c *Chain) SetupWithManager(mgr manager.Manager, opts ControllerOptions) (controller.Controller, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.MaxConcurrentReconciles > 1 {
+		return nil, fmt.Errorf("setup with manager: MaxConcurrentReconciles is %d, but a chain reconciles one object at a time", opts.MaxConcurrentReconciles)
+	}
+	primaryField := c.primaryField()
+	if !primaryField.IsValid() {
+		return nil, errors.New("setup with manager: chain has no primary resource")
+	}
+	if c.Client == nil {
+		c.Client = mgr.GetClient()
+	}
+	if c.Recorder == nil {
+		c.Recorder = mgr.GetEventRecorderFor(c.controllerName(mgr, opts))
+	}
+	if c.LeaderCheck == nil {
+		c.LeaderCheck = ElectedLeader(mgr)
+	}
+	if c.Log.GetSink() == nil {
+		c.useManagerLogger(mgr)
+	}
+	if c.APIReader == nil {
+		c.APIReader = mgr.GetAPIReader()
+	}
+	if c.metrics == nil {
+		c.metrics = newChainMetrics(metrics.Registry)
+	}
+	res, fields := c.primaryFields()
+	if len(fields) == 1 {
+		return c.buildController(mgr, opts, c.controllerName(mgr, opts), c, primaryField, sameName)
+	}
+	var first controller.Controller
+	for _, i := range fields {
+		kind, err := c.fieldKind(res.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("setup with manager: %w", err)
+		}
+		name := strings.ToLower(kind)
+		if base := c.baseControllerName(opts); base != "" {
+			name = base + "-" + name
+		}
+		ctl, err := c.buildController(mgr, opts, name, kindReconciler{chain: c, kind: kind}, res.Field(i), sameNameIfExists(mgr.GetClient(), res.Field(i)))
+		if err != nil {
+			return nil, err
+		}
+		if first == nil {
+			first = ctl
+		}
+	}
+	return first, nil
+}
+
+// buildController registers a controller with the given name for the primary
+// resource field, reconciling with r, and mapping the objects of the other
+// resource fields, loaded by the request's name, to requests with mapFunc.
+func (c *Chain) buildController(mgr manager.Manager, opts ControllerOptions, name string, r reconcile.Reconciler, primaryField reflect.Value, mapFunc handler.MapFunc) (controller.Controller, error) {
+	primary := reflect.New(primaryField.Type().Elem()).Interface().(client.Object)
+	b := builder.ControllerManagedBy(mgr).
+		Named(name).
+		For(primary, opts.watchPredicates(primary)).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: opts.MaxConcurrentReconciles,
+			RateLimiter:             opts.RateLimiter,
+			NeedLeaderElection:      c.LeaderPolicy.needLeaderElection(),
+		}).
+		WithEventFilter(ctrlpredicate.And(opts.Predicates...))
+	res, primaries := c.primaryFields()
+	for i := 0; i < res.NumField(); i++ {
+		field := res.Field(i)
+		if !field.CanSet() || slices.Contains(primaries, i) {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.Ptr:
+			obj := reflect.New(field.Type().Elem()).Interface().(client.Object)
+			b = b.Watches(obj, handler.EnqueueRequestsFromMapFunc(mapFunc), opts.watchPredicates(obj))
+		case reflect.Slice:
+			elem := field.Type().Elem()
+			if elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+			obj := reflect.New(elem).Interface().(client.Object)
+			b = b.Owns(obj, opts.watchPredicates(obj))
+		}
+	}
+	return b.Build(r)
+}
+
+// watchPredicates returns the builder option adding the WatchPredicates of
+// the type of obj to its watch.
+func (opts ControllerOptions) watchPredicates(obj client.Object) builder.Predicates {
+	if opts.WatchPredicates == nil {
+		return builder.WithPredicates()
+	}
+	return builder.WithPredicates(opts.WatchPredicates(obj)...)
+}
+
+// controllerName returns the name of the controller registered by
+// SetupWithManager.
+func (c *Chain) controllerName(mgr manager.Manager, opts ControllerOptions) string {
+	if base := c.baseControllerName(opts); base != "" {
+		return base
+	}
+	primary := reflect.New(c.primaryField().Type().Elem()).Interface().(client.Object)
+	if gvk, err := apiutil.GVKForObject(primary, mgr.GetScheme()); err == nil {
+		return strings.ToLower(gvk.Kind)
+	}
+	return "operchain"
+}
+
+// baseControllerName returns the name given to the controller registered by
+// SetupWithManager, if any: the Name of the options, or else the chain's.
+func (c *Chain) baseControllerName(opts ControllerOptions) string {
+	if opts.Name != "" {
+		return opts.Name
+	}
+	return c.Name
+}
+
+// sameName maps an object to the request of the same name.
+func sameName(ctx context.Context, obj client.Object) []ctrl.Request {
+	return []ctrl.Request{{NamespacedName: client.ObjectKeyFromObject(obj)}}
+}
@@ -0,0 +1,122 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// newTestManager returns a manager for an API server that is never contacted.
+func newTestManager(t *testing.T) ctrl.Manager {
+	mgr, err := ctrl.NewManager(&rest.Config{Host: "https://127.0.0.1:1"}, ctrl.Options{
+		Scheme:  newTestScheme(),
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	if err != nil {
+		t.Fatalf("cannot create manager: %s", err)
+	}
+	return mgr
+}
+
+// Test_If_SetupWithManager_Registers_The_Chain tests that SetupWithManager
+// wires the chain to the manager and returns the registered controller.
+func Test_If_SetupWithManager_Registers_The_Chain(t *testing.T) {
+	mgr := newTestManager(t)
+	var res struct {
+		Widget     *Widget
+		Secret     *corev1.Secret
+		ConfigMaps []corev1.ConfigMap
+	}
+	c := &Chain{Resources: &res}
+	ctl, err := c.SetupWithManager(mgr, ControllerOptions{MaxConcurrentReconciles: 1})
+	assert.NoError(t, err, "SetupWithManager failed")
+	assert.NotNil(t, ctl, "controller was not returned")
+	assert.NotNil(t, c.Client, "client was not set")
+	assert.NotNil(t, c.Recorder, "recorder was not set")
+	assert.NotNil(t, c.LeaderCheck, "leader check was not set")
+	assert.NotNil(t, c.Log.GetSink(), "logger was not set")
+}
+
+// Test_If_SetupWithManager_Rejects_Concurrent_Reconciles tests that
+// SetupWithManager fails for more than one concurrent reconcile, which a
+// chain cannot do, before wiring the chain.
+func Test_If_SetupWithManager_Rejects_Concurrent_Reconciles(t *testing.T) {
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{Resources: &res}
+	_, err := c.SetupWithManager(newTestManager(t), ControllerOptions{MaxConcurrentReconciles: 2})
+	assert.EqualError(t, err, "setup with manager: MaxConcurrentReconciles is 2, but a chain reconciles one object at a time", "concurrent reconciles were accepted")
+	assert.Nil(t, c.Client, "chain was wired")
+}
+
+// Test_If_SetupWithManager_Validates_The_Chain tests that SetupWithManager
+// fails for a chain that does not validate, before registering it.
+func Test_If_SetupWithManager_Validates_The_Chain(t *testing.T) {
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{Resources: &res}
+	c.invalid = append(c.invalid, errors.New("broken template"))
+	_, err := c.SetupWithManager(newTestManager(t), ControllerOptions{Name: "widgets"})
+	assert.EqualError(t, err, "broken template", "invalid chain was set up")
+	assert.Nil(t, c.Client, "invalid chain was wired")
+}
+
+// Test_If_InitializeFromManager_Wires_The_Chain tests that InitializeFromManager
+// populates the chain's fields from the manager.
+func Test_If_InitializeFromManager_Wires_The_Chain(t *testing.T) {
+	mgr := newTestManager(t)
+	var res struct {
+		Widget *Widget
+	}
+	rules := []Rule{{Do: func(context.Context) {}}}
+	c := &Chain{Name: "widgets"}
+	c.InitializeFromManager(mgr, &res, rules, WithPauseSupport("example.com/paused"))
+	assert.Equal(t, mgr.GetClient(), c.Client, "client was not set")
+	assert.Equal(t, mgr.GetScheme(), c.Scheme(), "scheme was not set")
+	assert.Equal(t, mgr.GetAPIReader(), c.APIReader, "API reader was not set")
+	assert.NotNil(t, c.Log.GetSink(), "logger was not set")
+	assert.NotNil(t, c.Recorder, "recorder was not set")
+	assert.NotNil(t, c.LeaderCheck, "leader check was not set")
+	assert.Same(t, &res, c.Resources, "resources were not set")
+	assert.Len(t, c.Rules, 3, "rules and the rules of options were not set")
+	assert.Panics(t, func() { (&Chain{}).InitializeFromManager(mgr, &res, rules) }, "chain without a name was initialized")
+}
+
+// Test_If_InitializeFromManager_Names_The_Logger tests that the logger of a
+// chain initialized from a manager is named after the chain, once, also in
+// its Runs.
+func Test_If_InitializeFromManager_Names_The_Logger(t *testing.T) {
+	var lines []string
+	mgr, err := ctrl.NewManager(&rest.Config{Host: "https://127.0.0.1:1"}, ctrl.Options{
+		Scheme:  newTestScheme(),
+		Metrics: metricsserver.Options{BindAddress: "0"},
+		Logger: funcr.New(func(prefix, args string) {
+			lines = append(lines, prefix)
+		}, funcr.Options{}),
+	})
+	if err != nil {
+		t.Fatalf("cannot create manager: %s", err)
+	}
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{Name: "widgets"}
+	c.InitializeFromManager(mgr, &res, []Rule{{Do: c.LogInfo("ran")}})
+	c.Log.Info("initialized")
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).Build()
+	c.Client, c.APIReader = cl, cl
+	_, err = c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, []string{"widgets", "widgets"}, lines, "the logger was not named after the chain once")
+}
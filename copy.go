@@ -0,0 +1,169 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Provenance annotations stamped by Copy on the copies it writes.
+const (
+	// CopiedFromAnnotation holds the namespace and name of the source.
+	CopiedFromAnnotation = "operchain.smxlong.github.io/copied-from"
+	// CopiedVersionAnnotation holds the resourceVersion of the source that
+	// was copied.
+	CopiedVersionAnnotation = "operchain.smxlong.github.io/copied-version"
+)
+
+// copyOptions holds the options of Copy.
+type copyOptions struct {
+	labels      []string
+	annotations []string
+	owned       bool
+}
+
+// CopyOption configures Copy.
+type CopyOption func(o *copyOptions)
+
+// CopyLabels copies the given labels of the source, if it has them.
+func CopyLabels(keys ...string) CopyOption {
+	return func(o *copyOptions) {
+		o.labels = append(o.labels, keys...)
+	}
+}
+
+// CopyAnnotations copies the given annotations of the source, if it has them.
+func CopyAnnotations(keys ...string) CopyOption {
+	return func(o *copyOptions) {
+		o.annotations = append(o.annotations, keys...)
+	}
+}
+
+// CopyOwned makes the primary resource the controller owner of the copy, which
+// must then be in the primary's namespace.
+func CopyOwned() CopyOption {
+	return func(o *copyOptions) {
+		o.owned = true
+	}
+}
+
+// Copy returns an action that creates or updates a copy of the object in the
+// given resource field, e.g. a Secret in the operator's namespace, under the
+// key returned by target, e.g. in a tenant's namespace. The copy gets the
+// content of the source: the data of a Secret or ConfigMap, and for other
+// kinds every top-level field but metadata and status. Only the labels and
+// annotations allowed by the options are copied. The copy is stamped with
+// CopiedFromAnnotation and CopiedVersionAnnotation, and is not written again
+// while the stamped version matches the source. If the chain tracks its
+// objects, the copy is labeled for PruneTracked. The action does nothing if
+// the source is not loaded.
+func (c *Chain) Copy(sourceFieldPtr interface{}, target func() client.ObjectKey, opts ...CopyOption) Action {
+	return writes(c.Try(c.CopyE(sourceFieldPtr, target, opts...)), kindTarget(sourceFieldPtr))
+}
+
+// CopyE is like Copy, but returns the error.
+func (c *Chain) CopyE(sourceFieldPtr interface{}, target func() client.ObjectKey, opts ...CopyOption) ActionE {
+	checkField(sourceFieldPtr)
+	o := &copyOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(ctx context.Context) error {
+		source := objectAt(sourceFieldPtr)
+		if source == nil {
+			return nil
+		}
+		key := target()
+		obj, copyContent, err := c.newCopy(source)
+		if err != nil {
+			return fmt.Errorf("copy %s/%s: %w", source.GetNamespace(), source.GetName(), err)
+		}
+		obj.SetNamespace(key.Namespace)
+		obj.SetName(key.Name)
+		from := source.GetNamespace() + "/" + source.GetName()
+		result, err := controllerutil.CreateOrUpdate(ctx, c.Client, obj, func() error {
+			stamped := obj.GetAnnotations()
+			if stamped[CopiedFromAnnotation] == from && stamped[CopiedVersionAnnotation] == source.GetResourceVersion() {
+				return nil
+			}
+			copyContent(obj)
+			obj.SetLabels(copyKeys(obj.GetLabels(), source.GetLabels(), o.labels))
+			annotations := copyKeys(obj.GetAnnotations(), source.GetAnnotations(), o.annotations)
+			annotations[CopiedFromAnnotation] = from
+			annotations[CopiedVersionAnnotation] = source.GetResourceVersion()
+			obj.SetAnnotations(annotations)
+			if err := c.track(obj); err != nil {
+				return err
+			}
+			if o.owned {
+				return c.ownByPrimary(obj, true)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("copy %s to %s: %w", from, key, err)
+		}
+		c.recordOperation(obj, result)
+		return nil
+	}
+}
+
+// newCopy returns an empty object of the kind of source, and a function that
+// copies the content of source into it.
+func (c *Chain) newCopy(source client.Object) (client.Object, func(obj client.Object), error) {
+	switch source := source.(type) {
+	case *corev1.Secret:
+		return &corev1.Secret{}, func(obj client.Object) {
+			secret := obj.(*corev1.Secret)
+			secret.Data = source.DeepCopy().Data
+			if secret.CreationTimestamp.IsZero() {
+				// The type of a Secret is immutable.
+				secret.Type = source.Type
+			}
+		}, nil
+	case *corev1.ConfigMap:
+		return &corev1.ConfigMap{}, func(obj client.Object) {
+			cm := obj.(*corev1.ConfigMap)
+			copied := source.DeepCopy()
+			cm.Data, cm.BinaryData = copied.Data, copied.BinaryData
+		}, nil
+	}
+	gvk, err := c.gvkFor(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	return u, func(obj client.Object) {
+		u := obj.(*unstructured.Unstructured)
+		for field, value := range runtime.DeepCopyJSON(content) {
+			switch field {
+			case "apiVersion", "kind", "metadata", "status":
+			default:
+				u.Object[field] = value
+			}
+		}
+	}, nil
+}
+
+// copyKeys returns dst with the given keys of src, where set, copied into it.
+func copyKeys(dst, src map[string]string, keys []string) map[string]string {
+	if dst == nil {
+		dst = map[string]string{}
+	}
+	for _, key := range keys {
+		if value, ok := src[key]; ok {
+			dst[key] = value
+		}
+	}
+	return dst
+}
@@ -0,0 +1,83 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Test_If_Copy_Syncs_A_Secret_Across_Namespaces tests that Copy creates the
+// copy with the source's data, allowed labels, and provenance, writes nothing
+// while the source is unchanged, and syncs a changed source.
+func Test_If_Copy_Syncs_A_Secret_Across_Namespaces(t *testing.T) {
+	ctx := context.Background()
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "operator", Labels: map[string]string{"team": "infra", "internal": "true"}},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+	}).Build()
+	var res struct {
+		Secret *corev1.Secret
+	}
+	c := &Chain{Client: cl, Resources: &res}
+	load := func() {
+		res.Secret = &corev1.Secret{}
+		assert.NoError(t, cl.Get(ctx, client.ObjectKey{Namespace: "operator", Name: "registry"}, res.Secret))
+	}
+	target := client.ObjectKey{Namespace: "tenant-a", Name: "pull-secret"}
+	action := c.CopyE(&res.Secret, func() client.ObjectKey { return target }, CopyLabels("team"))
+	copied := &corev1.Secret{}
+
+	load()
+	assert.NoError(t, action(ctx), "initial copy failed")
+	assert.NoError(t, cl.Get(ctx, target, copied))
+	assert.Equal(t, corev1.SecretTypeDockerConfigJson, copied.Type, "type was not copied")
+	assert.Equal(t, `{"auths":{}}`, string(copied.Data[corev1.DockerConfigJsonKey]), "data was not copied")
+	assert.Equal(t, map[string]string{"team": "infra"}, copied.Labels, "labels were not filtered")
+	assert.Equal(t, "operator/registry", copied.Annotations[CopiedFromAnnotation], "source was not stamped")
+	assert.Equal(t, res.Secret.ResourceVersion, copied.Annotations[CopiedVersionAnnotation], "source version was not stamped")
+
+	assert.NoError(t, action(ctx), "copy of unchanged source failed")
+	res.Secret.Data[corev1.DockerConfigJsonKey] = []byte(`{"auths":{"example.com":{}}}`)
+	assert.NoError(t, cl.Update(ctx, res.Secret))
+	load()
+	assert.NoError(t, action(ctx), "copy of changed source failed")
+	assert.NoError(t, cl.Get(ctx, target, copied))
+	assert.Equal(t, `{"auths":{"example.com":{}}}`, string(copied.Data[corev1.DockerConfigJsonKey]), "changed data was not synced")
+	var results []controllerutil.OperationResult
+	for _, op := range c.operations {
+		results = append(results, op.Result)
+	}
+	assert.Equal(t, []controllerutil.OperationResult{
+		controllerutil.OperationResultCreated, controllerutil.OperationResultNone, controllerutil.OperationResultUpdated,
+	}, results, "copy was not written only when the source changed")
+}
+
+// Test_If_Copy_Copies_Other_Kinds_Unstructured tests that Copy copies the spec
+// of a kind it has no special handling for, but not its status.
+func Test_If_Copy_Copies_Other_Kinds_Unstructured(t *testing.T) {
+	ctx := context.Background()
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).Build()
+	var res struct {
+		Widget *Widget
+	}
+	res.Widget = &Widget{
+		ObjectMeta: metav1.ObjectMeta{Name: "template", Namespace: "operator", ResourceVersion: "7"},
+		Spec:       WidgetSpec{Size: 5},
+		Status:     WidgetStatus{ObservedGeneration: 2},
+	}
+	c := &Chain{Client: cl, Resources: &res}
+	target := client.ObjectKey{Namespace: "tenant-a", Name: "widget"}
+	assert.NoError(t, c.CopyE(&res.Widget, func() client.ObjectKey { return target })(ctx), "copy failed")
+	copied := &Widget{}
+	assert.NoError(t, cl.Get(ctx, target, copied))
+	assert.Equal(t, int64(5), copied.Spec.Size, "spec was not copied")
+	assert.Zero(t, copied.Status.ObservedGeneration, "status was copied")
+	assert.Equal(t, "7", copied.Annotations[CopiedVersionAnnotation], "source version was not stamped")
+}
@@ -0,0 +1,96 @@
+package operchain
+
+import (
+	"fmt"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Counter counts the objects in a resource slice field that match an optional
+// filter. Its predicates record the counts they evaluated, which remain
+// available from Count so that later actions can report them, e.g. in a
+// condition message such as "3/5 ready".
+type Counter struct {
+	name     string
+	slicePtr interface{}
+	filter   func(obj client.Object) bool
+
+	lock    sync.Mutex
+	matched int
+	total   int
+}
+
+// Counter returns a Counter over the given resource slice field. If filter is
+// given, only objects for which it returns true are counted.
+func (c *Chain) Counter(slicePtr interface{}, filter ...func(obj client.Object) bool) *Counter {
+	checkSliceField(slicePtr)
+	if len(filter) > 1 {
+		panic("Counter accepts at most one filter")
+	}
+	n := &Counter{name: c.fieldName(slicePtr), slicePtr: slicePtr}
+	if len(filter) == 1 {
+		n.filter = filter[0]
+	}
+	return n
+}
+
+// CountAtLeast returns a predicate that is true when at least min objects in
+// the given resource slice field match the optional filter.
+func (c *Chain) CountAtLeast(slicePtr interface{}, min int, filter ...func(obj client.Object) bool) *predicate {
+	return c.Counter(slicePtr, filter...).AtLeast(min)
+}
+
+// CountEquals returns a predicate that is true when exactly count objects in
+// the given resource slice field match the optional filter.
+func (c *Chain) CountEquals(slicePtr interface{}, count int, filter ...func(obj client.Object) bool) *predicate {
+	return c.Counter(slicePtr, filter...).Equals(count)
+}
+
+// AtLeast returns a predicate that is true when at least min objects match.
+func (n *Counter) AtLeast(min int) *predicate {
+	return n.predicate(fmt.Sprintf("CountAtLeast(%s, %d)", n.name, min), func(matched int) bool {
+		return matched >= min
+	})
+}
+
+// Equals returns a predicate that is true when exactly count objects match.
+func (n *Counter) Equals(count int) *predicate {
+	return n.predicate(fmt.Sprintf("CountEquals(%s, %d)", n.name, count), func(matched int) bool {
+		return matched == count
+	})
+}
+
+// Count returns the number of matching objects and the total number of objects
+// as of the most recent evaluation of one of the Counter's predicates.
+func (n *Counter) Count() (matched, total int) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.matched, n.total
+}
+
+// predicate returns a predicate that counts the objects and applies compare to
+// the number that matched.
+func (n *Counter) predicate(name string, compare func(matched int) bool) *predicate {
+	return pcache.NewLeaf(name, func(e *pcache.Evaluation) bool {
+		matched, total := n.count()
+		e.Notef("%d/%d matched", matched, total)
+		return compare(matched)
+	})
+}
+
+// count counts the objects and records the result.
+func (n *Counter) count() (matched, total int) {
+	objs := objectsAt(n.slicePtr)
+	for _, obj := range objs {
+		if n.filter == nil || n.filter(obj) {
+			matched++
+		}
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.matched, n.total = matched, len(objs)
+	return n.matched, n.total
+}
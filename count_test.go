@@ -0,0 +1,50 @@
+package operchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Test_If_Count_Predicates_Apply_The_Filter tests that CountAtLeast and
+// CountEquals count only the objects matching the filter, and that the Counter
+// reports the evaluated counts.
+func Test_If_Count_Predicates_Apply_The_Filter(t *testing.T) {
+	var res struct {
+		Pods []corev1.Pod
+	}
+	c := &Chain{Resources: &res}
+	running := c.Counter(&res.Pods, podRunning)
+	res.Pods = []corev1.Pod{
+		{Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+		{Status: corev1.PodStatus{Phase: corev1.PodPending}},
+		{Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+	}
+	cache := pcache.New()
+	cache.EnableTrace()
+	assert.True(t, running.AtLeast(2).Eval(cache), "AtLeast(2) was false")
+	assert.False(t, running.AtLeast(3).Eval(cache), "AtLeast(3) was true")
+	assert.True(t, running.Equals(2).Eval(cache), "Equals(2) was false")
+	assert.True(t, c.CountEquals(&res.Pods, 3).Eval(cache), "unfiltered count was not 3")
+	assert.True(t, c.CountAtLeast(&res.Pods, 1, podRunning).Eval(cache), "CountAtLeast(1) was false")
+	matched, total := running.Count()
+	assert.Equal(t, 2, matched, "wrong matched count")
+	assert.Equal(t, 3, total, "wrong total count")
+	assert.Equal(t, TraceEntry{Name: "CountAtLeast(Pods, 2)", Value: true, Notes: []string{"2/3 matched"}},
+		cache.Trace()[0], "trace did not record the count")
+}
+
+// Test_If_Count_Predicates_Handle_Nil_Slices tests that a nil slice counts as
+// zero objects.
+func Test_If_Count_Predicates_Handle_Nil_Slices(t *testing.T) {
+	var res struct {
+		Pods []*corev1.Pod
+	}
+	c := &Chain{Resources: &res}
+	cache := pcache.New()
+	assert.True(t, c.CountEquals(&res.Pods, 0, podRunning).Eval(cache), "nil slice did not count zero")
+	assert.False(t, c.CountAtLeast(&res.Pods, 1).Eval(cache), "nil slice counted at least one")
+}
@@ -0,0 +1,354 @@
+package operchain
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultReportHistory is the number of recent reports kept by a chain without
+// a ReportHistory.
+const DefaultReportHistory = 16
+
+// ChainDescription describes the structure of a chain.
+type ChainDescription struct {
+	// Name is the name of the chain.
+	Name string `json:"name"`
+	// Resources are the resource fields of the chain.
+	Resources []ResourceDescription `json:"resources"`
+	// Rules are the chain's rules.
+	Rules []RuleDescription `json:"rules"`
+	// Finally are the chain's Finally rules.
+	Finally []RuleDescription `json:"finally,omitempty"`
+	// VersionedRules are the chain's VersionedRules, by version.
+	VersionedRules map[string][]RuleDescription `json:"versionedRules,omitempty"`
+	// Subchains are the chains run by the chain's rules.
+	Subchains []SubchainDescription `json:"subchains,omitempty"`
+}
+
+// SubchainDescription describes a chain run by the rules of another chain.
+type SubchainDescription struct {
+	// Rule is the rule running the chain, if known.
+	Rule string `json:"rule,omitempty"`
+	// Chain is the structure of the chain. A chain already described by
+	// one of the chains running it is described by its name alone.
+	Chain ChainDescription `json:"chain"`
+}
+
+// ResourceDescription describes a resource field of a chain.
+type ResourceDescription struct {
+	// Field is the name of the field.
+	Field string `json:"field"`
+	// Type is the Go type of the field.
+	Type string `json:"type"`
+	// Primary is true for the primary resource, or the primary resources of
+	// a chain serving several kinds.
+	Primary bool `json:"primary,omitempty"`
+	// List is true for a resource slice field.
+	List bool `json:"list,omitempty"`
+}
+
+// RuleDescription describes a rule of a chain.
+type RuleDescription struct {
+	// Name is the name of the rule, or its index if it has none.
+	Name string `json:"name"`
+	// Phase is the phase of the rule, for rules built from a ChainSpec with
+	// phases.
+	Phase string `json:"phase,omitempty"`
+	// LeaderOnly is true if the rule runs only on the leader.
+	LeaderOnly bool `json:"leaderOnly,omitempty"`
+	// Kinds are the kinds of primary resources the rule is restricted to, if
+	// any.
+	Kinds []string `json:"kinds,omitempty"`
+	// ExclusiveGroup is the exclusive group of the rule, if any.
+	ExclusiveGroup string `json:"exclusiveGroup,omitempty"`
+	// When is the predicate of the rule, nil if it always runs.
+	When *PredicateDescription `json:"when,omitempty"`
+	// Targets are the objects the action of the rule writes, as declared by
+	// the action helpers it is built from.
+	Targets []string `json:"targets,omitempty"`
+}
+
+// PredicateDescription describes a predicate and the predicates it is
+// composed of.
+type PredicateDescription struct {
+	// Name is the name of the predicate, or its operator, such as And, for
+	// composed predicates, or empty if it is anonymous.
+	Name string `json:"name,omitempty"`
+	// Key is the key of the predicate, if any.
+	Key string `json:"key,omitempty"`
+	// Tags are the tags of the predicate itself.
+	Tags []string `json:"tags,omitempty"`
+	// Children are the predicates it is composed of.
+	Children []*PredicateDescription `json:"children,omitempty"`
+}
+
+// String returns the predicate as an expression, such as
+// And(GenerationChanged(Widget), Not(Paused(Widget, example.com/paused))).
+func (d *PredicateDescription) String() string {
+	name := d.Name
+	if name == "" {
+		name = "(anonymous)"
+	}
+	if len(d.Children) == 0 {
+		return name
+	}
+	children := make([]string, len(d.Children))
+	for i, child := range d.Children {
+		children[i] = child.String()
+	}
+	return name + "(" + strings.Join(children, ", ") + ")"
+}
+
+// Describe returns the structure of the chain: its resource fields, and its
+// rules with their predicate trees, and the chains run by its rules.
+func (c *Chain) Describe() ChainDescription {
+	return c.describeChain(map[*Chain]bool{})
+}
+
+// describeChain describes the chain, describing the chains in running by
+// their names alone, so that cycles of subchains terminate.
+func (c *Chain) describeChain(running map[*Chain]bool) ChainDescription {
+	d := ChainDescription{Name: c.Name, Rules: c.describeRules(c.Rules, "rule"), Finally: c.describeRules(c.Finally, "finally rule")}
+	for version, rules := range c.VersionedRules {
+		if d.VersionedRules == nil {
+			d.VersionedRules = map[string][]RuleDescription{}
+		}
+		d.VersionedRules[version] = c.describeRules(rules, "rule")
+	}
+	running[c] = true
+	defer delete(running, c)
+	for _, sub := range c.subchainList() {
+		s := SubchainDescription{Rule: sub.rule, Chain: ChainDescription{Name: sub.chain.Name}}
+		if !running[sub.chain] {
+			s.Chain = sub.chain.describeChain(running)
+		}
+		d.Subchains = append(d.Subchains, s)
+	}
+	res := reflect.ValueOf(c.Resources)
+	if res.Kind() != reflect.Ptr || res.IsNil() || res.Elem().Kind() != reflect.Struct {
+		return d
+	}
+	_, primaries := c.primaryFields()
+	res = res.Elem()
+	for i := 0; i < res.NumField(); i++ {
+		field := res.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		d.Resources = append(d.Resources, ResourceDescription{
+			Field:   field.Name,
+			Type:    field.Type.String(),
+			Primary: slices.Contains(primaries, i),
+			List:    field.Type.Kind() == reflect.Slice,
+		})
+	}
+	return d
+}
+
+// describeRules describes the rules, identifying those without names by the
+// prefix and their index.
+func (c *Chain) describeRules(rules []Rule, prefix string) []RuleDescription {
+	var d []RuleDescription
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = prefix + " " + strconv.Itoa(i)
+		}
+		rd := RuleDescription{Name: name, LeaderOnly: rule.LeaderOnly, Kinds: rule.Kinds, ExclusiveGroup: rule.ExclusiveGroup, When: describePredicate(rule.When)}
+		for _, t := range c.Targets(rule) {
+			rd.Targets = append(rd.Targets, t.String())
+		}
+		if rule.spec != nil {
+			rd.Phase = rule.spec.Phase
+		}
+		d = append(d, rd)
+	}
+	return d
+}
+
+// describePredicate describes p, or returns nil if p is nil.
+func describePredicate(p *predicate) *PredicateDescription {
+	if p == nil {
+		return nil
+	}
+	d := &PredicateDescription{Name: p.Name(), Key: p.Key()}
+	if d.Name == "" {
+		d.Name = p.Op()
+	}
+	seen := map[string]bool{}
+	for _, child := range p.Children() {
+		d.Children = append(d.Children, describePredicate(child))
+		for _, tag := range child.Tags() {
+			seen[tag] = true
+		}
+	}
+	for _, tag := range p.Tags() {
+		if !seen[tag] {
+			d.Tags = append(d.Tags, tag)
+		}
+	}
+	return d
+}
+
+// recordHistory keeps the report among the chain's recent reports. The lock
+// must be held.
+func (c *Chain) recordHistory(report *RunReport) {
+	max := c.ReportHistory
+	if max == 0 {
+		max = DefaultReportHistory
+	}
+	if max < 0 {
+		return
+	}
+	c.history = append(c.history, report)
+	if len(c.history) > max {
+		c.history = append(c.history[:0:0], c.history[len(c.history)-max:]...)
+	}
+}
+
+// RecentReports returns the reports of the most recent Runs of the chain, most
+// recent first, as many as its ReportHistory keeps.
+func (c *Chain) RecentReports() []*RunReport {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	reports := make([]*RunReport, len(c.history))
+	for i, report := range c.history {
+		reports[len(reports)-1-i] = report
+	}
+	return reports
+}
+
+// DebugState is the state of chains served by DebugHandler.
+type DebugState struct {
+	// Chains are the states of the chains.
+	Chains []DebugChain `json:"chains"`
+}
+
+// DebugChain is the state of a chain served by DebugHandler.
+type DebugChain struct {
+	// Description is the structure of the chain.
+	Description ChainDescription `json:"description"`
+	// Reports are the chain's recent reports, most recent first, without the
+	// content of the diffs and patches they record, nor the notes of their
+	// traces.
+	Reports []*RunReport `json:"reports"`
+	// Objects are the objects with values kept across runs, most recently
+	// run first.
+	Objects []DebugObject `json:"objects"`
+}
+
+// DebugObject is the state kept by a chain for an object.
+type DebugObject struct {
+	// Key is the namespace and name of the object, preceded by its kind for
+	// a chain serving several kinds.
+	Key string `json:"key"`
+	// Values are the names of the values kept across runs for the object,
+	// but not the values themselves.
+	Values []string `json:"values"`
+	// LastReport is the most recent report of the object among the chain's
+	// recent reports, if any.
+	LastReport *RunReport `json:"lastReport,omitempty"`
+}
+
+// debugState returns the state of the chain for DebugHandler.
+func (c *Chain) debugState() DebugChain {
+	d := DebugChain{Description: c.Describe(), Reports: []*RunReport{}, Objects: []DebugObject{}}
+	last := map[string]*RunReport{}
+	for _, report := range c.RecentReports() {
+		report = redactReport(report)
+		d.Reports = append(d.Reports, report)
+		if key := c.storeKey(report.Kind, report.Request.NamespacedName); last[key] == nil {
+			last[key] = report
+		}
+	}
+	for _, key := range c.store().Keys() {
+		d.Objects = append(d.Objects, DebugObject{Key: key, Values: c.store().Names(key), LastReport: last[key]})
+	}
+	return d
+}
+
+// redactReport returns a copy of the report without the content of diffs,
+// patches, and trace notes, which may hold the data of objects such as
+// Secrets, including those of the reports of subchains.
+func redactReport(report *RunReport) *RunReport {
+	r := *report
+	if report.Rules != nil {
+		r.Rules = make([]RuleReport, len(report.Rules))
+		for i, rule := range report.Rules {
+			if rule.Subchains != nil {
+				subs := make([]*RunReport, len(rule.Subchains))
+				for j, sub := range rule.Subchains {
+					if sub != nil {
+						subs[j] = redactReport(sub)
+					}
+				}
+				rule.Subchains = subs
+			}
+			r.Rules[i] = rule
+		}
+	}
+	r.Operations = make([]Operation, len(report.Operations))
+	for i, op := range report.Operations {
+		op.Diff = ""
+		op.ObjectDiff = ""
+		r.Operations[i] = op
+	}
+	r.Audit = make([]AuditEntry, len(report.Audit))
+	for i, entry := range report.Audit {
+		entry.Diff = ""
+		r.Audit[i] = entry
+	}
+	r.DryRun = make([]AuditEntry, len(report.DryRun))
+	for i, entry := range report.DryRun {
+		entry.Diff = ""
+		r.DryRun[i] = entry
+	}
+	if report.Trace != nil {
+		r.Trace = make([]TraceEntry, len(report.Trace))
+		for i, entry := range report.Trace {
+			entry.Notes = nil
+			r.Trace[i] = entry
+		}
+	}
+	return &r
+}
+
+// DebugHandler returns an http.Handler serving the state of the chains: their
+// descriptions, recent reports, and the objects they keep values for, as JSON
+// in the form of DebugState, or as a minimal HTML page to clients that accept
+// text/html. Only the identities of objects and the outcomes of Runs are
+// served, never the content of objects. Mount it e.g. with the ExtraHandlers of
+// the manager's metrics server options.
+func DebugHandler(chains ...*Chain) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := DebugState{Chains: make([]DebugChain, len(chains))}
+		for i, c := range chains {
+			state.Chains[i] = c.debugState()
+		}
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_ = debugPage.Execute(w, state)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(state)
+	})
+}
+
+// debugPage is the HTML view of DebugHandler.
+var debugPage = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html><head><title>operchain</title></head><body>
+{{range .Chains}}<h1>Chain {{.Description.Name}}</h1>
+<h2>Resources</h2><ul>{{range .Description.Resources}}<li>{{.Field}} {{.Type}}{{if .Primary}} (primary){{end}}</li>{{end}}</ul>
+<h2>Rules</h2><ol start="0">{{range .Description.Rules}}<li>{{.Name}}{{if .When}}: {{.When}}{{end}}{{if .LeaderOnly}} (leader only){{end}}</li>{{end}}</ol>
+{{if .Description.Finally}}<h2>Finally</h2><ol start="0">{{range .Description.Finally}}<li>{{.Name}}{{if .When}}: {{.When}}{{end}}</li>{{end}}</ol>{{end}}
+<h2>Recent runs</h2><table><tr><th>Run</th><th>Request</th><th>Operations</th><th>Stopped</th><th>Error</th></tr>
+{{range .Reports}}<tr><td>{{.RunID}}</td><td>{{.Request.NamespacedName}}</td><td>{{len .Operations}}</td><td>{{.Stopped}}</td><td>{{.Error}}</td></tr>{{end}}</table>
+<h2>Objects</h2><ul>{{range .Objects}}<li>{{.Key}}: {{range $i, $v := .Values}}{{if $i}}, {{end}}{{$v}}{{end}}</li>{{end}}</ul>
+{{end}}</body></html>
+`))
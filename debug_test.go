@@ -0,0 +1,114 @@
+package operchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_DebugHandler_Serves_Chain_State tests that DebugHandler serves the
+// description, recent reports, and kept objects of a chain as JSON and HTML,
+// without the content of Secrets.
+func Test_If_DebugHandler_Serves_Chain_State(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+		Secret *corev1.Secret
+	}
+	c := &Chain{Name: "widgets", Trace: true, ReportHistory: 2}
+	run := 0
+	c.InitializeChain(cl, &res, []Rule{
+		{Name: "sync", When: Or(c.ChangedSinceLastRun(&res.Widget), Not(c.FieldMatches(&res.Secret, "data[token]", func(interface{}) bool { return false }))), Do: c.Try(func(ctx context.Context) error {
+			run++
+			modified := res.Secret.DeepCopy()
+			modified.Data = map[string][]byte{"token": []byte(fmt.Sprintf("secret-%d", run))}
+			return c.Patch(ctx, modified, client.MergeFrom(res.Secret))
+		})},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	for i := 0; i < 3; i++ {
+		_, err := c.Run(context.Background(), req)
+		assert.NoError(t, err, "Run failed")
+	}
+
+	rec := httptest.NewRecorder()
+	DebugHandler(c).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/operchain", nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"), "JSON was not served")
+	assert.NotContains(t, rec.Body.String(), "c2VjcmV0", "secret data was served")
+	assert.NotEmpty(t, c.LastReport().Audit[0].Diff, "patch was not audited")
+	var state DebugState
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state), "JSON does not decode")
+	assert.Len(t, state.Chains, 1, "chain was not served")
+	chain := state.Chains[0]
+	assert.Equal(t, "widgets", chain.Description.Name, "name was not served")
+	assert.Equal(t, []ResourceDescription{
+		{Field: "Widget", Type: "*operchain.Widget", Primary: true},
+		{Field: "Secret", Type: "*v1.Secret"},
+	}, chain.Description.Resources, "resources were not described")
+	assert.Equal(t, "Or(ChangedSinceLastRun(Widget), Not(FieldMatches(Secret, data[token])))", chain.Description.Rules[0].When.String(), "predicate tree was not described")
+	assert.Len(t, chain.Reports, 2, "history was not bounded")
+	assert.Equal(t, c.LastReport().RunID, chain.Reports[0].RunID, "reports are not most recent first")
+	assert.Len(t, chain.Objects, 1, "kept objects were not served")
+	assert.Equal(t, "default/demo", chain.Objects[0].Key, "object was not identified")
+	assert.Equal(t, []string{"changed:Widget"}, chain.Objects[0].Values, "names of kept values were not served")
+	assert.Equal(t, chain.Reports[0].RunID, chain.Objects[0].LastReport.RunID, "last report of object was not served")
+
+	var raw map[string][]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &raw), "JSON does not match the schema")
+	for _, key := range []string{"description", "reports", "objects"} {
+		assert.Contains(t, raw["chains"][0], key, "chain has no %s", key)
+	}
+
+	rec = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/debug/operchain", nil)
+	r.Header.Set("Accept", "text/html")
+	DebugHandler(c).ServeHTTP(rec, r)
+	assert.Contains(t, rec.Body.String(), "<h1>Chain widgets</h1>", "HTML was not served")
+}
+
+// Test_If_DebugHandler_Redacts_Subchain_Reports tests that DebugHandler does
+// not serve the content of a Secret patched by a subchain.
+func Test_If_DebugHandler_Redacts_Subchain_Reports(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Secret *corev1.Secret
+	}
+	sub := &Chain{Name: "rotate", Trace: true}
+	sub.InitializeChain(cl, &res, []Rule{
+		{Name: "patch", Do: sub.Try(func(ctx context.Context) error {
+			modified := res.Secret.DeepCopy()
+			modified.StringData = map[string]string{"password": "hunter2"}
+			modified.Data = map[string][]byte{"password": []byte("hunter2")}
+			return sub.Patch(ctx, modified, client.MergeFrom(res.Secret))
+		})},
+	})
+	c := &Chain{Name: "secrets"}
+	c.InitializeChain(cl, &struct{}{}, []Rule{{Name: "rotate", Do: c.Subchain(sub)}})
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run failed")
+	subReport := c.LastReport().Rules[0].Subchains[0]
+	assert.NotEmpty(t, subReport.Audit[0].Diff, "patch of the subchain was not audited")
+
+	rec := httptest.NewRecorder()
+	DebugHandler(c).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/operchain", nil))
+	assert.NotContains(t, rec.Body.String(), "hunter2", "secret data of the subchain was served")
+	assert.NotContains(t, rec.Body.String(), "aHVudGVyMg", "secret data of the subchain was served")
+	assert.Contains(t, rec.Body.String(), `"subchains"`, "report of the subchain was not served")
+	assert.NotEmpty(t, subReport.Audit[0].Diff, "report of the subchain was redacted in place")
+}
@@ -0,0 +1,84 @@
+package operchain
+
+import (
+	"context"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// defaultConflictRequeue is how soon to check again after a defaulting patch
+// conflicted with a concurrent change.
+const defaultConflictRequeue = 5 * time.Second
+
+// defaultOptions holds the options of Default.
+type defaultOptions struct {
+	keepRunning bool
+}
+
+// DefaultOption configures Default.
+type DefaultOption func(o *defaultOptions)
+
+// DefaultWithoutStopping makes Default carry on with the chain after writing
+// defaults, instead of stopping it and relying on the write's watch event to
+// start a new Run.
+func DefaultWithoutStopping() DefaultOption {
+	return func(o *defaultOptions) {
+		o.keepRunning = true
+	}
+}
+
+// Default returns an action that defaults the object in the given resource
+// field, e.g. the primary resource's optional spec fields, as a mutating
+// webhook would. defaults sets the defaults on a copy of the object and
+// reports whether it changed anything; it must only set fields the user left
+// unset, so that it never fights the user. If it changed something, the
+// difference is sent as a merge patch carrying the object's resourceVersion,
+// and the chain stops, since the write starts a new Run. A patch that conflicts
+// with a concurrent change is not an error, but requeues the Run, which
+// defaults the changed object. Once the object is defaulted, the action writes
+// nothing.
+func (c *Chain) Default(fieldPtr interface{}, defaults func(obj client.Object) bool, opts ...DefaultOption) Action {
+	return writes(c.Try(c.DefaultE(fieldPtr, defaults, opts...)), fieldTarget(fieldPtr, ""))
+}
+
+// DefaultE is like Default, but returns the error.
+func (c *Chain) DefaultE(fieldPtr interface{}, defaults func(obj client.Object) bool, opts ...DefaultOption) ActionE {
+	checkField(fieldPtr)
+	o := &defaultOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(ctx context.Context) error {
+		obj := objectAt(fieldPtr)
+		if obj == nil {
+			return nil
+		}
+		modified := obj.DeepCopyObject().(client.Object)
+		if !defaults(modified) {
+			return nil
+		}
+		// A defaulting function that reports a change it did not make must
+		// not cause a write per Run.
+		if data, err := client.MergeFrom(obj).Data(modified); err != nil || string(data) == "{}" {
+			return err
+		}
+		patch := client.MergeFromWithOptions(obj, client.MergeFromWithOptimisticLock{})
+		if err := c.sendPatch(ctx, obj, modified, patch); err != nil {
+			if !apierrors.IsConflict(err) {
+				return err
+			}
+			log.FromContext(ctx).Info("defaults conflicted with a concurrent change, requeueing", "object", c.describe(obj))
+			c.doRequeue(defaultConflictRequeue)
+			c.doStop()
+			return nil
+		}
+		c.invalidateRun()
+		if !o.keepRunning {
+			c.doStop()
+		}
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// defaultWidgetSize defaults the size of a Widget to 3, and reports whether it
+// did.
+func defaultWidgetSize(obj client.Object) bool {
+	widget := obj.(*Widget)
+	if widget.Spec.Size != 0 {
+		return false
+	}
+	widget.Spec.Size = 3
+	return true
+}
+
+// defaultChain returns a chain over a stored Widget of the given size that
+// defaults it, counting patches and the Runs that got past the defaulting.
+func defaultChain(size int64) (*Chain, client.Client, *int, *int) {
+	patches, proceeded := 0, 0
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).
+		WithObjects(&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}, Spec: WidgetSpec{Size: size}}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				patches++
+				return cl.Patch(ctx, obj, patch, opts...)
+			},
+		}).Build()
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: c.Default(&res.Widget, defaultWidgetSize)},
+		{Do: func(context.Context) { proceeded++ }},
+	})
+	return c, cl, &patches, &proceeded
+}
+
+// Test_If_Default_Writes_Defaults_Once tests that Default writes missing
+// defaults and stops the chain, and then lets Runs proceed without writing.
+func Test_If_Default_Writes_Defaults_Once(t *testing.T) {
+	c, cl, patches, proceeded := defaultChain(0)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	for i := 0; i < 3; i++ {
+		_, err := c.Run(context.Background(), req)
+		assert.NoError(t, err, "Run failed")
+	}
+	assert.Equal(t, 1, *patches, "defaults were not written exactly once")
+	assert.Equal(t, 2, *proceeded, "chain did not stop only after writing defaults")
+	stored := &Widget{}
+	assert.NoError(t, cl.Get(context.Background(), req.NamespacedName, stored))
+	assert.Equal(t, int64(3), stored.Spec.Size, "default was not stored")
+}
+
+// Test_If_Default_Leaves_User_Values_Alone tests that Default writes nothing
+// for an object whose user set the defaulted field.
+func Test_If_Default_Leaves_User_Values_Alone(t *testing.T) {
+	c, cl, patches, proceeded := defaultChain(7)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run failed")
+	assert.Zero(t, *patches, "user's object was written")
+	assert.Equal(t, 1, *proceeded, "chain stopped")
+	stored := &Widget{}
+	assert.NoError(t, cl.Get(context.Background(), req.NamespacedName, stored))
+	assert.Equal(t, int64(7), stored.Spec.Size, "user's value was changed")
+}
@@ -0,0 +1,179 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// deleteConflictRequeue is how soon to check again after a delete whose UID
+// precondition failed.
+const deleteConflictRequeue = 5 * time.Second
+
+// deleteOptions holds the options of DeleteResource and DeleteAll.
+type deleteOptions struct {
+	propagation    *metav1.DeletionPropagation
+	uid            bool
+	ignoreNotFound bool
+}
+
+// DeleteOption configures DeleteResource and DeleteAll.
+type DeleteOption func(o *deleteOptions)
+
+// Propagation sets the propagation policy of the delete: Foreground,
+// Background, or Orphan.
+func Propagation(policy metav1.DeletionPropagation) DeleteOption {
+	return func(o *deleteOptions) {
+		o.propagation = &policy
+	}
+}
+
+// PreconditionUID makes the delete apply only to the loaded copy of the
+// object, by its UID, so that an object recreated under the same name is not
+// deleted. When the precondition fails, the action requeues instead of failing.
+func PreconditionUID() DeleteOption {
+	return func(o *deleteOptions) {
+		o.uid = true
+	}
+}
+
+// IgnoreNotFound treats an object that is already gone as deleted.
+func IgnoreNotFound() DeleteOption {
+	return func(o *deleteOptions) {
+		o.ignoreNotFound = true
+	}
+}
+
+// DeleteResource returns an action that deletes an object, given either as a
+// client.Object or as a pointer to a resource field. It does nothing if the
+// field is not loaded. Once the object is deleted, the field is set to nil and
+// the values of the predicates evaluated so far in the run are discarded, so
+// that later rules see the deletion. The method is not named Delete, which is
+// the embedded client's.
+func (c *Chain) DeleteResource(target interface{}, opts ...DeleteOption) Action {
+	return writes(c.Try(c.DeleteResourceE(target, opts...)), objectOrFieldTarget(target, ""))
+}
+
+// DeleteResourceE is like DeleteResource, but returns the error.
+func (c *Chain) DeleteResourceE(target interface{}, opts ...DeleteOption) ActionE {
+	o := &deleteOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	obj, isObject := target.(client.Object)
+	if !isObject {
+		checkField(target)
+	}
+	return func(ctx context.Context) error {
+		if !isObject {
+			if obj = objectAt(target); obj == nil {
+				return nil
+			}
+		}
+		deleted, err := c.deleteObject(ctx, obj, o)
+		if err != nil || !deleted {
+			return err
+		}
+		if !isObject {
+			reflect.ValueOf(target).Elem().Set(reflect.Zero(reflect.TypeOf(target).Elem()))
+		}
+		c.invalidateRun()
+		return nil
+	}
+}
+
+// DeleteAll returns an action that deletes every object in the given resource
+// slice field, with the same options as DeleteResource. Deleted objects are
+// removed from the field. Errors are aggregated, and do not stop the remaining
+// objects from being deleted.
+func (c *Chain) DeleteAll(slicePtr interface{}, opts ...DeleteOption) Action {
+	return writes(c.Try(c.DeleteAllE(slicePtr, opts...)), fieldTarget(slicePtr, ""))
+}
+
+// DeleteAllE is like DeleteAll, but returns the error.
+func (c *Chain) DeleteAllE(slicePtr interface{}, opts ...DeleteOption) ActionE {
+	checkSliceField(slicePtr)
+	o := &deleteOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(ctx context.Context) error {
+		return c.deleteItems(slicePtr, func(obj client.Object) (bool, error) {
+			return c.deleteObject(ctx, obj, o)
+		})
+	}
+}
+
+// deleteItems calls del for every object in the resource slice field and
+// removes the objects it reports deleted from the field. Errors are
+// aggregated.
+func (c *Chain) deleteItems(slicePtr interface{}, del func(obj client.Object) (bool, error)) error {
+	field := reflect.ValueOf(slicePtr).Elem()
+	kept := reflect.MakeSlice(field.Type(), 0, field.Len())
+	var errs []error
+	for i := 0; i < field.Len(); i++ {
+		item := field.Index(i)
+		obj := item
+		if obj.Kind() != reflect.Ptr {
+			obj = obj.Addr()
+		} else if obj.IsNil() {
+			continue
+		}
+		deleted, err := del(obj.Interface().(client.Object))
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if !deleted {
+			kept = reflect.Append(kept, item)
+		}
+	}
+	if kept.Len() < field.Len() {
+		field.Set(kept)
+		c.invalidateRun()
+	}
+	return errors.Join(errs...)
+}
+
+// deleteObject deletes the object and reports whether it is gone. A failed UID
+// precondition is not an error, but requeues the run.
+func (c *Chain) deleteObject(ctx context.Context, obj client.Object, o *deleteOptions) (bool, error) {
+	var opts []client.DeleteOption
+	if o.propagation != nil {
+		opts = append(opts, client.PropagationPolicy(*o.propagation))
+	}
+	if o.uid && obj.GetUID() != "" {
+		opts = append(opts, client.Preconditions{UID: ptr.To(obj.GetUID())})
+	}
+	err := c.Delete(ctx, obj, opts...)
+	switch {
+	case err == nil:
+		c.recordOperation(obj, OperationResultDeleted)
+		return true, nil
+	case apierrors.IsNotFound(err) && o.ignoreNotFound:
+		c.recordOperation(obj, controllerutil.OperationResultNone)
+		return true, nil
+	case apierrors.IsConflict(err) && o.uid:
+		c.doRequeue(deleteConflictRequeue)
+		return false, nil
+	}
+	return false, fmt.Errorf("delete %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+}
+
+// invalidateRun discards the values of the predicates evaluated so far in the
+// current run.
+func (c *Chain) invalidateRun() {
+	c.lock.Lock()
+	cache := c.cache
+	c.lock.Unlock()
+	if cache != nil {
+		cache.InvalidateAll()
+	}
+}
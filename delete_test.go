@@ -0,0 +1,102 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// Test_If_DeleteResource_Clears_The_Field tests that DeleteResource deletes the
+// loaded object, sets its field to nil, and discards cached predicate values so
+// later rules see the deletion.
+func Test_If_DeleteResource_Clears_The_Field(t *testing.T) {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	cl := fake.NewClientBuilder().WithObjects(cm).Build()
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+	}
+	existsAfter := true
+	c := &Chain{}
+	exists := c.Exists(&res.ConfigMap)
+	c.InitializeChain(cl, &res, []Rule{
+		{When: exists, Do: c.DeleteResource(&res.ConfigMap, Propagation(metav1.DeletePropagationForeground), PreconditionUID())},
+		{When: Not(exists), Do: func(context.Context) { existsAfter = false }},
+	})
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Nil(t, res.ConfigMap, "field was not cleared")
+	assert.False(t, existsAfter, "cached predicate was not invalidated")
+	err = cl.Get(context.Background(), client.ObjectKeyFromObject(cm), &corev1.ConfigMap{})
+	assert.True(t, apierrors.IsNotFound(err), "object was not deleted")
+}
+
+// Test_If_DeleteResource_Requeues_On_Precondition_Mismatch tests that a
+// recreated namesake is not deleted, and that the mismatch requeues the run
+// instead of failing it.
+func Test_If_DeleteResource_Requeues_On_Precondition_Mismatch(t *testing.T) {
+	// The fake client ignores preconditions, so check them as the API server
+	// would.
+	cl := fake.NewClientBuilder().WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", UID: "new-uid"}},
+	).WithInterceptorFuncs(interceptor.Funcs{
+		Delete: func(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			options := (&client.DeleteOptions{}).ApplyOptions(opts)
+			stored := &corev1.ConfigMap{}
+			if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), stored); err != nil {
+				return err
+			}
+			if options.Preconditions != nil && *options.Preconditions.UID != stored.UID {
+				return apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, obj.GetName(), assert.AnError)
+			}
+			return cl.Delete(ctx, obj, opts...)
+		},
+	}).Build()
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+	}
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: func(context.Context) { res.ConfigMap.UID = "old-uid" }},
+		{Do: c.DeleteResource(&res.ConfigMap, PreconditionUID())},
+	})
+	result, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "precondition mismatch was an error")
+	assert.Equal(t, deleteConflictRequeue, result.RequeueAfter, "precondition mismatch did not requeue")
+	assert.NotNil(t, res.ConfigMap, "field was cleared")
+	assert.NoError(t, cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "demo"}, &corev1.ConfigMap{}), "namesake was deleted")
+}
+
+// Test_If_DeleteAll_Aggregates_Errors tests that DeleteAll deletes every
+// object, removes deleted objects from the field, and aggregates errors.
+func Test_If_DeleteAll_Aggregates_Errors(t *testing.T) {
+	cl := fake.NewClientBuilder().WithObjects(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Pods []corev1.Pod
+	}
+	c := &Chain{Client: cl, Resources: &res}
+	res.Pods = []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "gone", Namespace: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "missing", Namespace: "default"}},
+	}
+	err := c.DeleteAllE(&res.Pods)(context.Background())
+	assert.ErrorContains(t, err, "delete default/gone", "errors were not aggregated")
+	assert.ErrorContains(t, err, "delete default/missing", "errors were not aggregated")
+	assert.Len(t, res.Pods, 2, "deleted object was not removed from the field")
+
+	err = c.DeleteAllE(&res.Pods, IgnoreNotFound())(context.Background())
+	assert.NoError(t, err, "NotFound was not ignored")
+	assert.Empty(t, res.Pods, "objects were not removed from the field")
+}
@@ -0,0 +1,249 @@
+package operchain
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DiagramFormat is the format of a diagram written by WriteDiagram.
+type DiagramFormat string
+
+const (
+	// DiagramMermaid is a Mermaid flowchart.
+	DiagramMermaid DiagramFormat = "mermaid"
+	// DiagramDOT is a Graphviz DOT digraph.
+	DiagramDOT DiagramFormat = "dot"
+)
+
+// subchain is a chain run by the rules of a chain.
+type subchain struct {
+	// rule is the rule running the chain, if known.
+	rule  string
+	chain *Chain
+}
+
+// addSubchain records that the chain runs sub, by the named rule if known.
+func (c *Chain) addSubchain(rule string, sub *Chain) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, s := range c.subchains {
+		if s.chain == sub && s.rule == rule {
+			return
+		}
+	}
+	c.subchains = append(c.subchains, subchain{rule: rule, chain: sub})
+}
+
+// subchainList returns the chains recorded by addSubchain, in order.
+func (c *Chain) subchainList() []subchain {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]subchain(nil), c.subchains...)
+}
+
+// WriteDiagram writes the structure of the chains, as given by Describe, as a
+// diagram in the format: each chain is a cluster of its rules in the order
+// they run, grouped by phase, with the predicate of each rule on the edge
+// leading to it. The chains run by a chain's rules are clusters of their own,
+// linked from the rule running them, or from the start of the chain if it is
+// not known. The output depends only on the structure of the chains, so that
+// it can be compared with golden files.
+func WriteDiagram(w io.Writer, format DiagramFormat, chains ...*Chain) error {
+	d := &diagram{}
+	for i, c := range chains {
+		d.addChain(&d.root, "c"+strconv.Itoa(i), c.Describe())
+	}
+	var sb strings.Builder
+	switch format {
+	case DiagramMermaid:
+		d.writeMermaid(&sb)
+	case DiagramDOT:
+		d.writeDOT(&sb)
+	default:
+		return fmt.Errorf("unknown diagram format %q", format)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// diagram is a diagram of chains, independent of its format.
+type diagram struct {
+	root  diagramGroup
+	edges []diagramEdge
+}
+
+// diagramGroup is a cluster of nodes and groups, in order.
+type diagramGroup struct {
+	id    string
+	label string
+	items []diagramItem
+}
+
+// diagramItem is either a node or a group of a diagramGroup.
+type diagramItem struct {
+	node  *diagramNode
+	group *diagramGroup
+}
+
+// diagramNode is a node of a diagram: the start of a chain, or a rule.
+type diagramNode struct {
+	id    string
+	label string
+	start bool
+}
+
+// diagramEdge is an edge of a diagram. Dashed edges lead to subchains.
+type diagramEdge struct {
+	from, to string
+	label    string
+	dashed   bool
+}
+
+// addChain adds the chain described by cd to parent as a group with the given
+// id, and returns the id of its start node.
+func (d *diagram) addChain(parent *diagramGroup, id string, cd ChainDescription) string {
+	label := "chain"
+	if cd.Name != "" {
+		label += " " + cd.Name
+	}
+	g := &diagramGroup{id: id, label: label}
+	parent.items = append(parent.items, diagramItem{group: g})
+	start := id + "_start"
+	g.items = append(g.items, diagramItem{node: &diagramNode{id: start, label: "Run", start: true}})
+	prev := start
+	nodes := map[string]string{}
+	var phase *diagramGroup
+	for i, rule := range cd.Rules {
+		node := &diagramNode{id: id + "_r" + strconv.Itoa(i), label: ruleLabel(rule)}
+		nodes[rule.Name] = node.id
+		switch {
+		case rule.Phase == "":
+			phase = nil
+			g.items = append(g.items, diagramItem{node: node})
+		case phase != nil && phase.label == "phase "+rule.Phase:
+			phase.items = append(phase.items, diagramItem{node: node})
+		default:
+			phase = &diagramGroup{id: id + "_p" + strconv.Itoa(i), label: "phase " + rule.Phase}
+			phase.items = append(phase.items, diagramItem{node: node})
+			g.items = append(g.items, diagramItem{group: phase})
+		}
+		d.edges = append(d.edges, diagramEdge{from: prev, to: node.id, label: whenLabel(rule)})
+		prev = node.id
+	}
+	if len(cd.Finally) > 0 {
+		finally := &diagramGroup{id: id + "_finally", label: "Finally"}
+		g.items = append(g.items, diagramItem{group: finally})
+		for i, rule := range cd.Finally {
+			node := &diagramNode{id: id + "_f" + strconv.Itoa(i), label: ruleLabel(rule)}
+			finally.items = append(finally.items, diagramItem{node: node})
+			d.edges = append(d.edges, diagramEdge{from: prev, to: node.id, label: whenLabel(rule)})
+			prev = node.id
+		}
+	}
+	for i, sub := range cd.Subchains {
+		from, ok := nodes[sub.Rule]
+		if !ok {
+			from = start
+		}
+		to := d.addChain(g, id+"_s"+strconv.Itoa(i), sub.Chain)
+		d.edges = append(d.edges, diagramEdge{from: from, to: to, label: "Subchain", dashed: true})
+	}
+	return start
+}
+
+// ruleLabel returns the label of the node of the rule.
+func ruleLabel(rule RuleDescription) string {
+	label := rule.Name
+	if len(rule.Kinds) > 0 {
+		label += " [" + strings.Join(rule.Kinds, ", ") + "]"
+	}
+	if rule.LeaderOnly {
+		label += " (leader only)"
+	}
+	return label
+}
+
+// whenLabel returns the label of the edge leading to the rule: its predicate,
+// or nothing if it always runs.
+func whenLabel(rule RuleDescription) string {
+	if rule.When == nil {
+		return ""
+	}
+	return rule.When.String()
+}
+
+// writeMermaid writes the diagram as a Mermaid flowchart.
+func (d *diagram) writeMermaid(sb *strings.Builder) {
+	quote := func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+	}
+	var writeGroup func(g *diagramGroup, indent string)
+	writeGroup = func(g *diagramGroup, indent string) {
+		for _, item := range g.items {
+			switch {
+			case item.node != nil && item.node.start:
+				fmt.Fprintf(sb, "%s%s([%s])\n", indent, item.node.id, quote(item.node.label))
+			case item.node != nil:
+				fmt.Fprintf(sb, "%s%s[%s]\n", indent, item.node.id, quote(item.node.label))
+			default:
+				fmt.Fprintf(sb, "%ssubgraph %s[%s]\n", indent, item.group.id, quote(item.group.label))
+				writeGroup(item.group, indent+"  ")
+				fmt.Fprintf(sb, "%send\n", indent)
+			}
+		}
+	}
+	sb.WriteString("flowchart TD\n")
+	writeGroup(&d.root, "  ")
+	for _, e := range d.edges {
+		arrow := "-->"
+		if e.dashed {
+			arrow = "-.->"
+		}
+		if e.label != "" {
+			arrow += "|" + quote(e.label) + "|"
+		}
+		fmt.Fprintf(sb, "  %s %s %s\n", e.from, arrow, e.to)
+	}
+}
+
+// writeDOT writes the diagram as a Graphviz DOT digraph.
+func (d *diagram) writeDOT(sb *strings.Builder) {
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+	var writeGroup func(g *diagramGroup, indent string)
+	writeGroup = func(g *diagramGroup, indent string) {
+		for _, item := range g.items {
+			switch {
+			case item.node != nil && item.node.start:
+				fmt.Fprintf(sb, "%s%s [label=%s, shape=oval];\n", indent, item.node.id, quote(item.node.label))
+			case item.node != nil:
+				fmt.Fprintf(sb, "%s%s [label=%s];\n", indent, item.node.id, quote(item.node.label))
+			default:
+				fmt.Fprintf(sb, "%ssubgraph cluster_%s {\n", indent, item.group.id)
+				fmt.Fprintf(sb, "%s  label=%s;\n", indent, quote(item.group.label))
+				writeGroup(item.group, indent+"  ")
+				fmt.Fprintf(sb, "%s}\n", indent)
+			}
+		}
+	}
+	sb.WriteString("digraph operchain {\n  node [shape=box];\n")
+	writeGroup(&d.root, "  ")
+	for _, e := range d.edges {
+		var attrs []string
+		if e.label != "" {
+			attrs = append(attrs, "label="+quote(e.label))
+		}
+		if e.dashed {
+			attrs = append(attrs, "style=dashed")
+		}
+		if len(attrs) > 0 {
+			fmt.Fprintf(sb, "  %s -> %s [%s];\n", e.from, e.to, strings.Join(attrs, ", "))
+		} else {
+			fmt.Fprintf(sb, "  %s -> %s;\n", e.from, e.to)
+		}
+	}
+	sb.WriteString("}\n")
+}
@@ -0,0 +1,73 @@
+package operchain
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// diagramChain returns a chain built from the golden spec, with a Finally
+// rule, a finalizer whose cleanup chain runs a further chain, and a subchain
+// run by a rule.
+func diagramChain(t *testing.T) *Chain {
+	ready, count := false, 0
+	c := specChain(&ready, &count)
+	c.Name = "widgets"
+	golden, err := os.ReadFile("testdata/chainspec.yaml")
+	assert.NoError(t, err, "golden spec was not read")
+	rules, err := LoadChainSpec(strings.NewReader(string(golden)), c)
+	assert.NoError(t, err, "golden spec was not loaded")
+	c.Rules = rules
+	c.Finally = []Rule{{Name: "report \"done\"", Do: func(ctx context.Context) {}}}
+
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).Build()
+	archive := &Chain{Name: "archive"}
+	archive.InitializeChain(cl, &struct{ Widget *Widget }{}, []Rule{{Name: "archive", Do: func(ctx context.Context) {}}})
+	cleanup := &Chain{Name: "cleanup"}
+	cleanupRes := &struct{ Widget *Widget }{}
+	cleanup.InitializeChain(cl, cleanupRes, nil)
+	cleanup.Rules = []Rule{{Name: "release", When: cleanup.Exists(&cleanupRes.Widget), Do: cleanup.Subchain(archive)}}
+	c.WithFinalizer("example.com/cleanup", cleanup)
+	return c
+}
+
+// Test_If_WriteDiagram_Renders_Mermaid tests the Mermaid flowchart of a chain
+// against the golden file.
+func Test_If_WriteDiagram_Renders_Mermaid(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteDiagram(&buf, DiagramMermaid, diagramChain(t)), "WriteDiagram returned an error")
+	assertGolden(t, "diagram.mmd", buf.String())
+}
+
+// Test_If_WriteDiagram_Renders_DOT tests the DOT digraph of a chain against
+// the golden file.
+func Test_If_WriteDiagram_Renders_DOT(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteDiagram(&buf, DiagramDOT, diagramChain(t)), "WriteDiagram returned an error")
+	assertGolden(t, "diagram.dot", buf.String())
+}
+
+// Test_If_WriteDiagram_Rejects_An_Unknown_Format tests that an unknown format
+// is an error, and that nothing is written.
+func Test_If_WriteDiagram_Rejects_An_Unknown_Format(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Error(t, WriteDiagram(&buf, "svg", diagramChain(t)), "an unknown format was accepted")
+	assert.Zero(t, buf.Len(), "output was written for an unknown format")
+}
+
+// Test_If_Describe_Terminates_On_Cyclic_Subchains tests that a chain running
+// itself is described by name where it recurs.
+func Test_If_Describe_Terminates_On_Cyclic_Subchains(t *testing.T) {
+	c := &Chain{Name: "loop"}
+	c.Rules = []Rule{{Name: "again", Do: c.Subchain(c)}}
+	d := c.Describe()
+	if assert.Len(t, d.Subchains, 1, "the subchain was not described") {
+		assert.Equal(t, "loop", d.Subchains[0].Chain.Name, "the subchain was not named")
+		assert.Empty(t, d.Subchains[0].Chain.Rules, "the recurring chain was described again")
+	}
+}
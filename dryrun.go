@@ -0,0 +1,181 @@
+package operchain
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DryRunMode says what a chain in dry-run mode does with a write.
+type DryRunMode string
+
+const (
+	// DryRunServer sends writes with the server-side DryRun option, so that
+	// the API server validates them without persisting them.
+	DryRunServer DryRunMode = "Server"
+	// DryRunSuppress does not send writes at all; they succeed without
+	// effect.
+	DryRunSuppress DryRunMode = "Suppress"
+)
+
+// dryRunClient is the Client of a chain in dry-run mode during a Run,
+// intercepting its writes.
+type dryRunClient struct {
+	client.Client
+	chain *Chain
+}
+
+// write issues a write of obj as the mode says, by calling send with whether
+// to send it with the DryRun option, and records it unless mode is empty.
+func (d *dryRunClient) write(mode DryRunMode, verb, subresource string, obj client.Object, fieldOwner, diff string, send func(dryRun bool) error) error {
+	if mode == "" {
+		return send(false)
+	}
+	var err error
+	if mode == DryRunServer {
+		err = send(true)
+	}
+	c := d.chain
+	entry := c.auditEntry(verb, subresource, obj, fieldOwner, diff, err)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.dryRun = append(c.dryRun, entry)
+	return err
+}
+
+// Create creates obj as the chain's DryRun says.
+func (d *dryRunClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	return d.write(d.chain.dryRunMode, "create", "", obj, (&client.CreateOptions{}).ApplyOptions(opts).FieldManager, "", func(dryRun bool) error {
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+		return d.Client.Create(ctx, obj, opts...)
+	})
+}
+
+// Update updates obj as the chain's DryRun says.
+func (d *dryRunClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return d.write(d.chain.dryRunMode, "update", "", obj, (&client.UpdateOptions{}).ApplyOptions(opts).FieldManager, "", func(dryRun bool) error {
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+		return d.Client.Update(ctx, obj, opts...)
+	})
+}
+
+// Patch patches obj as the chain's DryRun says.
+func (d *dryRunClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return d.write(d.chain.dryRunMode, "patch", "", obj, (&client.PatchOptions{}).ApplyOptions(opts).FieldManager, patchDiff(patch, obj), func(dryRun bool) error {
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+		return d.Client.Patch(ctx, obj, patch, opts...)
+	})
+}
+
+// Delete deletes obj as the chain's DryRun says.
+func (d *dryRunClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	return d.write(d.chain.dryRunMode, "delete", "", obj, "", "", func(dryRun bool) error {
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+		return d.Client.Delete(ctx, obj, opts...)
+	})
+}
+
+// DeleteAllOf deletes the objects of the type of obj as the chain's DryRun
+// says.
+func (d *dryRunClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	return d.write(d.chain.dryRunMode, "deletecollection", "", obj, "", "", func(dryRun bool) error {
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+		return d.Client.DeleteAllOf(ctx, obj, opts...)
+	})
+}
+
+// Status returns a writer of the status subresource intercepting its writes.
+func (d *dryRunClient) Status() client.SubResourceWriter {
+	return d.SubResource("status")
+}
+
+// SubResource returns a client of the subresource intercepting its writes.
+func (d *dryRunClient) SubResource(subresource string) client.SubResourceClient {
+	return &dryRunSubResourceClient{SubResourceClient: d.Client.SubResource(subresource), dryRun: d, subresource: subresource}
+}
+
+// dryRunSubResourceClient is a subresource client of a dryRunClient.
+type dryRunSubResourceClient struct {
+	client.SubResourceClient
+	dryRun      *dryRunClient
+	subresource string
+}
+
+// mode returns the DryRunMode of the writes of the subresource.
+func (s *dryRunSubResourceClient) mode() DryRunMode {
+	c := s.dryRun.chain
+	if s.subresource == "status" {
+		return c.dryRunStatusMode
+	}
+	return c.dryRunMode
+}
+
+// Create creates the subresource of obj as the chain's dry-run mode says.
+func (s *dryRunSubResourceClient) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	return s.dryRun.write(s.mode(), "create", s.subresource, obj, (&client.SubResourceCreateOptions{}).ApplyOptions(opts).FieldManager, "", func(dryRun bool) error {
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+		return s.SubResourceClient.Create(ctx, obj, subResource, opts...)
+	})
+}
+
+// Update updates the subresource of obj as the chain's dry-run mode says.
+func (s *dryRunSubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	return s.dryRun.write(s.mode(), "update", s.subresource, obj, (&client.SubResourceUpdateOptions{}).ApplyOptions(opts).FieldManager, "", func(dryRun bool) error {
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+		return s.SubResourceClient.Update(ctx, obj, opts...)
+	})
+}
+
+// Patch patches the subresource of obj as the chain's dry-run mode says.
+func (s *dryRunSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	return s.dryRun.write(s.mode(), "patch", s.subresource, obj, (&client.SubResourcePatchOptions{}).ApplyOptions(opts).FieldManager, patchDiff(patch, obj), func(dryRun bool) error {
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+		return s.SubResourceClient.Patch(ctx, obj, patch, opts...)
+	})
+}
+
+// startDryRun makes the chain's Client intercept the writes of the Run if the
+// chain is in dry-run mode, or if its LeaderPolicy makes the Run read-only,
+// and returns a function restoring it.
+func (c *Chain) startDryRun() func() {
+	c.dryRun = nil
+	c.dryRunMode, c.dryRunStatusMode = c.DryRun, c.DryRunStatus
+	if c.simulating {
+		c.dryRunMode, c.dryRunStatusMode = DryRunSuppress, DryRunSuppress
+	}
+	if c.dryRunStatusMode == "" {
+		c.dryRunStatusMode = c.dryRunMode
+	}
+	if c.LeaderPolicy == LeaderPolicyReadOnlyWhenFollower && !c.isLeader() {
+		if c.dryRunMode == "" {
+			c.dryRunMode = DryRunSuppress
+		}
+		if c.dryRunStatusMode == "" {
+			c.dryRunStatusMode = DryRunSuppress
+		}
+	}
+	if c.Client == nil || (c.dryRunMode == "" && c.dryRunStatusMode == "") {
+		return func() {}
+	}
+	base := c.Client
+	c.Client = &dryRunClient{Client: base, chain: c}
+	return func() {
+		c.Client = base
+	}
+}
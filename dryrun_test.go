@@ -0,0 +1,90 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// dryRunReport runs a chain in the given dry-run modes whose rules create a
+// ConfigMap, patch and set a condition on the Widget, and delete a ConfigMap
+// through the client, and returns its report and the client.
+func dryRunReport(t *testing.T, mode, statusMode DryRunMode) (*RunReport, client.Client) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	old := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "old", Namespace: "default"}}
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget, old).WithStatusSubresource(widget).Build()
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{DryRun: mode, DryRunStatus: statusMode}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: c.CreateIfNotExists(func() client.Object {
+			return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+		})},
+		{Do: c.PatchMerge(&res.Widget, func(obj client.Object) error {
+			obj.SetLabels(map[string]string{"reconciled": "true"})
+			return nil
+		})},
+		{Do: c.SetCondition(&res.Widget, metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Ready"})},
+		{Do: c.Try(func(ctx context.Context) error {
+			return c.Client.Delete(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "old", Namespace: "default"}})
+		})},
+	})
+	report, err := c.RunWithReport(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run returned an error")
+	return report, cl
+}
+
+// assertNothingPersisted asserts that the writes of the chain of dryRunReport
+// were not persisted.
+func assertNothingPersisted(t *testing.T, cl client.Client) {
+	ctx := context.Background()
+	err := cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "demo"}, &corev1.ConfigMap{})
+	assert.True(t, apierrors.IsNotFound(err), "ConfigMap was created")
+	assert.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "old"}, &corev1.ConfigMap{}), "ConfigMap was deleted")
+	w := &Widget{}
+	assert.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "demo"}, w))
+	assert.Empty(t, w.Labels, "Widget was patched")
+	assert.Empty(t, w.Status.Conditions, "status was written")
+}
+
+// dryRunVerbs returns the verbs and subresources of the entries.
+func dryRunVerbs(entries []AuditEntry) []string {
+	var verbs []string
+	for _, entry := range entries {
+		verb := entry.Verb + " " + entry.Name
+		if entry.Subresource != "" {
+			verb += "/" + entry.Subresource
+		}
+		verbs = append(verbs, verb)
+	}
+	return verbs
+}
+
+// Test_If_Suppressing_Dry_Run_Persists_Nothing tests that a chain suppressing
+// its writes persists nothing, whether they are issued by its actions or
+// through its Client, and reports them.
+func Test_If_Suppressing_Dry_Run_Persists_Nothing(t *testing.T) {
+	report, cl := dryRunReport(t, DryRunSuppress, "")
+	assertNothingPersisted(t, cl)
+	assert.Equal(t, []string{"create demo", "patch demo", "update demo/status", "delete old"}, dryRunVerbs(report.DryRun), "intended writes were not reported")
+	assert.Contains(t, report.DryRun[1].Diff, `"reconciled":"true"`, "patch was not reported")
+	assert.Len(t, report.Audit, 4, "intercepted writes were not audited")
+}
+
+// Test_If_Server_Dry_Run_Sends_Writes_With_DryRun tests that a chain in
+// server-side dry-run mode sends its writes with the DryRun option, and that
+// DryRunStatus suppresses status writes separately.
+func Test_If_Server_Dry_Run_Sends_Writes_With_DryRun(t *testing.T) {
+	report, cl := dryRunReport(t, DryRunServer, DryRunSuppress)
+	assertNothingPersisted(t, cl)
+	assert.Equal(t, []string{"create demo", "patch demo", "update demo/status", "delete old"}, dryRunVerbs(report.DryRun), "intended writes were not reported")
+}
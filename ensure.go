@@ -0,0 +1,412 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// OperationResultRecreated means that the object was deleted and created
+// again, because it could not be updated.
+const OperationResultRecreated controllerutil.OperationResult = "recreated"
+
+// UpdateStrategy is how Ensure corrects a drifted object.
+type UpdateStrategy int
+
+const (
+	// StrategyUpdate updates the live object with the fields of the desired
+	// object, keeping the fields the desired object does not set.
+	StrategyUpdate UpdateStrategy = iota
+	// StrategyApply server-side applies the desired object.
+	StrategyApply
+	// StrategyRecreate updates the live object as StrategyUpdate does, but if
+	// the API server rejects the update as invalid, e.g. because it changes an
+	// immutable field, deletes the object and creates it again.
+	StrategyRecreate
+)
+
+// Comparator compares the desired state of an object with the live object, and
+// returns a description of their differences, one per line, or "" if the live
+// object has drifted in no way that matters.
+type Comparator func(ctx context.Context, cl client.Client, desired, live client.Object) (string, error)
+
+// ensureOptions holds the options of Ensure.
+type ensureOptions struct {
+	owned      bool
+	fieldOwner string
+	strategy   UpdateStrategy
+	compare    Comparator
+}
+
+// EnsureOption configures Ensure.
+type EnsureOption func(o *ensureOptions)
+
+// EnsureOwned makes the primary resource the controller owner of the object.
+// An object not controlled by the primary resource has drifted.
+func EnsureOwned() EnsureOption {
+	return func(o *ensureOptions) {
+		o.owned = true
+	}
+}
+
+// EnsureFieldOwner sets the field manager of the writes, overriding the
+// Chain's FieldOwner.
+func EnsureFieldOwner(owner string) EnsureOption {
+	return func(o *ensureOptions) {
+		o.fieldOwner = owner
+	}
+}
+
+// EnsureStrategy sets how a drifted object is corrected. It is StrategyUpdate
+// by default.
+func EnsureStrategy(strategy UpdateStrategy) EnsureOption {
+	return func(o *ensureOptions) {
+		o.strategy = strategy
+	}
+}
+
+// EnsureComparator sets how drift is detected. It is SemanticDiff by default.
+func EnsureComparator(compare Comparator) EnsureOption {
+	return func(o *ensureOptions) {
+		o.compare = compare
+	}
+}
+
+// Ensure returns an action that makes the object in the given resource field
+// equal to the object returned by generate: it creates the object if the field
+// is not loaded, and otherwise writes it only if the comparator finds that the
+// live object has drifted. The difference is recorded in the run report and
+// makes Drifted true for the rest of the Run. On success, the field holds the
+// object returned by the API server. If the chain tracks its objects, the
+// object is labeled for PruneTracked.
+func (c *Chain) Ensure(fieldPtr interface{}, generate func() (client.Object, error), opts ...EnsureOption) Action {
+	return writes(c.Try(c.EnsureE(fieldPtr, generate, opts...)), fieldTarget(fieldPtr, ""))
+}
+
+// EnsureE is like Ensure, but returns the error.
+func (c *Chain) EnsureE(fieldPtr interface{}, generate func() (client.Object, error), opts ...EnsureOption) ActionE {
+	checkField(fieldPtr)
+	o := &ensureOptions{compare: SemanticDiff}
+	for _, opt := range opts {
+		opt(o)
+	}
+	field := reflect.ValueOf(fieldPtr).Elem()
+	return func(ctx context.Context) error {
+		desired, err := generate()
+		if err != nil {
+			return err
+		}
+		if reflect.TypeOf(desired) != field.Type() {
+			return fmt.Errorf("ensure %s/%s: generated %T for a field of type %s", desired.GetNamespace(), desired.GetName(), desired, field.Type())
+		}
+		if err := c.track(desired); err != nil {
+			return err
+		}
+		if o.owned {
+			if err := c.ownByPrimary(desired, true); err != nil {
+				return err
+			}
+		}
+		live := objectAt(fieldPtr)
+		if live == nil {
+			if err := c.ensureCreate(ctx, desired, o); err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(desired))
+			return nil
+		}
+		diff, err := o.compare(ctx, c.Client, desired, live)
+		if err != nil {
+			return fmt.Errorf("compare %s/%s: %w", live.GetNamespace(), live.GetName(), err)
+		}
+		if primary := c.primary(); o.owned && primary != nil && !metav1.IsControlledBy(live, primary) {
+			diff = strings.TrimPrefix(diff+"\nmetadata.ownerReferences: not controlled by "+c.describe(primary), "\n")
+		}
+		if diff == "" {
+			c.recordOperation(live, controllerutil.OperationResultNone)
+			return nil
+		}
+		c.setDrifted(fieldPtr)
+		rendered := c.renderDiff(ctx, live, desired)
+		written, result, err := c.ensureWrite(ctx, desired, live, o)
+		if err != nil {
+			return err
+		}
+		c.recordWrite(written, result, diff, rendered)
+		field.Set(reflect.ValueOf(written))
+		return nil
+	}
+}
+
+// Drifted returns a predicate that is true when an Ensure action earlier in the
+// Run found that the object in the given resource field had drifted from its
+// desired state.
+func (c *Chain) Drifted(fieldPtr interface{}) *predicate {
+	checkField(fieldPtr)
+	return pcache.NewLeaf(fmt.Sprintf("Drifted(%s)", c.fieldName(fieldPtr)), func(e *pcache.Evaluation) bool {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return c.drifted[fieldPtr]
+	})
+}
+
+// setDrifted records that the object in the resource field drifted, and
+// discards the values of the predicates evaluated so far in the run so that
+// later rules see it.
+func (c *Chain) setDrifted(fieldPtr interface{}) {
+	c.lock.Lock()
+	if c.drifted == nil {
+		c.drifted = map[interface{}]bool{}
+	}
+	c.drifted[fieldPtr] = true
+	c.lock.Unlock()
+	c.invalidateRun()
+}
+
+// ensureCreate creates the desired object.
+func (c *Chain) ensureCreate(ctx context.Context, desired client.Object, o *ensureOptions) error {
+	rendered := c.renderDiff(ctx, nil, desired)
+	if o.strategy == StrategyApply {
+		if err := c.sendApply(ctx, desired, c.ensureApplyOptions(o)); err != nil {
+			return err
+		}
+		c.recordWrite(desired, OperationResultApplied, "", rendered)
+		return nil
+	}
+	if err := c.Create(ctx, desired, client.FieldOwner(c.ensureFieldOwner(o))); err != nil {
+		return fmt.Errorf("create %s/%s: %w", desired.GetNamespace(), desired.GetName(), err)
+	}
+	c.recordWrite(desired, controllerutil.OperationResultCreated, "", rendered)
+	return nil
+}
+
+// ensureWrite corrects the drifted live object according to the strategy, and
+// returns the written object and what was done.
+func (c *Chain) ensureWrite(ctx context.Context, desired, live client.Object, o *ensureOptions) (client.Object, controllerutil.OperationResult, error) {
+	if o.strategy == StrategyApply {
+		if err := c.sendApply(ctx, desired, c.ensureApplyOptions(o)); err != nil {
+			return nil, "", err
+		}
+		return desired, OperationResultApplied, nil
+	}
+	updated, err := overlay(live, desired)
+	if err != nil {
+		return nil, "", fmt.Errorf("update %s/%s: %w", live.GetNamespace(), live.GetName(), err)
+	}
+	if o.owned {
+		if err := c.ownByPrimary(updated, true); err != nil {
+			return nil, "", err
+		}
+	}
+	err = c.Update(ctx, updated, client.FieldOwner(c.ensureFieldOwner(o)))
+	switch {
+	case err == nil:
+		return updated, controllerutil.OperationResultUpdated, nil
+	case o.strategy != StrategyRecreate || !apierrors.IsInvalid(err):
+		return nil, "", fmt.Errorf("update %s/%s: %w", live.GetNamespace(), live.GetName(), err)
+	}
+	uid := live.GetUID()
+	if err := c.Delete(ctx, live, client.Preconditions{UID: &uid}); err != nil && !apierrors.IsNotFound(err) {
+		return nil, "", fmt.Errorf("delete %s/%s: %w", live.GetNamespace(), live.GetName(), err)
+	}
+	if err := c.Create(ctx, desired, client.FieldOwner(c.ensureFieldOwner(o))); err != nil {
+		return nil, "", fmt.Errorf("create %s/%s: %w", desired.GetNamespace(), desired.GetName(), err)
+	}
+	return desired, OperationResultRecreated, nil
+}
+
+// ensureApplyOptions returns the options of the apply patches of Ensure.
+func (c *Chain) ensureApplyOptions(o *ensureOptions) *applyOptions {
+	return &applyOptions{fieldOwner: o.fieldOwner, force: true}
+}
+
+// ensureFieldOwner returns the field manager of the writes of Ensure.
+func (c *Chain) ensureFieldOwner(o *ensureOptions) string {
+	return c.fieldOwner(c.ensureApplyOptions(o))
+}
+
+// overlay returns a copy of live with the fields set in desired, other than
+// status and the metadata managed by the API server.
+func overlay(live, desired client.Object) (client.Object, error) {
+	liveMap, err := contentOf(live)
+	if err != nil {
+		return nil, err
+	}
+	desiredMap, err := contentOf(desired)
+	if err != nil {
+		return nil, err
+	}
+	mergeContent(liveMap, stripContent(desiredMap))
+	updated := live.DeepCopyObject().(client.Object)
+	if u, ok := updated.(*unstructured.Unstructured); ok {
+		u.Object = liveMap
+		return u, nil
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(liveMap, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// mergeContent sets the fields of src in dst, merging maps and replacing
+// everything else.
+func mergeContent(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if srcMap, ok := v.(map[string]interface{}); ok {
+			if dstMap, ok := dst[k].(map[string]interface{}); ok {
+				mergeContent(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// contentOf returns a copy of the content of obj as unstructured data.
+func contentOf(obj client.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return runtime.DeepCopyJSON(u.Object), nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
+
+// stripContent removes the status, type, and metadata other than labels and
+// annotations from content, for comparing desired and live objects.
+func stripContent(content map[string]interface{}) map[string]interface{} {
+	delete(content, "status")
+	delete(content, "apiVersion")
+	delete(content, "kind")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		kept := map[string]interface{}{}
+		for _, k := range []string{"labels", "annotations"} {
+			if v, ok := metadata[k]; ok {
+				kept[k] = v
+			}
+		}
+		content["metadata"] = kept
+	}
+	return content
+}
+
+// SemanticDiff is the default Comparator of Ensure. It compares the fields set
+// in the desired object with those of the live object, ignoring the fields the
+// desired object leaves unset, which the API server may have defaulted, as well
+// as status and the metadata other than labels and annotations.
+func SemanticDiff(ctx context.Context, cl client.Client, desired, live client.Object) (string, error) {
+	desiredMap, err := contentOf(desired)
+	if err != nil {
+		return "", err
+	}
+	liveMap, err := contentOf(live)
+	if err != nil {
+		return "", err
+	}
+	var diffs []string
+	diffContent("", stripContent(desiredMap), stripContent(liveMap), false, &diffs)
+	return strings.Join(diffs, "\n"), nil
+}
+
+// DryRunApplyDiff returns a Comparator that server-side applies the desired
+// object as the given field manager in dry-run mode, and compares the result
+// with the live object. It finds drift that SemanticDiff cannot, such as
+// fields the field manager no longer sets, at the cost of a request.
+func DryRunApplyDiff(fieldOwner string) Comparator {
+	return func(ctx context.Context, cl client.Client, desired, live client.Object) (string, error) {
+		applied := desired.DeepCopyObject().(client.Object)
+		gvk, err := apiutil.GVKForObject(applied, cl.Scheme())
+		if err != nil {
+			return "", err
+		}
+		applied.GetObjectKind().SetGroupVersionKind(gvk)
+		applied.SetManagedFields(nil)
+		if err := cl.Patch(ctx, applied, client.Apply, client.DryRunAll, client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+			return "", err
+		}
+		appliedMap, err := contentOf(applied)
+		if err != nil {
+			return "", err
+		}
+		liveMap, err := contentOf(live)
+		if err != nil {
+			return "", err
+		}
+		var diffs []string
+		diffContent("", stripContent(appliedMap), stripContent(liveMap), true, &diffs)
+		return strings.Join(diffs, "\n"), nil
+	}
+}
+
+// diffContent appends to diffs a line for each field of desired that differs
+// in live, and if all is true, for each field of live missing from desired.
+func diffContent(path string, desired, live interface{}, all bool, diffs *[]string) {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		if all {
+			for k := range l {
+				if _, ok := d[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffContent(strings.TrimPrefix(path+"."+k, "."), d[k], l[k], all, diffs)
+		}
+		return
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			break
+		}
+		for i := range d {
+			diffContent(fmt.Sprintf("%s[%d]", path, i), d[i], l[i], all, diffs)
+		}
+		return
+	case nil:
+		if !all || live == nil {
+			return
+		}
+	}
+	if !reflect.DeepEqual(normalizeNumber(desired), normalizeNumber(live)) {
+		*diffs = append(*diffs, fmt.Sprintf("%s: %s -> %s", path, describeValue(live), describeValue(desired)))
+	}
+}
+
+// normalizeNumber converts the integers decoded from JSON to int64, so that
+// equal numbers compare equal.
+func normalizeNumber(v interface{}) interface{} {
+	if n, ok := toInt64(v); ok {
+		if f, isFloat := v.(float64); !isFloat || float64(n) == f {
+			return n
+		}
+	}
+	return v
+}
+
+// describeValue formats a value for a diff.
+func describeValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,114 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// ensureChain returns a chain that ensures a ConfigMap holding value, immutable
+// if immutable is true, with the given options. It also returns the client, a
+// counter of updates, and whether the last Run found drift. Updates of
+// immutable ConfigMaps fail as the API server's do.
+func ensureChain(value *string, immutable bool, opts ...EnsureOption) (*Chain, client.Client, *int, *bool) {
+	updates := 0
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).
+		WithObjects(&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", UID: "widget-uid"}}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Update: func(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				updates++
+				stored := &corev1.ConfigMap{}
+				if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), stored); err == nil && ptr.Deref(stored.Immutable, false) {
+					return apierrors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, obj.GetName(), field.ErrorList{
+						field.Forbidden(field.NewPath("data"), "field is immutable when `immutable` is set"),
+					})
+				}
+				return cl.Update(ctx, obj, opts...)
+			},
+		}).Build()
+	var res struct {
+		Widget    *Widget
+		ConfigMap *corev1.ConfigMap
+	}
+	drifted := false
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: func(context.Context) { drifted = false }},
+		{Do: c.Ensure(&res.ConfigMap, func() (client.Object, error) {
+			return &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+				Immutable:  ptr.To(immutable),
+				Data:       map[string]string{"key": *value},
+			}, nil
+		}, opts...)},
+		{When: c.Drifted(&res.ConfigMap), Do: func(context.Context) { drifted = true }},
+	})
+	return c, cl, &updates, &drifted
+}
+
+// Test_If_Ensure_Corrects_Only_Drift tests that Ensure creates the object,
+// does not write it while it matches, and updates it with a recorded diff once
+// it drifts.
+func Test_If_Ensure_Corrects_Only_Drift(t *testing.T) {
+	value := "a"
+	c, cl, updates, drifted := ensureChain(&value, false, EnsureOwned())
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	report, err := c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, "created", string(report.Operations[0].Result), "object was not created")
+
+	report, err = c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 0, *updates, "matching object was written")
+	assert.False(t, *drifted, "matching object drifted")
+	assert.Equal(t, "unchanged", string(report.Operations[0].Result), "matching object was not reported")
+
+	cm := &corev1.ConfigMap{}
+	assert.NoError(t, cl.Get(context.Background(), req.NamespacedName, cm))
+	cm.Data["key"] = "drifted"
+	assert.NoError(t, cl.Update(context.Background(), cm))
+	*updates = 0
+	report, err = c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.True(t, *drifted, "drift was not detected")
+	assert.Equal(t, 1, *updates, "drift was not corrected")
+	assert.Equal(t, "data.key: drifted -> a", report.Operations[0].Diff, "diff was not reported")
+	assert.NoError(t, cl.Get(context.Background(), req.NamespacedName, cm))
+	assert.Equal(t, "a", cm.Data["key"], "drift was not corrected")
+}
+
+// Test_If_Ensure_Recreates_On_Immutable_Field_Change tests that the recreate
+// strategy deletes and creates an object that cannot be updated.
+func Test_If_Ensure_Recreates_On_Immutable_Field_Change(t *testing.T) {
+	value := "a"
+	c, cl, _, _ := ensureChain(&value, true, EnsureStrategy(StrategyRecreate))
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+
+	value = "b"
+	report, err := c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, OperationResultRecreated, report.Operations[0].Result, "object was not recreated")
+	cm := &corev1.ConfigMap{}
+	assert.NoError(t, cl.Get(context.Background(), req.NamespacedName, cm))
+	assert.Equal(t, "b", cm.Data["key"], "object was not recreated")
+
+	value = "c"
+	c, _, _, _ = ensureChain(&value, true)
+	c.Client = cl
+	_, err = c.Run(context.Background(), req)
+	assert.True(t, apierrors.IsInvalid(err), "immutable field was updated without the recreate strategy")
+}
@@ -0,0 +1,186 @@
+// Package envtesting runs operchain chains in a manager against a real API
+// server, started with envtest or given by a rest.Config, so that tests
+// exercise what fake clients do not: server-side apply field ownership,
+// defaulting, and validation.
+package envtesting
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/smxlong/operchain"
+)
+
+// DefaultPollInterval is how often WaitForReconcile reads the object.
+const DefaultPollInterval = 100 * time.Millisecond
+
+// options holds the options of New.
+type options struct {
+	config   *rest.Config
+	scheme   *runtime.Scheme
+	crdPaths []string
+	crds     []*apiextensionsv1.CustomResourceDefinition
+}
+
+// Option configures New.
+type Option func(o *options)
+
+// WithConfig runs against the API server of the config, e.g. of a kind
+// cluster, instead of starting one with envtest.
+func WithConfig(config *rest.Config) Option {
+	return func(o *options) {
+		o.config = config
+	}
+}
+
+// WithScheme makes the manager and client use the scheme, e.g. for custom
+// resources. The types of client-go are added to it.
+func WithScheme(scheme *runtime.Scheme) Option {
+	return func(o *options) {
+		o.scheme = scheme
+	}
+}
+
+// WithCRDPaths installs the CRDs of the files, or of the files of the
+// directories, at the paths. A missing path is an error.
+func WithCRDPaths(paths ...string) Option {
+	return func(o *options) {
+		o.crdPaths = append(o.crdPaths, paths...)
+	}
+}
+
+// WithCRDs installs the CRDs.
+func WithCRDs(crds ...*apiextensionsv1.CustomResourceDefinition) Option {
+	return func(o *options) {
+		o.crds = append(o.crds, crds...)
+	}
+}
+
+// Environment is an API server with the CRDs installed and a manager for the
+// chains under test.
+type Environment struct {
+	// Config is the config of the API server.
+	Config *rest.Config
+	// Client reads and writes the API server directly, without a cache.
+	Client client.Client
+	// Manager is the manager the chains are set up with. It starts with
+	// Start.
+	Manager manager.Manager
+}
+
+// New starts an API server with envtest, unless given one WithConfig,
+// installs the CRDs, and builds a manager for it, failing the test if it
+// cannot. Everything is stopped when the test ends, even if it fails.
+// envtest needs the binaries of the API server and etcd, found by the
+// KUBEBUILDER_ASSETS environment variable.
+func New(t testing.TB, opts ...Option) *Environment {
+	t.Helper()
+	o := &options{scheme: runtime.NewScheme()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := clientgoscheme.AddToScheme(o.scheme); err != nil {
+		t.Fatalf("envtesting: %s", err)
+	}
+	env := &envtest.Environment{
+		Scheme:                o.scheme,
+		CRDDirectoryPaths:     o.crdPaths,
+		CRDs:                  o.crds,
+		ErrorIfCRDPathMissing: true,
+	}
+	if o.config != nil {
+		env.Config = o.config
+		env.UseExistingCluster = ptr.To(true)
+	}
+	config, err := env.Start()
+	if err != nil {
+		t.Fatalf("envtesting: start API server: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := env.Stop(); err != nil {
+			t.Errorf("envtesting: stop API server: %s", err)
+		}
+	})
+	c, err := client.New(config, client.Options{Scheme: o.scheme})
+	if err != nil {
+		t.Fatalf("envtesting: build client: %s", err)
+	}
+	mgr, err := manager.New(config, manager.Options{
+		Scheme:                 o.scheme,
+		Metrics:                metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+	})
+	if err != nil {
+		t.Fatalf("envtesting: build manager: %s", err)
+	}
+	return &Environment{Config: config, Client: c, Manager: mgr}
+}
+
+// Setup sets the chain up with the manager, as SetupWithManager does,
+// failing the test if it cannot. Set up every chain before Start.
+func (e *Environment) Setup(t testing.TB, chain *operchain.Chain, opts operchain.ControllerOptions) {
+	t.Helper()
+	if _, err := chain.SetupWithManager(e.Manager, opts); err != nil {
+		t.Fatalf("envtesting: set up chain: %s", err)
+	}
+}
+
+// Start starts the manager and waits for its caches to sync. The manager is
+// stopped when the test ends, before the API server is.
+func (e *Environment) Start(t testing.TB) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := e.Manager.Start(ctx); err != nil {
+			t.Errorf("envtesting: manager stopped: %s", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	if !e.Manager.GetCache().WaitForCacheSync(ctx) {
+		t.Fatalf("envtesting: caches did not sync")
+	}
+}
+
+// WaitForReconcile reads the object with the key into obj until cond returns
+// true for it, or the timeout passes, which fails the test with the last
+// error, if any. cond is not called while the object cannot be read, e.g. is
+// not yet created. It returns true if cond held.
+func (e *Environment) WaitForReconcile(t testing.TB, key types.NamespacedName, obj client.Object, cond func(obj client.Object) bool, timeout time.Duration) bool {
+	t.Helper()
+	var lastErr error
+	err := wait.PollUntilContextTimeout(context.Background(), DefaultPollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		if lastErr = e.Client.Get(ctx, key, obj); lastErr != nil {
+			return false, nil
+		}
+		return cond(obj), nil
+	})
+	if err == nil {
+		return true
+	}
+	if lastErr == nil {
+		lastErr = errors.New("condition does not hold")
+	}
+	t.Errorf("envtesting: waiting for %s for %s: %s", key, timeout, lastErr)
+	return false
+}
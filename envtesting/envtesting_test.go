@@ -0,0 +1,59 @@
+package envtesting_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain"
+	"github.com/smxlong/operchain/envtesting"
+)
+
+// envtestVariable is the environment variable enabling the tests needing an
+// API server, which unit CI leaves unset.
+const envtestVariable = "OPERCHAIN_ENVTEST"
+
+// Test_If_Chain_Reconciles_Against_An_API_Server tests that a chain set up
+// with the manager of an Environment creates the Secret of an app ConfigMap
+// on a real API server.
+func Test_If_Chain_Reconciles_Against_An_API_Server(t *testing.T) {
+	if os.Getenv(envtestVariable) == "" {
+		t.Skipf("set %s to run the tests against an API server", envtestVariable)
+	}
+	env := envtesting.New(t)
+	var res struct {
+		App    *corev1.ConfigMap `operchain:"primary"`
+		Secret *corev1.Secret
+	}
+	c := &operchain.Chain{Name: "app"}
+	c.InitializeFromManager(env.Manager, &res, []operchain.Rule{
+		{
+			When: operchain.And(c.Exists(&res.App), operchain.Not(c.Exists(&res.Secret))),
+			Do: c.Ensure(&res.Secret, func() (client.Object, error) {
+				return &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: res.App.Name, Namespace: res.App.Namespace},
+					StringData: map[string]string{"app": res.App.Data["app"]},
+				}, nil
+			}),
+		},
+	})
+	env.Setup(t, c, operchain.ControllerOptions{})
+	env.Start(t)
+
+	app := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Data:       map[string]string{"app": "demo"},
+	}
+	if err := env.Client.Create(context.Background(), app); err != nil {
+		t.Fatalf("create ConfigMap: %s", err)
+	}
+	env.WaitForReconcile(t, types.NamespacedName{Namespace: "default", Name: "demo"}, &corev1.Secret{}, func(obj client.Object) bool {
+		return string(obj.(*corev1.Secret).Data["app"]) == "demo"
+	}, 30*time.Second)
+}
@@ -0,0 +1,147 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ErrorConditionRule maps the errors of Runs to a condition of the primary
+// resource, for the chain's ErrorConditionPolicy.
+type ErrorConditionRule struct {
+	// Match returns true for the errors the rule applies to, e.g.
+	// apierrors.IsNotFound, or the functions returned by ErrorIs and
+	// ErrorAs. If nil, the rule applies to every error.
+	Match func(err error) bool
+	// Condition is the condition set on the primary resource. Its Message
+	// may be a text/template template of ErrorConditionData, e.g.
+	// "{{.Error}}"; its Reason is used as is, so that a successful Run can
+	// recognize the conditions set by the policy.
+	Condition metav1.Condition
+}
+
+// ErrorConditionData is the data of the Message templates of
+// ErrorConditionRules.
+type ErrorConditionData struct {
+	ConditionData
+	// Error is the message of the error of the Run.
+	Error string
+}
+
+// ErrorIs returns a match for ErrorConditionRule that is true for the errors
+// that are target, as errors.Is says.
+func ErrorIs(target error) func(err error) bool {
+	return func(err error) bool {
+		return errors.Is(err, target)
+	}
+}
+
+// ErrorAs returns a match for ErrorConditionRule that is true for the errors
+// that have an error of type T in their chain, as errors.As says.
+func ErrorAs[T error]() func(err error) bool {
+	return func(err error) bool {
+		var target T
+		return errors.As(err, &target)
+	}
+}
+
+// validateErrorConditions returns the errors of the Message templates of the
+// ErrorConditionPolicy.
+func (c *Chain) validateErrorConditions() []error {
+	var errs []error
+	for i, rule := range c.ErrorConditionPolicy {
+		if _, err := template.New("message").Parse(rule.Condition.Message); err != nil {
+			errs = append(errs, fmt.Errorf("error condition rule %d: %w", i, err))
+		}
+	}
+	return errs
+}
+
+// applyErrorConditions applies the chain's ErrorConditionPolicy to the
+// primary resource at the end of the Run, before its batched status is
+// written. A Run that fails sets the condition of the first rule matching its
+// error. A Run that succeeds removes the conditions whose type and reason are
+// those of a rule of the policy.
+func (c *Chain) applyErrorConditions(ctx context.Context) {
+	if len(c.ErrorConditionPolicy) == 0 || c.primary() == nil {
+		return
+	}
+	fieldPtr := c.primaryField().Addr().Interface()
+	c.lock.Lock()
+	runErr := c.err
+	c.lock.Unlock()
+	var err error
+	if runErr != nil {
+		err = c.setErrorCondition(ctx, fieldPtr, runErr)
+	} else {
+		err = c.clearErrorConditions(ctx, fieldPtr)
+	}
+	if err != nil {
+		log.FromContext(ctx).Error(err, "cannot apply the error condition policy")
+		if runErr == nil {
+			c.doError(err)
+		}
+	}
+}
+
+// setErrorCondition sets the condition of the first rule of the policy
+// matching err on the object in the resource field.
+func (c *Chain) setErrorCondition(ctx context.Context, fieldPtr interface{}, err error) error {
+	for _, rule := range c.ErrorConditionPolicy {
+		if rule.Match != nil && !rule.Match(err) {
+			continue
+		}
+		cond := rule.Condition
+		message, parseErr := template.New("message").Parse(cond.Message)
+		if parseErr != nil {
+			return parseErr
+		}
+		data := ErrorConditionData{ConditionData: c.conditionData(), Error: err.Error()}
+		if cond.Message, parseErr = renderTemplate(message, data); parseErr != nil {
+			return parseErr
+		}
+		if cond.LastTransitionTime.IsZero() {
+			cond.LastTransitionTime = metav1.NewTime(c.now())
+		}
+		return c.updateStatusLater(ctx, fieldPtr, func(obj client.Object) error {
+			cond := cond
+			cond.ObservedGeneration = obj.GetGeneration()
+			_, err := updateConditions(obj, func(conditions *[]metav1.Condition) bool {
+				return meta.SetStatusCondition(conditions, cond)
+			})
+			return err
+		})
+	}
+	return nil
+}
+
+// clearErrorConditions removes the conditions set by the policy from the
+// object in the resource field, writing its status only if there are any.
+func (c *Chain) clearErrorConditions(ctx context.Context, fieldPtr interface{}) error {
+	remove := func(conditions *[]metav1.Condition) bool {
+		changed := false
+		for _, rule := range c.ErrorConditionPolicy {
+			cond := meta.FindStatusCondition(*conditions, rule.Condition.Type)
+			if cond != nil && cond.Reason == rule.Condition.Reason {
+				changed = meta.RemoveStatusCondition(conditions, rule.Condition.Type) || changed
+			}
+		}
+		return changed
+	}
+	// Look for them in a copy first, so that Runs without them do not read
+	// the object afresh.
+	found, err := updateConditions(objectAt(fieldPtr).DeepCopyObject().(client.Object), remove)
+	if err != nil || !found {
+		return err
+	}
+	return c.updateStatusLater(ctx, fieldPtr, func(obj client.Object) error {
+		_, err := updateConditions(obj, remove)
+		return err
+	})
+}
@@ -0,0 +1,136 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// readyPolicy is the error condition policy of the tests.
+var readyPolicy = []ErrorConditionRule{
+	{
+		Match:     apierrors.IsNotFound,
+		Condition: metav1.Condition{Type: "Ready", Status: metav1.ConditionFalse, Reason: "MissingDependency", Message: "{{.Error}}"},
+	},
+	{
+		Match:     ErrorIs(reconcile.TerminalError(nil)),
+		Condition: metav1.Condition{Type: "Ready", Status: metav1.ConditionFalse, Reason: "InvalidSpec", Message: "invalid spec: {{.Error}}"},
+	},
+	{
+		Condition: metav1.Condition{Type: "Ready", Status: metav1.ConditionUnknown, Reason: "ReconcileError", Message: "{{.Error}}"},
+	},
+}
+
+// errorConditionChain returns a batching chain over the Widget demo with the
+// readyPolicy, whose rule fails with *runErr unless it is nil.
+func errorConditionChain(runErr *error) (*Chain, client.Client) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).WithStatusSubresource(&Widget{}).Build()
+	c := &Chain{BatchStatus: true, ErrorConditionPolicy: readyPolicy}
+	c.InitializeChain(cl, &struct{ Widget *Widget }{}, []Rule{{Name: "work", Do: func(ctx context.Context) {
+		if *runErr != nil {
+			c.doError(*runErr)
+		}
+	}}})
+	return c, cl
+}
+
+// readyOf returns the Ready condition of the Widget demo.
+func readyOf(t *testing.T, cl client.Client) *metav1.Condition {
+	w := &Widget{}
+	assert.NoError(t, cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "demo"}, w), "the Widget was not read")
+	return meta.FindStatusCondition(w.Status.Conditions, "Ready")
+}
+
+// Test_If_ErrorConditionPolicy_Maps_Errors_To_Conditions tests that the
+// errors of Runs set the condition of the first matching rule, in a single
+// status write.
+func Test_If_ErrorConditionPolicy_Maps_Errors_To_Conditions(t *testing.T) {
+	tests := []struct {
+		err     error
+		status  metav1.ConditionStatus
+		reason  string
+		message string
+	}{
+		{
+			err:     fmt.Errorf("get secret: %w", apierrors.NewNotFound(ctrl.GroupResource{Resource: "secrets"}, "creds")),
+			status:  metav1.ConditionFalse,
+			reason:  "MissingDependency",
+			message: `get secret: secrets "creds" not found`,
+		},
+		{
+			err:     reconcile.TerminalError(errors.New("size must be positive")),
+			status:  metav1.ConditionFalse,
+			reason:  "InvalidSpec",
+			message: "invalid spec: terminal error: size must be positive",
+		},
+		{
+			err:     errors.New("boom"),
+			status:  metav1.ConditionUnknown,
+			reason:  "ReconcileError",
+			message: "boom",
+		},
+	}
+	for _, test := range tests {
+		runErr := test.err
+		c, cl := errorConditionChain(&runErr)
+		report, err := c.RunWithReport(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+		assert.ErrorIs(t, err, test.err, "the Run did not fail with the error")
+		assert.Len(t, report.Audit, 1, "the status was not written once for %v", test.err)
+		if ready := readyOf(t, cl); assert.NotNil(t, ready, "the condition was not set for %v", test.err) {
+			assert.Equal(t, test.status, ready.Status, "wrong status for %v", test.err)
+			assert.Equal(t, test.reason, ready.Reason, "wrong reason for %v", test.err)
+			assert.Equal(t, test.message, ready.Message, "wrong message for %v", test.err)
+		}
+	}
+}
+
+// Test_If_ErrorConditionPolicy_Clears_On_Success tests that a successful Run
+// removes the condition set by the policy, but not one set otherwise, and
+// does not write the status when there is none.
+func Test_If_ErrorConditionPolicy_Clears_On_Success(t *testing.T) {
+	runErr := error(apierrors.NewNotFound(ctrl.GroupResource{Resource: "secrets"}, "creds"))
+	c, cl := errorConditionChain(&runErr)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, _ = c.Run(context.Background(), req)
+	assert.NotNil(t, readyOf(t, cl), "the condition was not set")
+
+	runErr = nil
+	report, err := c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Len(t, report.Audit, 1, "the status was not written once")
+	assert.Nil(t, readyOf(t, cl), "the condition was not cleared")
+
+	report, err = c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Empty(t, report.Audit, "the status was written without a condition to clear")
+
+	c.Rules = append(c.Rules, Rule{Name: "ready", Do: c.SetCondition(&c.Resources.(*struct{ Widget *Widget }).Widget, metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Reconciled"})})
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	if ready := readyOf(t, cl); assert.NotNil(t, ready, "the condition set by a rule was cleared") {
+		assert.Equal(t, "Reconciled", ready.Reason, "the condition set by a rule was changed")
+	}
+}
+
+// Test_If_ErrorConditionPolicy_Templates_Are_Validated tests that a Message
+// that does not parse is reported by Validate.
+func Test_If_ErrorConditionPolicy_Templates_Are_Validated(t *testing.T) {
+	c := &Chain{ErrorConditionPolicy: []ErrorConditionRule{{Condition: metav1.Condition{Type: "Ready", Message: "{{.Error"}}}}
+	assert.ErrorContains(t, c.Validate(), "error condition rule 0", "the broken template was not reported")
+	assert.True(t, ErrorAs[*PanicError]()(fmt.Errorf("wrapped: %w", &PanicError{})), "ErrorAs did not match a wrapped error")
+}
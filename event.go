@@ -0,0 +1,120 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// EventNormal returns an action that records a Normal event on the primary
+// resource. The message is formatted as fmt.Sprintf does, after executing it as
+// a template of ConditionData, so it may refer to run data such as
+// {{.Rule}}. The action does nothing if the chain has no Recorder or the
+// primary resource is not loaded.
+func (c *Chain) EventNormal(reason, messageFmt string, args ...interface{}) Action {
+	return c.EventFor(nil, corev1.EventTypeNormal, reason, messageFmt, args...)
+}
+
+// EventWarning is like EventNormal, but records a Warning event.
+func (c *Chain) EventWarning(reason, messageFmt string, args ...interface{}) Action {
+	return c.EventFor(nil, corev1.EventTypeWarning, reason, messageFmt, args...)
+}
+
+// EventFor returns an action that records an event of the given type on an
+// object, given either as a client.Object or as a pointer to a resource field,
+// or on the primary resource if target is nil. The message is formatted as by
+// EventNormal. The action does nothing if the chain has no Recorder or the
+// field is not loaded. If the chain has an EventInterval, a repeated event is
+// suppressed as described there.
+func (c *Chain) EventFor(target interface{}, eventType, reason, messageFmt string, args ...interface{}) Action {
+	return c.emitEvent(target, eventType, reason, messageFmt, args, true)
+}
+
+// EventAlways is like EventFor, but the event is recorded every time, even if
+// the chain has an EventInterval.
+func (c *Chain) EventAlways(target interface{}, eventType, reason, messageFmt string, args ...interface{}) Action {
+	return c.emitEvent(target, eventType, reason, messageFmt, args, false)
+}
+
+// lastEvent is the last event recorded with a type and reason on an object,
+// kept across runs to suppress repeated events.
+type lastEvent struct {
+	message string
+	at      time.Time
+}
+
+// emitEvent returns an action recording an event, suppressed while it repeats
+// within the chain's EventInterval if dedup is true.
+func (c *Chain) emitEvent(target interface{}, eventType, reason, messageFmt string, args []interface{}, dedup bool) Action {
+	resolve := c.primary
+	if target != nil {
+		resolve = targetResolver(target)
+	}
+	message := mustParseTemplate("message", messageFmt)
+	return c.Try(func(ctx context.Context) error {
+		obj := resolve()
+		if c.Recorder == nil || obj == nil {
+			return nil
+		}
+		text, err := renderTemplate(message, c.conditionData())
+		if err != nil {
+			return err
+		}
+		if len(args) > 0 {
+			text = fmt.Sprintf(text, args...)
+		}
+		if dedup && c.EventInterval > 0 {
+			key := fmt.Sprintf("event:%s:%s:%s", eventType, reason, c.describe(obj))
+			now := c.now()
+			if v, ok := c.storeGet(key); ok {
+				if last := v.(lastEvent); last.message == text && now.Sub(last.at) < c.EventInterval {
+					return nil
+				}
+			}
+			c.storeSet(key, lastEvent{message: text, at: now})
+		}
+		c.event(obj, eventType, reason, text)
+		return nil
+	})
+}
+
+// event records an event on the given object, if the chain has a Recorder,
+// with the ID of the Run as EventRunID asks.
+func (c *Chain) event(obj client.Object, eventType, reason, message string) {
+	if c.Recorder == nil {
+		return
+	}
+	switch c.EventRunID {
+	case EventRunIDAnnotation:
+		c.Recorder.AnnotatedEventf(obj, map[string]string{RunIDAnnotation: c.runLog.id}, eventType, reason, "%s", message)
+	case EventRunIDMessage:
+		c.Recorder.Event(obj, eventType, reason, fmt.Sprintf("%s (run %s)", message, c.runLog.id))
+	default:
+		c.Recorder.Event(obj, eventType, reason, message)
+	}
+}
+
+// recordTransition records an event on the primary resource if the value of
+// the predicate of the current rule differs from its value in the previous Run
+// for the object.
+func (c *Chain) recordTransition(rule Rule, value bool) {
+	key := "transition:" + c.currentRule()
+	last, seen := c.storeGet(key)
+	c.storeSet(key, value)
+	obj := c.primary()
+	if !seen || last == value || obj == nil {
+		return
+	}
+	reason, state := "RuleActivated", "active"
+	if !value {
+		reason, state = "RuleDeactivated", "inactive"
+	}
+	message := fmt.Sprintf("%s became %s", c.currentRule(), state)
+	if rule.When != nil {
+		message += ": " + describePredicate(rule.When).String()
+	}
+	c.event(obj, corev1.EventTypeNormal, reason, message)
+}
@@ -0,0 +1,134 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_Events_Are_Recorded_With_Run_Data tests that the event actions record
+// events of the right type, reason, and message, interpolating run data, and
+// that they do nothing without a recorder.
+func Test_If_Events_Are_Recorded_With_Run_Data(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+		Secret *corev1.Secret
+	}
+	c := &Chain{}
+	event, err := c.LookupAction("Event", map[string]string{"type": "Warning", "reason": "Registered", "message": "100% from {{.Rule}}"})
+	assert.NoError(t, err, "LookupAction returned an error")
+	c.InitializeChain(cl, &res, []Rule{
+		{Name: "create", Do: c.EventNormal("Created", "Created Deployment %s by {{.Rule}}", "x")},
+		{Name: "wait", Do: c.EventWarning("Waiting", "Waiting for Secret y")},
+		{Name: "secret", Do: c.EventFor(&res.Secret, corev1.EventTypeNormal, "Used", "Used by {{.Request.Name}}")},
+		{Name: "registry", Do: event},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run without a recorder returned an error")
+
+	recorder := record.NewFakeRecorder(10)
+	c.Recorder = recorder
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	close(recorder.Events)
+	var events []string
+	for e := range recorder.Events {
+		events = append(events, e)
+	}
+	assert.Equal(t, []string{
+		"Normal Created Created Deployment x by create",
+		"Warning Waiting Waiting for Secret y",
+		"Normal Used Used by demo",
+		"Warning Registered 100% from registry",
+	}, events, "events were not recorded as expected")
+}
+
+// Test_If_Repeated_Events_Are_Suppressed tests that a repeated event is
+// recorded at most once per EventInterval, immediately when its message
+// changes, and every time when recorded with EventAlways.
+func Test_If_Repeated_Events_Are_Suppressed(t *testing.T) {
+	clk := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+	}
+	recorder := record.NewFakeRecorder(20)
+	secret := "y"
+	c := &Chain{Clock: clk, Recorder: recorder, EventInterval: 5 * time.Minute}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: func(ctx context.Context) { c.EventWarning("Waiting", "Waiting for Secret %s", secret)(ctx) }},
+		{Do: c.EventAlways(nil, corev1.EventTypeNormal, "Checked", "Checked")},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	run := func() []string {
+		_, err := c.Run(context.Background(), req)
+		assert.NoError(t, err, "Run returned an error")
+		var events []string
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		return events
+	}
+	assert.Equal(t, []string{"Warning Waiting Waiting for Secret y", "Normal Checked Checked"}, run(), "first event was not recorded")
+	clk.Step(time.Minute)
+	assert.Equal(t, []string{"Normal Checked Checked"}, run(), "repeated event was not suppressed")
+	secret = "z"
+	assert.Equal(t, []string{"Warning Waiting Waiting for Secret z", "Normal Checked Checked"}, run(), "changed event was suppressed")
+	clk.Step(4 * time.Minute)
+	assert.Equal(t, []string{"Normal Checked Checked"}, run(), "repeated event was not suppressed")
+	clk.Step(time.Minute)
+	assert.Equal(t, []string{"Warning Waiting Waiting for Secret z", "Normal Checked Checked"}, run(), "event was not recorded again after the interval")
+}
+
+// Test_If_Rule_Transitions_Are_Recorded tests that a rule with
+// EmitTransitionEvents records an event only when the value of its predicate
+// changes between Runs.
+func Test_If_Rule_Transitions_Are_Recorded(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+	}
+	paused := false
+	recorder := record.NewFakeRecorder(10)
+	c := &Chain{Recorder: recorder}
+	c.InitializeChain(cl, &res, []Rule{
+		{
+			Name:                 "BackupSchedulePaused",
+			When:                 Named("SchedulePaused", Predicate(func() bool { return paused })),
+			Do:                   func(context.Context) {},
+			EmitTransitionEvents: true,
+		},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	for _, value := range []bool{false, true, true} {
+		paused = value
+		_, err := c.Run(context.Background(), req)
+		assert.NoError(t, err, "Run returned an error")
+	}
+	close(recorder.Events)
+	var events []string
+	for e := range recorder.Events {
+		events = append(events, e)
+	}
+	assert.Equal(t, []string{
+		"Normal RuleActivated BackupSchedulePaused became active: SchedulePaused",
+	}, events, "transitions were not recorded once")
+}
@@ -0,0 +1,195 @@
+package operchain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RuleReport records the evaluation of a rule during a run.
+type RuleReport struct {
+	// Name is the name of the rule, or its prefix and index if it has none,
+	// e.g. "rule 2".
+	Name string `json:"name"`
+	// Predicate describes the predicate of the rule, or is empty if the rule
+	// always runs.
+	Predicate string `json:"predicate,omitempty"`
+	// Value is the value of the predicate.
+	Value bool `json:"value"`
+	// Fired is true if the action of the rule ran.
+	Fired bool `json:"fired,omitempty"`
+	// WouldFire is true if Simulate found that the action of the rule would
+	// run.
+	WouldFire bool `json:"wouldFire,omitempty"`
+	// Err is the error the rule made the run fail with, if any.
+	Err error `json:"-"`
+	// Error is the message of Err, if any.
+	Error string `json:"error,omitempty"`
+	// Subchains are the reports of the chains run by the action of the rule,
+	// in order.
+	Subchains []*RunReport `json:"subchains,omitempty"`
+}
+
+// RuleResult is the result of looking up a rule in a RunReport with Rule.
+// The zero RuleResult is the one of a rule that was not evaluated.
+type RuleResult struct {
+	report *RuleReport
+}
+
+// Evaluated returns true if the rule was evaluated.
+func (r RuleResult) Evaluated() bool {
+	return r.report != nil
+}
+
+// Fired returns true if the action of the rule ran.
+func (r RuleResult) Fired() bool {
+	return r.report != nil && r.report.Fired
+}
+
+// PredicateValue returns the value of the predicate of the rule, or false if
+// it was not evaluated.
+func (r RuleResult) PredicateValue() bool {
+	return r.report != nil && r.report.Value
+}
+
+// Err returns the error the rule made the run fail with, if any.
+func (r RuleResult) Err() error {
+	if r.report == nil {
+		return nil
+	}
+	return r.report.Err
+}
+
+// Report returns the report of the rule, or nil if it was not evaluated.
+func (r RuleResult) Report() *RuleReport {
+	return r.report
+}
+
+// Rule looks up the evaluation of a rule by its path: its name, or for a rule
+// of a chain run by the Subchain action of a rule, the name of that rule, the
+// subchain, and the rule in it, separated by slashes, e.g. "parent/sub/rule".
+// A subchain is identified by its name, or by its index among the subchains
+// of its rule if it has none.
+func (r *RunReport) Rule(path string) RuleResult {
+	segments := strings.Split(path, "/")
+	report := r
+	for {
+		rule := report.findRule(segments[0])
+		if rule == nil || len(segments) == 1 {
+			return RuleResult{report: rule}
+		}
+		if len(segments) == 2 {
+			return RuleResult{}
+		}
+		if report = rule.findSubchain(segments[1]); report == nil {
+			return RuleResult{}
+		}
+		segments = segments[2:]
+	}
+}
+
+// findRule returns the report of the first evaluation of the named rule, or
+// nil.
+func (r *RunReport) findRule(name string) *RuleReport {
+	for i := range r.Rules {
+		if r.Rules[i].Name == name {
+			return &r.Rules[i]
+		}
+	}
+	return nil
+}
+
+// findSubchain returns the report of the subchain of the rule with the given
+// name or index, or nil.
+func (r *RuleReport) findSubchain(name string) *RunReport {
+	for _, sub := range r.Subchains {
+		if sub.Chain == name {
+			return sub
+		}
+	}
+	if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(r.Subchains) {
+		return r.Subchains[i]
+	}
+	return nil
+}
+
+// ExecutionTrace returns the canonical form of the rules evaluated by the run
+// and by its subchains, one line per rule in the order of evaluation, e.g.
+//
+//	create: Exists(Secret) = false
+//	update: always, fired
+//	update/0/apply: always, fired, error: "conflict"
+//
+// It depends only on what ran, not on when or for which request, so that
+// table tests can compare the expected and actual executions of a chain.
+func (r *RunReport) ExecutionTrace() string {
+	var sb strings.Builder
+	r.writeExecutionTrace(&sb, "")
+	return sb.String()
+}
+
+// writeExecutionTrace writes the lines of ExecutionTrace for the rules of the
+// report, prefixing their names with prefix.
+func (r *RunReport) writeExecutionTrace(sb *strings.Builder, prefix string) {
+	for _, rule := range r.Rules {
+		fmt.Fprintf(sb, "%s%s: ", prefix, rule.Name)
+		if rule.Predicate == "" {
+			sb.WriteString("always")
+		} else {
+			fmt.Fprintf(sb, "%s = %t", rule.Predicate, rule.Value)
+		}
+		if rule.Fired {
+			sb.WriteString(", fired")
+		}
+		if rule.WouldFire {
+			sb.WriteString(", would fire")
+		}
+		if rule.Error != "" {
+			fmt.Fprintf(sb, ", error: %q", rule.Error)
+		}
+		sb.WriteString("\n")
+		for i, sub := range rule.Subchains {
+			name := sub.Chain
+			if name == "" {
+				name = strconv.Itoa(i)
+			}
+			sub.writeExecutionTrace(sb, prefix+rule.Name+"/"+name+"/")
+		}
+	}
+}
+
+// startRuleReport starts collecting the reports of the subchains run by the
+// current rule.
+func (c *Chain) startRuleReport() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.subReports = nil
+}
+
+// recordSubReport records the report of a chain run by the current rule.
+func (c *Chain) recordSubReport(report *RunReport) {
+	if report == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.subReports = append(c.subReports, report)
+}
+
+// recordRuleReport records the evaluation of the current rule in the report
+// of the Run.
+func (c *Chain) recordRuleReport(rule Rule, value, fired bool, err error) {
+	report := RuleReport{Name: c.currentRule(), Value: value, Fired: fired, Err: err}
+	if rule.When != nil {
+		report.Predicate = describePredicate(rule.When).String()
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	report.WouldFire = c.simulating && value
+	report.Subchains = c.subReports
+	c.subReports = nil
+	c.ruleReports = append(c.ruleReports, report)
+}
@@ -0,0 +1,74 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// executionChain returns a chain with a rule whose predicate is false, a
+// fired rule, and a rule running a subchain whose rule fails with err.
+func executionChain(err error) *Chain {
+	sub := &Chain{Name: "sub"}
+	sub.InitializeChain(nil, &struct{}{}, []Rule{
+		{Name: "rule", Do: sub.Error(err)},
+	})
+	c := &Chain{}
+	c.InitializeChain(nil, &struct{}{}, []Rule{
+		{Name: "skipped", When: Named("never", False()), Do: func(context.Context) {}},
+		{Name: "fired", When: Named("always", True()), Do: func(context.Context) {}},
+		{Name: "parent", Do: c.Subchain(sub)},
+		{Name: "unreached"},
+	})
+	return c
+}
+
+// Test_If_Rule_Reports_The_Evaluation_Of_Rules tests that Rule finds rules
+// whose predicates were false, fired rules, rules of subchains by path, and
+// rules that were not evaluated.
+func Test_If_Rule_Reports_The_Evaluation_Of_Rules(t *testing.T) {
+	boom := errors.New("boom")
+	report, err := executionChain(boom).RunWithReport(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.ErrorIs(t, err, boom)
+
+	skipped := report.Rule("skipped")
+	assert.True(t, skipped.Evaluated(), "rule with a false predicate was not evaluated")
+	assert.False(t, skipped.PredicateValue(), "predicate value is wrong")
+	assert.False(t, skipped.Fired(), "rule with a false predicate fired")
+
+	fired := report.Rule("fired")
+	assert.True(t, fired.PredicateValue(), "predicate value is wrong")
+	assert.True(t, fired.Fired(), "rule did not fire")
+	assert.NoError(t, fired.Err(), "successful rule has an error")
+
+	assert.True(t, report.Rule("parent").Fired(), "rule running the subchain did not fire")
+	assert.ErrorIs(t, report.Rule("parent").Err(), boom, "rule running the failed subchain has no error")
+	sub := report.Rule("parent/sub/rule")
+	assert.True(t, sub.Fired(), "rule of the subchain did not fire")
+	assert.ErrorIs(t, sub.Err(), boom, "rule of the subchain has no error")
+	assert.True(t, report.Rule("parent/0/rule").Fired(), "subchain was not found by index")
+
+	for _, path := range []string{"unreached", "missing", "parent/sub", "parent/other/rule", "fired/sub/rule"} {
+		assert.False(t, report.Rule(path).Evaluated(), "rule %q was found", path)
+	}
+}
+
+// Test_If_ExecutionTrace_Is_Canonical tests that ExecutionTrace lists the
+// rules evaluated, including those of subchains, and does not depend on the
+// request.
+func Test_If_ExecutionTrace_Is_Canonical(t *testing.T) {
+	c := executionChain(errors.New("boom"))
+	first, _ := c.RunWithReport(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "a"}})
+	second, _ := c.RunWithReport(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "other", Name: "b"}})
+	expected := `skipped: never = false
+fired: always = true, fired
+parent: always, fired, error: "boom"
+parent/sub/rule: always, fired, error: "boom"
+`
+	assert.Equal(t, expected, first.ExecutionTrace())
+	assert.Equal(t, first.ExecutionTrace(), second.ExecutionTrace(), "trace depends on the request")
+}
@@ -0,0 +1,398 @@
+package operchain
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// PredicateResolver resolves the predicate names used in expressions.
+type PredicateResolver interface {
+	// ResolvePredicate returns the predicate with the given name.
+	ResolvePredicate(name string) (*predicate, error)
+}
+
+// PredicateRegistry is a PredicateResolver that maps names to predicates.
+type PredicateRegistry map[string]*predicate
+
+// ResolvePredicate implements PredicateResolver.
+func (r PredicateRegistry) ResolvePredicate(name string) (*predicate, error) {
+	if p, ok := r[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown predicate %q", name)
+}
+
+// ExpressionError is an error in an expression, at a position within it.
+type ExpressionError struct {
+	// Expression is the expression containing the error.
+	Expression string
+	// Pos is the byte offset of the error within the expression.
+	Pos int
+	// Err describes the error.
+	Err error
+}
+
+// Error implements error.
+func (e *ExpressionError) Error() string {
+	return fmt.Sprintf("expression %q: position %d: %v", e.Expression, e.Pos, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ExpressionError) Unwrap() error {
+	return e.Err
+}
+
+// Expression is a parsed predicate expression, combining named predicates with
+// ! (not), && (and), and || (or), in decreasing order of precedence, and
+// parentheses. Names may contain letters, digits, and any of "-_./:".
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// ParseExpression parses an expression. Errors are *ExpressionError.
+func ParseExpression(s string) (*Expression, error) {
+	p := &exprParser{source: s}
+	p.next()
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Expression{source: s, root: root}, nil
+}
+
+// String returns the expression in canonical form, with single spaces around
+// binary operators and only the parentheses precedence requires. Parsing the
+// result yields an equivalent expression.
+func (x *Expression) String() string {
+	return x.root.String()
+}
+
+// Names returns the predicate names the expression refers to, in order of
+// first appearance.
+func (x *Expression) Names() []string {
+	var names []string
+	seen := map[string]bool{}
+	x.root.walk(func(name string, _ int) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	})
+	return names
+}
+
+// Compile compiles the expression into a predicate named by the canonical form
+// of the expression, resolving names with r. Errors resolving a name are
+// *ExpressionError giving the name's position.
+func (x *Expression) Compile(r PredicateResolver) (*predicate, error) {
+	var err error
+	x.root.walk(func(name string, pos int) {
+		if err != nil {
+			return
+		}
+		if _, rerr := r.ResolvePredicate(name); rerr != nil {
+			err = &ExpressionError{Expression: x.source, Pos: pos, Err: rerr}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	p, err := x.root.compile(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := x.root.(*nameNode); ok {
+		// Don't rename the resolved predicate itself.
+		return p, nil
+	}
+	return Named(x.String(), p), nil
+}
+
+// CompileExpression parses and compiles an expression, resolving names with r.
+func CompileExpression(s string, r PredicateResolver) (*predicate, error) {
+	x, err := ParseExpression(s)
+	if err != nil {
+		return nil, err
+	}
+	return x.Compile(r)
+}
+
+// MustCompileExpression is like CompileExpression but panics on error. It is
+// intended for use while constructing a chain.
+func MustCompileExpression(s string, r PredicateResolver) *predicate {
+	p, err := CompileExpression(s, r)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// exprNode is a node of a parsed expression.
+type exprNode interface {
+	String() string
+	compile(r PredicateResolver) (*predicate, error)
+	walk(f func(name string, pos int))
+	precedence() int
+}
+
+// Operator precedences, from loosest to tightest binding.
+const (
+	precOr = iota
+	precAnd
+	precNot
+	precName
+)
+
+// nameNode is a reference to a named predicate.
+type nameNode struct {
+	name string
+	pos  int
+}
+
+func (n *nameNode) String() string { return n.name }
+
+func (n *nameNode) compile(r PredicateResolver) (*predicate, error) {
+	return r.ResolvePredicate(n.name)
+}
+
+func (n *nameNode) walk(f func(name string, pos int)) { f(n.name, n.pos) }
+
+func (n *nameNode) precedence() int { return precName }
+
+// notNode is the negation of its operand.
+type notNode struct {
+	operand exprNode
+}
+
+func (n *notNode) String() string {
+	return "!" + wrap(n.operand, precNot)
+}
+
+func (n *notNode) compile(r PredicateResolver) (*predicate, error) {
+	p, err := n.operand.compile(r)
+	if err != nil {
+		return nil, err
+	}
+	return Not(p), nil
+}
+
+func (n *notNode) walk(f func(name string, pos int)) { n.operand.walk(f) }
+
+func (n *notNode) precedence() int { return precNot }
+
+// binaryNode is the conjunction or disjunction of its operands.
+type binaryNode struct {
+	or       bool
+	operands []exprNode
+}
+
+func (n *binaryNode) String() string {
+	op := " && "
+	if n.or {
+		op = " || "
+	}
+	parts := make([]string, len(n.operands))
+	for i, operand := range n.operands {
+		parts[i] = wrap(operand, n.precedence())
+	}
+	return strings.Join(parts, op)
+}
+
+func (n *binaryNode) compile(r PredicateResolver) (*predicate, error) {
+	ps := make([]*predicate, len(n.operands))
+	for i, operand := range n.operands {
+		p, err := operand.compile(r)
+		if err != nil {
+			return nil, err
+		}
+		ps[i] = p
+	}
+	if n.or {
+		return Or(ps...), nil
+	}
+	return And(ps...), nil
+}
+
+func (n *binaryNode) walk(f func(name string, pos int)) {
+	for _, operand := range n.operands {
+		operand.walk(f)
+	}
+}
+
+func (n *binaryNode) precedence() int {
+	if n.or {
+		return precOr
+	}
+	return precAnd
+}
+
+// wrap returns the string form of n, parenthesized if it binds more loosely
+// than the given precedence.
+func wrap(n exprNode, prec int) string {
+	if n.precedence() < prec {
+		return "(" + n.String() + ")"
+	}
+	return n.String()
+}
+
+// Token kinds.
+const (
+	tokEOF = iota
+	tokName
+	tokNot
+	tokAnd
+	tokOr
+	tokLParen
+	tokRParen
+)
+
+// token is a lexical token of an expression.
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+// String describes the token for error messages.
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// exprParser is a recursive descent parser for expressions.
+type exprParser struct {
+	source string
+	pos    int
+	tok    token
+}
+
+// errorf returns an ExpressionError at the current token.
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return &ExpressionError{Expression: p.source, Pos: p.tok.pos, Err: fmt.Errorf(format, args...)}
+}
+
+// isNameRune returns true if r may appear in a predicate name.
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_./:", r)
+}
+
+// next advances to the next token.
+func (p *exprParser) next() {
+	for p.pos < len(p.source) && unicode.IsSpace(rune(p.source[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.source) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+	rest := p.source[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "&&"):
+		p.tok = token{kind: tokAnd, text: "&&", pos: start}
+		p.pos += 2
+	case strings.HasPrefix(rest, "||"):
+		p.tok = token{kind: tokOr, text: "||", pos: start}
+		p.pos += 2
+	case rest[0] == '!':
+		p.tok = token{kind: tokNot, text: "!", pos: start}
+		p.pos++
+	case rest[0] == '(':
+		p.tok = token{kind: tokLParen, text: "(", pos: start}
+		p.pos++
+	case rest[0] == ')':
+		p.tok = token{kind: tokRParen, text: ")", pos: start}
+		p.pos++
+	default:
+		end := strings.IndexFunc(rest, func(r rune) bool { return !isNameRune(r) })
+		if end < 0 {
+			end = len(rest)
+		}
+		if end == 0 {
+			end = 1
+			for end < len(rest) && !isNameRune(rune(rest[end])) && !unicode.IsSpace(rune(rest[end])) {
+				end++
+			}
+			p.tok = token{kind: -1, text: rest[:end], pos: start}
+		} else {
+			p.tok = token{kind: tokName, text: rest[:end], pos: start}
+		}
+		p.pos += end
+	}
+}
+
+// parseOr parses a disjunction.
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseBinary(true, p.parseAnd)
+}
+
+// parseAnd parses a conjunction.
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseBinary(false, p.parseUnary)
+}
+
+// parseBinary parses one or more operands separated by && or ||.
+func (p *exprParser) parseBinary(or bool, operand func() (exprNode, error)) (exprNode, error) {
+	kind := tokAnd
+	if or {
+		kind = tokOr
+	}
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	operands := []exprNode{first}
+	for p.tok.kind == kind {
+		p.next()
+		n, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, n)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &binaryNode{or: or, operands: operands}, nil
+}
+
+// parseUnary parses a negation, a parenthesized expression, or a name.
+func (p *exprParser) parseUnary() (exprNode, error) {
+	switch p.tok.kind {
+	case tokNot:
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	case tokLParen:
+		open := p.tok
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			if p.tok.kind == tokEOF {
+				p.tok = open
+				return nil, p.errorf("unclosed (")
+			}
+			return nil, p.errorf("expected ) but found %s", p.tok)
+		}
+		p.next()
+		return n, nil
+	case tokName:
+		n := &nameNode{name: p.tok.text, pos: p.tok.pos}
+		p.next()
+		return n, nil
+	}
+	return nil, p.errorf("expected a predicate name, ! or ( but found %s", p.tok)
+}
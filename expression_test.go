@@ -0,0 +1,115 @@
+package operchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// testRegistry returns a PredicateRegistry of constant predicates.
+func testRegistry(values map[string]bool) PredicateRegistry {
+	r := PredicateRegistry{}
+	for name, value := range values {
+		value := value
+		r[name] = Predicate(func() bool { return value })
+	}
+	return r
+}
+
+// Test_If_Expressions_Respect_Precedence tests operator precedence and
+// parentheses.
+func Test_If_Expressions_Respect_Precedence(t *testing.T) {
+	r := testRegistry(map[string]bool{"t": true, "f": false, "secret-exists": true, "paused": true, "force-sync": false})
+	testcases := []struct {
+		expr string
+		want bool
+	}{
+		{"t", true},
+		{"!t", false},
+		{"!!t", true},
+		{"t || f && f", true},
+		{"(t || f) && f", false},
+		{"f && f || t", true},
+		{"f && (f || t)", false},
+		{"!f && t", true},
+		{"!(f || t)", false},
+		{"secret-exists && !paused || force-sync", false},
+		{"secret-exists && !(paused || force-sync)", false},
+		{"secret-exists && (!paused || !force-sync)", true},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.expr, func(t *testing.T) {
+			p, err := CompileExpression(tc.expr, r)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.want, p.Eval(pcache.New()), "wrong value")
+			}
+		})
+	}
+}
+
+// Test_If_Expressions_Round_Trip_Through_String tests that String produces a
+// canonical form which parses to the same canonical form.
+func Test_If_Expressions_Round_Trip_Through_String(t *testing.T) {
+	testcases := map[string]string{
+		"a":                      "a",
+		"  a&&b ":                "a && b",
+		"a && b || c":            "a && b || c",
+		"(a && b) || c":          "a && b || c",
+		"a && (b || c)":          "a && (b || c)",
+		"!(a&&b)":                "!(a && b)",
+		"!a && !!b":              "!a && !!b",
+		"((a))||(b||c)":          "a || b || c",
+		"x/y.z-1 && ns:name_two": "x/y.z-1 && ns:name_two",
+	}
+	for input, want := range testcases {
+		x, err := ParseExpression(input)
+		if !assert.NoError(t, err, input) {
+			continue
+		}
+		assert.Equal(t, want, x.String(), input)
+		again, err := ParseExpression(x.String())
+		if assert.NoError(t, err, input) {
+			assert.Equal(t, want, again.String(), input)
+		}
+	}
+}
+
+// Test_If_Expression_Errors_Report_Positions tests that syntax errors and
+// unknown names are reported with their positions.
+func Test_If_Expression_Errors_Report_Positions(t *testing.T) {
+	r := testRegistry(map[string]bool{"a": true, "b": true})
+	testcases := []struct {
+		expr string
+		pos  int
+	}{
+		{"", 0},
+		{"a &&", 4},
+		{"a b", 2},
+		{"(a || b", 0},
+		{"a && )", 5},
+		{"a & b", 2},
+		{"a && nope", 5},
+	}
+	for _, tc := range testcases {
+		_, err := CompileExpression(tc.expr, r)
+		var xerr *ExpressionError
+		if assert.True(t, errors.As(err, &xerr), "%q: error was not an ExpressionError: %v", tc.expr, err) {
+			assert.Equal(t, tc.pos, xerr.Pos, "%q: wrong position: %v", tc.expr, err)
+		}
+	}
+	assert.Panics(t, func() { MustCompileExpression("a ||", r) })
+}
+
+// Test_If_Compiled_Expressions_Are_Named tests that compiled expressions are
+// named by their canonical form and report the names they use.
+func Test_If_Compiled_Expressions_Are_Named(t *testing.T) {
+	r := testRegistry(map[string]bool{"a": true, "b": false})
+	p := MustCompileExpression("(a&&!b)||a", r)
+	assert.Equal(t, "a && !b || a", p.Name())
+	x, _ := ParseExpression("(a&&!b)||a")
+	assert.Equal(t, []string{"a", "b"}, x.Names())
+}
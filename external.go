@@ -0,0 +1,110 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// DefaultExternalCheckRetry is the interval after which a failed ExternalCheck
+// suggests checking again, unless set with ExternalCheckRetry.
+const DefaultExternalCheckRetry = 30 * time.Second
+
+// externalCheck holds the options of an ExternalCheck.
+type externalCheck struct {
+	retry    time.Duration
+	failsRun bool
+	ttl      time.Duration
+}
+
+// ExternalCheckOption configures an ExternalCheck.
+type ExternalCheckOption func(o *externalCheck)
+
+// ExternalCheckRetry sets the interval after which a failed check suggests
+// checking again. Zero disables the suggestion.
+func ExternalCheckRetry(interval time.Duration) ExternalCheckOption {
+	return func(o *externalCheck) {
+		o.retry = interval
+	}
+}
+
+// ExternalCheckFailsRun makes an error from the check the error of the Run, in
+// addition to making the predicate false.
+func ExternalCheckFailsRun() ExternalCheckOption {
+	return func(o *externalCheck) {
+		o.failsRun = true
+	}
+}
+
+// ExternalCheckCache keeps the result of the check across runs, per object,
+// for the given time to live. Errors are not kept.
+func ExternalCheckCache(ttl time.Duration) ExternalCheckOption {
+	return func(o *externalCheck) {
+		o.ttl = ttl
+	}
+}
+
+// externalResult is an ExternalCheck result kept across runs.
+type externalResult struct {
+	value   bool
+	expires time.Time
+}
+
+// ExternalCheck returns a predicate, with the given name, that probes an
+// external system with f. f is called with the Run's context, limited to the
+// given timeout. An error makes the predicate false and is noted in the trace.
+// While the predicate is false it suggests checking again after the retry
+// interval, or when its cached result expires.
+func (c *Chain) ExternalCheck(name string, timeout time.Duration, f func(ctx context.Context) (bool, error), opts ...ExternalCheckOption) *predicate {
+	o := &externalCheck{retry: DefaultExternalCheckRetry}
+	for _, opt := range opts {
+		opt(o)
+	}
+	key := "external:" + name
+	return pcache.NewLeaf(name, func(e *pcache.Evaluation) bool {
+		now := c.now()
+		if o.ttl > 0 {
+			if v, ok := c.storeGet(key); ok {
+				if result := v.(externalResult); now.Before(result.expires) {
+					e.Notef("cached until %s", result.expires.Format(time.RFC3339))
+					if !result.value {
+						e.SuggestRequeue(result.expires.Sub(now))
+					}
+					return result.value
+				}
+			}
+		}
+		value, err := c.runExternalCheck(timeout, f)
+		if err != nil {
+			e.Notef("check failed: %s", err)
+			if o.failsRun {
+				c.doError(fmt.Errorf("external check %s: %w", name, err))
+			}
+			e.SuggestRequeue(o.retry)
+			return false
+		}
+		if o.ttl > 0 {
+			c.storeSet(key, externalResult{value: value, expires: now.Add(o.ttl)})
+		}
+		if !value {
+			e.SuggestRequeue(o.retry)
+		}
+		return value
+	})
+}
+
+// runExternalCheck calls f with the Run's context limited to the timeout.
+func (c *Chain) runExternalCheck(timeout time.Duration, f func(ctx context.Context) (bool, error)) (bool, error) {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return f(ctx)
+}
@@ -0,0 +1,101 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// healthServer returns a test server answering with the given status after the
+// given delay, and a probe of its health endpoint counting requests.
+func healthServer(t *testing.T, status, delay *atomic.Int64, requests *int) func(ctx context.Context) (bool, error) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Duration(delay.Load())):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(server.Close)
+	return func(ctx context.Context) (bool, error) {
+		*requests++
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/healthz", nil)
+		if err != nil {
+			return false, err
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			return false, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return false, fmt.Errorf("health check returned %d", resp.StatusCode)
+		}
+		return resp.StatusCode == http.StatusOK, nil
+	}
+}
+
+// Test_If_ExternalCheck_Handles_Timeout_Failure_And_Success tests that an
+// ExternalCheck is false and suggests a retry when the check times out or
+// fails, and is true and cached when it succeeds.
+func Test_If_ExternalCheck_Handles_Timeout_Failure_And_Success(t *testing.T) {
+	var status, delay atomic.Int64
+	status.Store(http.StatusOK)
+	delay.Store(int64(time.Second))
+	requests := 0
+	probe := healthServer(t, &status, &delay, &requests)
+	healthy := false
+	c := &Chain{Trace: true}
+	c.InitializeChain(fake.NewClientBuilder().Build(), &struct{}{}, []Rule{
+		{
+			When: c.ExternalCheck("ServiceHealthy", 50*time.Millisecond, probe, ExternalCheckRetry(10*time.Second), ExternalCheckCache(time.Hour)),
+			Do:   func(context.Context) { healthy = true },
+		},
+	})
+
+	result, err := c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err, "Run returned an error")
+	assert.False(t, healthy, "check was true after a timeout")
+	assert.Equal(t, 10*time.Second, result.RequeueAfter, "timeout did not suggest a retry")
+	assert.Contains(t, c.LastTrace()[0].Notes[0], "context deadline exceeded", "timeout was not traced")
+
+	delay.Store(0)
+	status.Store(http.StatusServiceUnavailable)
+	result, err = c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err, "Run returned an error")
+	assert.False(t, healthy, "check was true after a failure")
+	assert.Equal(t, 10*time.Second, result.RequeueAfter, "failure did not suggest a retry")
+	assert.Equal(t, []string{"check failed: health check returned 503"}, c.LastTrace()[0].Notes, "failure was not traced")
+
+	status.Store(http.StatusOK)
+	_, err = c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err, "Run returned an error")
+	assert.True(t, healthy, "check was false after a success")
+	_, err = c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 3, requests, "successful result was not cached")
+}
+
+// Test_If_ExternalCheck_Can_Fail_The_Run tests that ExternalCheckFailsRun
+// makes an error from the check the error of the Run.
+func Test_If_ExternalCheck_Can_Fail_The_Run(t *testing.T) {
+	c := &Chain{}
+	c.InitializeChain(fake.NewClientBuilder().Build(), &struct{}{}, []Rule{
+		{
+			When: c.ExternalCheck("CloudReady", time.Second, func(context.Context) (bool, error) {
+				return false, assert.AnError
+			}, ExternalCheckFailsRun()),
+			Do: func(context.Context) {},
+		},
+	})
+	_, err := c.Run(context.Background(), ctrl.Request{})
+	assert.ErrorIs(t, err, assert.AnError, "check error was not returned")
+}
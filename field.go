@@ -0,0 +1,239 @@
+package operchain
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// checkField panics if fieldPtr is not a pointer to a resource field, i.e. a
+// pointer to a pointer to a struct implementing client.Object. It is called
+// when predicates and actions are constructed so that misuse is caught before
+// the chain runs.
+func checkField(fieldPtr interface{}) {
+	if err := validateField(fieldPtr); err != nil {
+		panic(err.Error())
+	}
+}
+
+// validateField returns an error if fieldPtr is not a pointer to a resource
+// field, as checkField panics.
+func validateField(fieldPtr interface{}) error {
+	t := reflect.TypeOf(fieldPtr)
+	if t == nil || t.Kind() != reflect.Ptr || reflect.ValueOf(fieldPtr).IsNil() {
+		return errors.New("field pointer must be a non-nil pointer to a resource field")
+	}
+	t = t.Elem()
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return errors.New("Resource fields must be pointers to structs")
+	}
+	if !t.Implements(reflect.TypeOf((*client.Object)(nil)).Elem()) {
+		return errors.New("Resource fields must implement client.Object")
+	}
+	return nil
+}
+
+// checkSliceField panics if slicePtr is not a pointer to a resource slice
+// field, i.e. a pointer to a slice of structs or pointers to structs
+// implementing client.Object.
+func checkSliceField(slicePtr interface{}) {
+	if err := validateSliceField(slicePtr); err != nil {
+		panic(err.Error())
+	}
+}
+
+// validateSliceField returns an error if slicePtr is not a pointer to a
+// resource slice field, as checkSliceField panics.
+func validateSliceField(slicePtr interface{}) error {
+	t := reflect.TypeOf(slicePtr)
+	if t == nil || t.Kind() != reflect.Ptr || reflect.ValueOf(slicePtr).IsNil() || t.Elem().Kind() != reflect.Slice {
+		return errors.New("slice pointer must be a non-nil pointer to a resource slice field")
+	}
+	elem := t.Elem().Elem()
+	if elem.Kind() != reflect.Ptr {
+		elem = reflect.PtrTo(elem)
+	}
+	if elem.Elem().Kind() != reflect.Struct || !elem.Implements(reflect.TypeOf((*client.Object)(nil)).Elem()) {
+		return errors.New("Resource slice fields must be slices of structs or pointers to structs implementing client.Object")
+	}
+	return nil
+}
+
+// isSliceField returns true if fieldPtr points to a slice field.
+func isSliceField(fieldPtr interface{}) bool {
+	t := reflect.TypeOf(fieldPtr)
+	return t != nil && t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice
+}
+
+// objectsAt returns the objects currently loaded into the resource slice field
+// pointed to by slicePtr. Elements of struct slices are returned by address, so
+// changes to the returned objects are visible in the field.
+func objectsAt(slicePtr interface{}) []client.Object {
+	field := reflect.ValueOf(slicePtr).Elem()
+	objs := make([]client.Object, 0, field.Len())
+	for i := 0; i < field.Len(); i++ {
+		item := field.Index(i)
+		if item.Kind() != reflect.Ptr {
+			item = item.Addr()
+		} else if item.IsNil() {
+			continue
+		}
+		objs = append(objs, item.Interface().(client.Object))
+	}
+	return objs
+}
+
+// objectAt returns the object currently loaded into the resource field pointed
+// to by fieldPtr, or nil if the field is not loaded.
+func objectAt(fieldPtr interface{}) client.Object {
+	field := reflect.ValueOf(fieldPtr).Elem()
+	if field.IsNil() {
+		return nil
+	}
+	return field.Interface().(client.Object)
+}
+
+// statusOf returns the Status struct of a typed object, or an invalid Value if
+// the object has no Status field.
+func statusOf(obj client.Object) reflect.Value {
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	status := v.FieldByName("Status")
+	for status.Kind() == reflect.Ptr {
+		if status.IsNil() {
+			return reflect.Value{}
+		}
+		status = status.Elem()
+	}
+	if status.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	return status
+}
+
+// fieldName returns the name of the resource field pointed to by fieldPtr, for
+// use in predicate names. Fields outside of Resources are named by their type.
+func (c *Chain) fieldName(fieldPtr interface{}) string {
+	ptr := reflect.ValueOf(fieldPtr)
+	res := reflect.ValueOf(c.Resources)
+	if res.Kind() == reflect.Ptr && !res.IsNil() {
+		res = res.Elem()
+		if res.Kind() == reflect.Struct {
+			for i := 0; i < res.NumField(); i++ {
+				field := res.Field(i)
+				if field.Addr().Pointer() == ptr.Pointer() && field.Type() == ptr.Elem().Type() {
+					return res.Type().Field(i).Name
+				}
+			}
+		}
+	}
+	t := ptr.Elem().Type().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// gvkFor returns the GroupVersionKind of obj, from its TypeMeta if set or else
+// from the client's scheme.
+func (c *Chain) gvkFor(obj client.Object) (schema.GroupVersionKind, error) {
+	if gvk := obj.GetObjectKind().GroupVersionKind(); gvk.Kind != "" {
+		return gvk, nil
+	}
+	if c.Client == nil {
+		return schema.GroupVersionKind{}, fmt.Errorf("cannot determine the kind of %T without a client", obj)
+	}
+	return apiutil.GVKForObject(obj, c.Scheme())
+}
+
+// primaryField returns the primary resource field of Resources: the field
+// tagged `operchain:"primary"`, or else the first pointer field. It returns an
+// invalid Value if there is none. For a chain serving several kinds, it is
+// the field of the kind of the current Run, or else the first tagged field.
+func (c *Chain) primaryField() reflect.Value {
+	res, fields := c.primaryFields()
+	switch {
+	case len(fields) == 0:
+		return reflect.Value{}
+	case c.primaryIndex > 0:
+		return res.Field(c.primaryIndex - 1)
+	}
+	return res.Field(fields[0])
+}
+
+// primaryFields returns the struct of Resources and the indexes of its
+// primary resource fields: those tagged `operchain:"primary"`, or else the
+// first pointer field.
+func (c *Chain) primaryFields() (reflect.Value, []int) {
+	res := reflect.ValueOf(c.Resources)
+	if res.Kind() != reflect.Ptr || res.IsNil() || res.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, nil
+	}
+	res = res.Elem()
+	var tagged []int
+	first := -1
+	for i := 0; i < res.NumField(); i++ {
+		field := res.Type().Field(i)
+		if !field.IsExported() || field.Type.Kind() != reflect.Ptr {
+			continue
+		}
+		if field.Tag.Get("operchain") == "primary" {
+			tagged = append(tagged, i)
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	if len(tagged) > 0 {
+		return res, tagged
+	}
+	if first < 0 {
+		return res, nil
+	}
+	return res, []int{first}
+}
+
+// primary returns the primary resource, or nil if it is not loaded.
+func (c *Chain) primary() client.Object {
+	field := c.primaryField()
+	if !field.IsValid() || field.IsNil() {
+		return nil
+	}
+	return field.Interface().(client.Object)
+}
+
+// setMatchingField stores obj in the first pointer field of the Resources with
+// the same type that is empty or holds the object with the same name, if any.
+func (c *Chain) setMatchingField(obj client.Object) {
+	res := reflect.ValueOf(c.Resources)
+	if res.Kind() != reflect.Ptr || res.IsNil() || res.Elem().Kind() != reflect.Struct {
+		return
+	}
+	res = res.Elem()
+	for i := 0; i < res.NumField(); i++ {
+		field := res.Field(i)
+		if !res.Type().Field(i).IsExported() || field.Type() != reflect.TypeOf(obj) {
+			continue
+		}
+		if !field.IsNil() {
+			current := field.Interface().(client.Object)
+			if current.GetNamespace() != obj.GetNamespace() || current.GetName() != obj.GetName() {
+				continue
+			}
+		}
+		field.Set(reflect.ValueOf(obj))
+		return
+	}
+}
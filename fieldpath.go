@@ -0,0 +1,181 @@
+package operchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// FieldEquals returns a predicate that is true when the value at the given
+// path in the object in the given resource field equals want. See FieldMatches
+// for the path syntax.
+//
+// Numbers are compared by value regardless of their Go type, so int64(3),
+// int32(3), and float64(3) are all equal; this matters because values decoded
+// from JSON are int64 or float64 depending on whether they have a fractional
+// part. Integers are compared exactly; if either side is a floating point
+// number, both are compared as float64. Other values are compared with
+// reflect.DeepEqual against their JSON representation, e.g. maps are
+// map[string]interface{} and lists are []interface{}.
+func (c *Chain) FieldEquals(fieldPtr interface{}, path string, want interface{}) *predicate {
+	name := fmt.Sprintf("FieldEquals(%s, %s, %v)", c.fieldName(fieldPtr), path, want)
+	return c.fieldPredicate(name, fieldPtr, path, func(v interface{}) bool {
+		return valuesEqual(v, want)
+	})
+}
+
+// FieldMatches returns a predicate that is true when the value at the given
+// path in the object in the given resource field exists and f returns true for
+// it. The path is a dot-separated list of JSON field names, such as
+// "spec.replicas"; map keys containing dots are written in brackets, such as
+// "metadata.annotations[example.com/hash]". Typed objects are navigated by
+// their JSON field names. A missing object or path evaluates to false, and the
+// trace distinguishes this from a value that does not match.
+func (c *Chain) FieldMatches(fieldPtr interface{}, path string, f func(v interface{}) bool) *predicate {
+	name := fmt.Sprintf("FieldMatches(%s, %s)", c.fieldName(fieldPtr), path)
+	return c.fieldPredicate(name, fieldPtr, path, f)
+}
+
+// fieldPredicate returns a predicate applying match to the value at path.
+func (c *Chain) fieldPredicate(name string, fieldPtr interface{}, path string, match func(v interface{}) bool) *predicate {
+	checkField(fieldPtr)
+	fields, err := parseFieldPath(path)
+	if err != nil {
+		panic(err.Error())
+	}
+	return c.reactsTo(pcache.NewLeaf(name, func(e *pcache.Evaluation) bool {
+		obj := objectAt(fieldPtr)
+		if obj == nil {
+			e.Notef("object not loaded")
+			return false
+		}
+		v, found, err := fieldValue(obj, fields)
+		if err != nil {
+			e.Notef("%s: %v", path, err)
+			return false
+		}
+		if !found {
+			e.Notef("%s not found", path)
+			return false
+		}
+		if !match(v) {
+			e.Notef("%s is %v", path, v)
+			return false
+		}
+		return true
+	}), fieldPtr, reactsToPath(fields)...)
+}
+
+// parseFieldPath splits a field path into its fields.
+func parseFieldPath(path string) ([]string, error) {
+	var fields []string
+	rest := path
+	for rest != "" {
+		if rest[0] == '[' {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid field path %q: unterminated [", path)
+			}
+			fields = append(fields, rest[1:end])
+			rest = rest[end+1:]
+			rest = strings.TrimPrefix(rest, ".")
+			continue
+		}
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("invalid field path %q: empty field", path)
+		}
+		fields = append(fields, rest[:end])
+		rest = rest[end:]
+		rest = strings.TrimPrefix(rest, ".")
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid field path %q: empty path", path)
+	}
+	return fields, nil
+}
+
+// fieldValue returns the value at the given fields of obj.
+func fieldValue(obj client.Object, fields []string) (interface{}, bool, error) {
+	content, ok := unstructuredContent(obj)
+	if !ok {
+		var err error
+		if content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj); err != nil {
+			return nil, false, err
+		}
+	}
+	return unstructured.NestedFieldNoCopy(content, fields...)
+}
+
+// unstructuredContent returns the content of obj if it is unstructured.
+func unstructuredContent(obj client.Object) (map[string]interface{}, bool) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.Object, true
+	}
+	return nil, false
+}
+
+// valuesEqual compares two values, coercing numbers as described by
+// FieldEquals.
+func valuesEqual(a, b interface{}) bool {
+	if ai, aok := asInt(a); aok {
+		if bi, bok := asInt(b); bok {
+			return ai == bi
+		}
+	}
+	if af, aok := asFloat(a); aok {
+		if bf, bok := asFloat(b); bok {
+			return af == bf
+		}
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// asInt returns v as an int64 if it is an integer that fits.
+func asInt(v interface{}) (int64, bool) {
+	if n, ok := v.(json.Number); ok {
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(rv.Uint()), true
+	}
+	return 0, false
+}
+
+// asFloat returns v as a float64 if it is a number.
+func asFloat(v interface{}) (float64, bool) {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
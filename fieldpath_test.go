@@ -0,0 +1,85 @@
+package operchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Test_If_FieldEquals_Navigates_Typed_Objects tests FieldEquals on a typed
+// object, including number coercion and bracketed keys.
+func Test_If_FieldEquals_Navigates_Typed_Objects(t *testing.T) {
+	var res struct {
+		Deployment *appsv1.Deployment
+	}
+	c := &Chain{Resources: &res}
+	res.Deployment = deployment("web", 3, 3)
+	res.Deployment.Annotations = map[string]string{"example.com/tier": "gold"}
+	cache := pcache.New()
+	assert.True(t, c.FieldEquals(&res.Deployment, "spec.replicas", int64(3)).Eval(cache), "int64 did not match")
+	assert.True(t, c.FieldEquals(&res.Deployment, "spec.replicas", 3).Eval(cache), "int did not match")
+	assert.True(t, c.FieldEquals(&res.Deployment, "spec.replicas", 3.0).Eval(cache), "float64 did not match")
+	assert.False(t, c.FieldEquals(&res.Deployment, "spec.replicas", 4).Eval(cache), "wrong number matched")
+	assert.False(t, c.FieldEquals(&res.Deployment, "spec.replicas", "3").Eval(cache), "string matched a number")
+	assert.True(t, c.FieldEquals(&res.Deployment, "metadata.annotations[example.com/tier]", "gold").Eval(cache), "bracketed key did not match")
+	assert.True(t, c.FieldMatches(&res.Deployment, "status.readyReplicas", func(v interface{}) bool {
+		return valuesEqual(v, 3)
+	}).Eval(cache), "FieldMatches did not match")
+}
+
+// Test_If_FieldEquals_Navigates_Unstructured_Objects tests FieldEquals on an
+// unstructured object.
+func Test_If_FieldEquals_Navigates_Unstructured_Objects(t *testing.T) {
+	var res struct {
+		Object *unstructured.Unstructured
+	}
+	c := &Chain{Resources: &res}
+	res.Object = &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": float64(2),
+			"ratio":    0.5,
+			"tags":     []interface{}{"a", "b"},
+		},
+	}}
+	cache := pcache.New()
+	assert.True(t, c.FieldEquals(&res.Object, "spec.replicas", int32(2)).Eval(cache), "int32 did not match float64")
+	assert.True(t, c.FieldEquals(&res.Object, "spec.ratio", 0.5).Eval(cache), "float did not match")
+	assert.True(t, c.FieldEquals(&res.Object, "spec.tags", []interface{}{"a", "b"}).Eval(cache), "list did not match")
+}
+
+// Test_If_Field_Predicates_Trace_Missing_Paths tests that missing paths
+// evaluate false and are distinguished from unequal values in the trace.
+func Test_If_Field_Predicates_Trace_Missing_Paths(t *testing.T) {
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{Resources: &res}
+	res.Widget = &Widget{
+		ObjectMeta: metav1.ObjectMeta{Name: "w"},
+		Spec:       WidgetSpec{Size: 1},
+	}
+	cache := pcache.New()
+	cache.EnableTrace()
+	assert.False(t, c.FieldEquals(&res.Widget, "spec.color", "red").Eval(cache), "missing path matched")
+	assert.False(t, c.FieldEquals(&res.Widget, "spec.size", 2).Eval(cache), "wrong value matched")
+	trace := cache.Trace()
+	assert.Equal(t, []string{"spec.color not found"}, trace[0].Notes, "missing path was not traced")
+	assert.Equal(t, []string{"spec.size is 1"}, trace[1].Notes, "unequal value was not traced")
+}
+
+// Test_If_Invalid_Field_Paths_Panic tests that invalid paths are rejected at
+// construction.
+func Test_If_Invalid_Field_Paths_Panic(t *testing.T) {
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{Resources: &res}
+	assert.Panics(t, func() { c.FieldEquals(&res.Widget, "spec..size", 1) })
+	assert.Panics(t, func() { c.FieldEquals(&res.Widget, "metadata.annotations[x", 1) })
+	assert.Panics(t, func() { c.FieldEquals(&res.Widget, "", 1) })
+}
@@ -0,0 +1,117 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// IsDeleting returns a predicate that is true when the object in the given
+// resource field is being deleted, i.e. has a deletionTimestamp.
+func (c *Chain) IsDeleting(fieldPtr interface{}) *predicate {
+	checkField(fieldPtr)
+	return pcache.NewLeaf(fmt.Sprintf("IsDeleting(%s)", c.fieldName(fieldPtr)), func(e *pcache.Evaluation) bool {
+		obj := objectAt(fieldPtr)
+		return obj != nil && !obj.GetDeletionTimestamp().IsZero()
+	})
+}
+
+// HasFinalizer returns a predicate that is true when the object in the given
+// resource field has the given finalizer.
+func (c *Chain) HasFinalizer(fieldPtr interface{}, finalizer string) *predicate {
+	checkField(fieldPtr)
+	return pcache.NewLeaf(fmt.Sprintf("HasFinalizer(%s, %s)", c.fieldName(fieldPtr), finalizer), func(e *pcache.Evaluation) bool {
+		obj := objectAt(fieldPtr)
+		return obj != nil && controllerutil.ContainsFinalizer(obj, finalizer)
+	})
+}
+
+// WithFinalizer adds rules to the front of the chain that manage the given
+// finalizer on the primary resource, and must be called after the chain is
+// initialized. While the primary resource is active, the rules add the
+// finalizer. Once it is being deleted, they run the cleanup chain and, only if
+// it completes without stopping or failing, remove the finalizer; either way,
+// the rest of the chain is skipped. When the last finalizer managed this way is
+// removed, the values kept across runs for the object are forgotten.
+//
+// Finalizers added by several calls are cleaned up in the order of the calls,
+// and a cleanup that does not complete prevents those after it from running.
+// Their rules come before rules added by WithPauseSupport, so deletion
+// proceeds even while the primary resource is paused. The rules are also
+// added to the front of each of the chain's VersionedRules.
+func (c *Chain) WithFinalizer(finalizer string, cleanup *Chain) {
+	field := c.primaryField()
+	if !field.IsValid() {
+		panic("finalizer support requires a primary resource")
+	}
+	fieldPtr := field.Addr().Interface()
+	deleting := c.IsDeleting(fieldPtr)
+	has := c.HasFinalizer(fieldPtr, finalizer)
+	rules := []Rule{
+		{
+			Name: "add finalizer " + finalizer,
+			When: And(c.Exists(fieldPtr), Not(deleting), Not(has)),
+			Do: c.PatchMerge(fieldPtr, func(obj client.Object) error {
+				controllerutil.AddFinalizer(obj, finalizer)
+				return nil
+			}),
+		},
+		{
+			Name: "clean up " + finalizer,
+			When: And(deleting, has),
+			Do:   c.Try(c.finalize(fieldPtr, finalizer, cleanup)),
+		},
+	}
+	var stop []Rule
+	if c.finalizers == nil {
+		// A single rule after all finalizer rules skips the rest of the chain
+		// during deletion.
+		stop = []Rule{{Name: "stop while deleting", When: deleting, Do: c.stopDeleting(fieldPtr)}}
+	}
+	c.finalizers = append(c.finalizers, finalizer)
+	c.addSubchain(rules[1].Name, cleanup)
+	at := 2 * (len(c.finalizers) - 1)
+	c.eachRuleSet(func(set []Rule) []Rule {
+		set = JoinRules(stop, set)
+		return JoinRules(set[:at], rules, set[at:])
+	})
+}
+
+// finalize returns an action that runs the cleanup chain for the finalizer
+// and removes the finalizer if it completes.
+func (c *Chain) finalize(fieldPtr interface{}, finalizer string, cleanup *Chain) ActionE {
+	return func(ctx context.Context) error {
+		report, err := cleanup.RunWithReport(ctx, c.req)
+		c.doRequeue(report.Result.RequeueAfter)
+		if err != nil {
+			return fmt.Errorf("clean up %s: %w", finalizer, err)
+		}
+		if report.Stopped {
+			c.doStop()
+			return nil
+		}
+		return c.PatchMergeE(fieldPtr, func(obj client.Object) error {
+			controllerutil.RemoveFinalizer(obj, finalizer)
+			return nil
+		})(ctx)
+	}
+}
+
+// stopDeleting returns an action that stops the chain, forgetting the values
+// kept across runs once none of the managed finalizers remain.
+func (c *Chain) stopDeleting(fieldPtr interface{}) Action {
+	return func(ctx context.Context) {
+		c.doStop()
+		obj := objectAt(fieldPtr)
+		for _, finalizer := range c.finalizers {
+			if controllerutil.ContainsFinalizer(obj, finalizer) {
+				return
+			}
+		}
+		c.Forget(c.req.NamespacedName)
+	}
+}
@@ -0,0 +1,69 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_WithFinalizer_Walks_An_Object_To_Gone tests that WithFinalizer adds
+// its finalizers to an active object, runs the cleanup chains in order on
+// deletion while skipping the normal rules, keeps a finalizer whose cleanup
+// fails, and lets the object go once every cleanup completed.
+func Test_If_WithFinalizer_Walks_An_Object_To_Gone(t *testing.T) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget).Build()
+	var res struct {
+		Widget *Widget
+	}
+	reconciled := 0
+	var cleaned []string
+	failDNS := true
+	cleanup := func(name string, fail *bool) *Chain {
+		sub := &Chain{}
+		sub.InitializeChain(cl, &struct{}{}, []Rule{
+			{When: Predicate(func() bool { return fail != nil && *fail }), Do: sub.Error(assert.AnError)},
+			{Do: func(context.Context) { cleaned = append(cleaned, name) }},
+		})
+		return sub
+	}
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: func(context.Context) { reconciled++ }},
+	})
+	c.WithFinalizer("example.com/storage", cleanup("storage", nil))
+	c.WithFinalizer("example.com/dns", cleanup("dns", &failDNS))
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	stored := func() (*Widget, error) {
+		w := &Widget{}
+		return w, cl.Get(context.Background(), req.NamespacedName, w)
+	}
+
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	w, _ := stored()
+	assert.Equal(t, []string{"example.com/storage", "example.com/dns"}, w.Finalizers, "finalizers were not added in order")
+	assert.Equal(t, 1, reconciled, "normal rules did not run")
+
+	assert.NoError(t, cl.Delete(context.Background(), w))
+	_, err = c.Run(context.Background(), req)
+	assert.ErrorIs(t, err, assert.AnError, "cleanup error was not returned")
+	w, _ = stored()
+	assert.Equal(t, []string{"example.com/dns"}, w.Finalizers, "finalizer of a failed cleanup was removed")
+	assert.Equal(t, []string{"storage"}, cleaned, "cleanups did not run in order")
+	assert.Equal(t, 1, reconciled, "normal rules ran during deletion")
+
+	failDNS = false
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, []string{"storage", "dns"}, cleaned, "remaining cleanup did not run")
+	assert.Equal(t, 1, reconciled, "normal rules ran during deletion")
+	_, err = stored()
+	assert.True(t, apierrors.IsNotFound(err), "object was not deleted")
+}
@@ -0,0 +1,169 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// forEachOptions holds the options of ForEach and its variants.
+type forEachOptions struct {
+	filters []func(item client.Object) bool
+}
+
+// ForEachOption configures ForEach and its variants.
+type ForEachOption func(o *forEachOptions)
+
+// ForEachFilter skips the items for which include returns false. It may be
+// given several times.
+func ForEachFilter(include func(item client.Object) bool) ForEachOption {
+	return func(o *forEachOptions) {
+		o.filters = append(o.filters, include)
+	}
+}
+
+// itemKey is the context key of the item an action runs for.
+type itemKey struct{}
+
+// ItemFrom returns the item of the resource slice field that the action with
+// the given context runs for under ForEach, or nil outside of ForEach.
+func ItemFrom(ctx context.Context) client.Object {
+	item, _ := ctx.Value(itemKey{}).(client.Object)
+	return item
+}
+
+// ForEach returns an action that runs the action returned by fn for each item
+// of the resource slice field, in order. The item is also available to the
+// action through ItemFrom. An item whose action fails does not prevent the
+// others from running; the errors of all items, each prefixed with its item,
+// become the error of the chain. Items are those loaded when the action starts.
+func (c *Chain) ForEach(slicePtr interface{}, fn func(item client.Object) Action, opts ...ForEachOption) Action {
+	return c.Try(c.ForEachE(slicePtr, fn, opts...))
+}
+
+// ForEachE is like ForEach, but returns the error.
+func (c *Chain) ForEachE(slicePtr interface{}, fn func(item client.Object) Action, opts ...ForEachOption) ActionE {
+	checkSliceField(slicePtr)
+	o := &forEachOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(ctx context.Context) error {
+		var errs []error
+		for _, item := range o.items(slicePtr) {
+			if err := c.runForItem(ctx, item, fn(item)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// ForEachParallel is like ForEach, but runs the actions of up to limit items
+// at a time. Requeues requested by the actions fold into the chain's requeue
+// interval as usual. A panic in the action of an item becomes the error of the
+// item, as a PanicError, without affecting the others. Once ctx is done, no
+// further items are started, and the context's error is reported for them.
+// If the chain has ForceSequentialParallel set, the items run one at a time,
+// in order.
+func (c *Chain) ForEachParallel(slicePtr interface{}, limit int, fn func(item client.Object) Action, opts ...ForEachOption) Action {
+	return c.Try(c.ForEachParallelE(slicePtr, limit, fn, opts...))
+}
+
+// ForEachParallelE is like ForEachParallel, but returns the error.
+func (c *Chain) ForEachParallelE(slicePtr interface{}, limit int, fn func(item client.Object) Action, opts ...ForEachOption) ActionE {
+	checkSliceField(slicePtr)
+	if limit < 1 {
+		panic("ForEachParallel requires a limit of at least 1")
+	}
+	o := &forEachOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(ctx context.Context) error {
+		items := o.items(slicePtr)
+		errs := make([]error, len(items))
+		limit := limit
+		if c.ForceSequentialParallel {
+			// With one worker, each item starts once the previous is done.
+			limit = 1
+		}
+		workers := make(chan struct{}, limit)
+		var wg sync.WaitGroup
+		for i, item := range items {
+			if ctx.Err() == nil {
+				select {
+				case workers <- struct{}{}:
+				case <-ctx.Done():
+				}
+			}
+			if ctx.Err() != nil {
+				errs[i] = fmt.Errorf("%s: %w", c.describe(item), ctx.Err())
+				continue
+			}
+			wg.Add(1)
+			go func(i int, item client.Object) {
+				defer wg.Done()
+				defer func() { <-workers }()
+				refineLabels(ctx, func(ctx context.Context) {
+					errs[i] = c.runForItemRecovering(ctx, item, fn)
+				}, "item", c.describe(item))
+			}(i, item)
+		}
+		wg.Wait()
+		return errors.Join(errs...)
+	}
+}
+
+// ForEachChain returns an action that runs the chain returned by newChain for
+// each item of the resource slice field, in order, as Subchain runs a chain.
+// Errors are aggregated as by ForEach, and requeues are propagated to the
+// parent chain. The chains are made anew by every run, so they are not among
+// the subchains of the chain's description.
+func (c *Chain) ForEachChain(slicePtr interface{}, newChain func(item client.Object) *Chain, opts ...ForEachOption) Action {
+	return c.ForEach(slicePtr, func(item client.Object) Action {
+		return c.runSubchain(newChain(item))
+	}, opts...)
+}
+
+// items returns the items of the resource slice field that pass the filters.
+func (o *forEachOptions) items(slicePtr interface{}) []client.Object {
+	var items []client.Object
+next:
+	for _, item := range objectsAt(slicePtr) {
+		for _, include := range o.filters {
+			if !include(item) {
+				continue next
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// runForItem runs the action for the item and returns its errors, prefixed
+// with the item.
+func (c *Chain) runForItem(ctx context.Context, item client.Object, action Action) error {
+	sink := &errorSink{chain: c}
+	ctx = context.WithValue(ctx, itemKey{}, item)
+	action(context.WithValue(ctx, errorSinkKey{}, sink))
+	if err := sink.err(); err != nil {
+		return fmt.Errorf("%s: %w", c.describe(item), err)
+	}
+	return nil
+}
+
+// runForItemRecovering is like runForItem, for the action fn returns for the
+// item, but returns a panic in fn or the action as its error.
+func (c *Chain) runForItemRecovering(ctx context.Context, item client.Object, fn func(item client.Object) Action) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: %w", c.describe(item), &PanicError{Rule: c.currentRule(), Value: r, Stack: debug.Stack()})
+		}
+	}()
+	return c.runForItem(ctx, item, fn(item))
+}
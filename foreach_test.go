@@ -0,0 +1,160 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// forEachResources are the resources of the ForEach tests.
+type forEachResources struct {
+	Namespaces []corev1.Namespace
+}
+
+// forEachChain returns a chain over a cluster with the tenant Namespaces a, b,
+// and c, and the Namespace kube-system.
+func forEachChain() (*Chain, *forEachResources) {
+	builder := fake.NewClientBuilder().WithScheme(newTestScheme())
+	for _, name := range []string{"a", "b", "c", "kube-system"} {
+		builder = builder.WithObjects(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	res := &forEachResources{}
+	return &Chain{Client: builder.Build(), Resources: res}, res
+}
+
+// Test_If_ForEach_Continues_Past_A_Failing_Item tests that ForEach runs the
+// action of every item that passes the filter, even after one fails, and
+// makes the prefixed error of the failing item the error of the chain.
+func Test_If_ForEach_Continues_Past_A_Failing_Item(t *testing.T) {
+	c, res := forEachChain()
+	var ran []string
+	c.Rules = []Rule{{Do: c.ForEach(&res.Namespaces, func(item client.Object) Action {
+		return c.Try(func(ctx context.Context) error {
+			ran = append(ran, ItemFrom(ctx).GetName())
+			if item.GetName() == "b" {
+				return errors.New("quota rejected")
+			}
+			return nil
+		})
+	}, ForEachFilter(func(item client.Object) bool {
+		return item.GetName() != "kube-system"
+	}))}}
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo"}})
+	assert.Equal(t, []string{"a", "b", "c"}, ran, "ForEach did not run every included item")
+	assert.EqualError(t, err, "Namespace b: quota rejected", "ForEach did not report the failing item")
+}
+
+// Test_If_ForEachChain_Runs_A_Chain_Per_Item tests that ForEachChain runs the
+// chain made for every item and propagates their errors.
+func Test_If_ForEachChain_Runs_A_Chain_Per_Item(t *testing.T) {
+	c, res := forEachChain()
+	var ran []string
+	c.Rules = []Rule{{Do: c.ForEachChain(&res.Namespaces, func(item client.Object) *Chain {
+		sub := &Chain{Client: c.Client, Resources: &struct{}{}}
+		sub.Rules = []Rule{{Do: func(context.Context) { ran = append(ran, item.GetName()) }}}
+		if item.GetName() == "b" {
+			sub.Rules = append(sub.Rules, Rule{Do: sub.Error(errors.New("policy rejected"))})
+		}
+		return sub
+	})}}
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo"}})
+	assert.Equal(t, []string{"a", "b", "c", "kube-system"}, ran, "ForEachChain did not run a chain per item")
+	assert.EqualError(t, err, "Namespace b: policy rejected", "ForEachChain did not report the failing item")
+	assert.Empty(t, c.Describe().Subchains, "the chains of the items were recorded as subchains")
+}
+
+// Test_If_Subchains_Are_Recorded_Safely_In_Parallel tests that running
+// subchains from parallel items while the chain is described does not race,
+// and that a subchain is recorded once however often it is run.
+func Test_If_Subchains_Are_Recorded_Safely_In_Parallel(t *testing.T) {
+	c, res := forEachChain()
+	shared := &Chain{Name: "shared", Client: c.Client, Resources: &struct{}{}}
+	c.Rules = []Rule{{Do: c.ForEachParallel(&res.Namespaces, 4, func(item client.Object) Action {
+		return c.Subchain(shared)
+	})}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			c.Describe()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo"}})
+		assert.NoError(t, err)
+	}
+	<-done
+	assert.Len(t, c.Describe().Subchains, 1, "the subchain was not recorded once")
+}
+
+// Test_If_ForEachParallel_Bounds_Concurrency_And_Aggregates_Errors tests that
+// ForEachParallel runs at most limit items at a time, attempts every item, and
+// joins the errors of failing and panicking items.
+func Test_If_ForEachParallel_Bounds_Concurrency_And_Aggregates_Errors(t *testing.T) {
+	c, res := forEachChain()
+	for i := 0; i < 6; i++ {
+		res.Namespaces = append(res.Namespaces, corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("tenant-%d", i)}})
+	}
+	var running, highWater atomic.Int32
+	var attempted sync.Map
+	err := c.ForEachParallelE(&res.Namespaces, 3, func(item client.Object) Action {
+		return c.Try(func(ctx context.Context) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				if h := highWater.Load(); n <= h || highWater.CompareAndSwap(h, n) {
+					break
+				}
+			}
+			attempted.Store(item.GetName(), true)
+			time.Sleep(10 * time.Millisecond)
+			switch item.GetName() {
+			case "tenant-1":
+				return errors.New("quota rejected")
+			case "tenant-4":
+				panic("policy generator crashed")
+			}
+			c.doRequeue(time.Minute)
+			return nil
+		})
+	})(context.Background())
+	assert.Equal(t, int32(3), highWater.Load(), "ForEachParallel did not run up to limit items at a time")
+	count := 0
+	attempted.Range(func(key, value any) bool {
+		count++
+		return true
+	})
+	assert.Equal(t, 6, count, "ForEachParallel did not attempt every item")
+	assert.ErrorContains(t, err, "Namespace tenant-1: quota rejected", "error of the failing item was not reported")
+	var panicErr *PanicError
+	assert.ErrorAs(t, err, &panicErr, "panic of an item was not reported")
+	assert.Equal(t, "policy generator crashed", panicErr.Value, "panic value was not reported")
+	assert.Equal(t, time.Minute, c.interval, "requeue of the items was not kept")
+}
+
+// Test_If_ForEachParallel_Starts_No_Items_Once_Cancelled tests that
+// ForEachParallel reports the context's error for items it did not start.
+func Test_If_ForEachParallel_Starts_No_Items_Once_Cancelled(t *testing.T) {
+	c, res := forEachChain()
+	res.Namespaces = []corev1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "a"}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ran := false
+	err := c.ForEachParallelE(&res.Namespaces, 1, func(item client.Object) Action {
+		return func(context.Context) { ran = true }
+	})(ctx)
+	assert.False(t, ran, "ForEachParallel started an item after cancellation")
+	assert.ErrorIs(t, err, context.Canceled, "ForEachParallel did not report the cancellation")
+}
@@ -0,0 +1,148 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ObservedGenerationGetter is implemented by resource types that report their
+// status.observedGeneration directly. ok is false when no generation has been
+// observed yet. Types that do not implement it are inspected by reflection for
+// a Status.ObservedGeneration field.
+type ObservedGenerationGetter interface {
+	GetObservedGeneration() (generation int64, ok bool)
+}
+
+// ObservedGenerationSetter is implemented by resource types that set their
+// status.observedGeneration directly. Types that do not implement it are
+// updated by reflection through a Status.ObservedGeneration field.
+type ObservedGenerationSetter interface {
+	SetObservedGeneration(generation int64)
+}
+
+// observedGenerationOptions holds the options of SetObservedGeneration.
+type observedGenerationOptions struct {
+	onlyOnSuccess bool
+}
+
+// ObservedGenerationOption configures SetObservedGeneration.
+type ObservedGenerationOption func(o *observedGenerationOptions)
+
+// OnlyOnSuccess makes SetObservedGeneration do nothing if the Run has already
+// failed, so that a generation is only recorded as observed once the chain
+// has fully handled it. It is meant for use in the chain's Finally rules.
+func OnlyOnSuccess() ObservedGenerationOption {
+	return func(o *observedGenerationOptions) {
+		o.onlyOnSuccess = true
+	}
+}
+
+// GenerationChanged returns a predicate that is true when the object in the
+// given resource field has a metadata.generation that differs from its
+// status.observedGeneration, or has no observed generation at all. It is false
+// when the object is not loaded.
+func (c *Chain) GenerationChanged(fieldPtr interface{}) *predicate {
+	checkField(fieldPtr)
+	return Predicate(func() bool {
+		obj := objectAt(fieldPtr)
+		if obj == nil {
+			return false
+		}
+		observed, ok := observedGeneration(obj)
+		return !ok || observed != obj.GetGeneration()
+	})
+}
+
+// observedGeneration returns the status.observedGeneration of obj, and whether
+// it was present.
+func observedGeneration(obj client.Object) (int64, bool) {
+	if g, ok := obj.(ObservedGenerationGetter); ok {
+		return g.GetObservedGeneration()
+	}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		v, found, err := unstructured.NestedFieldNoCopy(u.Object, "status", "observedGeneration")
+		if err != nil || !found {
+			return 0, false
+		}
+		return toInt64(v)
+	}
+	status := statusOf(obj)
+	if !status.IsValid() {
+		return 0, false
+	}
+	field := status.FieldByName("ObservedGeneration")
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return 0, false
+		}
+		field = field.Elem()
+	}
+	if field.Kind() != reflect.Int64 {
+		return 0, false
+	}
+	return field.Int(), true
+}
+
+// toInt64 converts a number decoded from JSON to an int64.
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// SetObservedGeneration returns an action that copies the metadata.generation
+// of the object in the given resource field into its status.observedGeneration.
+// The status is written as configured by the chain's BatchStatus, and not at
+// all if it did not change.
+func (c *Chain) SetObservedGeneration(fieldPtr interface{}, opts ...ObservedGenerationOption) Action {
+	checkField(fieldPtr)
+	o := &observedGenerationOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return writes(c.Try(func(ctx context.Context) error {
+		if o.onlyOnSuccess && c.failed() {
+			return nil
+		}
+		return c.updateStatusLater(ctx, fieldPtr, setObservedGeneration)
+	}), fieldTarget(fieldPtr, "status/observedGeneration"))
+}
+
+// setObservedGeneration copies the generation of obj into its
+// status.observedGeneration.
+func setObservedGeneration(obj client.Object) error {
+	generation := obj.GetGeneration()
+	if s, ok := obj.(ObservedGenerationSetter); ok {
+		s.SetObservedGeneration(generation)
+		return nil
+	}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return unstructured.SetNestedField(u.Object, generation, "status", "observedGeneration")
+	}
+	status := statusOf(obj)
+	field := reflect.Value{}
+	if status.IsValid() {
+		field = status.FieldByName("ObservedGeneration")
+	}
+	switch {
+	case field.Kind() == reflect.Int64 && field.CanSet():
+		field.SetInt(generation)
+	case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Int64 && field.CanSet():
+		field.Set(reflect.ValueOf(&generation).Convert(field.Type()))
+	default:
+		return fmt.Errorf("%T has no Status.ObservedGeneration of type int64", obj)
+	}
+	return nil
+}
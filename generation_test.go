@@ -0,0 +1,126 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Test_If_GenerationChanged_Compares_Typed_Status tests that GenerationChanged
+// compares metadata.generation to Status.ObservedGeneration on a typed object.
+func Test_If_GenerationChanged_Compares_Typed_Status(t *testing.T) {
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{Resources: &res}
+	p := c.GenerationChanged(&res.Widget)
+	assert.False(t, p.Eval(pcache.New()), "predicate was true for an unloaded object")
+
+	res.Widget = &Widget{
+		TypeMeta:   metav1.TypeMeta{APIVersion: widgetGroupVersion.String(), Kind: "Widget"},
+		ObjectMeta: metav1.ObjectMeta{Generation: 2},
+		Status:     WidgetStatus{ObservedGeneration: 1},
+	}
+	assert.True(t, p.Eval(pcache.New()), "predicate was false for a changed generation")
+	res.Widget.Status.ObservedGeneration = 2
+	assert.False(t, p.Eval(pcache.New()), "predicate was true for an observed generation")
+}
+
+// Test_If_GenerationChanged_Is_True_Without_ObservedGeneration tests that
+// GenerationChanged is true for an object without an observed generation.
+func Test_If_GenerationChanged_Is_True_Without_ObservedGeneration(t *testing.T) {
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+	}
+	c := &Chain{Resources: &res}
+	p := c.GenerationChanged(&res.ConfigMap)
+	res.ConfigMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Generation: 1}}
+	assert.True(t, p.Eval(pcache.New()), "predicate was false without an observed generation")
+}
+
+// Test_If_GenerationChanged_Reads_Unstructured tests that GenerationChanged
+// reads status.observedGeneration from an unstructured object.
+func Test_If_GenerationChanged_Reads_Unstructured(t *testing.T) {
+	var res struct {
+		Object *unstructured.Unstructured
+	}
+	c := &Chain{Resources: &res}
+	p := c.GenerationChanged(&res.Object)
+	res.Object = &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"generation": int64(3)},
+	}}
+	assert.True(t, p.Eval(pcache.New()), "predicate was false without an observed generation")
+	res.Object.Object["status"] = map[string]interface{}{"observedGeneration": int64(2)}
+	assert.True(t, p.Eval(pcache.New()), "predicate was false for a changed generation")
+	res.Object.Object["status"] = map[string]interface{}{"observedGeneration": float64(3)}
+	assert.False(t, p.Eval(pcache.New()), "predicate was true for an observed generation")
+}
+
+// accessorWidget is a Widget that reports its observed generation through the
+// ObservedGenerationGetter interface.
+type accessorWidget struct {
+	Widget
+	observed *int64
+}
+
+// GetObservedGeneration implements ObservedGenerationGetter.
+func (w *accessorWidget) GetObservedGeneration() (int64, bool) {
+	if w.observed == nil {
+		return 0, false
+	}
+	return *w.observed, true
+}
+
+// Test_If_GenerationChanged_Uses_The_Accessor tests that GenerationChanged
+// prefers the ObservedGenerationGetter interface over reflection.
+func Test_If_GenerationChanged_Uses_The_Accessor(t *testing.T) {
+	var res struct {
+		Widget *accessorWidget
+	}
+	c := &Chain{Resources: &res}
+	p := c.GenerationChanged(&res.Widget)
+	res.Widget = &accessorWidget{}
+	res.Widget.Generation = 4
+	res.Widget.Status.ObservedGeneration = 4
+	assert.True(t, p.Eval(pcache.New()), "predicate used the Status field instead of the accessor")
+	observed := int64(4)
+	res.Widget.observed = &observed
+	assert.False(t, p.Eval(pcache.New()), "predicate was true for an observed generation")
+}
+
+// Test_If_SetObservedGeneration_Only_Records_Clean_Runs tests that
+// SetObservedGeneration with OnlyOnSuccess, as a Finally rule, is skipped when
+// an earlier rule failed and applied on a clean run.
+func Test_If_SetObservedGeneration_Only_Records_Clean_Runs(t *testing.T) {
+	fail := true
+	c, cl, _ := conditionChain(false, func(c *Chain, widget **Widget) []Rule {
+		c.Finally = []Rule{
+			{When: c.GenerationChanged(widget), Do: c.SetObservedGeneration(widget, OnlyOnSuccess())},
+		}
+		return []Rule{
+			{When: Predicate(func() bool { return fail }), Do: c.Error(assert.AnError)},
+		}
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	observed := func() int64 {
+		w := &Widget{}
+		assert.NoError(t, cl.Get(context.Background(), req.NamespacedName, w))
+		return w.Status.ObservedGeneration
+	}
+	_, err := c.Run(context.Background(), req)
+	assert.Equal(t, assert.AnError, err, "Run did not fail")
+	assert.Zero(t, observed(), "generation was recorded after a failure")
+
+	fail = false
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, int64(2), observed(), "generation was not recorded after a clean run")
+}
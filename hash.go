@@ -0,0 +1,111 @@
+package operchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// HashOf returns a stable hash of v. The value is encoded as canonical JSON,
+// with object keys sorted and numbers kept in their original decimal form, so
+// the hash does not depend on map iteration order or on the Go version.
+func HashOf(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	// Round-trip through a generic value so that all objects, including
+	// structs with custom marshalers, are re-encoded with sorted keys.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return "", err
+	}
+	canonical, err := json.Marshal(generic)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// MustHashOf is like HashOf but panics on error.
+func MustHashOf(v interface{}) string {
+	h, err := HashOf(v)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// stringFunc converts a value given as a string or a func() string to a
+// function. It panics otherwise, naming the value as what.
+func stringFunc(what string, v interface{}) func() string {
+	switch f := v.(type) {
+	case string:
+		return func() string { return f }
+	case func() string:
+		return f
+	}
+	panic(what + " must be a string or a func() string")
+}
+
+// HashDiffers returns a predicate that is true when the object in the given
+// resource field does not carry the current hash in the given annotation, or is
+// not loaded. currentHash is either a string or a func() string evaluated when
+// the predicate is.
+func (c *Chain) HashDiffers(fieldPtr interface{}, annotationKey string, currentHash interface{}) *predicate {
+	checkField(fieldPtr)
+	hash := stringFunc("hash", currentHash)
+	name := fmt.Sprintf("HashDiffers(%s, %s)", c.fieldName(fieldPtr), annotationKey)
+	return c.reactsTo(pcache.NewLeaf(name, func(e *pcache.Evaluation) bool {
+		obj := objectAt(fieldPtr)
+		if obj == nil {
+			e.Notef("object not loaded")
+			return true
+		}
+		stored, ok := obj.GetAnnotations()[annotationKey]
+		if !ok {
+			e.Notef("annotation %s not set", annotationKey)
+			return true
+		}
+		return stored != hash()
+	}), fieldPtr, ReactsToAnnotations)
+}
+
+// StampHash returns an action that records the current hash in the given
+// annotation of the object in the given resource field, typically after the
+// object has been successfully updated. It does nothing when the object is not
+// loaded or already carries the hash.
+func (c *Chain) StampHash(fieldPtr interface{}, annotationKey string, currentHash interface{}) Action {
+	checkField(fieldPtr)
+	hash := stringFunc("hash", currentHash)
+	return writes(func(ctx context.Context) {
+		obj := objectAt(fieldPtr)
+		if obj == nil {
+			return
+		}
+		value := hash()
+		if obj.GetAnnotations()[annotationKey] == value {
+			return
+		}
+		patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[annotationKey] = value
+		obj.SetAnnotations(annotations)
+		if err := c.Patch(ctx, obj, patch); err != nil {
+			c.fail(ctx, err)
+		}
+	}, fieldTarget(fieldPtr, "metadata/annotations/"+annotationKey))
+}
@@ -0,0 +1,81 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Test_If_HashOf_Matches_Golden_Values tests that HashOf produces the SHA-256
+// of the canonical JSON encoding, which must never change between releases.
+func Test_If_HashOf_Matches_Golden_Values(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "settings",
+			Namespace: "default",
+			Labels:    map[string]string{"tier": "web", "app": "demo"},
+		},
+		Data: map[string]string{"z.conf": "last", "a.conf": "first", "count": "3"},
+	}
+	// sha256(`{"a.conf":"first","count":"3","z.conf":"last"}`)
+	assert.Equal(t, "d73141e5f8c7e0878a448854400eee8eadc6b6c05afe9ee54bfbfa4d3815bbaa", MustHashOf(cm.Data))
+	assert.Equal(t, "72b322310aa5005d50541ee0bc96ae024b02b85e876de1ba93825b7716ebd63c", MustHashOf(cm))
+	// sha256(`{"big":18446744073709551615,"ratio":0.5,"replicas":3}`)
+	assert.Equal(t, "17123597a34de0f20a7108103e30ae02df4c0eb19da5026e14b0bc4733e78d01", MustHashOf(map[string]interface{}{
+		"replicas": int64(3),
+		"ratio":    0.5,
+		"big":      uint64(18446744073709551615),
+	}))
+}
+
+// Test_If_HashOf_Ignores_Field_Order tests that a struct and a map with the
+// same content hash identically.
+func Test_If_HashOf_Ignores_Field_Order(t *testing.T) {
+	type spec struct {
+		Zeta  string `json:"zeta"`
+		Alpha int    `json:"alpha"`
+	}
+	assert.Equal(t, MustHashOf(map[string]interface{}{"alpha": 1, "zeta": "z"}), MustHashOf(spec{Zeta: "z", Alpha: 1}))
+}
+
+// Test_If_HashDiffers_Compares_The_Annotation tests that HashDiffers compares
+// the stored annotation with the current hash.
+func Test_If_HashDiffers_Compares_The_Annotation(t *testing.T) {
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+	}
+	c := &Chain{Resources: &res}
+	current := "abc"
+	p := c.HashDiffers(&res.ConfigMap, "example.com/hash", func() string { return current })
+	assert.True(t, p.Eval(pcache.New()), "predicate was false for an unloaded object")
+	res.ConfigMap = &corev1.ConfigMap{}
+	assert.True(t, p.Eval(pcache.New()), "predicate was false without the annotation")
+	res.ConfigMap.Annotations = map[string]string{"example.com/hash": "abc"}
+	assert.False(t, p.Eval(pcache.New()), "predicate was true for a matching hash")
+	current = "def"
+	assert.True(t, p.Eval(pcache.New()), "predicate was false for a changed hash")
+}
+
+// Test_If_StampHash_Patches_The_Annotation tests that StampHash writes the
+// current hash to the object's annotation.
+func Test_If_StampHash_Patches_The_Annotation(t *testing.T) {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "child", Namespace: "default"}}
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+	}
+	c := &Chain{Client: fake.NewClientBuilder().WithObjects(cm).Build(), Resources: &res}
+	res.ConfigMap = cm.DeepCopy()
+	c.StampHash(&res.ConfigMap, "example.com/hash", "abc")(context.Background())
+	assert.NoError(t, c.err, "StampHash recorded an error")
+	stored := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(cm), stored))
+	assert.Equal(t, "abc", stored.Annotations["example.com/hash"], "annotation was not stamped")
+	assert.False(t, c.HashDiffers(&res.ConfigMap, "example.com/hash", "abc").Eval(pcache.New()), "loaded object was not updated")
+}
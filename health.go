@@ -0,0 +1,132 @@
+package operchain
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// DefaultHealthStaleness is the HealthStaleness of a chain without one.
+const DefaultHealthStaleness = 5 * time.Minute
+
+// health is the state of a chain reported by HealthCheck. It is guarded by the
+// chain's lock.
+type health struct {
+	// started is when the chain first finished a Run.
+	started time.Time
+	// lastSuccess and lastFailure are when the last successful and failed
+	// Runs finished.
+	lastSuccess, lastFailure time.Time
+	// streaking are the keys of the objects whose failure streak reached the
+	// chain's HealthFailureStreak.
+	streaking map[string]bool
+}
+
+// HealthCheck returns a checker for the manager's health or readiness probes
+// that fails while the chain is not making progress: when Runs have failed
+// since the last successful one, and none succeeded within the chain's
+// HealthStaleness, or, if the chain has a HealthFailureStreak, when the Runs
+// for an object have failed that many times in a row. A chain that has not
+// run yet is healthy.
+func (c *Chain) HealthCheck() healthz.Checker {
+	return func(*http.Request) error {
+		staleness := c.HealthStaleness
+		if staleness == 0 {
+			staleness = DefaultHealthStaleness
+		}
+		now := c.now()
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		h := &c.health
+		var errs []error
+		if h.lastFailure.After(h.lastSuccess) {
+			since := h.lastSuccess
+			if since.IsZero() {
+				since = h.started
+			}
+			if now.Sub(since) >= staleness {
+				if h.lastSuccess.IsZero() {
+					errs = append(errs, fmt.Errorf("no successful Run since %s", since.Format(time.RFC3339)))
+				} else {
+					errs = append(errs, fmt.Errorf("no successful Run since %s, last failure at %s", since.Format(time.RFC3339), h.lastFailure.Format(time.RFC3339)))
+				}
+			}
+		}
+		if len(h.streaking) > 0 {
+			keys := make([]string, 0, len(h.streaking))
+			for key := range h.streaking {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			errs = append(errs, fmt.Errorf("%d objects failed at least %d Runs in a row: %s", len(keys), c.HealthFailureStreak, strings.Join(keys, ", ")))
+		}
+		if err := errors.Join(errs...); err != nil {
+			return fmt.Errorf("chain %s: %w", c.Name, err)
+		}
+		return nil
+	}
+}
+
+// recordHealth records the end of a Run that failed with err, if not nil,
+// for HealthCheck.
+func (c *Chain) recordHealth(err error) {
+	now := c.now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	h := &c.health
+	if h.started.IsZero() {
+		h.started = now
+	}
+	if err != nil {
+		h.lastFailure = now
+	} else {
+		h.lastSuccess = now
+	}
+}
+
+// recordHealthStreak records, for HealthCheck, whether the failure streak of
+// the current request reached the chain's HealthFailureStreak.
+func (c *Chain) recordHealthStreak(streak int) {
+	if c.HealthFailureStreak <= 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.setStreaking(c.storeKey(c.kind, c.req.NamespacedName), streak >= c.HealthFailureStreak)
+}
+
+// setStreaking records whether the object with the key is streaking. The lock
+// must be held.
+func (c *Chain) setStreaking(key string, streaking bool) {
+	h := &c.health
+	switch {
+	case streaking && h.streaking == nil:
+		h.streaking = map[string]bool{key: true}
+	case streaking:
+		h.streaking[key] = true
+	default:
+		delete(h.streaking, key)
+	}
+}
+
+// AddReadyzChecks registers the HealthCheck of each chain with the manager's
+// readiness probe, named after the chain, or after its index among chains if
+// it has no Name.
+func AddReadyzChecks(mgr manager.Manager, chains ...*Chain) error {
+	for i, c := range chains {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("chain-%d", i)
+		}
+		if err := mgr.AddReadyzCheck(name, c.HealthCheck()); err != nil {
+			return fmt.Errorf("add readyz check %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// healthChain returns a chain over a Widget that fails while failing is true,
+// and its clock.
+func healthChain(failing *bool) (*Chain, *clocktesting.FakeClock) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+	}
+	clk := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := &Chain{Name: "widgets", Clock: clk, HealthStaleness: 5 * time.Minute}
+	c.InitializeChain(cl, &res, []Rule{
+		{When: Predicate(func() bool { return *failing }), Do: c.Error(errors.New("broken"))},
+	})
+	return c, clk
+}
+
+// Test_If_Failing_Runs_Make_The_HealthCheck_Fail tests that the health check
+// fails once Runs have failed for longer than the staleness window without a
+// successful one, and recovers with a successful Run.
+func Test_If_Failing_Runs_Make_The_HealthCheck_Fail(t *testing.T) {
+	failing := false
+	c, clk := healthChain(&failing)
+	check := c.HealthCheck()
+	assert.NoError(t, check(nil), "a chain that never ran was unhealthy")
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, _ = c.Run(context.Background(), req)
+
+	failing = true
+	for i := 0; i < 5; i++ {
+		clk.Step(time.Minute)
+		_, _ = c.Run(context.Background(), req)
+		if i < 3 {
+			assert.NoError(t, check(nil), "the check failed within the staleness window")
+		}
+	}
+	assert.EqualError(t, check(nil), "chain widgets: no successful Run since 2024-01-01T00:00:00Z, last failure at 2024-01-01T00:05:00Z", "the check did not fail")
+
+	failing = false
+	_, _ = c.Run(context.Background(), req)
+	assert.NoError(t, check(nil), "a successful Run did not restore health")
+}
+
+// Test_If_A_Failure_Streak_Makes_The_HealthCheck_Fail tests that the health
+// check fails while an object's failure streak reaches HealthFailureStreak.
+func Test_If_A_Failure_Streak_Makes_The_HealthCheck_Fail(t *testing.T) {
+	failing := true
+	c, _ := healthChain(&failing)
+	c.HealthFailureStreak = 3
+	check := c.HealthCheck()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	for i := 0; i < 2; i++ {
+		_, _ = c.Run(context.Background(), req)
+	}
+	assert.NoError(t, check(nil), "the check failed below the streak")
+	_, _ = c.Run(context.Background(), req)
+	assert.EqualError(t, check(nil), "chain widgets: 1 objects failed at least 3 Runs in a row: default/demo", "the check did not fail at the streak")
+
+	c.Forget(req.NamespacedName)
+	assert.NoError(t, check(nil), "a forgotten object kept the check failing")
+}
+
+// Test_If_AddReadyzChecks_Registers_The_Chains tests that AddReadyzChecks
+// registers the checks of chains with and without names.
+func Test_If_AddReadyzChecks_Registers_The_Chains(t *testing.T) {
+	mgr := newTestManager(t)
+	assert.NoError(t, AddReadyzChecks(mgr, &Chain{Name: "widgets"}, &Chain{}), "checks were not registered")
+}
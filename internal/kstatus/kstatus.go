@@ -0,0 +1,284 @@
+// Package kstatus computes the readiness of Kubernetes objects, following the
+// conventions of sigs.k8s.io/cli-utils/pkg/kstatus in a much smaller form.
+package kstatus
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Status is the readiness status of an object.
+type Status string
+
+const (
+	// Current means the object has reached its desired state.
+	Current Status = "Current"
+	// InProgress means the object is still working towards its desired state.
+	InProgress Status = "InProgress"
+	// Failed means the object cannot reach its desired state without
+	// intervention.
+	Failed Status = "Failed"
+	// Terminating means the object is being deleted.
+	Terminating Status = "Terminating"
+)
+
+// Result is the computed status of an object and a human-readable message
+// explaining it.
+type Result struct {
+	Status  Status
+	Message string
+}
+
+// statusFunc computes the status of an object of a specific kind.
+type statusFunc func(u *unstructured.Unstructured) Result
+
+// kinds maps group/kind to the kind-specific status computation.
+var kinds = map[string]statusFunc{
+	"apps/Deployment":            deploymentStatus,
+	"apps/StatefulSet":           statefulSetStatus,
+	"apps/DaemonSet":             daemonSetStatus,
+	"apps/ReplicaSet":            replicaSetStatus,
+	"/Pod":                       podStatus,
+	"/PersistentVolumeClaim":     pvcStatus,
+	"/Service":                   serviceStatus,
+	"batch/Job":                  jobStatus,
+	"policy/PodDisruptionBudget": pdbStatus,
+}
+
+// Compute computes the status of the given object.
+func Compute(u *unstructured.Unstructured) Result {
+	if u.GetDeletionTimestamp() != nil {
+		return Result{Status: Terminating, Message: "object is being deleted"}
+	}
+	if observed, ok := nestedInt64(u, "status", "observedGeneration"); ok && observed < u.GetGeneration() {
+		return Result{Status: InProgress, Message: fmt.Sprintf("generation %d not yet observed", u.GetGeneration())}
+	}
+	if f, ok := kinds[u.GroupVersionKind().Group+"/"+u.GetKind()]; ok {
+		return f(u)
+	}
+	return conditionStatus(u)
+}
+
+// conditionStatus computes the status of an object from the standard
+// Stalled, Reconciling, and Ready conditions. An object without any of them is
+// considered Current.
+func conditionStatus(u *unstructured.Unstructured) Result {
+	if cond, ok := condition(u, "Stalled"); ok && cond.status == "True" {
+		return Result{Status: Failed, Message: cond.message}
+	}
+	if cond, ok := condition(u, "Reconciling"); ok && cond.status == "True" {
+		return Result{Status: InProgress, Message: cond.message}
+	}
+	if cond, ok := condition(u, "Ready"); ok {
+		if cond.status == "True" {
+			return Result{Status: Current, Message: cond.message}
+		}
+		return Result{Status: InProgress, Message: cond.message}
+	}
+	return Result{Status: Current}
+}
+
+// deploymentStatus computes the status of a Deployment.
+func deploymentStatus(u *unstructured.Unstructured) Result {
+	if cond, ok := condition(u, "Progressing"); ok && cond.reason == "ProgressDeadlineExceeded" {
+		return Result{Status: Failed, Message: cond.message}
+	}
+	replicas := specReplicas(u)
+	updated, _ := nestedInt64(u, "status", "updatedReplicas")
+	ready, _ := nestedInt64(u, "status", "readyReplicas")
+	available, _ := nestedInt64(u, "status", "availableReplicas")
+	total, _ := nestedInt64(u, "status", "replicas")
+	switch {
+	case updated < replicas:
+		return inProgress("%d/%d replicas updated", updated, replicas)
+	case total > updated:
+		return inProgress("%d old replicas pending termination", total-updated)
+	case available < updated:
+		return inProgress("%d/%d replicas available", available, updated)
+	case ready < updated:
+		return inProgress("%d/%d replicas ready", ready, updated)
+	}
+	return Result{Status: Current, Message: fmt.Sprintf("%d/%d replicas available", available, replicas)}
+}
+
+// statefulSetStatus computes the status of a StatefulSet.
+func statefulSetStatus(u *unstructured.Unstructured) Result {
+	replicas := specReplicas(u)
+	ready, _ := nestedInt64(u, "status", "readyReplicas")
+	current, _ := nestedInt64(u, "status", "currentReplicas")
+	updated, _ := nestedInt64(u, "status", "updatedReplicas")
+	strategy, _, _ := unstructured.NestedString(u.Object, "spec", "updateStrategy", "type")
+	if ready < replicas {
+		return inProgress("%d/%d replicas ready", ready, replicas)
+	}
+	if strategy != "OnDelete" {
+		currentRevision, _, _ := unstructured.NestedString(u.Object, "status", "currentRevision")
+		updateRevision, _, _ := unstructured.NestedString(u.Object, "status", "updateRevision")
+		if updated < replicas || currentRevision != updateRevision {
+			return inProgress("%d/%d replicas updated", updated, replicas)
+		}
+	} else if current < replicas {
+		return inProgress("%d/%d replicas current", current, replicas)
+	}
+	return Result{Status: Current, Message: fmt.Sprintf("%d/%d replicas ready", ready, replicas)}
+}
+
+// daemonSetStatus computes the status of a DaemonSet.
+func daemonSetStatus(u *unstructured.Unstructured) Result {
+	desired, _ := nestedInt64(u, "status", "desiredNumberScheduled")
+	updated, _ := nestedInt64(u, "status", "updatedNumberScheduled")
+	available, _ := nestedInt64(u, "status", "numberAvailable")
+	ready, _ := nestedInt64(u, "status", "numberReady")
+	switch {
+	case updated < desired:
+		return inProgress("%d/%d pods updated", updated, desired)
+	case available < desired:
+		return inProgress("%d/%d pods available", available, desired)
+	case ready < desired:
+		return inProgress("%d/%d pods ready", ready, desired)
+	}
+	return Result{Status: Current, Message: fmt.Sprintf("%d/%d pods ready", ready, desired)}
+}
+
+// replicaSetStatus computes the status of a ReplicaSet.
+func replicaSetStatus(u *unstructured.Unstructured) Result {
+	if cond, ok := condition(u, "ReplicaFailure"); ok && cond.status == "True" {
+		return Result{Status: InProgress, Message: cond.message}
+	}
+	replicas := specReplicas(u)
+	ready, _ := nestedInt64(u, "status", "readyReplicas")
+	available, _ := nestedInt64(u, "status", "availableReplicas")
+	switch {
+	case available < replicas:
+		return inProgress("%d/%d replicas available", available, replicas)
+	case ready < replicas:
+		return inProgress("%d/%d replicas ready", ready, replicas)
+	}
+	return Result{Status: Current, Message: fmt.Sprintf("%d/%d replicas ready", ready, replicas)}
+}
+
+// podStatus computes the status of a Pod.
+func podStatus(u *unstructured.Unstructured) Result {
+	phase, _, _ := unstructured.NestedString(u.Object, "status", "phase")
+	switch phase {
+	case "Succeeded":
+		return Result{Status: Current, Message: "pod has completed"}
+	case "Failed":
+		return Result{Status: Failed, Message: "pod has failed"}
+	case "Running":
+		if cond, ok := condition(u, "Ready"); ok && cond.status == "True" {
+			return Result{Status: Current, Message: "pod is ready"}
+		}
+		return inProgress("pod is running but not ready")
+	}
+	return inProgress("pod is %s", phaseOrUnknown(phase))
+}
+
+// pvcStatus computes the status of a PersistentVolumeClaim.
+func pvcStatus(u *unstructured.Unstructured) Result {
+	phase, _, _ := unstructured.NestedString(u.Object, "status", "phase")
+	if phase == "Bound" {
+		return Result{Status: Current, Message: "claim is bound"}
+	}
+	return inProgress("claim is %s", phaseOrUnknown(phase))
+}
+
+// serviceStatus computes the status of a Service. Only LoadBalancer Services
+// need to wait, for an ingress point to be assigned.
+func serviceStatus(u *unstructured.Unstructured) Result {
+	serviceType, _, _ := unstructured.NestedString(u.Object, "spec", "type")
+	if serviceType != "LoadBalancer" {
+		return Result{Status: Current, Message: "service is ready"}
+	}
+	ingress, _, _ := unstructured.NestedSlice(u.Object, "status", "loadBalancer", "ingress")
+	if len(ingress) == 0 {
+		return inProgress("waiting for load balancer ingress")
+	}
+	return Result{Status: Current, Message: "load balancer is ready"}
+}
+
+// jobStatus computes the status of a Job.
+func jobStatus(u *unstructured.Unstructured) Result {
+	if cond, ok := condition(u, "Failed"); ok && cond.status == "True" {
+		return Result{Status: Failed, Message: cond.message}
+	}
+	if cond, ok := condition(u, "Complete"); ok && cond.status == "True" {
+		return Result{Status: Current, Message: "job has completed"}
+	}
+	return inProgress("job is running")
+}
+
+// pdbStatus computes the status of a PodDisruptionBudget.
+func pdbStatus(u *unstructured.Unstructured) Result {
+	healthy, _ := nestedInt64(u, "status", "currentHealthy")
+	desired, _ := nestedInt64(u, "status", "desiredHealthy")
+	if healthy < desired {
+		return inProgress("%d/%d pods healthy", healthy, desired)
+	}
+	return Result{Status: Current, Message: fmt.Sprintf("%d/%d pods healthy", healthy, desired)}
+}
+
+// inProgress returns an InProgress result with a formatted message.
+func inProgress(format string, args ...interface{}) Result {
+	return Result{Status: InProgress, Message: fmt.Sprintf(format, args...)}
+}
+
+// phaseOrUnknown returns the phase, or "Unknown" if it is empty.
+func phaseOrUnknown(phase string) string {
+	if phase == "" {
+		return "Unknown"
+	}
+	return phase
+}
+
+// specReplicas returns spec.replicas, defaulting to 1.
+func specReplicas(u *unstructured.Unstructured) int64 {
+	if replicas, ok := nestedInt64(u, "spec", "replicas"); ok {
+		return replicas
+	}
+	return 1
+}
+
+// nestedInt64 returns the integer at the given path, accepting any of the
+// numeric types a JSON decoder may have produced.
+func nestedInt64(u *unstructured.Unstructured, fields ...string) (int64, bool) {
+	v, found, err := unstructured.NestedFieldNoCopy(u.Object, fields...)
+	if err != nil || !found {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int32:
+		return int64(n), true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// cond is a status condition read from an unstructured object.
+type cond struct {
+	status  string
+	reason  string
+	message string
+}
+
+// condition returns the status condition of the given type.
+func condition(u *unstructured.Unstructured, condType string) (cond, bool) {
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, item := range conditions {
+		c, ok := item.(map[string]interface{})
+		if !ok || c["type"] != condType {
+			continue
+		}
+		status, _ := c["status"].(string)
+		reason, _ := c["reason"].(string)
+		message, _ := c["message"].(string)
+		return cond{status: status, reason: reason, message: message}, true
+	}
+	return cond{}, false
+}
@@ -0,0 +1,87 @@
+package kstatus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// object returns an unstructured object of the given kind built from content.
+func object(apiVersion, kind string, content map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: content}
+	u.SetAPIVersion(apiVersion)
+	u.SetKind(kind)
+	return u
+}
+
+// Test_If_Compute_Judges_Deployments tests the Deployment status computation.
+func Test_If_Compute_Judges_Deployments(t *testing.T) {
+	ready := object("apps/v1", "Deployment", map[string]interface{}{
+		"spec":   map[string]interface{}{"replicas": int64(2)},
+		"status": map[string]interface{}{"replicas": int64(2), "updatedReplicas": int64(2), "readyReplicas": int64(2), "availableReplicas": int64(2)},
+	})
+	assert.Equal(t, Current, Compute(ready).Status, "ready Deployment was not Current")
+
+	rolling := object("apps/v1", "Deployment", map[string]interface{}{
+		"spec":   map[string]interface{}{"replicas": int64(2)},
+		"status": map[string]interface{}{"replicas": int64(3), "updatedReplicas": int64(1), "readyReplicas": int64(3), "availableReplicas": int64(3)},
+	})
+	assert.Equal(t, Result{Status: InProgress, Message: "1/2 replicas updated"}, Compute(rolling))
+
+	stuck := object("apps/v1", "Deployment", map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Progressing", "status": "False", "reason": "ProgressDeadlineExceeded", "message": "timed out"},
+			},
+		},
+	})
+	assert.Equal(t, Result{Status: Failed, Message: "timed out"}, Compute(stuck))
+}
+
+// Test_If_Compute_Checks_Observed_Generation tests that an object whose
+// generation has not been observed is InProgress regardless of its kind.
+func Test_If_Compute_Checks_Observed_Generation(t *testing.T) {
+	u := object("example.com/v1", "Thing", map[string]interface{}{
+		"metadata": map[string]interface{}{"generation": int64(2)},
+		"status":   map[string]interface{}{"observedGeneration": int64(1)},
+	})
+	assert.Equal(t, InProgress, Compute(u).Status, "unobserved generation was not InProgress")
+}
+
+// Test_If_Compute_Uses_Standard_Conditions tests the computation for kinds
+// without a specific rule.
+func Test_If_Compute_Uses_Standard_Conditions(t *testing.T) {
+	withCondition := func(condType, status string) *unstructured.Unstructured {
+		return object("example.com/v1", "Thing", map[string]interface{}{
+			"status": map[string]interface{}{
+				"conditions": []interface{}{
+					map[string]interface{}{"type": condType, "status": status},
+				},
+			},
+		})
+	}
+	assert.Equal(t, Current, Compute(withCondition("Ready", "True")).Status)
+	assert.Equal(t, InProgress, Compute(withCondition("Ready", "False")).Status)
+	assert.Equal(t, InProgress, Compute(withCondition("Reconciling", "True")).Status)
+	assert.Equal(t, Failed, Compute(withCondition("Stalled", "True")).Status)
+	assert.Equal(t, Current, Compute(object("example.com/v1", "Thing", map[string]interface{}{})).Status)
+}
+
+// Test_If_Compute_Judges_Pods tests the Pod status computation.
+func Test_If_Compute_Judges_Pods(t *testing.T) {
+	pod := func(phase string, ready string) *unstructured.Unstructured {
+		return object("v1", "Pod", map[string]interface{}{
+			"status": map[string]interface{}{
+				"phase": phase,
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Ready", "status": ready},
+				},
+			},
+		})
+	}
+	assert.Equal(t, Current, Compute(pod("Running", "True")).Status)
+	assert.Equal(t, InProgress, Compute(pod("Running", "False")).Status)
+	assert.Equal(t, InProgress, Compute(pod("Pending", "False")).Status)
+	assert.Equal(t, Failed, Compute(pod("Failed", "False")).Status)
+}
@@ -1,104 +1,448 @@
 package pcache
 
-import "sync"
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // Predicate represents a cacheable boolean function.
+//
+// A Cache identifies a Predicate by its pointer unless it has a key. A
+// Predicate constructed anew each time it is needed, e.g. inside an action,
+// is therefore evaluated again each time, unless it is given a stable key with
+// WithKey.
 type Predicate struct {
-	f func(c *Cache) bool
+	f        func(c *Cache) bool
+	name     string
+	key      string
+	tags     []string
+	children []*Predicate
+	seq      uint64
+	meta     interface{}
+	op       string
 }
 
+// sequence numbers Predicates and Caches in order of construction, so that a
+// Cache can tell which Predicates were constructed after it.
+var sequence atomic.Uint64
+
 // NewPredicate creates a new Predicate.
 func NewPredicate(f func() bool) *Predicate {
 	return &Predicate{
 		f: func(c *Cache) bool {
 			return f()
 		},
+		seq: sequence.Add(1),
+	}
+}
+
+// Evaluation gives a predicate function access to the Cache evaluating it.
+type Evaluation struct {
+	cache   *Cache
+	p       *Predicate
+	requeue time.Duration
+}
+
+// Notef attaches a note to the trace entry of the predicate being evaluated.
+// Notes are discarded when the Cache is not tracing.
+func (e *Evaluation) Notef(format string, args ...interface{}) {
+	e.cache.addNote(e.p, fmt.Sprintf(format, args...))
+}
+
+// SuggestRequeue records that the predicate's value may change after the given
+// interval. The shortest positive suggestion is kept, and only if the predicate
+// evaluates false.
+func (e *Evaluation) SuggestRequeue(interval time.Duration) {
+	e.requeue = shorter(e.requeue, interval)
+}
+
+// Eval evaluates another predicate in the same Cache. If it evaluates false,
+// its requeue suggestion becomes a suggestion of the predicate being evaluated.
+func (e *Evaluation) Eval(p *Predicate) bool {
+	val := e.cache.eval(p)
+	if !val {
+		e.SuggestRequeue(e.cache.suggestion(p))
+	}
+	return val
+}
+
+// NewLeaf creates a new named Predicate whose function receives the
+// Evaluation, so that it can annotate the trace.
+func NewLeaf(name string, f func(e *Evaluation) bool) *Predicate {
+	return NewComposite(name, nil, f)
+}
+
+// NewComposite creates a new named Predicate computed from the given child
+// Predicates, which f evaluates through the Evaluation. The composite carries
+// the tags of its children.
+func NewComposite(name string, children []*Predicate, f func(e *Evaluation) bool) *Predicate {
+	p := &Predicate{name: name, children: children, seq: sequence.Add(1)}
+	p.f = func(c *Cache) bool {
+		e := &Evaluation{cache: c, p: p}
+		val := f(e)
+		if !val {
+			c.setSuggestion(p, e.requeue)
+		}
+		return val
+	}
+	return p
+}
+
+// Named sets the name of the given Predicate and returns it.
+func Named(name string, p *Predicate) *Predicate {
+	p.name = name
+	return p
+}
+
+// WithKey sets a key identifying the given Predicate in a Cache and returns
+// it. Predicates with the same key share their cached value, so the key must
+// be unique to what the Predicate computes.
+func WithKey(key string, p *Predicate) *Predicate {
+	p.key = key
+	return p
+}
+
+// WithMeta attaches data describing the given Predicate to it, for its
+// creator to inspect later, and returns it. The Cache ignores it.
+func WithMeta(p *Predicate, meta interface{}) *Predicate {
+	p.meta = meta
+	return p
+}
+
+// Meta returns the data attached with WithMeta, or nil.
+func (p *Predicate) Meta() interface{} {
+	return p.meta
+}
+
+// Key returns the key of the Predicate, or an empty string if it has none.
+func (p *Predicate) Key() string {
+	return p.key
+}
+
+// id returns what identifies the Predicate in a Cache.
+func (p *Predicate) id() interface{} {
+	if p.key != "" {
+		return p.key
+	}
+	return p
+}
+
+// Name returns the name of the Predicate, or an empty string if it is
+// anonymous.
+func (p *Predicate) Name() string {
+	return p.name
+}
+
+// WithTags adds tags to the given Predicate and returns it. Tags group
+// predicates for invalidation; see Cache.InvalidateTag.
+func WithTags(p *Predicate, tags ...string) *Predicate {
+	p.tags = append(p.tags, tags...)
+	return p
+}
+
+// Tags returns the tags of the Predicate, including those of its children.
+func (p *Predicate) Tags() []string {
+	var tags []string
+	seen := map[string]bool{}
+	p.walk(func(q *Predicate) {
+		for _, tag := range q.tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	})
+	return tags
+}
+
+// HasTag returns true if the Predicate or any of its children has the tag.
+func (p *Predicate) HasTag(tag string) bool {
+	found := false
+	p.walk(func(q *Predicate) {
+		for _, t := range q.tags {
+			if t == tag {
+				found = true
+			}
+		}
+	})
+	return found
+}
+
+// Children returns the Predicates the Predicate is composed of.
+func (p *Predicate) Children() []*Predicate {
+	return p.children
+}
+
+// walk calls f for the Predicate and all its descendants.
+func (p *Predicate) walk(f func(q *Predicate)) {
+	f(p)
+	for _, child := range p.children {
+		child.walk(f)
 	}
 }
 
+// TraceEntry records the evaluation of a single Predicate.
+type TraceEntry struct {
+	// Name is the name of the predicate, empty if it is anonymous.
+	Name string
+	// Value is the value the predicate evaluated to.
+	Value bool
+	// Notes are the notes recorded by the predicate during evaluation.
+	Notes []string
+}
+
 // Cache is a predicate value Cache.
 type Cache struct {
-	c    map[*Predicate]bool
-	lock sync.Mutex
+	c       map[interface{}]bool
+	lock    sync.Mutex
+	tracing bool
+	trace   []TraceEntry
+	notes   map[*Predicate][]string
+	requeue time.Duration
+	order   []*Predicate
+	ordered map[interface{}]bool
+	// suggestions are the requeue suggestions of false predicates.
+	suggestions map[interface{}]time.Duration
+	// onPanic, if set, is called with the value and stack of a panic raised by
+	// a predicate, which then evaluates to false.
+	onPanic func(p *Predicate, recovered interface{}, stack []byte)
+	// seq is the sequence number of the Cache; Predicates with a higher
+	// number were constructed after it.
+	seq uint64
+	// overrides are the values forced by Override, by predicate name.
+	overrides map[string]bool
 }
 
 // New creates a new Cache.
 func New() *Cache {
 	return &Cache{
-		c: map[*Predicate]bool{},
+		c:           map[interface{}]bool{},
+		ordered:     map[interface{}]bool{},
+		suggestions: map[interface{}]time.Duration{},
+		seq:         sequence.Add(1),
 	}
 }
 
-// Eval evaluates the predicate in the cache.
+// EnableTrace enables recording of a trace of predicate evaluations.
+func (c *Cache) EnableTrace() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.tracing = true
+	c.notes = map[*Predicate][]string{}
+}
+
+// RecoverPanics makes the Cache recover panics raised by predicates, which then
+// evaluate to false. onPanic is called with the innermost panicking predicate,
+// the recovered value, and the stack at the point of the panic.
+func (c *Cache) RecoverPanics(onPanic func(p *Predicate, recovered interface{}, stack []byte)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.onPanic = onPanic
+}
+
+// Trace returns the predicate evaluations recorded so far, in the order in
+// which they completed. Nested predicates appear before the predicates that
+// contain them.
+func (c *Cache) Trace() []TraceEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	trace := make([]TraceEntry, len(c.trace))
+	copy(trace, c.trace)
+	return trace
+}
+
+// SuggestedRequeue returns the shortest requeue interval suggested by the
+// predicates evaluated so far with Predicate.Eval that were false, or zero if
+// there were no suggestions. A composed predicate suggests what its false
+// children suggest, so e.g. an Or that is true because of one child ignores the
+// suggestions of the others.
+func (c *Cache) SuggestedRequeue() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.requeue
+}
+
+// Snapshot returns the value of every predicate evaluated so far, keyed by
+// name. Anonymous predicates are identified by their position in evaluation
+// order, as "#N", which is also their index in the Trace; a name shared by
+// several predicates is disambiguated the same way, as "name#N". The snapshot
+// holds no references to the predicates themselves.
+func (c *Cache) Snapshot() map[string]bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	snapshot := make(map[string]bool, len(c.order))
+	for i, p := range c.order {
+		key := p.name
+		if _, dup := snapshot[key]; key == "" || dup {
+			key = fmt.Sprintf("%s#%d", key, i)
+		}
+		snapshot[key] = c.c[p.id()]
+	}
+	return snapshot
+}
+
+// InvalidateTag removes the cached values of all predicates with the given
+// tag, including predicates composed from them, so that they are evaluated
+// again.
+func (c *Cache) InvalidateTag(tag string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, p := range c.order {
+		if p.HasTag(tag) {
+			delete(c.c, p.id())
+			delete(c.suggestions, p.id())
+		}
+	}
+}
+
+// InvalidateAll removes the cached values of all predicates, so that they are
+// evaluated again. The trace is kept.
+func (c *Cache) InvalidateAll() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.c = map[interface{}]bool{}
+	c.suggestions = map[interface{}]time.Duration{}
+}
+
+// Eval evaluates the predicate in the cache. If it evaluates false, its
+// requeue suggestion is recorded in the cache.
 func (p *Predicate) Eval(c *Cache) bool {
-	if val, ok := c.isInCache(p); ok {
-		return val
+	val := c.eval(p)
+	if !val {
+		c.suggestRequeue(c.suggestion(p))
 	}
-	val := p.f(c)
-	c.addToCache(p, val)
 	return val
 }
 
 // And returns a new Predicate that is the logical AND of the given Predicates.
+// When false, it suggests what the first false Predicate suggests.
 func And(p ...*Predicate) *Predicate {
-	return &Predicate{
-		f: func(c *Cache) bool {
-			for _, expr := range p {
-				if !expr.Eval(c) {
-					return false
-				}
+	return withOp("And", NewComposite("", p, func(e *Evaluation) bool {
+		for _, expr := range p {
+			if !e.Eval(expr) {
+				return false
 			}
-			return true
-		},
-	}
+		}
+		return true
+	}))
 }
 
 // Or returns a new Predicate that is the logical OR of the given Predicates.
+// When false, it suggests the shortest of the Predicates' suggestions.
 func Or(p ...*Predicate) *Predicate {
-	return &Predicate{
-		f: func(c *Cache) bool {
-			for _, expr := range p {
-				if expr.Eval(c) {
-					return true
-				}
+	return withOp("Or", NewComposite("", p, func(e *Evaluation) bool {
+		for _, expr := range p {
+			if e.Eval(expr) {
+				return true
 			}
-			return false
-		},
-	}
+		}
+		return false
+	}))
 }
 
-// Not returns the negation of the given Predicate.
+// Not returns the negation of the given Predicate. It makes no requeue
+// suggestion, since it is false only when the given Predicate is true.
 func Not(p *Predicate) *Predicate {
-	return &Predicate{
-		f: func(c *Cache) bool {
-			return !p.Eval(c)
-		},
-	}
+	return withOp("Not", NewComposite("", []*Predicate{p}, func(e *Evaluation) bool {
+		return !e.cache.eval(p)
+	}))
 }
 
 // True returns a Predicate that always returns true.
 func True() *Predicate {
-	return &Predicate{
+	return withOp("True", &Predicate{
 		f: func(*Cache) bool {
 			return true
 		},
-	}
+		seq: sequence.Add(1),
+	})
 }
 
 // False returns a Predicate that always returns false.
 func False() *Predicate {
-	return &Predicate{
+	return withOp("False", &Predicate{
 		f: func(*Cache) bool {
 			return false
 		},
+		seq: sequence.Add(1),
+	})
+}
+
+// withOp records the operator the Predicate was built with and returns it.
+func withOp(op string, p *Predicate) *Predicate {
+	p.op = op
+	return p
+}
+
+// Op returns the operator the Predicate was built with: And, Or, Not, True, or
+// False, or an empty string for other Predicates.
+func (p *Predicate) Op() string {
+	return p.op
+}
+
+// Override makes the predicates with the given name evaluate to value
+// without calling their functions, e.g. in tests.
+func (c *Cache) Override(name string, value bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.overrides == nil {
+		c.overrides = map[string]bool{}
+	}
+	c.overrides[name] = value
+}
+
+// override returns the value forced for the predicate by Override, if any.
+func (c *Cache) override(p *Predicate) (bool, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if p.name == "" {
+		return false, false
+	}
+	val, ok := c.overrides[p.name]
+	return val, ok
+}
+
+// eval returns the cached value of the predicate, evaluating it if needed.
+func (c *Cache) eval(p *Predicate) bool {
+	if val, ok := c.isInCache(p); ok {
+		return val
 	}
+	if val, ok := c.override(p); ok {
+		c.addNote(p, "overridden")
+		c.addToCache(p, val)
+		return val
+	}
+	val := c.call(p)
+	c.addToCache(p, val)
+	return val
+}
+
+// call calls the predicate's function, recovering a panic if the Cache is set
+// up to do so.
+func (c *Cache) call(p *Predicate) (val bool) {
+	c.lock.Lock()
+	onPanic := c.onPanic
+	c.lock.Unlock()
+	if onPanic != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				onPanic(p, r, debug.Stack())
+				c.addNote(p, fmt.Sprintf("panic: %v", r))
+				val = false
+			}
+		}()
+	}
+	return p.f(c)
 }
 
 // isInCache returns true if the given predicate is in the cache.
 func (c *Cache) isInCache(p *Predicate) (bool, bool) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	val, ok := c.c[p]
+	val, ok := c.c[p.id()]
 	return val, ok
 }
 
@@ -106,5 +450,59 @@ func (c *Cache) isInCache(p *Predicate) (bool, bool) {
 func (c *Cache) addToCache(p *Predicate, value bool) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	c.c[p] = value
+	if !c.ordered[p.id()] {
+		c.ordered[p.id()] = true
+		c.order = append(c.order, p)
+	}
+	c.c[p.id()] = value
+	if c.tracing {
+		notes := c.notes[p]
+		if p.name == "" && p.key == "" && p.seq > c.seq {
+			notes = append(notes, "anonymous predicate constructed during evaluation has no key; it is not cached across constructions")
+		}
+		c.trace = append(c.trace, TraceEntry{Name: p.name, Value: value, Notes: notes})
+		delete(c.notes, p)
+	}
+}
+
+// addNote records a note for the given predicate if the cache is tracing.
+func (c *Cache) addNote(p *Predicate, note string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.tracing {
+		c.notes[p] = append(c.notes[p], note)
+	}
+}
+
+// suggestRequeue records the given requeue interval if it is shorter than the
+// current suggestion.
+func (c *Cache) suggestRequeue(interval time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.requeue = shorter(c.requeue, interval)
+}
+
+// setSuggestion records the requeue suggestion of a false predicate.
+func (c *Cache) setSuggestion(p *Predicate, interval time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if interval > 0 {
+		c.suggestions[p.id()] = interval
+	}
+}
+
+// suggestion returns the requeue suggestion of a false predicate, or zero.
+func (c *Cache) suggestion(p *Predicate) time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.suggestions[p.id()]
+}
+
+// shorter returns the shorter of two requeue intervals, ignoring those that
+// are not positive.
+func shorter(a, b time.Duration) time.Duration {
+	if b > 0 && (a <= 0 || b < a) {
+		return b
+	}
+	return a
 }
@@ -3,6 +3,7 @@ package pcache
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -168,3 +169,169 @@ func Test_If_Not_Returns_The_Negation_Of_The_Given_Predicate(t *testing.T) {
 	assert.False(t, Not(True()).Eval(c), "Not(True()) returned true")
 	assert.True(t, Not(False()).Eval(c), "Not(False()) returned false")
 }
+
+// Test_If_Trace_Records_Named_Predicates_And_Notes tests that a tracing Cache
+// records each evaluation with its name, value, and notes, nested predicates
+// first.
+func Test_If_Trace_Records_Named_Predicates_And_Notes(t *testing.T) {
+	c := New()
+	c.EnableTrace()
+	leaf := NewLeaf("leaf", func(e *Evaluation) bool {
+		e.Notef("checked %d things", 2)
+		return true
+	})
+	p := Named("root", Not(leaf))
+	assert.False(t, p.Eval(c), "Eval returned true")
+	assert.False(t, p.Eval(c), "Eval returned true")
+	assert.Equal(t, []TraceEntry{
+		{Name: "leaf", Value: true, Notes: []string{"checked 2 things"}},
+		{Name: "root", Value: false},
+	}, c.Trace(), "trace was not recorded correctly")
+}
+
+// Test_If_Trace_Is_Empty_When_Not_Tracing tests that a Cache does not record a
+// trace unless tracing is enabled.
+func Test_If_Trace_Is_Empty_When_Not_Tracing(t *testing.T) {
+	c := New()
+	leaf := NewLeaf("leaf", func(e *Evaluation) bool {
+		e.Notef("ignored")
+		return true
+	})
+	assert.True(t, leaf.Eval(c), "Eval returned false")
+	assert.Empty(t, c.Trace(), "trace was recorded")
+}
+
+// Test_If_SuggestedRequeue_Keeps_The_Shortest_Interval tests that the Cache
+// keeps the shortest positive requeue suggestion.
+func Test_If_SuggestedRequeue_Keeps_The_Shortest_Interval(t *testing.T) {
+	c := New()
+	assert.Zero(t, c.SuggestedRequeue(), "suggestion was not initially zero")
+	suggest := func(d time.Duration) *Predicate {
+		return NewLeaf("", func(e *Evaluation) bool {
+			e.SuggestRequeue(d)
+			return false
+		})
+	}
+	assert.False(t, Or(suggest(time.Minute), suggest(0), suggest(time.Second), suggest(time.Hour)).Eval(c))
+	assert.Equal(t, time.Second, c.SuggestedRequeue(), "suggestion was not the shortest interval")
+}
+
+// Test_If_Suggestions_Propagate_Only_From_False_Children tests that a composed
+// predicate suggests only what the children that made it false suggest.
+func Test_If_Suggestions_Propagate_Only_From_False_Children(t *testing.T) {
+	suggest := func(value bool, d time.Duration) *Predicate {
+		return NewLeaf("", func(e *Evaluation) bool {
+			e.SuggestRequeue(d)
+			return value
+		})
+	}
+	for _, tc := range []struct {
+		name string
+		p    *Predicate
+		want time.Duration
+	}{
+		{"true Or", Or(suggest(false, time.Second), suggest(true, time.Minute)), 0},
+		{"false And", And(suggest(true, time.Second), suggest(false, time.Minute), suggest(false, time.Hour)), time.Minute},
+		{"nested", And(Or(suggest(false, time.Hour), suggest(false, time.Minute)), True()), time.Minute},
+		{"Not", Not(suggest(false, time.Second)), 0},
+		{"false Not", Not(Not(suggest(false, time.Second))), 0},
+	} {
+		c := New()
+		tc.p.Eval(c)
+		assert.Equal(t, tc.want, c.SuggestedRequeue(), tc.name)
+	}
+}
+
+// Test_If_Snapshot_Matches_The_Trace tests that the Snapshot of a nested
+// predicate tree has the same values as the trace, with positional keys for
+// anonymous and duplicate names.
+func Test_If_Snapshot_Matches_The_Trace(t *testing.T) {
+	c := New()
+	c.EnableTrace()
+	a := Named("a", True())
+	b := Named("b", False())
+	dup := Named("a", False())
+	p := Named("root", Or(And(a, b), Not(dup)))
+	assert.True(t, p.Eval(c), "Eval returned false")
+	trace := c.Trace()
+	snapshot := c.Snapshot()
+	assert.Equal(t, map[string]bool{
+		"a":    true,
+		"b":    false,
+		"#2":   false,
+		"a#3":  false,
+		"#4":   true,
+		"root": true,
+	}, snapshot, "snapshot was not correct")
+	assert.Len(t, snapshot, len(trace), "snapshot and trace differ in size")
+	for i, entry := range trace {
+		key := entry.Name
+		if _, ok := snapshot[key]; key == "" || !ok || (key == "a" && i == 3) {
+			key = fmt.Sprintf("%s#%d", key, i)
+		}
+		assert.Equal(t, entry.Value, snapshot[key], "snapshot of %s did not match the trace", key)
+	}
+}
+
+// Test_If_InvalidateTag_Clears_Tagged_Predicates tests that InvalidateTag
+// causes tagged predicates, and predicates composed from them, to be evaluated
+// again, but not untagged ones.
+func Test_If_InvalidateTag_Clears_Tagged_Predicates(t *testing.T) {
+	c := New()
+	counts := map[string]int{}
+	counter := func(name string) *Predicate {
+		return NewLeaf(name, func(*Evaluation) bool {
+			counts[name]++
+			return true
+		})
+	}
+	tagged := WithTags(counter("tagged"), "config")
+	untagged := counter("untagged")
+	both := And(tagged, untagged)
+	assert.Equal(t, []string{"config"}, both.Tags(), "composite did not carry the tag")
+	assert.True(t, both.Eval(c))
+	c.InvalidateTag("config")
+	assert.True(t, both.Eval(c))
+	assert.Equal(t, map[string]int{"tagged": 2, "untagged": 1}, counts, "wrong predicates were evaluated again")
+	assert.Len(t, c.Snapshot(), 3, "re-evaluation duplicated snapshot entries")
+}
+
+// Test_If_Keyed_Predicates_Are_Cached_Across_Constructions tests that
+// predicates constructed twice share a cached value only when they have the
+// same key, and that the trace flags unkeyed anonymous predicates constructed
+// after the Cache.
+func Test_If_Keyed_Predicates_Are_Cached_Across_Constructions(t *testing.T) {
+	c := New()
+	c.EnableTrace()
+	keyed, unkeyed := 0, 0
+	for i := 0; i < 2; i++ {
+		assert.True(t, WithKey("item/a", NewPredicate(func() bool { keyed++; return true })).Eval(c))
+		assert.True(t, NewPredicate(func() bool { unkeyed++; return true }).Eval(c))
+	}
+	assert.Equal(t, 1, keyed, "keyed predicate was not cached across constructions")
+	assert.Equal(t, 2, unkeyed, "unkeyed predicates shared a value")
+	trace := c.Trace()
+	if assert.Len(t, trace, 3) {
+		assert.Empty(t, trace[0].Notes, "keyed predicate was flagged")
+		assert.Len(t, trace[1].Notes, 1, "unkeyed predicate was not flagged")
+	}
+}
+
+// Test_If_Override_Forces_Named_Predicates tests that an overridden predicate
+// takes the forced value without calling its function, while other
+// predicates are evaluated as usual.
+func Test_If_Override_Forces_Named_Predicates(t *testing.T) {
+	c := New()
+	c.EnableTrace()
+	c.Override("ready", false)
+	called := 0
+	ready := Named("ready", NewPredicate(func() bool { called++; return true }))
+	other := Named("other", NewPredicate(func() bool { called++; return true }))
+	assert.False(t, ready.Eval(c), "override was not applied")
+	assert.True(t, other.Eval(c), "other predicate was overridden")
+	assert.Equal(t, 1, called, "overridden predicate was called")
+	trace := c.Trace()
+	if assert.Len(t, trace, 2) {
+		assert.Equal(t, []string{"overridden"}, trace[0].Notes)
+	}
+}
@@ -0,0 +1,152 @@
+// Package store implements a bounded, concurrency-safe store of values kept
+// across runs of a chain, keyed by object.
+package store
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+)
+
+// Store holds named values per object key. When it holds more than its
+// maximum number of object keys, the least recently used object key is evicted
+// with all its values.
+type Store struct {
+	lock    sync.Mutex
+	max     int
+	lru     *list.List
+	objects map[string]*list.Element
+	onSize  func(delta int)
+}
+
+// entry holds the values of a single object key.
+type entry struct {
+	key    string
+	values map[string]interface{}
+}
+
+// New creates a Store holding at most max object keys. If max is zero or
+// negative, the store is unbounded. onSize, if not nil, is called with the
+// change in the number of object keys whenever it changes.
+func New(max int, onSize func(delta int)) *Store {
+	return &Store{
+		max:     max,
+		lru:     list.New(),
+		objects: map[string]*list.Element{},
+		onSize:  onSize,
+	}
+}
+
+// Get returns the named value for the object key.
+func (s *Store) Get(key, name string) (interface{}, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	elem, ok := s.objects[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	v, ok := elem.Value.(*entry).values[name]
+	return v, ok
+}
+
+// Set sets the named value for the object key, evicting the least recently
+// used object key if the store is full.
+func (s *Store) Set(key, name string, value interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	elem, ok := s.objects[key]
+	if ok {
+		s.lru.MoveToFront(elem)
+	} else {
+		elem = s.lru.PushFront(&entry{key: key, values: map[string]interface{}{}})
+		s.objects[key] = elem
+		s.resized(1)
+		for s.max > 0 && s.lru.Len() > s.max {
+			s.remove(s.lru.Back())
+		}
+	}
+	elem.Value.(*entry).values[name] = value
+}
+
+// Delete deletes the named value for the object key.
+func (s *Store) Delete(key, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if elem, ok := s.objects[key]; ok {
+		delete(elem.Value.(*entry).values, name)
+	}
+}
+
+// DeleteWhere deletes every value, for every object key, for which match
+// returns true.
+func (s *Store) DeleteWhere(match func(name string, value interface{}) bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, elem := range s.objects {
+		values := elem.Value.(*entry).values
+		for name, value := range values {
+			if match(name, value) {
+				delete(values, name)
+			}
+		}
+	}
+}
+
+// Forget deletes all values for the object key.
+func (s *Store) Forget(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if elem, ok := s.objects[key]; ok {
+		s.remove(elem)
+	}
+}
+
+// Len returns the number of object keys in the store.
+func (s *Store) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.lru.Len()
+}
+
+// Keys returns the object keys in the store, most recently used first.
+func (s *Store) Keys() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	keys := make([]string, 0, s.lru.Len())
+	for elem := s.lru.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(*entry).key)
+	}
+	return keys
+}
+
+// Names returns the names of the values for the object key, sorted, without
+// marking it as used.
+func (s *Store) Names(key string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	elem, ok := s.objects[key]
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(elem.Value.(*entry).values))
+	for name := range elem.Value.(*entry).values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// remove removes an element. The lock must be held.
+func (s *Store) remove(elem *list.Element) {
+	s.lru.Remove(elem)
+	delete(s.objects, elem.Value.(*entry).key)
+	s.resized(-1)
+}
+
+// resized reports a change in size. The lock must be held.
+func (s *Store) resized(delta int) {
+	if s.onSize != nil {
+		s.onSize(delta)
+	}
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test_If_Store_Evicts_Least_Recently_Used tests that the least recently used
+// object key is evicted when the store is full.
+func Test_If_Store_Evicts_Least_Recently_Used(t *testing.T) {
+	size := 0
+	s := New(2, func(delta int) { size += delta })
+	s.Set("a", "x", 1)
+	s.Set("b", "x", 2)
+	_, ok := s.Get("a", "x")
+	assert.True(t, ok, "a was not stored")
+	s.Set("c", "x", 3)
+	assert.Equal(t, []string{"c", "a"}, s.Keys(), "b was not evicted")
+	_, ok = s.Get("b", "x")
+	assert.False(t, ok, "b was not evicted")
+	s.Set("a", "y", 4)
+	s.Set("d", "x", 5)
+	assert.Equal(t, []string{"d", "a"}, s.Keys(), "c was not evicted")
+	assert.Equal(t, 2, size, "size callback was not balanced")
+	v, _ := s.Get("a", "y")
+	assert.Equal(t, 4, v, "a lost its values")
+}
+
+// Test_If_Store_Forgets_And_Deletes tests Names, Forget, Delete, and
+// DeleteWhere.
+func Test_If_Store_Forgets_And_Deletes(t *testing.T) {
+	size := 0
+	s := New(0, func(delta int) { size += delta })
+	s.Set("a", "tag:x", 1)
+	s.Set("a", "other", 2)
+	s.Set("b", "tag:x", 3)
+	assert.Equal(t, []string{"other", "tag:x"}, s.Names("a"), "names were not listed")
+	s.DeleteWhere(func(name string, _ interface{}) bool { return name == "tag:x" })
+	_, ok := s.Get("b", "tag:x")
+	assert.False(t, ok, "DeleteWhere did not delete")
+	s.Delete("a", "other")
+	_, ok = s.Get("a", "other")
+	assert.False(t, ok, "Delete did not delete")
+	s.Forget("a")
+	assert.Equal(t, []string{"b"}, s.Keys(), "Forget did not remove the key")
+	assert.Equal(t, 1, size, "size callback was not called on Forget")
+}
+
+// Test_If_Store_Is_Safe_For_Concurrent_Use tests concurrent use under the race
+// detector, and that the bound holds.
+func Test_If_Store_Is_Safe_For_Concurrent_Use(t *testing.T) {
+	s := New(10, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("%d-%d", i, j%20)
+				s.Set(key, "v", j)
+				s.Get(key, "v")
+				if j%7 == 0 {
+					s.Forget(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, s.Len(), 10, "store exceeded its bound")
+}
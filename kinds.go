@@ -0,0 +1,121 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// kindKey is the context key of the kind set by WithKind.
+type kindKey struct{}
+
+// WithKind returns a context making a Run of a chain serving several kinds
+// run for the primary resource of the given kind. The controllers registered
+// by SetupWithManager for such a chain set it. Chains without a primary
+// resource of the kind ignore it.
+func WithKind(ctx context.Context, kind string) context.Context {
+	return context.WithValue(ctx, kindKey{}, kind)
+}
+
+// Kind returns the kind of the primary resource of the current Run, if
+// known.
+func (c *Chain) Kind() string {
+	return c.kind
+}
+
+// fieldKind returns the kind of the objects of the resource field.
+func (c *Chain) fieldKind(field reflect.Value) (string, error) {
+	gvk, err := c.gvkFor(reflect.New(field.Type().Elem()).Interface().(client.Object))
+	if err != nil {
+		return "", err
+	}
+	return gvk.Kind, nil
+}
+
+// resolveKind sets the kind of the primary resource of the Run. For a chain
+// serving several kinds, the kind is the one of the context, as set by
+// WithKind, or else the one returned by the KindResolver; it is an error if
+// there is none.
+func (c *Chain) resolveKind(ctx context.Context, req ctrl.Request) error {
+	c.kind, c.primaryIndex = "", 0
+	res, fields := c.primaryFields()
+	if len(fields) == 0 {
+		return nil
+	}
+	if len(fields) == 1 {
+		// The kind is only informative, and unknown without a client.
+		c.kind, _ = c.fieldKind(res.Field(fields[0]))
+		return nil
+	}
+	kinds := make([]string, len(fields))
+	for i, f := range fields {
+		kind, err := c.fieldKind(res.Field(f))
+		if err != nil {
+			return fmt.Errorf("resolve kind of %s: %w", req.NamespacedName, err)
+		}
+		kinds[i] = kind
+	}
+	kind, _ := ctx.Value(kindKey{}).(string)
+	if !slices.Contains(kinds, kind) && c.KindResolver != nil {
+		var err error
+		if kind, err = c.KindResolver(ctx, req); err != nil {
+			return fmt.Errorf("resolve kind of %s: %w", req.NamespacedName, err)
+		}
+		if !slices.Contains(kinds, kind) {
+			return fmt.Errorf("resolve kind of %s: unknown kind %q, not one of %s", req.NamespacedName, kind, strings.Join(kinds, ", "))
+		}
+	}
+	i := slices.Index(kinds, kind)
+	if i < 0 {
+		return fmt.Errorf("resolve kind of %s: no kind given, expected one of %s", req.NamespacedName, strings.Join(kinds, ", "))
+	}
+	c.kind, c.primaryIndex = kind, fields[i]+1
+	return nil
+}
+
+// appliesToKind returns true if the rule applies to the kind of the Run.
+func (c *Chain) appliesToKind(rule Rule) bool {
+	return len(rule.Kinds) == 0 || slices.Contains(rule.Kinds, c.kind)
+}
+
+// loadsField returns true unless the i-th resource field is the primary
+// resource of another kind than the one of the Run.
+func (c *Chain) loadsField(i int) bool {
+	if c.primaryIndex == 0 || i == c.primaryIndex-1 {
+		return true
+	}
+	_, fields := c.primaryFields()
+	return !slices.Contains(fields, i)
+}
+
+// kindReconciler runs a chain serving several kinds for the requests of the
+// controller of one of them.
+type kindReconciler struct {
+	chain *Chain
+	kind  string
+}
+
+// Reconcile runs the chain for the request, with the reconciler's kind.
+func (r kindReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.chain.Reconcile(WithKind(ctx, r.kind), req)
+}
+
+// sameNameIfExists returns a map from an object to the request of the same
+// name, if the reader has an object of the type of the primary resource field
+// with that name, so that the controllers of the other kinds do not run for
+// it.
+func sameNameIfExists(reader client.Reader, field reflect.Value) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []ctrl.Request {
+		primary := reflect.New(field.Type().Elem()).Interface().(client.Object)
+		if err := reader.Get(ctx, client.ObjectKeyFromObject(obj), primary); err != nil {
+			return nil
+		}
+		return sameName(ctx, obj)
+	}
+}
@@ -0,0 +1,157 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// kindsResources are the resources of a chain serving Widgets and
+// ConfigMaps.
+type kindsResources struct {
+	Widget    *Widget           `operchain:"primary"`
+	ConfigMap *corev1.ConfigMap `operchain:"primary"`
+	Secret    *corev1.Secret
+}
+
+// kindsChain returns a chain serving Widgets and ConfigMaps named demo, with
+// a shared rule and a rule for each kind, which record their names in ran.
+func kindsChain(ran *[]string) (*Chain, *kindsResources) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	res := &kindsResources{}
+	record := func(name string) Action {
+		return func(context.Context) { *ran = append(*ran, name) }
+	}
+	c := &Chain{}
+	c.InitializeChain(cl, res, []Rule{
+		{Name: "shared", Do: record("shared")},
+		{Name: "widget", Kinds: []string{"Widget"}, Do: record("widget")},
+		{Name: "configmap", Kinds: []string{"ConfigMap"}, Do: record("configmap")},
+	})
+	return c, res
+}
+
+// Test_If_A_Chain_Selects_Rules_By_Kind tests that a chain serving two kinds
+// runs the shared rules and those of the kind given by the context, and
+// loads only the primary resource of that kind.
+func Test_If_A_Chain_Selects_Rules_By_Kind(t *testing.T) {
+	var ran []string
+	c, res := kindsChain(&ran)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+
+	report, err := c.RunWithReport(WithKind(context.Background(), "Widget"), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, []string{"shared", "widget"}, ran, "the rules of the Widget kind did not run")
+	assert.Equal(t, "Widget", report.Kind, "the kind was not reported")
+	assert.NotNil(t, res.Widget, "the Widget was not loaded")
+	assert.Nil(t, res.ConfigMap, "the ConfigMap was loaded")
+	assert.NotNil(t, res.Secret, "the Secret was not loaded")
+
+	ran = nil
+	report, err = c.RunWithReport(WithKind(context.Background(), "ConfigMap"), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, []string{"shared", "configmap"}, ran, "the rules of the ConfigMap kind did not run")
+	assert.Equal(t, "ConfigMap", report.Kind, "the kind was not reported")
+	assert.Nil(t, res.Widget, "the Widget was loaded")
+	assert.NotNil(t, res.ConfigMap, "the ConfigMap was not loaded")
+	assert.Equal(t, res.ConfigMap, c.primary(), "the primary resource is not the ConfigMap")
+}
+
+// Test_If_A_Chain_Keeps_Values_Per_Kind tests that objects of different kinds
+// with the same name keep their own values across runs, and that forgetting
+// one does not forget the other.
+func Test_If_A_Chain_Keeps_Values_Per_Kind(t *testing.T) {
+	var ran []string
+	c, _ := kindsChain(&ran)
+	c.Rules = append(c.Rules, Rule{Name: "count", Do: func(context.Context) {
+		runs, _ := c.storeGet("runs")
+		n, _ := runs.(int)
+		c.storeSet("runs", n+1)
+	}})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	for _, kind := range []string{"Widget", "Widget", "ConfigMap"} {
+		_, err := c.Run(WithKind(context.Background(), kind), req)
+		assert.NoError(t, err, "Run returned an error")
+	}
+	assert.Equal(t, []string{"ConfigMap default/demo", "Widget default/demo"}, c.store().Keys(), "the values were not kept per kind")
+	runs, _ := c.store().Get("Widget default/demo", "runs")
+	assert.Equal(t, 2, runs, "the Widget shares the values of the ConfigMap")
+	runs, _ = c.store().Get("ConfigMap default/demo", "runs")
+	assert.Equal(t, 1, runs, "the ConfigMap shares the values of the Widget")
+
+	c.Forget(req.NamespacedName)
+	assert.Equal(t, []string{"Widget default/demo"}, c.store().Keys(), "forgetting the ConfigMap forgot the Widget")
+}
+
+// Test_If_A_Chain_Resolves_The_Kind_Of_A_Request tests that a chain serving
+// two kinds asks its KindResolver when the context carries no kind, and
+// fails when there is none or it returns an unknown kind.
+func Test_If_A_Chain_Resolves_The_Kind_Of_A_Request(t *testing.T) {
+	var ran []string
+	c, _ := kindsChain(&ran)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+
+	_, err := c.Run(context.Background(), req)
+	assert.ErrorContains(t, err, "no kind given", "a Run without a kind did not fail")
+	assert.Empty(t, ran, "rules ran without a kind")
+
+	c.KindResolver = func(ctx context.Context, req ctrl.Request) (string, error) {
+		return "ConfigMap", nil
+	}
+	report, err := c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, "ConfigMap", report.Kind, "the resolved kind was not used")
+	assert.Equal(t, []string{"shared", "configmap"}, ran, "the rules of the resolved kind did not run")
+
+	c.KindResolver = func(ctx context.Context, req ctrl.Request) (string, error) {
+		return "Gadget", nil
+	}
+	_, err = c.Run(context.Background(), req)
+	assert.ErrorContains(t, err, `unknown kind "Gadget"`, "an unknown kind was accepted")
+
+	c.KindResolver = func(ctx context.Context, req ctrl.Request) (string, error) {
+		return "", errors.New("no label")
+	}
+	_, err = c.Run(context.Background(), req)
+	assert.ErrorContains(t, err, "no label", "the error of the resolver was not returned")
+}
+
+// Test_If_Rule_Kinds_Apply_To_A_Single_Primary tests that a chain with one
+// primary resource skips the rules restricted to other kinds.
+func Test_If_Rule_Kinds_Apply_To_A_Single_Primary(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).Build()
+	var ran []string
+	c := &Chain{}
+	c.InitializeChain(cl, &struct{ Widget *Widget }{}, []Rule{
+		{Name: "widget", Kinds: []string{"Widget"}, Do: func(context.Context) { ran = append(ran, "widget") }},
+		{Name: "configmap", Kinds: []string{"ConfigMap"}, Do: func(context.Context) { ran = append(ran, "configmap") }},
+	})
+	report, err := c.RunWithReport(WithKind(context.Background(), "ConfigMap"), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, "Widget", report.Kind, "the kind of the primary resource was not reported")
+	assert.Equal(t, []string{"widget"}, ran, "the rules were not selected by the primary's kind")
+}
+
+// Test_If_SetupWithManager_Registers_A_Controller_Per_Kind tests that
+// SetupWithManager registers a chain serving two kinds, and that its
+// description marks both primary resources.
+func Test_If_SetupWithManager_Registers_A_Controller_Per_Kind(t *testing.T) {
+	c := &Chain{Name: "databases", Resources: &kindsResources{}}
+	ctl, err := c.SetupWithManager(newTestManager(t), ControllerOptions{})
+	assert.NoError(t, err, "SetupWithManager failed")
+	assert.NotNil(t, ctl, "controller was not returned")
+	d := c.Describe()
+	assert.True(t, d.Resources[0].Primary && d.Resources[1].Primary, "the primary resources were not described")
+	assert.False(t, d.Resources[2].Primary, "the Secret was described as primary")
+}
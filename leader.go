@@ -0,0 +1,71 @@
+package operchain
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// LeaderPolicy says how a chain runs depending on whether this process is the
+// elected leader.
+type LeaderPolicy string
+
+const (
+	// LeaderPolicyLeaderOnly runs the chain only on the leader: on other
+	// replicas, a Run returns an empty result immediately. SetupWithManager
+	// makes its controller need leader election.
+	LeaderPolicyLeaderOnly LeaderPolicy = "LeaderOnly"
+	// LeaderPolicyAlways runs the chain on every replica, e.g. to warm caches
+	// or export metrics. SetupWithManager makes its controller run without
+	// leader election.
+	LeaderPolicyAlways LeaderPolicy = "Always"
+	// LeaderPolicyReadOnlyWhenFollower runs the chain on every replica, but
+	// on replicas other than the leader, its writes are suppressed as in
+	// dry-run mode with DryRunSuppress, unless the chain's DryRun and
+	// DryRunStatus say otherwise. SetupWithManager makes its controller run
+	// without leader election.
+	LeaderPolicyReadOnlyWhenFollower LeaderPolicy = "ReadOnlyWhenFollower"
+)
+
+// needLeaderElection returns whether the controller of a chain with the
+// policy needs leader election, or nil to leave it to the manager.
+func (p LeaderPolicy) needLeaderElection() *bool {
+	var need bool
+	switch p {
+	case LeaderPolicyLeaderOnly:
+		need = true
+	case LeaderPolicyAlways, LeaderPolicyReadOnlyWhenFollower:
+		need = false
+	default:
+		return nil
+	}
+	return &need
+}
+
+// IsLeader returns a predicate that is true when this process is the elected
+// leader, according to the chain's LeaderCheck.
+func (c *Chain) IsLeader() *predicate {
+	return pcache.NewLeaf("IsLeader", func(e *pcache.Evaluation) bool {
+		return c.isLeader()
+	})
+}
+
+// isLeader returns true if this process is the elected leader, or if the chain
+// has no LeaderCheck.
+func (c *Chain) isLeader() bool {
+	return c.LeaderCheck == nil || c.LeaderCheck()
+}
+
+// ElectedLeader returns a LeaderCheck that is true once the manager has been
+// elected leader, or immediately if leader election is disabled.
+func ElectedLeader(mgr manager.Manager) func() bool {
+	elected := mgr.Elected()
+	return func() bool {
+		select {
+		case <-elected:
+			return true
+		default:
+			return false
+		}
+	}
+}
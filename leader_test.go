@@ -0,0 +1,119 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_LeaderOnly_Rules_Run_Only_On_The_Leader tests that LeaderOnly rules
+// are skipped without evaluating their predicates, and that IsLeader follows
+// the LeaderCheck, between Runs.
+func Test_If_LeaderOnly_Rules_Run_Only_On_The_Leader(t *testing.T) {
+	leader := false
+	evaluated, singleton, gated, status := 0, 0, 0, 0
+	c := &Chain{LeaderCheck: func() bool { return leader }}
+	c.InitializeChain(fake.NewClientBuilder().Build(), &struct{}{}, []Rule{
+		{
+			When:       Predicate(func() bool { evaluated++; return true }),
+			Do:         func(context.Context) { singleton++ },
+			LeaderOnly: true,
+		},
+		{When: c.IsLeader(), Do: func(context.Context) { gated++ }},
+		{Do: func(context.Context) { status++ }},
+	})
+	_, err := c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, []int{0, 0, 0, 1}, []int{evaluated, singleton, gated, status}, "follower ran leader rules")
+
+	leader = true
+	_, err = c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, []int{1, 1, 1, 2}, []int{evaluated, singleton, gated, status}, "leader did not run leader rules")
+}
+
+// Test_If_IsLeader_Defaults_To_True tests that a chain without a LeaderCheck
+// is always the leader.
+func Test_If_IsLeader_Defaults_To_True(t *testing.T) {
+	c := &Chain{}
+	assert.True(t, c.isLeader(), "chain without a LeaderCheck was not the leader")
+}
+
+// leaderPolicyChain returns a chain with the policy whose rule labels the
+// Widget, the client, and the leader flag of its LeaderCheck.
+func leaderPolicyChain(policy LeaderPolicy) (*Chain, client.Client, *bool) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+	}
+	leader := false
+	c := &Chain{LeaderPolicy: policy, LeaderCheck: func() bool { return leader }}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: c.PatchMerge(&res.Widget, func(obj client.Object) error {
+			obj.SetLabels(map[string]string{"leader": "seen"})
+			return nil
+		})},
+	})
+	return c, cl, &leader
+}
+
+// labeled returns true if the rule of leaderPolicyChain wrote the Widget.
+func labeled(t *testing.T, cl client.Client) bool {
+	w := &Widget{}
+	assert.NoError(t, cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "demo"}, w))
+	return w.Labels["leader"] == "seen"
+}
+
+// Test_If_ReadOnlyWhenFollower_Suppresses_Writes_Of_Followers tests that a
+// chain that is read-only when a follower runs its rules but writes nothing
+// until it is the leader.
+func Test_If_ReadOnlyWhenFollower_Suppresses_Writes_Of_Followers(t *testing.T) {
+	c, cl, leader := leaderPolicyChain(LeaderPolicyReadOnlyWhenFollower)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	report, err := c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.False(t, labeled(t, cl), "the follower wrote")
+	assert.Len(t, report.DryRun, 1, "the suppressed write was not reported")
+
+	*leader = true
+	report, err = c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.True(t, labeled(t, cl), "the leader did not write")
+	assert.Empty(t, report.DryRun, "the leader's write was suppressed")
+}
+
+// Test_If_LeaderPolicyLeaderOnly_Runs_Only_On_The_Leader tests that a
+// LeaderOnly chain returns an empty result without running on followers.
+func Test_If_LeaderPolicyLeaderOnly_Runs_Only_On_The_Leader(t *testing.T) {
+	c, cl, leader := leaderPolicyChain(LeaderPolicyLeaderOnly)
+	c.DefaultRequeue = time.Minute
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	result, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, ctrl.Result{}, result, "the follower's result was not empty")
+	assert.False(t, labeled(t, cl), "the follower ran the chain")
+
+	*leader = true
+	result, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, time.Minute, result.RequeueAfter, "the leader did not run the chain")
+	assert.True(t, labeled(t, cl), "the leader did not write")
+}
+
+// Test_If_Leader_Policies_Map_To_Leader_Election tests which policies make the
+// controller of the chain need leader election.
+func Test_If_Leader_Policies_Map_To_Leader_Election(t *testing.T) {
+	assert.Nil(t, LeaderPolicy("").needLeaderElection(), "the default policy overrode the manager")
+	assert.True(t, *LeaderPolicyLeaderOnly.needLeaderElection(), "LeaderOnly did not need leader election")
+	assert.False(t, *LeaderPolicyAlways.needLeaderElection(), "Always needed leader election")
+	assert.False(t, *LeaderPolicyReadOnlyWhenFollower.needLeaderElection(), "ReadOnlyWhenFollower needed leader election")
+}
@@ -0,0 +1,101 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// runLogKey is the context key of the runLog of the running chain.
+type runLogKey struct{}
+
+// runLog is the logging state of a Run, which a Subchain extends.
+type runLog struct {
+	// logger is enriched with the request and the chain's name, but not the
+	// rule.
+	logger logr.Logger
+	// chain is the path of chain names from the outermost chain.
+	chain string
+	// rule is the path of rule names from the outermost chain.
+	rule string
+	// id is the ID of the Run.
+	id string
+}
+
+// useManagerLogger sets Log to the manager's logger, named after the chain if
+// it has a Name.
+func (c *Chain) useManagerLogger(mgr manager.Manager) {
+	c.Log = mgr.GetLogger()
+	if c.Name != "" {
+		c.Log = c.Log.WithName(c.Name)
+		c.logName = c.Name
+	}
+}
+
+// startRunLog returns ctx with a logger enriched with the request, the ID of
+// the Run, and the chain's name, for the Run. A chain run by a rule of another
+// chain extends the logger of that rule, appending its name to the chain and
+// rule names, and the number of the chains run so far by the other chain's Run
+// to its ID.
+func (c *Chain) startRunLog(ctx context.Context) context.Context {
+	l := runLog{logger: c.Log, id: newRunID()}
+	parent, nested := ctx.Value(runLogKey{}).(runLog)
+	switch {
+	case nested:
+		l = runLog{logger: parent.logger, chain: parent.chain, rule: parent.rule + "/", id: parent.id}
+		if p := chainFrom(ctx); p != nil {
+			l.id = fmt.Sprintf("%s.%d", parent.id, p.subRuns.Add(1))
+		}
+	case c.Log.GetSink() == nil:
+		l.logger = log.FromContext(ctx)
+	}
+	if !nested {
+		l.logger = l.logger.WithValues("request", c.req.NamespacedName.String())
+	}
+	if c.Name != "" {
+		if nested || c.Log.GetSink() == nil || c.logName != c.Name {
+			l.logger = l.logger.WithName(c.Name)
+		}
+		if l.chain != "" {
+			l.chain += "/"
+		}
+		l.chain += c.Name
+	}
+	c.runLog = l
+	ctx = context.WithValue(ctx, runLogKey{}, l)
+	return log.IntoContext(ctx, l.logger.WithValues("runID", l.id))
+}
+
+// ruleContext returns ctx for running the current rule: with the chain, for
+// chainFrom, and with the run's logger enriched with the chain and the rule.
+func (c *Chain) ruleContext(ctx context.Context) context.Context {
+	l := c.runLog
+	l.rule += c.currentRule()
+	kvs := []interface{}{"rule", l.rule}
+	if l.chain != "" {
+		kvs = append([]interface{}{"chain", l.chain}, kvs...)
+	}
+	kvs = append([]interface{}{"runID", l.id}, kvs...)
+	ctx = context.WithValue(ctx, runLogKey{}, l)
+	ctx = context.WithValue(ctx, chainKey{}, c)
+	return log.IntoContext(ctx, c.runLog.logger.WithValues(kvs...))
+}
+
+// LogInfo returns an action that logs the message and key/value pairs with the
+// Run's logger.
+func (c *Chain) LogInfo(msg string, keysAndValues ...interface{}) Action {
+	return func(ctx context.Context) {
+		log.FromContext(ctx).Info(msg, keysAndValues...)
+	}
+}
+
+// LogDebug returns an action that logs the message and key/value pairs with the
+// Run's logger, at verbosity level 1.
+func (c *Chain) LogDebug(msg string, keysAndValues ...interface{}) Action {
+	return func(ctx context.Context) {
+		log.FromContext(ctx).V(1).Info(msg, keysAndValues...)
+	}
+}
@@ -0,0 +1,102 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Test_If_Actions_Log_With_Run_Context tests that the logger in the context of
+// actions, including those of a subchain, carries the request, run ID, chain,
+// and rule, and that LogDebug logs at verbosity level 1.
+func Test_If_Actions_Log_With_Run_Context(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var lines []string
+	logger := funcr.New(func(prefix, args string) {
+		lines = append(lines, prefix+" "+args)
+	}, funcr.Options{Verbosity: 1})
+	var res, subRes struct {
+		Widget *Widget
+	}
+	sub := &Chain{Name: "sub"}
+	sub.InitializeChain(cl, &subRes, []Rule{
+		{Name: "inner", Do: func(ctx context.Context) { log.FromContext(ctx).Info("nested") }},
+	})
+	c := &Chain{Name: "widgets", Log: logger}
+	c.InitializeChain(cl, &res, []Rule{
+		{Name: "breadcrumb", Do: c.LogDebug("checked", "size", 3)},
+		{Name: "outer", Do: c.Subchain(sub)},
+	})
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run returned an error")
+	id := c.LastReport().RunID
+	assert.Equal(t, []string{
+		`widgets "level"=1 "msg"="checked" "request"="default/demo" "runID"="` + id + `" "chain"="widgets" "rule"="breadcrumb" "size"=3`,
+		`widgets/sub "level"=0 "msg"="nested" "request"="default/demo" "runID"="` + id + `.1" "chain"="widgets/sub" "rule"="outer/inner"`,
+	}, lines, "logs were not enriched")
+}
+
+// Test_If_Runs_Have_Distinct_IDs tests that each Run logs, reports, and
+// records events with an ID of its own, that a subchain extends the ID of its
+// parent, and that the error of a Run can be wrapped with its ID.
+func Test_If_Runs_Have_Distinct_IDs(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var lines []string
+	logger := funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{})
+	var res, subRes struct {
+		Widget *Widget
+	}
+	sub := &Chain{Name: "sub"}
+	sub.InitializeChain(cl, &subRes, []Rule{
+		{Do: func(ctx context.Context) { log.FromContext(ctx).Info("nested", "id", RunIDFrom(ctx)) }},
+	})
+	recorder := record.NewFakeRecorder(10)
+	c := &Chain{Log: logger, Recorder: recorder, EventRunID: EventRunIDMessage, WrapErrorsWithRunID: true}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: c.Subchain(sub)},
+		{Do: c.Subchain(sub)},
+		{Do: c.EventNormal("Synced", "synced")},
+		{Do: c.Error(errors.New("broken"))},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	var ids []string
+	for i := 0; i < 2; i++ {
+		lines = nil
+		_, err := c.Run(context.Background(), req)
+		id := c.LastReport().RunID
+		ids = append(ids, id)
+		assert.Len(t, lines, 2, "subchains did not log")
+		for n, line := range lines {
+			sub := fmt.Sprintf("%s.%d", id, n+1)
+			assert.Contains(t, line, `"runID"="`+sub+`"`, "subchain did not extend the run ID")
+			assert.Contains(t, line, `"id"="`+sub+`"`, "RunIDFrom did not return the subchain's ID")
+		}
+		assert.Equal(t, "Normal Synced synced (run "+id+")", <-recorder.Events, "event did not carry the run ID")
+		var runErr *RunError
+		assert.ErrorAs(t, err, &runErr, "error was not wrapped")
+		assert.Equal(t, id, runErr.RunID, "error carried the wrong run ID")
+		assert.EqualError(t, err, "run "+id+": broken", "error was wrapped wrong")
+	}
+	assert.Len(t, ids[0], 8, "run ID is not short")
+	assert.NotEqual(t, ids[0], ids[1], "runs shared an ID")
+
+	c.EventRunID = EventRunIDAnnotation
+	_, _ = c.Run(context.Background(), req)
+	assert.Equal(t, "Normal Synced synced map["+RunIDAnnotation+":"+c.LastReport().RunID+"]", <-recorder.Events, "event was not annotated")
+}
@@ -0,0 +1,95 @@
+package operchain
+
+import (
+	"context"
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SetAnnotation returns an action that sets an annotation on the object in the
+// given resource field with a merge patch naming only that annotation. The
+// value is either a string or a func() string called when the action runs. The
+// action does nothing if the field is not loaded or the annotation already has
+// the value. The loaded object is updated, and predicates evaluated later in
+// the Run see the change.
+func (c *Chain) SetAnnotation(fieldPtr interface{}, key string, value interface{}) Action {
+	return writes(c.Try(c.setMetadataE(fieldPtr, annotations, key, stringFunc("metadata value", value), false)), fieldTarget(fieldPtr, "metadata/annotations/"+key))
+}
+
+// RemoveAnnotation returns an action that removes an annotation from the
+// object in the given resource field, as SetAnnotation sets it. It does
+// nothing if the annotation is not set.
+func (c *Chain) RemoveAnnotation(fieldPtr interface{}, key string) Action {
+	return writes(c.Try(c.setMetadataE(fieldPtr, annotations, key, nil, true)), fieldTarget(fieldPtr, "metadata/annotations/"+key))
+}
+
+// SetLabel returns an action that sets a label on the object in the given
+// resource field, as SetAnnotation sets an annotation.
+func (c *Chain) SetLabel(fieldPtr interface{}, key string, value interface{}) Action {
+	return writes(c.Try(c.setMetadataE(fieldPtr, labels, key, stringFunc("metadata value", value), false)), fieldTarget(fieldPtr, "metadata/labels/"+key))
+}
+
+// RemoveLabel returns an action that removes a label from the object in the
+// given resource field, as RemoveAnnotation removes an annotation.
+func (c *Chain) RemoveLabel(fieldPtr interface{}, key string) Action {
+	return writes(c.Try(c.setMetadataE(fieldPtr, labels, key, nil, true)), fieldTarget(fieldPtr, "metadata/labels/"+key))
+}
+
+// metadataMap gets and sets one of the string maps of an object's metadata.
+type metadataMap struct {
+	name string
+	get  func(obj client.Object) map[string]string
+	set  func(obj client.Object, m map[string]string)
+}
+
+var (
+	annotations = metadataMap{name: "annotations", get: client.Object.GetAnnotations, set: client.Object.SetAnnotations}
+	labels      = metadataMap{name: "labels", get: client.Object.GetLabels, set: client.Object.SetLabels}
+)
+
+// setMetadataE returns an action that sets, or if remove is true removes, the
+// key of the metadata map of the object in the resource field. The patch names
+// only the key, so that concurrent changes to other keys are kept.
+func (c *Chain) setMetadataE(fieldPtr interface{}, m metadataMap, key string, value func() string, remove bool) ActionE {
+	checkField(fieldPtr)
+	return func(ctx context.Context) error {
+		obj := objectAt(fieldPtr)
+		if obj == nil {
+			return nil
+		}
+		current, ok := m.get(obj)[key]
+		var desired interface{}
+		if !remove {
+			desired = value()
+			if ok && current == desired {
+				return nil
+			}
+		} else if !ok {
+			return nil
+		}
+		data, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{m.name: map[string]interface{}{key: desired}},
+		})
+		if err != nil {
+			return err
+		}
+		modified := obj.DeepCopyObject().(client.Object)
+		values := m.get(modified)
+		if remove {
+			delete(values, key)
+		} else {
+			if values == nil {
+				values = map[string]string{}
+			}
+			values[key] = desired.(string)
+		}
+		m.set(modified, values)
+		if err := c.sendPatch(ctx, obj, modified, client.RawPatch(types.MergePatchType, data)); err != nil {
+			return err
+		}
+		c.invalidateRun()
+		return nil
+	}
+}
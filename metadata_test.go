@@ -0,0 +1,42 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Test_If_Metadata_Actions_Send_Minimal_Patches tests that the annotation and
+// label actions patch only the key they change, skip values that are already
+// correct, and update the loaded object for later predicates.
+func Test_If_Metadata_Actions_Send_Minimal_Patches(t *testing.T) {
+	var patches []recordedPatch
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+	}
+	c := &Chain{Client: patchRecorder(&patches, nil), Resources: &res}
+	res.ConfigMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name: "demo", Namespace: "default",
+		Labels: map[string]string{"app": "demo", "stale": "true"},
+	}}
+	c.cache = pcache.New()
+	marked := Predicate(func() bool { return res.ConfigMap.Annotations["example.com/marker"] == "v2" })
+	assert.False(t, marked.Eval(c.cache), "marker was set")
+	version := "v2"
+	c.SetAnnotation(&res.ConfigMap, "example.com/marker", func() string { return version })(context.Background())
+	c.SetLabel(&res.ConfigMap, "app", "demo")(context.Background())
+	c.RemoveLabel(&res.ConfigMap, "stale")(context.Background())
+	c.RemoveAnnotation(&res.ConfigMap, "missing")(context.Background())
+	assert.NoError(t, c.err)
+	if assert.Len(t, patches, 2, "unchanged values were patched") {
+		assert.JSONEq(t, `{"metadata":{"annotations":{"example.com/marker":"v2"}}}`, patches[0].Data, "annotation patch was not minimal")
+		assert.JSONEq(t, `{"metadata":{"labels":{"stale":null}}}`, patches[1].Data, "label removal patch was not minimal")
+	}
+	assert.Equal(t, map[string]string{"app": "demo"}, res.ConfigMap.Labels, "loaded object was not updated")
+	assert.True(t, marked.Eval(c.cache), "later predicate did not see the change")
+}
@@ -0,0 +1,139 @@
+package operchain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// storeEntries is the number of objects with values kept across runs, over
+	// all chains.
+	storeEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "operchain_store_entries",
+		Help: "Number of objects with values kept across runs, over all chains.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(storeEntries)
+}
+
+// chainMetrics are the metrics of the rules and Runs of chains, labeled by the
+// name of the chain and of the rule. Rules without names are labeled by their
+// index, so the number of series is bounded by the rules of the chains.
+type chainMetrics struct {
+	evaluations        *prometheus.CounterVec
+	firings            *prometheus.CounterVec
+	errors             *prometheus.CounterVec
+	actionDuration     *prometheus.HistogramVec
+	lastRun            *prometheus.GaugeVec
+	requeues           *prometheus.CounterVec
+	breakerTransitions *prometheus.CounterVec
+}
+
+// newChainMetrics returns the chain metrics registered with reg. Metrics
+// already registered, e.g. by another chain, are shared.
+func newChainMetrics(reg prometheus.Registerer) *chainMetrics {
+	rule := []string{"chain", "rule"}
+	return &chainMetrics{
+		evaluations: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "operchain_rule_evaluations_total",
+			Help: "Number of times the predicate of a rule was evaluated.",
+		}, rule)),
+		firings: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "operchain_rule_firings_total",
+			Help: "Number of times the action of a rule was run.",
+		}, rule)),
+		errors: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "operchain_rule_errors_total",
+			Help: "Number of times a rule made a Run fail.",
+		}, rule)),
+		actionDuration: register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "operchain_action_duration_seconds",
+			Help:    "Duration of the actions of rules.",
+			Buckets: prometheus.DefBuckets,
+		}, rule)),
+		lastRun: register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "operchain_last_run_timestamp_seconds",
+			Help: "Time of the end of the last Run of a chain, in seconds since the epoch.",
+		}, []string{"chain"})),
+		requeues: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "operchain_requeue_requests_total",
+			Help: "Number of requeues requested during Runs, by reason.",
+		}, []string{"chain", "reason"})),
+		breakerTransitions: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "operchain_circuit_breaker_transitions_total",
+			Help: "Number of times the circuit breaker of a rule changed state, by new state.",
+		}, []string{"chain", "rule", "state"})),
+	}
+}
+
+// register registers the collector with reg and returns it, or the collector
+// already registered in its place.
+func register[C prometheus.Collector](reg prometheus.Registerer, collector C) C {
+	var already prometheus.AlreadyRegisteredError
+	if err := reg.Register(collector); errors.As(err, &already) {
+		if existing, ok := already.ExistingCollector.(C); ok {
+			return existing
+		}
+		panic(err)
+	} else if err != nil {
+		panic(err)
+	}
+	return collector
+}
+
+// WithMetrics makes the chain record metrics of its rules and Runs with reg:
+// operchain_rule_evaluations_total, operchain_rule_firings_total,
+// operchain_rule_errors_total, and operchain_action_duration_seconds, labeled
+// by chain and rule, operchain_last_run_timestamp_seconds, labeled by chain,
+// operchain_requeue_requests_total, labeled by chain and reason, and
+// operchain_circuit_breaker_transitions_total, labeled by chain, rule, and
+// state. Rules are labeled by their names, or by their index if they have
+// none. SetupWithManager records them with controller-runtime's
+// metrics.Registry if no option did.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(c *Chain) {
+		c.metrics = newChainMetrics(reg)
+	}
+}
+
+// ruleEvaluated records the evaluation of the predicate of the current rule.
+func (c *Chain) ruleEvaluated() {
+	if c.metrics != nil {
+		c.metrics.evaluations.WithLabelValues(c.Name, c.currentRule()).Inc()
+	}
+}
+
+// ruleFired records that the action of the current rule ran for the given
+// duration.
+func (c *Chain) ruleFired(duration time.Duration) {
+	if c.metrics != nil {
+		c.metrics.firings.WithLabelValues(c.Name, c.currentRule()).Inc()
+		c.metrics.actionDuration.WithLabelValues(c.Name, c.currentRule()).Observe(duration.Seconds())
+	}
+}
+
+// ruleFailed records that the current rule made the Run fail.
+func (c *Chain) ruleFailed() {
+	if c.metrics != nil {
+		c.metrics.errors.WithLabelValues(c.Name, c.currentRule()).Inc()
+	}
+}
+
+// runFinished records the end of the Run.
+func (c *Chain) runFinished() {
+	if c.metrics != nil {
+		c.metrics.lastRun.WithLabelValues(c.Name).Set(float64(c.now().UnixNano()) / 1e9)
+	}
+}
+
+// requeueRequested records that a requeue was requested for the reason.
+func (c *Chain) requeueRequested(reason string) {
+	if c.metrics != nil {
+		c.metrics.requeues.WithLabelValues(c.Name, reason).Inc()
+	}
+}
@@ -0,0 +1,84 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_WithMetrics_Records_Rules_And_Runs tests that a chain with metrics
+// counts the evaluations, firings, and errors of its rules, times their
+// actions, and records the time of its last Run.
+func Test_If_WithMetrics_Records_Rules_And_Runs(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	reg := prometheus.NewRegistry()
+	var res struct {
+		Widget *Widget
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c := &Chain{Name: "widgets", Clock: clocktesting.NewFakeClock(now)}
+	c.InitializeChain(cl, &res, []Rule{
+		{Name: "noop", Do: func(context.Context) {}},
+		{When: False(), Do: func(context.Context) {}},
+		{Name: "fail", Do: c.Error(errors.New("broken"))},
+	}, WithMetrics(reg))
+	// A second chain shares the metrics.
+	other := &Chain{Name: "others"}
+	other.InitializeChain(cl, &res, nil, WithMetrics(reg))
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	for i := 0; i < 2; i++ {
+		_, err := c.Run(context.Background(), req)
+		assert.Error(t, err, "Run did not fail")
+	}
+	m := c.metrics
+	assert.Same(t, m.evaluations, other.metrics.evaluations, "metrics were not shared")
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.evaluations.WithLabelValues("widgets", "noop")), "evaluations were not counted")
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.evaluations.WithLabelValues("widgets", "rule 1")), "evaluations of unnamed rule were not counted")
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.firings.WithLabelValues("widgets", "noop")), "firings were not counted")
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.firings.WithLabelValues("widgets", "rule 1")), "rule that did not fire was counted")
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.errors.WithLabelValues("widgets", "fail")), "errors were not counted")
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.errors.WithLabelValues("widgets", "noop")), "rule that did not fail was counted")
+	assert.Equal(t, float64(now.Unix()), testutil.ToFloat64(m.lastRun.WithLabelValues("widgets")), "last run was not recorded")
+	assert.Equal(t, 2, testutil.CollectAndCount(m.actionDuration), "action durations were not observed per fired rule")
+	assert.Equal(t, 3, testutil.CollectAndCount(m.evaluations), "labels are not bounded to the rules")
+}
+
+// Test_If_Requeue_Reasons_Are_Reported_And_Counted tests that the reason of
+// the shortest of competing requeues is reported, and that every requested
+// reason is counted.
+func Test_If_Requeue_Reasons_Are_Reported_And_Counted(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	reg := prometheus.NewRegistry()
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{Name: "widgets"}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: c.RequeueReason("waiting-for-cert", time.Minute)},
+		{Do: c.RequeueReason("waiting-for-dns", 10*time.Second)},
+		{Do: c.Requeue(time.Hour)},
+	}, WithMetrics(reg))
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	report, err := c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 10*time.Second, report.Result.RequeueAfter, "the shortest requeue did not win")
+	assert.Equal(t, "waiting-for-dns", report.RequeueReason, "the winning reason was not reported")
+	m := c.metrics
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requeues.WithLabelValues("widgets", "waiting-for-cert")), "losing reason was not counted")
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requeues.WithLabelValues("widgets", "waiting-for-dns")), "winning reason was not counted")
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requeues.WithLabelValues("widgets", RequeueReasonUnspecified)), "plain Requeue was not counted as unspecified")
+}
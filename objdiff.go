@@ -0,0 +1,313 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+// diffContextLines is the number of unchanged lines around the changes in the
+// hunks of a rendered ObjectDiff.
+const diffContextLines = 3
+
+// redactedValue replaces the values of Secrets in an ObjectDiff.
+const redactedValue = "***"
+
+// diffOptions holds the options of DiffObjects.
+type diffOptions struct {
+	showSecrets bool
+}
+
+// DiffOption configures DiffObjects.
+type DiffOption func(o *diffOptions)
+
+// DiffShowSecrets keeps the values of the data and stringData of Secrets in
+// the diff, which are redacted by default.
+func DiffShowSecrets() DiffOption {
+	return func(o *diffOptions) {
+		o.showSecrets = true
+	}
+}
+
+// ObjectDiff is the difference between a live object and the object a chain
+// writes in its place, for people to read.
+type ObjectDiff struct {
+	// Name identifies the object, e.g. "Deployment default/web".
+	Name string
+	// Live is the content of the live object, nil if it does not exist,
+	// without the fields that Desired does not set.
+	Live map[string]interface{}
+	// Desired is the content of the object written.
+	Desired map[string]interface{}
+}
+
+// DiffObjects returns the difference between live, nil if the object does not
+// exist, and desired. The noise that would hide the changes is left out: the
+// status, the metadata other than the name, namespace, labels, and
+// annotations, including managedFields, and the fields of live that desired
+// does not set, such as those defaulted by the API server. The values of
+// Secrets are redacted unless DiffShowSecrets is given, showing only whether
+// they changed.
+func DiffObjects(name string, live, desired client.Object, opts ...DiffOption) (*ObjectDiff, error) {
+	o := &diffOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	d := &ObjectDiff{Name: name}
+	desiredMap, err := contentOf(desired)
+	if err != nil {
+		return nil, err
+	}
+	d.Desired = stripDiffContent(desiredMap)
+	if live != nil && !reflect.ValueOf(live).IsNil() {
+		liveMap, err := contentOf(live)
+		if err != nil {
+			return nil, err
+		}
+		d.Live = pruneTo(stripDiffContent(liveMap), d.Desired).(map[string]interface{})
+	}
+	if !o.showSecrets && isSecret(desired) {
+		for _, field := range []string{"data", "stringData"} {
+			redactSecretData(d.Live, d.Desired, field)
+		}
+	}
+	return d, nil
+}
+
+// Empty returns true if the live object does not differ from the desired one.
+func (d *ObjectDiff) Empty() bool {
+	return d.Live != nil && reflect.DeepEqual(d.Live, d.Desired)
+}
+
+// String renders the difference as kubectl diff does, as a unified diff of the
+// YAML of the live and desired objects, or "" if they do not differ.
+func (d *ObjectDiff) String() string {
+	if d.Empty() {
+		return ""
+	}
+	return unifiedDiff(d.Name+" (live)", d.Name+" (desired)", yamlLines(d.Live), yamlLines(d.Desired))
+}
+
+// stripDiffContent removes the status and the metadata other than the name,
+// namespace, labels, and annotations from content.
+func stripDiffContent(content map[string]interface{}) map[string]interface{} {
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		kept := map[string]interface{}{}
+		for _, k := range []string{"name", "namespace", "labels", "annotations"} {
+			if v, ok := metadata[k]; ok {
+				kept[k] = v
+			}
+		}
+		content["metadata"] = kept
+	}
+	return content
+}
+
+// pruneTo returns live without the map keys that desired does not have,
+// recursively, and through the elements of lists of the same length.
+func pruneTo(live, desired interface{}) interface{} {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		pruned := map[string]interface{}{}
+		for k, v := range l {
+			if dv, ok := d[k]; ok {
+				pruned[k] = pruneTo(v, dv)
+			}
+		}
+		return pruned
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			return live
+		}
+		pruned := make([]interface{}, len(l))
+		for i := range l {
+			pruned[i] = pruneTo(l[i], d[i])
+		}
+		return pruned
+	}
+	return live
+}
+
+// isSecret returns true if obj is a Secret.
+func isSecret(obj client.Object) bool {
+	switch o := obj.(type) {
+	case *corev1.Secret:
+		return true
+	case *unstructured.Unstructured:
+		return o.GetKind() == "Secret" && o.GetAPIVersion() == "v1"
+	}
+	return false
+}
+
+// redactSecretData replaces the values of the map field of the live and
+// desired content, showing whether each changed.
+func redactSecretData(live, desired map[string]interface{}, field string) {
+	l, _ := live[field].(map[string]interface{})
+	d, _ := desired[field].(map[string]interface{})
+	for k, dv := range d {
+		lv, ok := l[k]
+		switch {
+		case !ok:
+			d[k] = redactedValue
+		case reflect.DeepEqual(lv, dv):
+			l[k], d[k] = redactedValue, redactedValue
+		default:
+			l[k], d[k] = redactedValue+" (before)", redactedValue+" (after)"
+		}
+	}
+	for k := range l {
+		if _, ok := d[k]; !ok {
+			l[k] = redactedValue
+		}
+	}
+}
+
+// yamlLines returns the lines of the YAML of content, none if it is nil.
+func yamlLines(content map[string]interface{}) []string {
+	if content == nil {
+		return nil
+	}
+	data, err := yaml.Marshal(content)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// diffLine is a line of a line diff: unchanged (' '), removed ('-'), or added
+// ('+').
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines returns the line diff from a to b, following their longest common
+// subsequence.
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+	return lines
+}
+
+// unifiedDiff renders the diff from a to b in the unified format, with hunks
+// of diffContextLines lines of context.
+func unifiedDiff(aName, bName string, a, b []string) string {
+	lines := diffLines(a, b)
+	// aLine and bLine are the numbers of the lines of a and b before each
+	// line of the diff.
+	aLine, bLine := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for k, line := range lines {
+		aLine[k+1], bLine[k+1] = aLine[k], bLine[k]
+		if line.op != '+' {
+			aLine[k+1]++
+		}
+		if line.op != '-' {
+			bLine[k+1]++
+		}
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(lines); {
+		first := start
+		for first < len(lines) && lines[first].op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		last := first
+		for k := first; k < len(lines) && k-last <= 2*diffContextLines; k++ {
+			if lines[k].op != ' ' {
+				last = k
+			}
+		}
+		lo, hi := max(first-diffContextLines, start), min(last+diffContextLines+1, len(lines))
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aLine[lo], aLine[hi]-aLine[lo]), hunkRange(bLine[lo], bLine[hi]-bLine[lo]))
+		for _, line := range lines[lo:hi] {
+			sb.WriteByte(line.op)
+			sb.WriteString(line.text)
+			sb.WriteByte('\n')
+		}
+		start = hi
+	}
+	return sb.String()
+}
+
+// hunkRange formats the range of a hunk of count lines after line before.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// rendersDiffs returns true if the chain renders the diffs of its writes in
+// the Run with the context.
+func (c *Chain) rendersDiffs(ctx context.Context) bool {
+	return c.RenderDiffs || c.dryRunMode != "" || log.FromContext(ctx).V(1).Enabled()
+}
+
+// renderDiff returns the diff from live to desired, logged at verbosity level
+// 1, or nil if the chain does not render diffs.
+func (c *Chain) renderDiff(ctx context.Context, live, desired client.Object) *ObjectDiff {
+	if !c.rendersDiffs(ctx) {
+		return nil
+	}
+	name := c.describe(desired)
+	d, err := DiffObjects(name, live, desired)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "rendering diff", "object", name)
+		return nil
+	}
+	log.FromContext(ctx).V(1).Info("rendered diff", "object", name, "diff", d.String())
+	return d
+}
@@ -0,0 +1,124 @@
+package operchain
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// diffDeployment returns a Deployment with the given replicas and env, as
+// stored by the API server.
+func diffDeployment(replicas int32, env ...corev1.EnvVar) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web",
+			Namespace:       "default",
+			Labels:          map[string]string{"app": "web"},
+			ResourceVersion: "42",
+			ManagedFields:   []metav1.ManagedFieldsEntry{{Manager: "operchain", Operation: metav1.ManagedFieldsOperationApply}},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{
+					Name:  "web",
+					Image: "nginx:1.25",
+					Env:   env,
+				}}},
+			},
+		},
+		Status: appsv1.DeploymentStatus{Replicas: replicas},
+	}
+}
+
+// assertGolden asserts that got equals the content of the golden file.
+func assertGolden(t *testing.T, name, got string) {
+	want, err := os.ReadFile(filepath.Join("testdata", name))
+	assert.NoError(t, err, "golden file was not read")
+	assert.Equal(t, string(want), got, "diff did not match %s", name)
+}
+
+// Test_If_ObjectDiff_Renders_A_Replica_Change tests the rendering of the diff
+// of a replica count change, without the server-managed noise.
+func Test_If_ObjectDiff_Renders_A_Replica_Change(t *testing.T) {
+	live := diffDeployment(3)
+	live.Spec.Template.Spec.Containers[0].TerminationMessagePath = "/dev/termination-log"
+	desired := diffDeployment(5)
+	desired.ResourceVersion, desired.ManagedFields = "", nil
+	d, err := DiffObjects("Deployment default/web", live, desired)
+	assert.NoError(t, err, "DiffObjects returned an error")
+	assertGolden(t, "objdiff_replicas.golden", d.String())
+}
+
+// Test_If_ObjectDiff_Renders_An_Env_Change tests the rendering of the diff of
+// a changed and an added environment variable.
+func Test_If_ObjectDiff_Renders_An_Env_Change(t *testing.T) {
+	live := diffDeployment(3, corev1.EnvVar{Name: "LOG_LEVEL", Value: "info"})
+	desired := diffDeployment(3, corev1.EnvVar{Name: "LOG_LEVEL", Value: "debug"}, corev1.EnvVar{Name: "FEATURE_X", Value: "on"})
+	d, err := DiffObjects("Deployment default/web", live, desired)
+	assert.NoError(t, err, "DiffObjects returned an error")
+	assertGolden(t, "objdiff_env.golden", d.String())
+
+	d, err = DiffObjects("Deployment default/web", live, live.DeepCopy())
+	assert.NoError(t, err, "DiffObjects returned an error")
+	assert.True(t, d.Empty(), "identical objects differed")
+	assert.Empty(t, d.String(), "identical objects rendered a diff")
+}
+
+// Test_If_ObjectDiff_Redacts_Secrets tests that the values of Secrets are
+// redacted unless asked otherwise, showing only which changed.
+func Test_If_ObjectDiff_Redacts_Secrets(t *testing.T) {
+	secret := func(password string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"},
+			Data:       map[string][]byte{"user": []byte("admin"), "password": []byte(password)},
+		}
+	}
+	d, err := DiffObjects("Secret default/creds", secret("hunter2"), secret("correct horse"))
+	assert.NoError(t, err, "DiffObjects returned an error")
+	assert.NotContains(t, d.String(), "aHVudGVyMg==", "the old value was shown")
+	assert.NotContains(t, d.String(), "Y29ycmVjdCBob3JzZQ==", "the new value was shown")
+	assertGolden(t, "objdiff_secret.golden", d.String())
+
+	d, err = DiffObjects("Secret default/creds", secret("hunter2"), secret("correct horse"), DiffShowSecrets())
+	assert.NoError(t, err, "DiffObjects returned an error")
+	assert.Contains(t, d.String(), "-  password: aHVudGVyMg==", "the value was redacted")
+}
+
+// Test_If_Dry_Runs_Report_Rendered_Diffs tests that the operations of a dry run
+// carry the rendered diffs of the writes of CreateOrUpdate.
+func Test_If_Dry_Runs_Report_Rendered_Diffs(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(diffDeployment(3)).Build()
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{DryRun: DryRunSuppress}
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: c.CreateOrUpdate(deployment, func() error {
+			replicas := int32(5)
+			deployment.Spec.Replicas = &replicas
+			return nil
+		})},
+	})
+	report, err := c.RunWithReport(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}})
+	assert.NoError(t, err, "Run returned an error")
+	if assert.Len(t, report.Operations, 1, "the write was not reported") {
+		assert.Contains(t, report.Operations[0].ObjectDiff, "-  replicas: 3\n+  replicas: 5\n", "the diff was not rendered")
+	}
+	stored := &appsv1.Deployment{}
+	assert.NoError(t, cl.Get(context.Background(), client.ObjectKeyFromObject(deployment), stored))
+	assert.Equal(t, int32(3), *stored.Spec.Replicas, "the dry run wrote the Deployment")
+}
@@ -0,0 +1,132 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// OncePerGeneration returns an action that runs fn at most once per
+// metadata.generation of the primary resource. The generation fn last
+// completed for is recorded in the primary's markerAnnotation, with a patch
+// naming only that annotation, once fn completes without an error. fn runs
+// when the annotation is missing or holds any other value, so editing it by
+// hand only makes fn run again. If the generation changes while fn runs, the
+// generation fn started for is recorded, so that fn runs again for the new
+// one. The action does nothing if the primary resource is not loaded.
+func (c *Chain) OncePerGeneration(markerAnnotation string, fn Action) Action {
+	return c.Try(func(ctx context.Context) error {
+		obj := c.primary()
+		if obj == nil {
+			return nil
+		}
+		generation := strconv.FormatInt(obj.GetGeneration(), 10)
+		if obj.GetAnnotations()[markerAnnotation] == generation {
+			return nil
+		}
+		failed := c.failed()
+		sink := &errorSink{chain: c}
+		fn(context.WithValue(ctx, errorSinkKey{}, sink))
+		if err := sink.err(); err != nil {
+			return err
+		}
+		if c.failed() != failed {
+			return nil
+		}
+		fieldPtr := c.primaryField().Addr().Interface()
+		return c.setMetadataE(fieldPtr, annotations, markerAnnotation, func() string { return generation }, false)(ctx)
+	})
+}
+
+// onceOptions holds the options of Once.
+type onceOptions struct {
+	done func(obj client.Object) bool
+	mark func(obj client.Object)
+}
+
+// OnceOption configures Once.
+type OnceOption func(o *onceOptions)
+
+// OnceInStatus keeps the completion marker in the status of the primary
+// resource instead of an annotation: done reports whether the marker is set,
+// and mark sets it on a copy of the object, which is then patched through the
+// status subresource.
+func OnceInStatus(done func(obj client.Object) bool, mark func(obj client.Object)) OnceOption {
+	return func(o *onceOptions) {
+		o.done = done
+		o.mark = mark
+	}
+}
+
+// Once returns an action that runs fn once in the lifetime of the primary
+// resource, e.g. to generate an initial password. Completion is recorded by a
+// marker on the primary: by default the annotation markerName, holding the
+// time fn completed. fn is skipped while the marker is set, and the marker is
+// set only once fn succeeds, with a patch carrying the primary's
+// resourceVersion, so that of two workers reconciling the object concurrently
+// only one records completion and the other fails with a conflict. Since the
+// marker write itself may fail, after fn has run, fn must be idempotent: it
+// runs again until the marker is recorded. The action does nothing if the
+// primary resource is not loaded.
+func (c *Chain) Once(markerName string, fn ActionE, opts ...OnceOption) Action {
+	return c.Try(c.OnceE(markerName, fn, opts...))
+}
+
+// OnceE is like Once, but returns the error.
+func (c *Chain) OnceE(markerName string, fn ActionE, opts ...OnceOption) ActionE {
+	o := &onceOptions{
+		done: func(obj client.Object) bool {
+			_, ok := obj.GetAnnotations()[markerName]
+			return ok
+		},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(ctx context.Context) error {
+		obj := c.primary()
+		if obj == nil {
+			return nil
+		}
+		if o.done(obj) {
+			return nil
+		}
+		if err := fn(ctx); err != nil {
+			return err
+		}
+		// fn may have reloaded the primary.
+		obj = c.primary()
+		if obj == nil {
+			return nil
+		}
+		modified := obj.DeepCopyObject().(client.Object)
+		patch := client.MergeFromWithOptions(obj, client.MergeFromWithOptimisticLock{})
+		var err error
+		result := controllerutil.OperationResultUpdated
+		if o.mark != nil {
+			o.mark(modified)
+			err = c.Status().Patch(ctx, modified, patch)
+			result = controllerutil.OperationResultUpdatedStatusOnly
+		} else {
+			annotations := modified.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[markerName] = c.now().UTC().Format(time.RFC3339)
+			modified.SetAnnotations(annotations)
+			err = c.Patch(ctx, modified, patch)
+		}
+		if err != nil {
+			return fmt.Errorf("mark %s done on %s/%s: %w", markerName, obj.GetNamespace(), obj.GetName(), err)
+		}
+		reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(modified).Elem())
+		c.recordOperation(obj, result)
+		c.invalidateRun()
+		return nil
+	}
+}
@@ -0,0 +1,119 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// onceMarker is the marker annotation of the OncePerGeneration tests.
+const onceMarker = "example.com/provisioned-generation"
+
+// Test_If_OncePerGeneration_Runs_Once_Per_Generation tests that the action
+// runs once for a generation however often the chain runs, runs again for a
+// new generation, and retries a generation whose run failed.
+func Test_If_OncePerGeneration_Runs_Once_Per_Generation(t *testing.T) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", Generation: 1}}
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget).Build()
+	var res struct {
+		Widget *Widget
+	}
+	provisioned := 0
+	var fail error
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{{Do: c.OncePerGeneration(onceMarker, c.Try(func(ctx context.Context) error {
+		provisioned++
+		return fail
+	}))}})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	run := func() {
+		_, _ = c.Run(context.Background(), req)
+	}
+	run()
+	run()
+	assert.Equal(t, 1, provisioned, "action ran more than once for a generation")
+	assert.Equal(t, "1", res.Widget.Annotations[onceMarker], "generation was not recorded")
+
+	stored := &Widget{}
+	assert.NoError(t, cl.Get(context.Background(), client.ObjectKeyFromObject(widget), stored))
+	stored.Generation = 2
+	assert.NoError(t, cl.Update(context.Background(), stored))
+	fail = errors.New("provisioning failed")
+	run()
+	assert.Equal(t, "1", res.Widget.Annotations[onceMarker], "failed generation was recorded")
+	fail = nil
+	run()
+	run()
+	assert.Equal(t, 3, provisioned, "action did not run again for a new generation")
+	assert.Equal(t, "2", res.Widget.Annotations[onceMarker], "new generation was not recorded")
+}
+
+// Test_If_OncePerGeneration_Records_The_Generation_It_Ran_For tests that a
+// generation bump while the action runs leaves the action to run again.
+func Test_If_OncePerGeneration_Records_The_Generation_It_Ran_For(t *testing.T) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", Generation: 4}}
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget).Build()
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{{Do: c.OncePerGeneration(onceMarker, func(ctx context.Context) {
+		res.Widget.Generation = 5
+	})}})
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run failed")
+	assert.Equal(t, "4", res.Widget.Annotations[onceMarker], "the generation the action ran for was not recorded")
+}
+
+// Test_If_Once_Runs_Until_Completion_Is_Recorded tests that Once runs its
+// action on the first run, skips it once the marker is recorded, and runs it
+// again when it or the marker write failed.
+func Test_If_Once_Runs_Until_Completion_Is_Recorded(t *testing.T) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	var patchErr error
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if patchErr != nil {
+					return patchErr
+				}
+				return cl.Patch(ctx, obj, patch, opts...)
+			},
+		}).Build()
+	var res struct {
+		Widget *Widget
+	}
+	generated := 0
+	var fail error
+	c := &Chain{Clock: clocktesting.NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))}
+	c.InitializeChain(cl, &res, []Rule{{Do: c.Once("example.com/admin-password", func(ctx context.Context) error {
+		generated++
+		return fail
+	})}})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	run := func() error {
+		_, err := c.Run(context.Background(), req)
+		return err
+	}
+
+	fail = errors.New("secret rejected")
+	assert.Error(t, run(), "failure of the action was not reported")
+	fail = nil
+	patchErr = errors.New("connection reset")
+	assert.Error(t, run(), "failure of the marker write was not reported")
+	patchErr = nil
+	assert.NoError(t, run(), "Run failed")
+	assert.NoError(t, run(), "Run failed")
+	assert.Equal(t, 3, generated, "action did not run exactly until its completion was recorded")
+	assert.Equal(t, "2024-01-02T03:04:05Z", res.Widget.Annotations["example.com/admin-password"], "completion was not recorded")
+}
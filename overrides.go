@@ -0,0 +1,59 @@
+package operchain
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// PredicateNames returns the sorted names of the named predicates of the
+// chain's rules, including those its rules' predicates are composed of, i.e.
+// the names PredicateOverrides can force.
+func (c *Chain) PredicateNames() []string {
+	seen := map[string]bool{}
+	var walk func(p *predicate)
+	walk = func(p *predicate) {
+		if p == nil {
+			return
+		}
+		if name := p.Name(); name != "" {
+			seen[name] = true
+		}
+		for _, child := range p.Children() {
+			walk(child)
+		}
+	}
+	sets := [][]Rule{c.Rules, c.Finally}
+	for _, set := range c.VersionedRules {
+		sets = append(sets, set)
+	}
+	for _, set := range sets {
+		for _, rule := range set {
+			walk(rule.When)
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validatePredicateOverrides returns an error for each name of
+// PredicateOverrides that is not the name of a predicate of the chain's
+// rules, which is most likely a typo.
+func (c *Chain) validatePredicateOverrides() []error {
+	if len(c.PredicateOverrides) == 0 {
+		return nil
+	}
+	known := c.PredicateNames()
+	var errs []error
+	for name := range c.PredicateOverrides {
+		if !slices.Contains(known, name) {
+			errs = append(errs, fmt.Errorf("predicate override %q: no predicate of the rules has this name", name))
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
@@ -0,0 +1,43 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Test_If_PredicateNames_Lists_Nested_Named_Predicates tests that
+// PredicateNames finds the named predicates composed into the predicates of
+// all rule sets, but not the anonymous operators composing them.
+func Test_If_PredicateNames_Lists_Nested_Named_Predicates(t *testing.T) {
+	c := &Chain{}
+	c.InitializeChain(nil, &struct{}{}, []Rule{
+		{When: And(Named("b", True()), Not(Named("a", False())))},
+		{When: Named("a", True())},
+		{},
+	})
+	c.Finally = []Rule{{When: Named("c", True())}}
+	c.VersionedRules = map[string][]Rule{"v1": {{When: Named("d", True())}}}
+	assert.Equal(t, []string{"a", "b", "c", "d"}, c.PredicateNames())
+}
+
+// Test_If_PredicateOverrides_Force_Rules_And_Are_Validated tests that an
+// overridden predicate makes its rule fire, and that Validate reports
+// overrides of unknown predicates.
+func Test_If_PredicateOverrides_Force_Rules_And_Are_Validated(t *testing.T) {
+	fired := false
+	c := &Chain{}
+	c.InitializeChain(nil, &struct{}{}, []Rule{
+		{When: Named("license-valid", False()), Do: func(context.Context) { fired = true }},
+	})
+	c.PredicateOverrides = map[string]bool{"license-valid": true}
+	assert.NoError(t, c.Validate())
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err)
+	assert.True(t, fired, "overridden predicate did not make the rule fire")
+	c.PredicateOverrides = map[string]bool{"licence-valid": true}
+	assert.EqualError(t, c.Validate(), `predicate override "licence-valid": no predicate of the rules has this name`)
+}
@@ -0,0 +1,150 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// AlreadyOwnedError is the error of SetControllerReference when the object is
+// already controlled by another owner. A rule can check for it with errors.As
+// to decide whether to adopt the object or raise an alarm.
+type AlreadyOwnedError = controllerutil.AlreadyOwnedError
+
+// SetControllerReference returns an action that makes the primary resource
+// the controller owner of the object in the given resource field, patching
+// the object if it changed. It fails with an AlreadyOwnedError if another
+// object controls it. It does nothing if the field is not loaded.
+func (c *Chain) SetControllerReference(childFieldPtr interface{}) Action {
+	return writes(c.Try(c.SetControllerReferenceE(childFieldPtr)), fieldTarget(childFieldPtr, "metadata/ownerReferences"))
+}
+
+// SetControllerReferenceE is like SetControllerReference, but returns the
+// error.
+func (c *Chain) SetControllerReferenceE(childFieldPtr interface{}) ActionE {
+	return c.PatchMergeE(childFieldPtr, func(obj client.Object) error {
+		return c.ownByPrimary(obj, true)
+	})
+}
+
+// SetOwnerReference returns an action that adds the primary resource to the
+// owners of the object in the given resource field, without making it the
+// controller, so that the object can be shared by several owners. It patches
+// the object if it changed, and does nothing if the field is not loaded.
+func (c *Chain) SetOwnerReference(childFieldPtr interface{}) Action {
+	return writes(c.Try(c.SetOwnerReferenceE(childFieldPtr)), fieldTarget(childFieldPtr, "metadata/ownerReferences"))
+}
+
+// SetOwnerReferenceE is like SetOwnerReference, but returns the error.
+func (c *Chain) SetOwnerReferenceE(childFieldPtr interface{}) ActionE {
+	return c.PatchMergeE(childFieldPtr, func(obj client.Object) error {
+		return c.ownByPrimary(obj, false)
+	})
+}
+
+// ownByPrimary adds the primary resource to the owners of obj, as its
+// controller if controller is true.
+func (c *Chain) ownByPrimary(obj client.Object, controller bool) error {
+	primary := c.primary()
+	if primary == nil {
+		return fmt.Errorf("cannot set owner of %s/%s: primary resource not loaded", obj.GetNamespace(), obj.GetName())
+	}
+	if ns := primary.GetNamespace(); ns != "" && ns != obj.GetNamespace() {
+		return fmt.Errorf("cannot make %s/%s the owner of %s/%s: a namespaced owner must be in the same namespace as the objects it owns; use a cluster-scoped owner, or track the object by label instead",
+			ns, primary.GetName(), obj.GetNamespace(), obj.GetName())
+	}
+	if controller {
+		return controllerutil.SetControllerReference(primary, obj, c.Scheme())
+	}
+	return controllerutil.SetOwnerReference(primary, obj, c.Scheme())
+}
+
+// OwnedByPrimary returns a predicate that is true when the object in the
+// given resource field is controlled by the primary resource. It is false when
+// either is not loaded.
+func (c *Chain) OwnedByPrimary(fieldPtr interface{}) *predicate {
+	checkField(fieldPtr)
+	return pcache.NewLeaf(fmt.Sprintf("OwnedByPrimary(%s)", c.fieldName(fieldPtr)), func(e *pcache.Evaluation) bool {
+		obj, primary := objectAt(fieldPtr), c.primary()
+		return obj != nil && primary != nil && metav1.IsControlledBy(obj, primary)
+	})
+}
+
+// adoptOptions holds the options of Adopt.
+type adoptOptions struct {
+	force bool
+}
+
+// AdoptOption configures Adopt.
+type AdoptOption func(o *adoptOptions)
+
+// ForceAdoption makes Adopt take the object over from another controller,
+// which is kept as a plain owner.
+func ForceAdoption() AdoptOption {
+	return func(o *adoptOptions) {
+		o.force = true
+	}
+}
+
+// Adopt returns an action that makes the primary resource the controller of an
+// existing object in the given resource field, e.g. one created by hand before
+// the operator was installed. The object is patched and an Adopted event is
+// recorded on both the primary resource and the object. It fails with an
+// AlreadyOwnedError if another object controls it, unless ForceAdoption is
+// given. It does nothing if the field is not loaded or the object is already
+// controlled by the primary resource. Guard it with a predicate, such as
+// Not(OwnedByPrimary), that decides which objects may be adopted.
+func (c *Chain) Adopt(fieldPtr interface{}, opts ...AdoptOption) Action {
+	return writes(c.Try(c.AdoptE(fieldPtr, opts...)), fieldTarget(fieldPtr, "metadata/ownerReferences"))
+}
+
+// AdoptE is like Adopt, but returns the error.
+func (c *Chain) AdoptE(fieldPtr interface{}, opts ...AdoptOption) ActionE {
+	checkField(fieldPtr)
+	o := &adoptOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	patch := c.PatchMergeE(fieldPtr, func(obj client.Object) error {
+		if previous := metav1.GetControllerOf(obj); previous != nil && o.force {
+			refs := obj.GetOwnerReferences()
+			for i := range refs {
+				if refs[i].UID == previous.UID {
+					refs[i].Controller = nil
+				}
+			}
+			obj.SetOwnerReferences(refs)
+		}
+		return c.ownByPrimary(obj, true)
+	})
+	return func(ctx context.Context) error {
+		obj, primary := objectAt(fieldPtr), c.primary()
+		if obj == nil || (primary != nil && metav1.IsControlledBy(obj, primary)) {
+			return nil
+		}
+		if err := patch(ctx); err != nil {
+			return err
+		}
+		c.event(primary, corev1.EventTypeNormal, "Adopted", "Adopted "+c.describe(obj))
+		c.event(obj, corev1.EventTypeNormal, "Adopted", "Adopted by "+c.describe(primary))
+		return nil
+	}
+}
+
+// describe returns the kind, namespace, and name of obj, for use in messages.
+func (c *Chain) describe(obj client.Object) string {
+	name := obj.GetName()
+	if ns := obj.GetNamespace(); ns != "" {
+		name = ns + "/" + name
+	}
+	if gvk, err := c.gvkFor(obj); err == nil {
+		return gvk.Kind + " " + name
+	}
+	return name
+}
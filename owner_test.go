@@ -0,0 +1,112 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// ownerResources are the resources of the owner reference tests.
+type ownerResources struct {
+	Widget    *Widget
+	ConfigMap *corev1.ConfigMap
+}
+
+// ownerChain returns a chain over a Widget and a stored child ConfigMap in the
+// given namespace, and a counter of patches.
+func ownerChain(namespace string) (*Chain, *ownerResources, *int) {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "child", Namespace: namespace}}
+	patches := 0
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(cm).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				patches++
+				return cl.Patch(ctx, obj, patch, opts...)
+			},
+		}).Build()
+	res := &ownerResources{
+		Widget:    &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", UID: "widget-uid"}},
+		ConfigMap: cm,
+	}
+	return &Chain{Client: cl, Resources: res}, res, &patches
+}
+
+// Test_If_SetControllerReference_Is_Idempotent tests that
+// SetControllerReference sets the primary as the controller once, and does not
+// patch again when it is already set.
+func Test_If_SetControllerReference_Is_Idempotent(t *testing.T) {
+	c, res, patches := ownerChain("default")
+	assert.NoError(t, c.SetControllerReferenceE(&res.ConfigMap)(context.Background()))
+	assert.True(t, metav1.IsControlledBy(res.ConfigMap, res.Widget), "controller was not set")
+	assert.NoError(t, c.SetControllerReferenceE(&res.ConfigMap)(context.Background()))
+	assert.Equal(t, 1, *patches, "unchanged owner was patched again")
+}
+
+// Test_If_SetControllerReference_Reports_Another_Controller tests that
+// SetControllerReference fails with an AlreadyOwnedError when another object
+// controls the child, while SetOwnerReference still adds a shared owner.
+func Test_If_SetControllerReference_Reports_Another_Controller(t *testing.T) {
+	c, res, _ := ownerChain("default")
+	res.ConfigMap.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: "v1", Kind: "Other", Name: "other", UID: "other-uid", Controller: ptr.To(true),
+	}}
+	err := c.SetControllerReferenceE(&res.ConfigMap)(context.Background())
+	var owned *AlreadyOwnedError
+	assert.True(t, errors.As(err, &owned), "conflict was not an AlreadyOwnedError")
+	assert.NoError(t, c.SetOwnerReferenceE(&res.ConfigMap)(context.Background()))
+	if assert.Len(t, res.ConfigMap.OwnerReferences, 2, "shared owner was not added") {
+		assert.Nil(t, res.ConfigMap.OwnerReferences[1].Controller, "shared owner was made the controller")
+	}
+}
+
+// Test_If_Owner_References_Cannot_Cross_Namespaces tests that owner references
+// to a primary in another namespace are rejected without a patch.
+func Test_If_Owner_References_Cannot_Cross_Namespaces(t *testing.T) {
+	c, res, patches := ownerChain("elsewhere")
+	err := c.SetOwnerReferenceE(&res.ConfigMap)(context.Background())
+	assert.ErrorContains(t, err, "same namespace", "cross-namespace owner was not rejected")
+	assert.Equal(t, 0, *patches, "cross-namespace owner was patched")
+}
+
+// Test_If_Adopt_Takes_Over_Orphans tests that Adopt makes the primary the
+// controller of an orphan and records events on both objects.
+func Test_If_Adopt_Takes_Over_Orphans(t *testing.T) {
+	c, res, patches := ownerChain("default")
+	recorder := record.NewFakeRecorder(10)
+	c.Recorder = recorder
+	owned := c.OwnedByPrimary(&res.ConfigMap)
+	assert.False(t, owned.Eval(pcache.New()), "orphan was owned")
+	assert.NoError(t, c.AdoptE(&res.ConfigMap)(context.Background()))
+	assert.True(t, owned.Eval(pcache.New()), "orphan was not adopted")
+	assert.Equal(t, "Normal Adopted Adopted ConfigMap default/child", <-recorder.Events, "primary event was not recorded")
+	assert.Equal(t, "Normal Adopted Adopted by Widget default/demo", <-recorder.Events, "adoptee event was not recorded")
+	assert.NoError(t, c.AdoptE(&res.ConfigMap)(context.Background()))
+	assert.Equal(t, 1, *patches, "adopted object was patched again")
+	assert.Empty(t, recorder.Events, "event was recorded again")
+}
+
+// Test_If_Adopt_Steals_Only_With_Force tests that Adopt refuses to take an
+// object from another controller unless forced, and then keeps the previous
+// controller as a plain owner.
+func Test_If_Adopt_Steals_Only_With_Force(t *testing.T) {
+	c, res, _ := ownerChain("default")
+	res.ConfigMap.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: "v1", Kind: "Other", Name: "other", UID: "other-uid", Controller: ptr.To(true),
+	}}
+	var owned *AlreadyOwnedError
+	assert.True(t, errors.As(c.AdoptE(&res.ConfigMap)(context.Background()), &owned), "object was stolen without force")
+	assert.NoError(t, c.AdoptE(&res.ConfigMap, ForceAdoption())(context.Background()))
+	assert.True(t, metav1.IsControlledBy(res.ConfigMap, res.Widget), "object was not adopted")
+	assert.Len(t, res.ConfigMap.OwnerReferences, 2, "previous owner was not kept")
+}
@@ -0,0 +1,76 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error of a Run in which a predicate or action panicked
+// and the chain recovers panics.
+type PanicError struct {
+	// Rule is the name of the rule being run.
+	Rule string
+	// Predicate is the name of the innermost predicate that panicked, or empty
+	// if an action panicked.
+	Predicate string
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack at the point of the panic.
+	Stack []byte
+}
+
+// Error returns the panic value, where it was raised, and the stack.
+func (e *PanicError) Error() string {
+	where := "action"
+	if e.Predicate != "" {
+		where = fmt.Sprintf("predicate %s", e.Predicate)
+	}
+	return fmt.Sprintf("panic in %s of %s: %v\n%s", where, e.Rule, e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// setRule records the rule being run, for attributing panics. A rule without
+// a name is identified by the prefix and its index.
+func (c *Chain) setRule(name, prefix string, i int) {
+	if name == "" {
+		name = fmt.Sprintf("%s %d", prefix, i)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.rule = name
+}
+
+// currentRule returns the name of the rule being run.
+func (c *Chain) currentRule() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.rule
+}
+
+// predicatePanicked records the panic of a predicate as the error of the Run.
+func (c *Chain) predicatePanicked(p *predicate, recovered interface{}, stack []byte) {
+	name := p.Name()
+	if name == "" {
+		name = "(anonymous)"
+	}
+	c.doError(&PanicError{Rule: c.currentRule(), Predicate: name, Value: recovered, Stack: stack})
+}
+
+// do runs the action, under pprof labels as runLabeled does, recovering a
+// panic as the error of the Run if the chain recovers panics.
+func (c *Chain) do(ctx context.Context, action Action) {
+	if c.RecoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				c.doError(&PanicError{Rule: c.currentRule(), Value: r, Stack: debug.Stack()})
+			}
+		}()
+	}
+	c.runLabeled(ctx, action)
+}
@@ -0,0 +1,56 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Test_If_Predicate_Panics_Are_Attributed tests that a panic in a leaf
+// predicate nested under And is recovered as an error naming the predicate and
+// rule, with the panic's stack, and that the rule does not fire.
+func Test_If_Predicate_Panics_Are_Attributed(t *testing.T) {
+	var res struct {
+		Widget *Widget
+	}
+	fired := false
+	c := &Chain{RecoverPanics: true}
+	replicasSet := pcache.NewLeaf("ReplicasSet", func(e *pcache.Evaluation) bool {
+		return res.Widget.Spec.Size > 0
+	})
+	c.InitializeChain(fake.NewClientBuilder().WithScheme(newTestScheme()).Build(), &res, []Rule{
+		{Do: func(context.Context) {}},
+		{Name: "scale", When: And(True(), replicasSet), Do: func(context.Context) { fired = true }},
+	})
+	_, err := c.Run(context.Background(), ctrl.Request{})
+	var panicErr *PanicError
+	if assert.True(t, errors.As(err, &panicErr), "error was not a PanicError") {
+		assert.Equal(t, "scale", panicErr.Rule, "panic was not attributed to the rule")
+		assert.Equal(t, "ReplicasSet", panicErr.Predicate, "panic was not attributed to the predicate")
+		assert.Contains(t, panicErr.Error(), "nil pointer dereference", "panic message was lost")
+		assert.Contains(t, string(panicErr.Stack), "Test_If_Predicate_Panics_Are_Attributed", "stack was lost")
+	}
+	assert.False(t, fired, "rule fired after its predicate panicked")
+}
+
+// Test_If_Action_Panics_Are_Recovered tests that a panic in an action is
+// recovered as an error naming the rule, and that panics propagate when the
+// chain does not recover them.
+func Test_If_Action_Panics_Are_Recovered(t *testing.T) {
+	c := &Chain{RecoverPanics: true}
+	c.InitializeChain(fake.NewClientBuilder().Build(), &struct{}{}, []Rule{
+		{Do: func(context.Context) { panic(assert.AnError) }},
+	})
+	_, err := c.Run(context.Background(), ctrl.Request{})
+	assert.ErrorIs(t, err, assert.AnError, "panic value was not wrapped")
+	assert.Contains(t, err.Error(), "panic in action of rule 0", "panic was not attributed")
+
+	c.RecoverPanics = false
+	assert.Panics(t, func() { _, _ = c.Run(context.Background(), ctrl.Request{}) }, "panic was recovered")
+}
@@ -0,0 +1,127 @@
+package operchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// patchMergeOptions holds the options of PatchMerge.
+type patchMergeOptions struct {
+	optimisticLock bool
+}
+
+// PatchMergeOption configures PatchMerge.
+type PatchMergeOption func(o *patchMergeOptions)
+
+// OptimisticLock makes the patch include the object's resourceVersion, so
+// that it fails with a conflict if the object changed since it was loaded.
+func OptimisticLock() PatchMergeOption {
+	return func(o *patchMergeOptions) {
+		o.optimisticLock = true
+	}
+}
+
+// JSONPatchOp is a JSON patch operation, as defined by RFC 6902.
+type JSONPatchOp struct {
+	// Op is the operation: add, remove, replace, move, copy, or test.
+	Op string `json:"op"`
+	// Path is the JSON pointer to the target location.
+	Path string `json:"path"`
+	// From is the source location of move and copy operations.
+	From string `json:"from,omitempty"`
+	// Value is the value of add, replace, and test operations.
+	Value interface{} `json:"value,omitempty"`
+}
+
+// PatchMerge returns an action that applies mutate to a copy of an object,
+// given either as a client.Object or as a pointer to a resource field, and
+// sends the difference as a merge patch, so that only the changed fields are
+// written. It does nothing if the field is not loaded or mutate changes
+// nothing. On success, the object holds the object returned by the API server.
+func (c *Chain) PatchMerge(target interface{}, mutate func(obj client.Object) error, opts ...PatchMergeOption) Action {
+	return writes(c.Try(c.PatchMergeE(target, mutate, opts...)), objectOrFieldTarget(target, ""))
+}
+
+// PatchMergeE is like PatchMerge, but returns the error.
+func (c *Chain) PatchMergeE(target interface{}, mutate func(obj client.Object) error, opts ...PatchMergeOption) ActionE {
+	o := &patchMergeOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	resolve := targetResolver(target)
+	return func(ctx context.Context) error {
+		obj := resolve()
+		if obj == nil {
+			return nil
+		}
+		var patch client.Patch = client.MergeFrom(obj)
+		if o.optimisticLock {
+			patch = client.MergeFromWithOptions(obj, client.MergeFromWithOptimisticLock{})
+		}
+		modified := obj.DeepCopyObject().(client.Object)
+		if err := mutate(modified); err != nil {
+			return err
+		}
+		data, err := patch.Data(modified)
+		if err != nil {
+			return err
+		}
+		if !o.optimisticLock && string(data) == "{}" {
+			c.recordOperation(obj, controllerutil.OperationResultNone)
+			return nil
+		}
+		return c.sendPatch(ctx, obj, modified, patch)
+	}
+}
+
+// PatchJSON returns an action that sends the given JSON patch operations to an
+// object, given either as a client.Object or as a pointer to a resource field.
+// It does nothing if the field is not loaded. On success, the object holds the
+// object returned by the API server.
+func (c *Chain) PatchJSON(target interface{}, ops []JSONPatchOp) Action {
+	return writes(c.Try(c.PatchJSONE(target, ops)), objectOrFieldTarget(target, ""))
+}
+
+// PatchJSONE is like PatchJSON, but returns the error.
+func (c *Chain) PatchJSONE(target interface{}, ops []JSONPatchOp) ActionE {
+	resolve := targetResolver(target)
+	data, err := json.Marshal(ops)
+	if err != nil {
+		panic(fmt.Sprintf("cannot encode JSON patch: %s", err))
+	}
+	return func(ctx context.Context) error {
+		obj := resolve()
+		if obj == nil {
+			return nil
+		}
+		return c.sendPatch(ctx, obj, obj.DeepCopyObject().(client.Object), client.RawPatch(types.JSONPatchType, data))
+	}
+}
+
+// sendPatch patches modified, a copy of obj, and on success copies the result
+// into obj.
+func (c *Chain) sendPatch(ctx context.Context, obj, modified client.Object, patch client.Patch) error {
+	if err := c.Patch(ctx, modified, patch); err != nil {
+		return fmt.Errorf("patch %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(modified).Elem())
+	c.recordOperation(obj, controllerutil.OperationResultUpdated)
+	return nil
+}
+
+// targetResolver returns a function returning the object an action targets,
+// given either as a client.Object or as a pointer to a resource field, or nil
+// if the field is not loaded.
+func targetResolver(target interface{}) func() client.Object {
+	if obj, ok := target.(client.Object); ok {
+		return func() client.Object { return obj }
+	}
+	checkField(target)
+	return func() client.Object { return objectAt(target) }
+}
@@ -0,0 +1,61 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Test_If_PatchMerge_Sends_Only_Changed_Fields tests that PatchMerge sends a
+// merge patch of only the fields mutate changed, and nothing when it changes
+// nothing.
+func Test_If_PatchMerge_Sends_Only_Changed_Fields(t *testing.T) {
+	var patches []recordedPatch
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+	}
+	c := &Chain{Client: patchRecorder(&patches, nil), Resources: &res}
+	res.ConfigMap = &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", ResourceVersion: "7", Labels: map[string]string{"app": "demo"}},
+		Data:       map[string]string{"key": "value"},
+	}
+	label := func(obj client.Object) error {
+		labels := obj.GetLabels()
+		labels["tier"] = "web"
+		obj.SetLabels(labels)
+		return nil
+	}
+	assert.NoError(t, c.PatchMergeE(&res.ConfigMap, label)(context.Background()))
+	assert.Equal(t, "web", res.ConfigMap.Labels["tier"], "loaded object was not updated")
+	assert.NoError(t, c.PatchMergeE(&res.ConfigMap, label)(context.Background()))
+	assert.NoError(t, c.PatchMergeE(&res.ConfigMap, func(client.Object) error { return nil }, OptimisticLock())(context.Background()))
+	if assert.Len(t, patches, 2, "unchanged object was patched") {
+		assert.Equal(t, types.MergePatchType, patches[0].Type)
+		assert.JSONEq(t, `{"metadata":{"labels":{"tier":"web"}}}`, patches[0].Data, "patch held unchanged fields")
+		assert.JSONEq(t, `{"metadata":{"resourceVersion":"7"}}`, patches[1].Data, "patch did not lock")
+	}
+}
+
+// Test_If_PatchJSON_Sends_The_Operations tests that PatchJSON sends the given
+// operations as a JSON patch.
+func Test_If_PatchJSON_Sends_The_Operations(t *testing.T) {
+	var patches []recordedPatch
+	c := &Chain{Client: patchRecorder(&patches, nil)}
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	assert.NoError(t, c.PatchJSONE(cm, []JSONPatchOp{
+		{Op: "add", Path: "/metadata/annotations/example.com~1bump", Value: "1"},
+		{Op: "remove", Path: "/data/old"},
+	})(context.Background()))
+	if assert.Len(t, patches, 1) {
+		assert.Equal(t, types.JSONPatchType, patches[0].Type)
+		assert.JSONEq(t, `[
+			{"op":"add","path":"/metadata/annotations/example.com~1bump","value":"1"},
+			{"op":"remove","path":"/data/old"}
+		]`, patches[0].Data)
+	}
+}
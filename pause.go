@@ -0,0 +1,98 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// PausedCondition is the type of the condition set on a paused primary
+// resource by WithPauseSupport.
+const PausedCondition = "Paused"
+
+// Paused returns a predicate that is true when the object in the given
+// resource field is paused, either by the given annotation set to "true" or by
+// spec.paused set to true.
+func (c *Chain) Paused(fieldPtr interface{}, annotationKey string) *predicate {
+	checkField(fieldPtr)
+	name := fmt.Sprintf("Paused(%s, %s)", c.fieldName(fieldPtr), annotationKey)
+	return c.reactsTo(pcache.NewLeaf(name, func(e *pcache.Evaluation) bool {
+		obj := objectAt(fieldPtr)
+		if obj == nil {
+			e.Notef("object not loaded")
+			return false
+		}
+		if obj.GetAnnotations()[annotationKey] == "true" {
+			e.Notef("annotation %s is true", annotationKey)
+			return true
+		}
+		if paused, _, _ := fieldValue(obj, []string{"spec", "paused"}); paused == true {
+			e.Notef("spec.paused is true")
+			return true
+		}
+		return false
+	}), fieldPtr, ReactsToAnnotations)
+}
+
+// WithPauseSupport returns an Option that adds leading rules to the chain for
+// pausing the primary resource with the given annotation or spec.paused, as
+// checked by Paused. While the primary resource is paused, the rules set its
+// Paused condition, recording an event when it becomes paused, and then stop
+// the chain and forget the values kept across runs. Once it is no longer
+// paused, they remove the condition and let the chain continue. The rules are
+// also added to the front of each of the chain's VersionedRules.
+func WithPauseSupport(annotationKey string) Option {
+	return func(c *Chain) {
+		field := c.primaryField()
+		if !field.IsValid() {
+			panic("pause support requires a primary resource")
+		}
+		fieldPtr := field.Addr().Interface()
+		paused := c.Paused(fieldPtr, annotationKey)
+		rules := []Rule{
+			{When: paused, Do: Sequential(c.pause(fieldPtr), c.StopAndForget())},
+			{When: Not(paused), Do: c.unpause(fieldPtr)},
+		}
+		c.eachRuleSet(func(set []Rule) []Rule {
+			return JoinRules(rules, set)
+		})
+	}
+}
+
+// pause returns an action that sets the Paused condition of the object in the
+// given resource field, as SetCondition does, and records an event if it was
+// not already paused.
+func (c *Chain) pause(fieldPtr interface{}) Action {
+	setPaused := c.setConditionE(fieldPtr, metav1.Condition{
+		Type:    PausedCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Paused",
+		Message: "Reconciliation is paused",
+	})
+	return writes(c.Try(func(ctx context.Context) error {
+		obj := objectAt(fieldPtr)
+		if obj == nil {
+			return nil
+		}
+		cond, ok := findCondition(obj, PausedCondition)
+		wasPaused := ok && cond.Status == string(metav1.ConditionTrue)
+		if err := setPaused(ctx); err != nil {
+			return err
+		}
+		if !wasPaused {
+			c.event(obj, corev1.EventTypeNormal, "Paused", "Reconciliation is paused")
+		}
+		return nil
+	}), fieldTarget(fieldPtr, "status/conditions/"+PausedCondition))
+}
+
+// unpause returns an action that removes the Paused condition of the object in
+// the given resource field, if it is loaded and has one, as RemoveCondition
+// does.
+func (c *Chain) unpause(fieldPtr interface{}) Action {
+	return c.RemoveCondition(fieldPtr, PausedCondition)
+}
@@ -0,0 +1,117 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Test_If_WithPauseSupport_Pauses_And_Unpauses tests that a paused primary
+// resource gets a Paused condition and one event while the chain stops, and
+// that the condition is removed once it is unpaused.
+func Test_If_WithPauseSupport_Pauses_And_Unpauses(t *testing.T) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{
+		Name:        "demo",
+		Namespace:   "default",
+		Annotations: map[string]string{"example.com/paused": "true"},
+	}}
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget).WithStatusSubresource(widget).Build()
+	recorder := record.NewFakeRecorder(10)
+	var res struct {
+		Widget *Widget
+	}
+	ran := 0
+	c := &Chain{Recorder: recorder}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: func(context.Context) { ran++ }},
+	}, WithPauseSupport("example.com/paused"))
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	stored := func() *Widget {
+		w := &Widget{}
+		assert.NoError(t, cl.Get(context.Background(), client.ObjectKeyFromObject(widget), w))
+		return w
+	}
+
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Zero(t, ran, "chain was not stopped")
+	assert.True(t, meta.IsStatusConditionTrue(stored().Status.Conditions, PausedCondition), "Paused condition was not set")
+	assert.Equal(t, "Normal Paused Reconciliation is paused", <-recorder.Events, "event was not recorded")
+
+	version := stored().ResourceVersion
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Zero(t, ran, "chain was not stopped")
+	assert.Equal(t, version, stored().ResourceVersion, "status was written when already paused")
+	assert.Empty(t, recorder.Events, "event was recorded when already paused")
+
+	w := stored()
+	w.Annotations = nil
+	assert.NoError(t, cl.Update(context.Background(), w))
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 1, ran, "chain did not continue when unpaused")
+	assert.Nil(t, meta.FindStatusCondition(stored().Status.Conditions, PausedCondition), "Paused condition was not removed")
+}
+
+// Test_If_WithPauseSupport_Writes_Status_As_Configured tests that the Paused
+// condition is written with the chain's batched status writes, and takes its
+// transition time from the chain's Clock.
+func Test_If_WithPauseSupport_Writes_Status_As_Configured(t *testing.T) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{
+		Name:        "demo",
+		Namespace:   "default",
+		Annotations: map[string]string{"example.com/paused": "true"},
+	}}
+	writes := 0
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget).WithStatusSubresource(widget).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourceUpdate: func(ctx context.Context, cl client.Client, subResource string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+				writes++
+				return cl.SubResource(subResource).Update(ctx, obj, opts...)
+			},
+		}).Build()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{BatchStatus: true, Clock: clocktesting.NewFakeClock(now)}
+	c.InitializeChain(cl, &res, nil, WithPauseSupport("example.com/paused"))
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 1, writes, "the status was not written once")
+	stored := &Widget{}
+	assert.NoError(t, cl.Get(context.Background(), client.ObjectKeyFromObject(widget), stored))
+	cond := meta.FindStatusCondition(stored.Status.Conditions, PausedCondition)
+	if assert.NotNil(t, cond, "Paused condition was not set") {
+		assert.True(t, cond.LastTransitionTime.Time.Equal(now), "the transition time does not come from the chain's Clock")
+	}
+}
+
+// Test_If_Paused_Checks_Spec_Paused tests that Paused is true when
+// spec.paused is set.
+func Test_If_Paused_Checks_Spec_Paused(t *testing.T) {
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{Resources: &res}
+	p := c.Paused(&res.Widget, "example.com/paused")
+	assert.False(t, p.Eval(pcache.New()), "Paused was true for an unloaded object")
+	res.Widget = &Widget{}
+	assert.False(t, p.Eval(pcache.New()), "Paused was true for an active object")
+	res.Widget.Spec.Paused = true
+	assert.True(t, p.Eval(pcache.New()), "Paused was false with spec.paused")
+}
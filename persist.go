@@ -0,0 +1,68 @@
+package operchain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// persistedValue is a predicate value kept across runs.
+type persistedValue struct {
+	value   bool
+	expires time.Time
+	tags    []string
+}
+
+// hasTag returns true if the value was computed by a predicate with the tag.
+func (v persistedValue) hasTag(tag string) bool {
+	for _, t := range v.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Persist returns a predicate that caches the value of p across runs, per
+// object, for the given time to live. The value is identified across runs by
+// p's key, set with WithKey, which must be unique within the chain; Persist
+// panics if p has none, as names need not be unique. Persisted values are
+// discarded early by InvalidateTag for any of p's tags, and when the object is
+// forgotten.
+func (c *Chain) Persist(p *predicate, ttl time.Duration) *predicate {
+	id := p.Key()
+	if id == "" {
+		panic(fmt.Sprintf("persisted predicate %q must have a key; set one with WithKey", p.Name()))
+	}
+	key := "predicate:" + id
+	return pcache.NewComposite(fmt.Sprintf("Persist(%s, %s)", id, ttl), []*predicate{p}, func(e *pcache.Evaluation) bool {
+		now := c.now()
+		if v, ok := c.storeGet(key); ok {
+			if pv := v.(persistedValue); now.Before(pv.expires) {
+				e.Notef("persisted until %s", pv.expires.Format(time.RFC3339))
+				return pv.value
+			}
+		}
+		value := e.Eval(p)
+		c.storeSet(key, persistedValue{value: value, expires: now.Add(ttl), tags: p.Tags()})
+		return value
+	})
+}
+
+// InvalidateTag discards the values of all predicates with the given tag that
+// were persisted across runs, for every object, so that they are evaluated
+// again. When called during a run, e.g. from an action, the run's own cached
+// values for those predicates are discarded too.
+func (c *Chain) InvalidateTag(tag string) {
+	c.store().DeleteWhere(func(_ string, value interface{}) bool {
+		pv, ok := value.(persistedValue)
+		return ok && pv.hasTag(tag)
+	})
+	c.lock.Lock()
+	cache := c.cache
+	c.lock.Unlock()
+	if cache != nil {
+		cache.InvalidateTag(tag)
+	}
+}
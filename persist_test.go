@@ -0,0 +1,91 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// countingPredicate returns a named predicate that counts its evaluations.
+func countingPredicate(name string, counts map[string]int) *predicate {
+	return Named(name, Predicate(func() bool {
+		counts[name]++
+		return true
+	}))
+}
+
+// persistedPredicate returns a counting predicate keyed by its name, as
+// Persist requires.
+func persistedPredicate(name string, counts map[string]int) *predicate {
+	return WithKey(name, countingPredicate(name, counts))
+}
+
+// Test_If_InvalidateTag_Discards_Persisted_Values tests that persisted values
+// are reused across runs until their tag is invalidated, for every object.
+func Test_If_InvalidateTag_Discards_Persisted_Values(t *testing.T) {
+	counts := map[string]int{}
+	c := &Chain{}
+	c.InitializeChain(fake.NewClientBuilder().Build(), &struct{}{}, []Rule{
+		{When: c.Persist(WithTags(persistedPredicate("a", counts), "global-config"), time.Hour), Do: func(context.Context) {}},
+		{When: c.Persist(WithTags(persistedPredicate("b", counts), "global-config"), time.Hour), Do: func(context.Context) {}},
+		{When: c.Persist(persistedPredicate("c", counts), time.Hour), Do: func(context.Context) {}},
+	})
+	run := func(name string) {
+		_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}})
+		assert.NoError(t, err)
+	}
+	run("x")
+	run("y")
+	run("x")
+	assert.Equal(t, map[string]int{"a": 2, "b": 2, "c": 2}, counts, "persisted values were not reused")
+
+	c.InvalidateTag("global-config")
+	run("x")
+	run("y")
+	assert.Equal(t, map[string]int{"a": 4, "b": 4, "c": 2}, counts, "tagged values were not evaluated again")
+}
+
+// Test_If_InvalidateTag_Applies_Within_A_Run tests that invalidating a tag
+// from an action causes tagged predicates to be evaluated again later in the
+// same run.
+func Test_If_InvalidateTag_Applies_Within_A_Run(t *testing.T) {
+	counts := map[string]int{}
+	tagged := WithTags(countingPredicate("tagged", counts), "config")
+	untagged := countingPredicate("untagged", counts)
+	c := &Chain{}
+	c.InitializeChain(fake.NewClientBuilder().Build(), &struct{}{}, []Rule{
+		{When: And(tagged, untagged), Do: func(context.Context) { c.InvalidateTag("config") }},
+		{When: And(tagged, untagged), Do: func(context.Context) {}},
+	})
+	_, err := c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"tagged": 2, "untagged": 1}, counts)
+}
+
+// Test_If_Persisted_Values_Expire tests that persisted values are evaluated
+// again once their time to live has passed.
+func Test_If_Persisted_Values_Expire(t *testing.T) {
+	counts := map[string]int{}
+	clk := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := &Chain{Clock: clk}
+	c.InitializeChain(fake.NewClientBuilder().Build(), &struct{}{}, []Rule{
+		{When: c.Persist(persistedPredicate("a", counts), time.Minute), Do: func(context.Context) {}},
+	})
+	for i := 0; i < 3; i++ {
+		_, err := c.Run(context.Background(), ctrl.Request{})
+		assert.NoError(t, err)
+		clk.Step(30 * time.Second)
+	}
+	assert.Equal(t, 2, counts["a"], "persisted value did not expire")
+	assert.Panics(t, func() { c.Persist(True(), time.Minute) }, "anonymous predicate was persisted")
+	assert.PanicsWithValue(t, `persisted predicate "a" must have a key; set one with WithKey`, func() {
+		c.Persist(countingPredicate("a", counts), time.Minute)
+	}, "named predicate without a key was persisted")
+	assert.NotPanics(t, func() { c.Persist(WithKey("keyed", True()), time.Minute) }, "keyed predicate was not persisted")
+}
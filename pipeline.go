@@ -0,0 +1,79 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// PipelineStep is a step of a Pipeline. It receives the output of the previous
+// step, or nil if it is the first, and returns its own output.
+type PipelineStep func(ctx context.Context, in interface{}) (out interface{}, err error)
+
+// PipelineTypeError is the error of a step made with Step that received an
+// input of the wrong type.
+type PipelineTypeError struct {
+	// Want is the type the step accepts.
+	Want string
+	// Got is the type of the input it received.
+	Got string
+}
+
+// Error returns the expected and actual types.
+func (e *PipelineTypeError) Error() string {
+	return fmt.Sprintf("input is %s, want %s", e.Got, e.Want)
+}
+
+// Step returns a PipelineStep for a function with a typed input and output.
+// An input that is not an I fails the step with a PipelineTypeError. A nil
+// input is accepted as the zero I.
+func Step[I, O any](fn func(ctx context.Context, in I) (O, error)) PipelineStep {
+	return func(ctx context.Context, in interface{}) (interface{}, error) {
+		typed, ok := in.(I)
+		if !ok && in != nil {
+			return nil, &PipelineTypeError{Want: reflect.TypeOf((*I)(nil)).Elem().String(), Got: fmt.Sprintf("%T", in)}
+		}
+		return fn(ctx, typed)
+	}
+}
+
+// Pipeline returns an action that runs the steps in order, passing the output
+// of each to the next. The first step that fails ends the pipeline, and its
+// error, naming the step by its position from 1, becomes the error of the
+// chain. If slot is not empty, the output of the last step is kept for the
+// rest of the Run, for RunValue.
+func (c *Chain) Pipeline(slot string, steps ...PipelineStep) Action {
+	return c.Try(c.PipelineE(slot, steps...))
+}
+
+// PipelineE is like Pipeline, but returns the error.
+func (c *Chain) PipelineE(slot string, steps ...PipelineStep) ActionE {
+	return func(ctx context.Context) error {
+		var value interface{}
+		for i, step := range steps {
+			out, err := step(ctx, value)
+			if err != nil {
+				return fmt.Errorf("pipeline step %d: %w", i+1, err)
+			}
+			value = out
+		}
+		if slot != "" {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			if c.values == nil {
+				c.values = map[string]interface{}{}
+			}
+			c.values[slot] = value
+		}
+		return nil
+	}
+}
+
+// RunValue returns the output kept in the slot by a Pipeline of the current
+// Run, and whether there is one.
+func (c *Chain) RunValue(slot string) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	value, ok := c.values[slot]
+	return value, ok
+}
@@ -0,0 +1,47 @@
+package operchain
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Test_If_Pipeline_Threads_A_Value_Through_Its_Steps tests that Pipeline
+// passes the output of each step to the next and keeps the last in its slot.
+func Test_If_Pipeline_Threads_A_Value_Through_Its_Steps(t *testing.T) {
+	c := &Chain{}
+	err := c.PipelineE("deployment",
+		Step(func(ctx context.Context, _ interface{}) (int, error) { return 3, nil }),
+		Step(func(ctx context.Context, replicas int) (string, error) { return strconv.Itoa(replicas), nil }),
+		Step(func(ctx context.Context, replicas string) (*appsv1.Deployment, error) {
+			return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web-" + replicas}}, nil
+		}),
+	)(context.Background())
+	assert.NoError(t, err, "Pipeline failed")
+	value, ok := c.RunValue("deployment")
+	assert.True(t, ok, "Pipeline did not keep its output")
+	assert.Equal(t, "web-3", value.(*appsv1.Deployment).Name, "Pipeline did not thread the value")
+}
+
+// Test_If_Pipeline_Reports_A_Type_Mismatch tests that a step given an input of
+// the wrong type fails the pipeline with a PipelineTypeError instead of
+// panicking, and that later steps do not run.
+func Test_If_Pipeline_Reports_A_Type_Mismatch(t *testing.T) {
+	c := &Chain{}
+	ran := false
+	err := c.PipelineE("deployment",
+		Step(func(ctx context.Context, _ interface{}) (string, error) { return "web", nil }),
+		Step(func(ctx context.Context, d *appsv1.Deployment) (*appsv1.Deployment, error) { return d, nil }),
+		func(ctx context.Context, in interface{}) (interface{}, error) { ran = true; return in, nil },
+	)(context.Background())
+	var typeErr *PipelineTypeError
+	assert.ErrorAs(t, err, &typeErr, "Pipeline did not report the type mismatch")
+	assert.EqualError(t, err, "pipeline step 2: input is string, want *v1.Deployment", "wrong error")
+	assert.False(t, ran, "Pipeline ran a step after a failure")
+	_, ok := c.RunValue("deployment")
+	assert.False(t, ok, "failed Pipeline kept an output")
+}
@@ -0,0 +1,39 @@
+package operchain
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// WithProfileLabels makes the chain run the actions of its rules under the
+// pprof labels chain, rule, and namespace, so that CPU profiles and goroutine
+// dumps attribute their samples to the rule. The chain and rule are the paths
+// of names from the outermost chain, as in logs. Parallel refines them with
+// the index of the branch, ForEachParallel with the item, and chains run by a
+// labeled chain's rules are labeled even without the option.
+func WithProfileLabels() Option {
+	return func(c *Chain) {
+		c.profileLabels = true
+	}
+}
+
+// runLabeled runs the action of the current rule with ctx, under the pprof
+// labels of the rule if the chain or a chain running it has profile labels.
+func (c *Chain) runLabeled(ctx context.Context, action Action) {
+	if _, nested := pprof.Label(ctx, "chain"); !c.profileLabels && !nested {
+		action(ctx)
+		return
+	}
+	l, _ := ctx.Value(runLogKey{}).(runLog)
+	pprof.Do(ctx, pprof.Labels("chain", l.chain, "rule", l.rule, "namespace", c.req.Namespace), action)
+}
+
+// refineLabels runs f with ctx, under the given pprof labels in addition to
+// those of ctx if it has the labels of a chain.
+func refineLabels(ctx context.Context, f func(ctx context.Context), labels ...string) {
+	if _, ok := pprof.Label(ctx, "chain"); !ok {
+		f(ctx)
+		return
+	}
+	pprof.Do(ctx, pprof.Labels(labels...), f)
+}
@@ -0,0 +1,58 @@
+package operchain
+
+import (
+	"context"
+	"runtime/pprof"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_WithProfileLabels_Labels_Actions tests that actions run under the
+// pprof labels of their chain and rule, refined by subchains and parallel
+// branches, and that chains without the option do not label them.
+func Test_If_WithProfileLabels_Labels_Actions(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var lock sync.Mutex
+	seen := map[string]map[string]string{}
+	capture := func(name string) Action {
+		return func(ctx context.Context) {
+			labels := map[string]string{}
+			pprof.ForLabels(ctx, func(key, value string) bool {
+				labels[key] = value
+				return true
+			})
+			lock.Lock()
+			defer lock.Unlock()
+			seen[name] = labels
+		}
+	}
+	var res, subRes struct {
+		Widget *Widget
+	}
+	sub := &Chain{Name: "sub"}
+	sub.InitializeChain(cl, &subRes, []Rule{{Name: "inner", Do: capture("inner")}})
+	c := &Chain{Name: "widgets"}
+	c.InitializeChain(cl, &res, []Rule{
+		{Name: "plain", Do: capture("plain")},
+		{Name: "fanout", Do: Parallel(capture("first"), capture("second"))},
+		{Name: "outer", Do: c.Subchain(sub)},
+	}, WithProfileLabels())
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run failed")
+	assert.Equal(t, map[string]string{"chain": "widgets", "rule": "plain", "namespace": "default"}, seen["plain"], "action was not labeled")
+	assert.Equal(t, map[string]string{"chain": "widgets", "rule": "fanout", "namespace": "default", "branch": "1"}, seen["second"], "branch was not labeled")
+	assert.Equal(t, map[string]string{"chain": "widgets/sub", "rule": "outer/inner", "namespace": "default"}, seen["inner"], "subchain did not refine the labels")
+
+	_, err = sub.Run(context.Background(), req)
+	assert.NoError(t, err, "Run failed")
+	assert.Empty(t, seen["inner"], "chain without the option labeled its action")
+}
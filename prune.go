@@ -0,0 +1,108 @@
+package operchain
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// pruneOptions holds the options of Prune.
+type pruneOptions struct {
+	dryRun  bool
+	delete  deleteOptions
+	protect []func(obj client.Object) bool
+	events  bool
+}
+
+// PruneOption configures Prune.
+type PruneOption func(o *pruneOptions)
+
+// PruneDryRun makes Prune only log and report the objects it would delete.
+func PruneDryRun() PruneOption {
+	return func(o *pruneOptions) {
+		o.dryRun = true
+	}
+}
+
+// PrunePropagation sets the propagation policy of the deletes: Foreground,
+// Background, or Orphan.
+func PrunePropagation(policy metav1.DeletionPropagation) PruneOption {
+	return func(o *pruneOptions) {
+		o.delete.propagation = &policy
+	}
+}
+
+// PruneProtect keeps the objects for which protected returns true, e.g. those
+// with a "keep" label. It may be given several times.
+func PruneProtect(protected func(obj client.Object) bool) PruneOption {
+	return func(o *pruneOptions) {
+		o.protect = append(o.protect, protected)
+	}
+}
+
+// PruneEvents records a Pruned event on the primary resource for every object
+// pruned.
+func PruneEvents() PruneOption {
+	return func(o *pruneOptions) {
+		o.events = true
+	}
+}
+
+// Prune returns an action that deletes the objects in the given resource slice
+// field that are controlled by the primary resource but whose keys are not
+// returned by desired, which is called when the action runs. Objects not
+// controlled by the primary resource are never deleted, and nothing is deleted
+// if the primary resource is not loaded. Pruned objects are removed from the
+// field and appear in the run report; objects already gone count as pruned.
+// Errors are aggregated, and do not stop the remaining objects from being
+// pruned.
+func (c *Chain) Prune(ownedSlicePtr interface{}, desired func() []client.ObjectKey, opts ...PruneOption) Action {
+	return c.Try(c.PruneE(ownedSlicePtr, desired, opts...))
+}
+
+// PruneE is like Prune, but returns the error.
+func (c *Chain) PruneE(ownedSlicePtr interface{}, desired func() []client.ObjectKey, opts ...PruneOption) ActionE {
+	checkSliceField(ownedSlicePtr)
+	o := &pruneOptions{delete: deleteOptions{ignoreNotFound: true}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(ctx context.Context) error {
+		primary := c.primary()
+		if primary == nil {
+			return nil
+		}
+		keep := map[client.ObjectKey]bool{}
+		for _, key := range desired() {
+			keep[key] = true
+		}
+		return c.deleteItems(ownedSlicePtr, func(obj client.Object) (bool, error) {
+			if keep[client.ObjectKeyFromObject(obj)] || !metav1.IsControlledBy(obj, primary) || o.protected(obj) {
+				return false, nil
+			}
+			if o.dryRun {
+				log.FromContext(ctx).Info("would prune", "object", c.describe(obj))
+				c.recordOperation(obj, OperationResultWouldDelete)
+				return false, nil
+			}
+			deleted, err := c.deleteObject(ctx, obj, &o.delete)
+			if deleted && o.events {
+				c.event(primary, corev1.EventTypeNormal, "Pruned", "Pruned "+c.describe(obj))
+			}
+			return deleted, err
+		})
+	}
+}
+
+// protected returns true if any protection applies to obj.
+func (o *pruneOptions) protected(obj client.Object) bool {
+	for _, protected := range o.protect {
+		if protected(obj) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// pruneResources are the resources of the Prune tests.
+type pruneResources struct {
+	Widget     *Widget
+	ConfigMaps []corev1.ConfigMap
+}
+
+// pruneChain returns a chain over a Widget that controls three stored
+// ConfigMaps: desired, prunable, and one labeled keep.
+func pruneChain() (*Chain, client.Client, *pruneResources) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", UID: "widget-uid"}}
+	owner := []metav1.OwnerReference{{APIVersion: "example.com/v1", Kind: "Widget", Name: "demo", UID: "widget-uid", Controller: ptr.To(true)}}
+	res := &pruneResources{Widget: widget}
+	builder := fake.NewClientBuilder().WithScheme(newTestScheme())
+	for _, name := range []string{"desired", "prunable", "protected"} {
+		cm := corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: owner}}
+		if name == "protected" {
+			cm.Labels = map[string]string{"keep": "true"}
+		}
+		builder = builder.WithObjects(cm.DeepCopy())
+		res.ConfigMaps = append(res.ConfigMaps, cm)
+	}
+	cl := builder.Build()
+	return &Chain{Client: cl, Resources: res}, cl, res
+}
+
+// pruneDesired returns the key of the desired ConfigMap.
+func pruneDesired() []client.ObjectKey {
+	return []client.ObjectKey{{Namespace: "default", Name: "desired"}}
+}
+
+// pruneKeep protects objects labeled keep.
+func pruneKeep(obj client.Object) bool {
+	return obj.GetLabels()["keep"] == "true"
+}
+
+// Test_If_Prune_Deletes_Only_Undesired_Unprotected_Objects tests that Prune
+// deletes the owned object that is neither desired nor protected, reports it,
+// and records an event.
+func Test_If_Prune_Deletes_Only_Undesired_Unprotected_Objects(t *testing.T) {
+	c, cl, res := pruneChain()
+	recorder := record.NewFakeRecorder(10)
+	c.Recorder = recorder
+	assert.NoError(t, c.PruneE(&res.ConfigMaps, pruneDesired, PruneProtect(pruneKeep), PruneEvents())(context.Background()))
+	list := &corev1.ConfigMapList{}
+	assert.NoError(t, cl.List(context.Background(), list))
+	var names []string
+	for _, cm := range list.Items {
+		names = append(names, cm.Name)
+	}
+	assert.ElementsMatch(t, []string{"desired", "protected"}, names, "wrong objects were pruned")
+	assert.Len(t, res.ConfigMaps, 2, "pruned object was not removed from the field")
+	assert.Equal(t, []Operation{{Kind: "ConfigMap", Namespace: "default", Name: "prunable", Result: OperationResultDeleted}}, c.operations, "prune was not reported")
+	assert.Equal(t, "Normal Pruned Pruned ConfigMap default/prunable", <-recorder.Events, "prune event was not recorded")
+}
+
+// Test_If_Prune_Dry_Run_Deletes_Nothing tests that a dry run only reports the
+// objects it would delete.
+func Test_If_Prune_Dry_Run_Deletes_Nothing(t *testing.T) {
+	c, cl, res := pruneChain()
+	assert.NoError(t, c.PruneE(&res.ConfigMaps, pruneDesired, PruneProtect(pruneKeep), PruneDryRun())(context.Background()))
+	list := &corev1.ConfigMapList{}
+	assert.NoError(t, cl.List(context.Background(), list))
+	assert.Len(t, list.Items, 3, "dry run deleted objects")
+	assert.Equal(t, []Operation{{Kind: "ConfigMap", Namespace: "default", Name: "prunable", Result: OperationResultWouldDelete}}, c.operations, "dry run was not reported")
+}
@@ -0,0 +1,69 @@
+package operchain
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Exists returns a predicate that is true when the given resource field is
+// loaded. For resource slice fields, it is true when at least one object was
+// loaded.
+func (c *Chain) Exists(fieldPtr interface{}) *predicate {
+	if isSliceField(fieldPtr) {
+		checkSliceField(fieldPtr)
+		return pcache.NewLeaf(fmt.Sprintf("Exists(%s)", c.fieldName(fieldPtr)), func(e *pcache.Evaluation) bool {
+			return len(objectsAt(fieldPtr)) > 0
+		})
+	}
+	checkField(fieldPtr)
+	return pcache.NewLeaf(fmt.Sprintf("Exists(%s)", c.fieldName(fieldPtr)), func(e *pcache.Evaluation) bool {
+		return objectAt(fieldPtr) != nil
+	})
+}
+
+// ForAll returns a predicate that is true when f is true for every object in
+// the given resource slice field. It is true for an empty slice, so combine it
+// with Exists to also require at least one object. Evaluation stops at the
+// first object for which f is false, and the trace names that object.
+func (c *Chain) ForAll(slicePtr interface{}, f func(obj client.Object) bool) *predicate {
+	checkSliceField(slicePtr)
+	return pcache.NewLeaf(fmt.Sprintf("ForAll(%s)", c.fieldName(slicePtr)), func(e *pcache.Evaluation) bool {
+		for _, obj := range objectsAt(slicePtr) {
+			if !f(obj) {
+				e.Notef("%s does not match", client.ObjectKeyFromObject(obj))
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// ExistsIn returns a predicate that is true when f is true for at least one
+// object in the given resource slice field. It is false for an empty slice.
+// Evaluation stops at the first object for which f is true, and the trace names
+// that object.
+func (c *Chain) ExistsIn(slicePtr interface{}, f func(obj client.Object) bool) *predicate {
+	checkSliceField(slicePtr)
+	return pcache.NewLeaf(fmt.Sprintf("ExistsIn(%s)", c.fieldName(slicePtr)), func(e *pcache.Evaluation) bool {
+		for _, obj := range objectsAt(slicePtr) {
+			if f(obj) {
+				e.Notef("%s matches", client.ObjectKeyFromObject(obj))
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Typed adapts a function of a concrete object type to a function of
+// client.Object, for use with ForAll, ExistsIn, and similar helpers. Objects of
+// any other type do not match.
+func Typed[T client.Object](f func(obj T) bool) func(obj client.Object) bool {
+	return func(obj client.Object) bool {
+		typed, ok := obj.(T)
+		return ok && f(typed)
+	}
+}
@@ -0,0 +1,108 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// podRunning is a ForAll/ExistsIn function matching running Pods.
+var podRunning = Typed(func(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodRunning
+})
+
+// claimBound is a ForAll/ExistsIn function matching bound PVCs.
+var claimBound = Typed(func(pvc *corev1.PersistentVolumeClaim) bool {
+	return pvc.Status.Phase == corev1.ClaimBound
+})
+
+// Test_If_Quantifiers_Evaluate_Loaded_Lists tests that ForAll and ExistsIn
+// evaluate over slices loaded from the request's namespace.
+func Test_If_Quantifiers_Evaluate_Loaded_Lists(t *testing.T) {
+	pod := func(name, ns string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	claim := func(name string, phase corev1.PersistentVolumeClaimPhase) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: phase},
+		}
+	}
+	cl := fake.NewClientBuilder().WithObjects(
+		pod("a", "default", corev1.PodRunning),
+		pod("b", "default", corev1.PodRunning),
+		pod("c", "other", corev1.PodPending),
+		claim("x", corev1.ClaimPending),
+		claim("y", corev1.ClaimBound),
+	).Build()
+	var res struct {
+		Pods   []corev1.Pod
+		Claims []*corev1.PersistentVolumeClaim
+	}
+	c := &Chain{}
+	var allRunning, anyBound, allBound bool
+	c.InitializeChain(cl, &res, []Rule{
+		{
+			When: And(c.Exists(&res.Pods), c.ForAll(&res.Pods, podRunning)),
+			Do:   func(context.Context) { allRunning = true },
+		},
+		{
+			When: c.ExistsIn(&res.Claims, claimBound),
+			Do:   func(context.Context) { anyBound = true },
+		},
+		{
+			When: c.ForAll(&res.Claims, claimBound),
+			Do:   func(context.Context) { allBound = true },
+		},
+	})
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "primary"}})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Len(t, res.Pods, 2, "Pods were not loaded from the request namespace")
+	assert.True(t, allRunning, "all Pods were not running")
+	assert.True(t, anyBound, "no PVC was bound")
+	assert.False(t, allBound, "all PVCs were bound")
+}
+
+// Test_If_Quantifiers_Handle_Empty_Slices tests that ForAll is true and
+// ExistsIn and Exists are false for an empty slice.
+func Test_If_Quantifiers_Handle_Empty_Slices(t *testing.T) {
+	var res struct {
+		Pods []corev1.Pod
+	}
+	c := &Chain{Resources: &res}
+	cache := pcache.New()
+	assert.True(t, c.ForAll(&res.Pods, podRunning).Eval(cache), "ForAll was false for an empty slice")
+	assert.False(t, c.ExistsIn(&res.Pods, podRunning).Eval(cache), "ExistsIn was true for an empty slice")
+	assert.False(t, c.Exists(&res.Pods).Eval(cache), "Exists was true for an empty slice")
+}
+
+// Test_If_ForAll_Traces_The_Failing_Element tests that ForAll stops at the
+// first failing element and names it in the trace.
+func Test_If_ForAll_Traces_The_Failing_Element(t *testing.T) {
+	var res struct {
+		Pods []*corev1.Pod
+	}
+	c := &Chain{Resources: &res}
+	res.Pods = []*corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default"}, Status: corev1.PodStatus{Phase: corev1.PodPending}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "default"}, Status: corev1.PodStatus{Phase: corev1.PodPending}},
+	}
+	cache := pcache.New()
+	cache.EnableTrace()
+	assert.False(t, c.ForAll(&res.Pods, podRunning).Eval(cache), "ForAll was true")
+	assert.Equal(t, []TraceEntry{
+		{Name: "ForAll(Pods)", Value: false, Notes: []string{"default/b does not match"}},
+	}, cache.Trace(), "trace did not name the failing element")
+}
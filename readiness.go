@@ -0,0 +1,107 @@
+package operchain
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain/internal/kstatus"
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// ReadinessStatus is the readiness status of an object, as computed by
+// Readiness.
+type ReadinessStatus = kstatus.Status
+
+const (
+	// StatusCurrent means the object has reached its desired state.
+	StatusCurrent = kstatus.Current
+	// StatusInProgress means the object is still working towards its desired
+	// state.
+	StatusInProgress = kstatus.InProgress
+	// StatusFailed means the object cannot reach its desired state without
+	// intervention.
+	StatusFailed = kstatus.Failed
+	// StatusTerminating means the object is being deleted.
+	StatusTerminating = kstatus.Terminating
+)
+
+// Readiness computes the readiness status of obj and a message explaining it.
+// Well-known workload kinds are judged by their replica counts, and other
+// kinds, including custom resources, by their Ready, Reconciling, and Stalled
+// conditions.
+func (c *Chain) Readiness(obj client.Object) (ReadinessStatus, string, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		gvk, err := c.gvkFor(obj)
+		if err != nil {
+			return "", "", err
+		}
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return "", "", err
+		}
+		u = &unstructured.Unstructured{Object: content}
+		u.SetGroupVersionKind(gvk)
+	}
+	result := kstatus.Compute(u)
+	return result.Status, result.Message, nil
+}
+
+// Ready returns a predicate that is true when the object in the given resource
+// field is loaded and its readiness status is Current.
+func (c *Chain) Ready(fieldPtr interface{}) *predicate {
+	return c.readinessPredicate("Ready", fieldPtr, StatusCurrent)
+}
+
+// Failed returns a predicate that is true when the object in the given
+// resource field is loaded and its readiness status is Failed.
+func (c *Chain) Failed(fieldPtr interface{}) *predicate {
+	return c.readinessPredicate("Failed", fieldPtr, StatusFailed)
+}
+
+// AllReady returns a predicate that is true when the readiness status of every
+// object in the given resource slice field is Current. Like ForAll, it is true
+// for an empty slice.
+func (c *Chain) AllReady(slicePtr interface{}) *predicate {
+	checkSliceField(slicePtr)
+	return pcache.NewLeaf(fmt.Sprintf("AllReady(%s)", c.fieldName(slicePtr)), func(e *pcache.Evaluation) bool {
+		for _, obj := range objectsAt(slicePtr) {
+			if !c.hasReadiness(e, obj, StatusCurrent) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// readinessPredicate returns a predicate that is true when the object in the
+// given resource field has the given readiness status.
+func (c *Chain) readinessPredicate(kind string, fieldPtr interface{}, want ReadinessStatus) *predicate {
+	checkField(fieldPtr)
+	return c.reactsTo(pcache.NewLeaf(fmt.Sprintf("%s(%s)", kind, c.fieldName(fieldPtr)), func(e *pcache.Evaluation) bool {
+		obj := objectAt(fieldPtr)
+		if obj == nil {
+			e.Notef("object not loaded")
+			return false
+		}
+		return c.hasReadiness(e, obj, want)
+	}), fieldPtr, ReactsToStatus)
+}
+
+// hasReadiness returns true if obj has the given readiness status, noting the
+// actual status in the trace otherwise.
+func (c *Chain) hasReadiness(e *pcache.Evaluation, obj client.Object, want ReadinessStatus) bool {
+	status, message, err := c.Readiness(obj)
+	if err != nil {
+		e.Notef("%s: %v", client.ObjectKeyFromObject(obj), err)
+		return false
+	}
+	if status != want {
+		e.Notef("%s is %s: %s", client.ObjectKeyFromObject(obj), status, message)
+		return false
+	}
+	return true
+}
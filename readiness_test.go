@@ -0,0 +1,95 @@
+package operchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// deployment returns a Deployment with the given desired and ready replica
+// counts, fully rolled out otherwise.
+func deployment(name string, replicas, ready int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status: appsv1.DeploymentStatus{
+			Replicas:          replicas,
+			UpdatedReplicas:   replicas,
+			ReadyReplicas:     ready,
+			AvailableReplicas: ready,
+		},
+	}
+}
+
+// Test_If_Ready_Judges_Typed_Deployments tests that Ready is true for a ready
+// Deployment and false for a progressing one.
+func Test_If_Ready_Judges_Typed_Deployments(t *testing.T) {
+	var res struct {
+		Deployment *appsv1.Deployment
+	}
+	c := &Chain{Client: fake.NewClientBuilder().Build(), Resources: &res}
+	ready := c.Ready(&res.Deployment)
+	failed := c.Failed(&res.Deployment)
+	assert.False(t, ready.Eval(pcache.New()), "unloaded Deployment was ready")
+
+	res.Deployment = deployment("web", 3, 3)
+	assert.True(t, ready.Eval(pcache.New()), "ready Deployment was not ready")
+	assert.False(t, failed.Eval(pcache.New()), "ready Deployment was failed")
+
+	res.Deployment = deployment("web", 3, 1)
+	cache := pcache.New()
+	cache.EnableTrace()
+	assert.False(t, ready.Eval(cache), "progressing Deployment was ready")
+	assert.Equal(t, []string{"default/web is InProgress: 1/3 replicas available"}, cache.Trace()[0].Notes)
+
+	status, _, err := c.Readiness(res.Deployment)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusInProgress, status, "progressing Deployment was not InProgress")
+}
+
+// Test_If_Ready_Judges_Unstructured_Custom_Resources tests that Ready and
+// Failed use the conditions of an unstructured custom resource.
+func Test_If_Ready_Judges_Unstructured_Custom_Resources(t *testing.T) {
+	var res struct {
+		Object *unstructured.Unstructured
+	}
+	c := &Chain{Resources: &res}
+	withCondition := func(condType, status string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{
+				"conditions": []interface{}{
+					map[string]interface{}{"type": condType, "status": status},
+				},
+			},
+		}}
+		u.SetAPIVersion("example.com/v1")
+		u.SetKind("Database")
+		return u
+	}
+	res.Object = withCondition("Ready", "True")
+	assert.True(t, c.Ready(&res.Object).Eval(pcache.New()), "Ready=True was not ready")
+	res.Object = withCondition("Ready", "False")
+	assert.False(t, c.Ready(&res.Object).Eval(pcache.New()), "Ready=False was ready")
+	res.Object = withCondition("Stalled", "True")
+	assert.True(t, c.Failed(&res.Object).Eval(pcache.New()), "Stalled=True was not failed")
+}
+
+// Test_If_AllReady_Requires_Every_Object_Ready tests AllReady over a slice.
+func Test_If_AllReady_Requires_Every_Object_Ready(t *testing.T) {
+	var res struct {
+		Deployments []appsv1.Deployment
+	}
+	c := &Chain{Client: fake.NewClientBuilder().Build(), Resources: &res}
+	allReady := c.AllReady(&res.Deployments)
+	assert.True(t, allReady.Eval(pcache.New()), "empty slice was not all ready")
+	res.Deployments = []appsv1.Deployment{*deployment("a", 1, 1), *deployment("b", 2, 2)}
+	assert.True(t, allReady.Eval(pcache.New()), "ready Deployments were not all ready")
+	res.Deployments = append(res.Deployments, *deployment("c", 2, 0))
+	assert.False(t, allReady.Eval(pcache.New()), "a progressing Deployment was ready")
+}
@@ -0,0 +1,301 @@
+package operchain
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PredicateConstructor constructs a predicate for a chain from parameters.
+type PredicateConstructor func(c *Chain, params map[string]string) (*predicate, error)
+
+// ActionConstructor constructs an action for a chain from parameters.
+type ActionConstructor func(c *Chain, params map[string]string) (Action, error)
+
+// Registry maps names to predicate and action constructors, so that chains can
+// be assembled from names, e.g. by expressions or declarative configuration.
+type Registry struct {
+	lock       sync.RWMutex
+	predicates map[string]PredicateConstructor
+	actions    map[string]ActionConstructor
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		predicates: map[string]PredicateConstructor{},
+		actions:    map[string]ActionConstructor{},
+	}
+}
+
+// DefaultRegistry is the global Registry, consulted by every chain after its
+// own Registry. It contains the built-in predicates and actions.
+var DefaultRegistry = NewRegistry()
+
+// RegisterPredicate registers a predicate constructor in the DefaultRegistry.
+// It panics if the name is already registered.
+func RegisterPredicate(name string, ctor PredicateConstructor) {
+	DefaultRegistry.RegisterPredicate(name, ctor)
+}
+
+// RegisterAction registers an action constructor in the DefaultRegistry. It
+// panics if the name is already registered.
+func RegisterAction(name string, ctor ActionConstructor) {
+	DefaultRegistry.RegisterAction(name, ctor)
+}
+
+// RegisterPredicate registers a predicate constructor. It panics if the name
+// is already registered.
+func (r *Registry) RegisterPredicate(name string, ctor PredicateConstructor) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.predicates[name]; ok {
+		panic(fmt.Sprintf("predicate %q is already registered", name))
+	}
+	r.predicates[name] = ctor
+}
+
+// RegisterAction registers an action constructor. It panics if the name is
+// already registered.
+func (r *Registry) RegisterAction(name string, ctor ActionConstructor) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.actions[name]; ok {
+		panic(fmt.Sprintf("action %q is already registered", name))
+	}
+	r.actions[name] = ctor
+}
+
+// PredicateNames returns the registered predicate names, sorted.
+func (r *Registry) PredicateNames() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return sortedKeys(r.predicates)
+}
+
+// ActionNames returns the registered action names, sorted.
+func (r *Registry) ActionNames() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return sortedKeys(r.actions)
+}
+
+// predicate returns the predicate constructor with the given name.
+func (r *Registry) predicate(name string) (PredicateConstructor, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	ctor, ok := r.predicates[name]
+	return ctor, ok
+}
+
+// action returns the action constructor with the given name.
+func (r *Registry) action(name string) (ActionConstructor, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	ctor, ok := r.actions[name]
+	return ctor, ok
+}
+
+// sortedKeys returns the keys of m, sorted.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// registries returns the registries the chain consults, in order.
+func (c *Chain) registries() []*Registry {
+	if c.Registry != nil {
+		return []*Registry{c.Registry, DefaultRegistry}
+	}
+	return []*Registry{DefaultRegistry}
+}
+
+// LookupPredicate constructs the named predicate for the chain, looking in the
+// chain's Registry first and then in the DefaultRegistry.
+func (c *Chain) LookupPredicate(name string, params map[string]string) (*predicate, error) {
+	for _, r := range c.registries() {
+		if ctor, ok := r.predicate(name); ok {
+			p, err := ctor(c, params)
+			if err != nil {
+				return nil, fmt.Errorf("predicate %q: %w", name, err)
+			}
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown predicate %q", name)
+}
+
+// LookupAction constructs the named action for the chain, looking in the
+// chain's Registry first and then in the DefaultRegistry.
+func (c *Chain) LookupAction(name string, params map[string]string) (Action, error) {
+	for _, r := range c.registries() {
+		if ctor, ok := r.action(name); ok {
+			a, err := ctor(c, params)
+			if err != nil {
+				return nil, fmt.Errorf("action %q: %w", name, err)
+			}
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown action %q", name)
+}
+
+// ResolvePredicate implements PredicateResolver, so that expressions can refer
+// to registered predicates which take no parameters. Each name is constructed
+// once per chain, so that repeated references share a cached value.
+func (c *Chain) ResolvePredicate(name string) (*predicate, error) {
+	c.lock.Lock()
+	p, ok := c.resolved[name]
+	c.lock.Unlock()
+	if ok {
+		return p, nil
+	}
+	// Construct without holding the lock, as the constructor may itself
+	// resolve predicates.
+	p, err := c.LookupPredicate(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if existing, ok := c.resolved[name]; ok {
+		return existing, nil
+	}
+	if c.resolved == nil {
+		c.resolved = map[string]*predicate{}
+	}
+	c.resolved[name] = p
+	return p, nil
+}
+
+// FieldByName returns a pointer to the named field of Resources, for use with
+// predicates and actions taking a field pointer.
+func (c *Chain) FieldByName(name string) (interface{}, error) {
+	res := reflect.ValueOf(c.Resources)
+	if res.Kind() != reflect.Ptr || res.IsNil() || res.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("Resources must be a pointer to a struct")
+	}
+	field := res.Elem().FieldByName(name)
+	if !field.IsValid() || !field.CanSet() {
+		return nil, fmt.Errorf("unknown resource field %q", name)
+	}
+	return field.Addr().Interface(), nil
+}
+
+// requiredParam returns the named parameter, or an error if it is missing.
+func requiredParam(params map[string]string, name string) (string, error) {
+	v, ok := params[name]
+	if !ok || v == "" {
+		return "", fmt.Errorf("missing parameter %q", name)
+	}
+	return v, nil
+}
+
+// fieldParam returns a pointer to the resource field named by the given
+// parameter.
+func (c *Chain) fieldParam(params map[string]string, name string) (interface{}, error) {
+	fieldName, err := requiredParam(params, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.FieldByName(fieldName)
+}
+
+// resourceFieldParam returns a pointer to the resource field named by the
+// given parameter, or an error if it is not a resource field, or else a
+// resource slice field if slices is true.
+func (c *Chain) resourceFieldParam(params map[string]string, name string, slices bool) (interface{}, error) {
+	field, err := c.fieldParam(params, name)
+	if err != nil {
+		return nil, err
+	}
+	if slices && isSliceField(field) {
+		err = validateSliceField(field)
+	} else {
+		err = validateField(field)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parameter %q: %w", name, err)
+	}
+	return field, nil
+}
+
+func init() {
+	RegisterPredicate("Exists", func(c *Chain, params map[string]string) (*predicate, error) {
+		field, err := c.resourceFieldParam(params, "field", true)
+		if err != nil {
+			return nil, err
+		}
+		return c.Exists(field), nil
+	})
+	RegisterPredicate("GenerationChanged", func(c *Chain, params map[string]string) (*predicate, error) {
+		field, err := c.resourceFieldParam(params, "field", false)
+		if err != nil {
+			return nil, err
+		}
+		return c.GenerationChanged(field), nil
+	})
+	RegisterPredicate("ConditionTrue", func(c *Chain, params map[string]string) (*predicate, error) {
+		field, err := c.resourceFieldParam(params, "field", false)
+		if err != nil {
+			return nil, err
+		}
+		condType, err := requiredParam(params, "type")
+		if err != nil {
+			return nil, err
+		}
+		return c.ConditionTrue(field, condType), nil
+	})
+	RegisterAction("Requeue", func(c *Chain, params map[string]string) (Action, error) {
+		after, err := requiredParam(params, "after")
+		if err != nil {
+			return nil, err
+		}
+		interval, err := time.ParseDuration(after)
+		if err != nil {
+			return nil, fmt.Errorf("parameter \"after\": %w", err)
+		}
+		if reason := params["reason"]; reason != "" {
+			return c.RequeueReason(reason, interval), nil
+		}
+		return c.Requeue(interval), nil
+	})
+	RegisterAction("Stop", func(c *Chain, params map[string]string) (Action, error) {
+		return c.Stop(), nil
+	})
+	RegisterAction("Event", func(c *Chain, params map[string]string) (Action, error) {
+		reason, err := requiredParam(params, "reason")
+		if err != nil {
+			return nil, err
+		}
+		eventType := params["type"]
+		switch eventType {
+		case "":
+			eventType = corev1.EventTypeNormal
+		case corev1.EventTypeNormal, corev1.EventTypeWarning:
+		default:
+			return nil, fmt.Errorf("parameter \"type\": unknown event type %q", eventType)
+		}
+		if _, err := template.New("message").Parse(params["message"]); err != nil {
+			return nil, fmt.Errorf("parameter \"message\": %w", err)
+		}
+		return c.EventFor(nil, eventType, reason, params["message"]), nil
+	})
+	RegisterAction("Error", func(c *Chain, params map[string]string) (Action, error) {
+		message, err := requiredParam(params, "message")
+		if err != nil {
+			return nil, err
+		}
+		return c.Error(errors.New(message)), nil
+	})
+}
@@ -0,0 +1,112 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_A_Chain_Can_Be_Built_From_Registries tests constructing and running
+// a chain purely through the registries, combining built-in and chain-specific
+// registrations.
+func Test_If_A_Chain_Can_Be_Built_From_Registries(t *testing.T) {
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+		Secret    *corev1.Secret
+	}
+	labeled := []string{}
+	c := &Chain{Resources: &res, Registry: NewRegistry()}
+	c.Registry.RegisterPredicate("secret-exists", func(c *Chain, params map[string]string) (*predicate, error) {
+		return c.LookupPredicate("Exists", map[string]string{"field": "Secret"})
+	})
+	c.Registry.RegisterAction("Record", func(c *Chain, params map[string]string) (Action, error) {
+		label, err := requiredParam(params, "label")
+		if err != nil {
+			return nil, err
+		}
+		return func(context.Context) { labeled = append(labeled, label) }, nil
+	})
+
+	configMapExists, err := c.LookupPredicate("Exists", map[string]string{"field": "ConfigMap"})
+	assert.NoError(t, err)
+	noSecret, err := CompileExpression("!secret-exists", c)
+	assert.NoError(t, err)
+	record, err := c.LookupAction("Record", map[string]string{"label": "configmap"})
+	assert.NoError(t, err)
+	recordMissing, err := c.LookupAction("Record", map[string]string{"label": "no-secret"})
+	assert.NoError(t, err)
+	requeue, err := c.LookupAction("Requeue", map[string]string{"after": "30s"})
+	assert.NoError(t, err)
+
+	cl := fake.NewClientBuilder().WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	c.InitializeChain(cl, &res, []Rule{
+		{When: configMapExists, Do: record},
+		{When: noSecret, Do: Sequential(recordMissing, requeue)},
+	})
+	result, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"configmap", "no-secret"}, labeled, "registered actions did not run")
+	assert.Equal(t, 30*time.Second, result.RequeueAfter, "Requeue action was not applied")
+}
+
+// Test_If_Registry_Lookups_Report_Errors tests the errors returned for unknown
+// names, bad parameters, fields and templates, and duplicate registrations.
+func Test_If_Registry_Lookups_Report_Errors(t *testing.T) {
+	var res struct {
+		ConfigMap  *corev1.ConfigMap
+		ConfigMaps []*corev1.ConfigMap
+		Label      string
+	}
+	c := &Chain{Resources: &res}
+	_, err := c.LookupPredicate("NoSuchPredicate", nil)
+	assert.EqualError(t, err, `unknown predicate "NoSuchPredicate"`)
+	_, err = c.LookupAction("NoSuchAction", nil)
+	assert.EqualError(t, err, `unknown action "NoSuchAction"`)
+	_, err = c.LookupPredicate("Exists", nil)
+	assert.EqualError(t, err, `predicate "Exists": missing parameter "field"`)
+	_, err = c.LookupPredicate("Exists", map[string]string{"field": "Nope"})
+	assert.EqualError(t, err, `predicate "Exists": unknown resource field "Nope"`)
+	_, err = c.LookupPredicate("Exists", map[string]string{"field": "ConfigMaps"})
+	assert.NoError(t, err, "Exists rejected a resource slice field")
+	_, err = c.LookupPredicate("Exists", map[string]string{"field": "Label"})
+	assert.EqualError(t, err, `predicate "Exists": parameter "field": Resource fields must be pointers to structs`)
+	_, err = c.LookupPredicate("GenerationChanged", map[string]string{"field": "ConfigMaps"})
+	assert.EqualError(t, err, `predicate "GenerationChanged": parameter "field": Resource fields must be pointers to structs`)
+	_, err = c.LookupPredicate("ConditionTrue", map[string]string{"field": "ConfigMaps", "type": "Ready"})
+	assert.EqualError(t, err, `predicate "ConditionTrue": parameter "field": Resource fields must be pointers to structs`)
+	_, err = c.LookupAction("Event", map[string]string{"reason": "Synced", "message": "synced {{.Nope"})
+	assert.ErrorContains(t, err, `action "Event": parameter "message": template: message:`)
+	_, err = c.LookupAction("Requeue", map[string]string{"after": "soon"})
+	assert.Error(t, err)
+	assert.Panics(t, func() {
+		RegisterAction("Requeue", func(*Chain, map[string]string) (Action, error) { return nil, nil })
+	})
+	assert.Contains(t, DefaultRegistry.ActionNames(), "Requeue")
+	assert.Contains(t, DefaultRegistry.PredicateNames(), "Exists")
+}
+
+// Test_If_ResolvePredicate_Shares_Predicates tests that resolving the same
+// name twice yields the same predicate, so it is evaluated once per Run.
+func Test_If_ResolvePredicate_Shares_Predicates(t *testing.T) {
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+	}
+	c := &Chain{Resources: &res, Registry: NewRegistry()}
+	c.Registry.RegisterPredicate("has-config", func(c *Chain, params map[string]string) (*predicate, error) {
+		return c.Exists(&res.ConfigMap), nil
+	})
+	p1, err := c.ResolvePredicate("has-config")
+	assert.NoError(t, err)
+	p2, err := c.ResolvePredicate("has-config")
+	assert.NoError(t, err)
+	assert.Same(t, p1, p2, "resolved predicates were not shared")
+}
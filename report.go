@@ -0,0 +1,194 @@
+package operchain
+
+import (
+	"context"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// RunReport describes a single run of a chain. It holds only plain data, so it
+// can be kept after the run and serialized to JSON, e.g. for support bundles.
+type RunReport struct {
+	// Request is the request the chain ran for.
+	Request ctrl.Request `json:"request"`
+	// Chain is the name of the chain, if any.
+	Chain string `json:"chain,omitempty"`
+	// RunID is the ID of the run, as in its logs.
+	RunID string `json:"runID"`
+	// Kind is the kind of the primary resource of the run, if known.
+	Kind string `json:"kind,omitempty"`
+	// RuleSet is the key of the chain's VersionedRules run instead of its
+	// Rules, if any.
+	RuleSet string `json:"ruleSet,omitempty"`
+	// Predicates is the value of every predicate evaluated during the run,
+	// keyed by name; see Cache.Snapshot for how anonymous predicates are
+	// identified.
+	Predicates map[string]bool `json:"predicates"`
+	// Trace is the trace of predicate evaluations, if tracing was enabled.
+	Trace []TraceEntry `json:"trace,omitempty"`
+	// Operations are the writes performed by actions during the run, in
+	// order.
+	Operations []Operation `json:"operations,omitempty"`
+	// Audit is the audit trail of the writes issued through the chain's
+	// Client during the run, in order, including failed ones.
+	Audit []AuditEntry `json:"audit,omitempty"`
+	// DryRun are the writes intercepted during the run by the chain's dry-run
+	// mode, in order, as they would have been issued.
+	DryRun []AuditEntry `json:"dryRun,omitempty"`
+	// Fired are the rules whose actions ran, in order.
+	Fired []string `json:"fired,omitempty"`
+	// Rules are the reports of the rules evaluated, in order; see Rule.
+	Rules []RuleReport `json:"rules,omitempty"`
+	// Simulated is true if the report is of Simulate, whose rules do not
+	// fire; see RuleReport.WouldFire.
+	Simulated bool `json:"simulated,omitempty"`
+	// Skipped are the rules whose predicates were true but which were
+	// skipped, e.g. by an open CircuitBreaker, in order.
+	Skipped []SkippedRule `json:"skipped,omitempty"`
+	// Stopped is true if a rule stopped the chain.
+	Stopped bool `json:"stopped,omitempty"`
+	// Result is the result of the run.
+	Result ctrl.Result `json:"result"`
+	// RequeueReason is the reason of the requeue interval of Result, the
+	// shortest requested during the run, if any.
+	RequeueReason string `json:"requeueReason,omitempty"`
+	// Err is the error the run ended with, if any.
+	Err error `json:"-"`
+	// Error is the message of Err, for serialization.
+	Error string `json:"error,omitempty"`
+}
+
+// SkippedRule records a rule skipped during a run.
+type SkippedRule struct {
+	// Rule is the name of the rule.
+	Rule string `json:"rule"`
+	// Reason is why it was skipped, e.g. SkipReasonCircuitOpen.
+	Reason string `json:"reason"`
+}
+
+// Operation records a write to an object performed during a run.
+type Operation struct {
+	// Kind is the kind of the object.
+	Kind string `json:"kind"`
+	// Namespace is the namespace of the object.
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the name of the object.
+	Name string `json:"name"`
+	// Result is what the write did, e.g. "created" or "unchanged".
+	Result controllerutil.OperationResult `json:"result"`
+	// Diff describes what the write changed, e.g. how the object had
+	// drifted from its desired state, if known.
+	Diff string `json:"diff,omitempty"`
+	// ObjectDiff is the diff from the live object to the object written, as
+	// rendered by ObjectDiff, if the chain rendered it; see Chain.RenderDiffs.
+	ObjectDiff string `json:"objectDiff,omitempty"`
+}
+
+// Operation results of writes beyond those of controllerutil.
+const (
+	// OperationResultDeleted means that the object was deleted.
+	OperationResultDeleted controllerutil.OperationResult = "deleted"
+	// OperationResultApplied means that the object was server-side applied.
+	OperationResultApplied controllerutil.OperationResult = "applied"
+	// OperationResultWouldDelete means that the object would have been
+	// deleted, but the action was a dry run.
+	OperationResultWouldDelete controllerutil.OperationResult = "would-delete"
+)
+
+// LastReport returns the report of the most recent run, or nil if the chain
+// has not run.
+func (c *Chain) LastReport() *RunReport {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.report
+}
+
+// finishReport records the report of the current run and returns it.
+func (c *Chain) finishReport(result ctrl.Result, err error) *RunReport {
+	c.runFinished()
+	report := &RunReport{
+		Request:    c.req,
+		Chain:      c.Name,
+		RunID:      c.runLog.id,
+		Kind:       c.kind,
+		RuleSet:    c.ruleSet,
+		Predicates: c.cache.Snapshot(),
+		Result:     result,
+		Err:        err,
+	}
+	if c.Trace {
+		report.Trace = c.cache.Trace()
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	c.lock.Lock()
+	report.Operations = c.operations
+	report.Audit = c.audit
+	report.DryRun = c.dryRun
+	report.Skipped = c.skipped
+	report.Fired = c.fired
+	report.Rules = c.ruleReports
+	report.Stopped = c.stop
+	if result.RequeueAfter > 0 && result.RequeueAfter == c.interval {
+		report.RequeueReason = c.requeueReason
+	}
+	report.Simulated = c.simulating
+	if c.simulating {
+		// A simulation is not a Run of the chain as far as its history and
+		// health are concerned.
+		c.lock.Unlock()
+		return report
+	}
+	c.report = report
+	c.recordHistory(report)
+	c.lock.Unlock()
+	c.recordHealth(err)
+	c.recordFailureStreak(c.ctx, err)
+	c.finishAudit(c.ctx, report.Audit)
+	return report
+}
+
+// recordOperation records a write to the object in the report of the run.
+func (c *Chain) recordOperation(obj client.Object, result controllerutil.OperationResult) {
+	c.recordDiff(obj, result, "")
+}
+
+// recordDiff records a write to the object that made the described change in
+// the report of the run.
+func (c *Chain) recordDiff(obj client.Object, result controllerutil.OperationResult, diff string) {
+	c.recordWrite(obj, result, diff, nil)
+}
+
+// recordWrite records a write to the object that made the described change,
+// with its rendered diff if any, in the report of the run.
+func (c *Chain) recordWrite(obj client.Object, result controllerutil.OperationResult, diff string, rendered *ObjectDiff) {
+	kind := ""
+	if gvk, err := c.gvkFor(obj); err == nil {
+		kind = gvk.Kind
+	}
+	op := Operation{
+		Kind:      kind,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Result:    result,
+		Diff:      diff,
+	}
+	if rendered != nil {
+		op.ObjectDiff = rendered.String()
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.operations = append(c.operations, op)
+}
+
+// DebugDump returns an action that logs the value of every predicate evaluated
+// so far in the current run, at verbosity level 1.
+func (c *Chain) DebugDump() Action {
+	return func(ctx context.Context) {
+		log.FromContext(ctx).V(1).Info("predicate cache", "request", c.req, "predicates", c.cache.Snapshot())
+	}
+}
@@ -0,0 +1,59 @@
+package operchain
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Test_If_RunReport_Snapshot_Matches_The_Trace tests that the report of a run
+// holds the value of every predicate in a nested tree, matching the trace, and
+// serializes to JSON.
+func Test_If_RunReport_Snapshot_Matches_The_Trace(t *testing.T) {
+	c := &Chain{Trace: true}
+	ready := Named("ready", True())
+	paused := Named("paused", False())
+	c.InitializeChain(fake.NewClientBuilder().Build(), &struct{}{}, []Rule{
+		{When: Named("active", And(ready, Not(paused))), Do: c.Error(assert.AnError)},
+	})
+	report, err := c.RunWithReport(context.Background(), ctrl.Request{})
+	assert.Equal(t, assert.AnError, err)
+	assert.Same(t, report, c.LastReport(), "LastReport did not return the report")
+	assert.Equal(t, map[string]bool{"ready": true, "paused": false, "#2": true, "active": true}, report.Predicates)
+	assert.Len(t, report.Trace, 4, "trace was not recorded")
+	for i, entry := range report.Trace {
+		key := entry.Name
+		if key == "" {
+			key = "#2"
+		}
+		assert.Equal(t, entry.Value, report.Predicates[key], "snapshot of entry %d did not match the trace", i)
+	}
+	data, err := json.Marshal(report)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"predicates":{"#2":true,"active":true,"paused":false,"ready":true}`)
+	assert.Contains(t, string(data), `"error":"assert.AnError general error for testing"`)
+}
+
+// Test_If_DebugDump_Logs_The_Snapshot tests that DebugDump logs the predicate
+// values at verbosity 1.
+func Test_If_DebugDump_Logs_The_Snapshot(t *testing.T) {
+	var logged []string
+	logger := funcr.New(func(prefix, args string) {
+		logged = append(logged, args)
+	}, funcr.Options{Verbosity: 1})
+	c := &Chain{}
+	c.InitializeChain(fake.NewClientBuilder().Build(), &struct{}{}, []Rule{
+		{When: Named("ready", True()), Do: c.DebugDump()},
+	})
+	_, err := c.Run(log.IntoContext(context.Background(), logger), ctrl.Request{})
+	assert.NoError(t, err)
+	if assert.Len(t, logged, 1, "snapshot was not logged") {
+		assert.Contains(t, logged[0], `"predicates"={"ready"=true}`)
+	}
+}
@@ -0,0 +1,170 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// retryOptions holds the options of Retry.
+type retryOptions struct {
+	retryable func(error) bool
+}
+
+// RetryOption configures Retry.
+type RetryOption func(o *retryOptions)
+
+// RetryIf sets which errors Retry retries. By default, it retries conflicts,
+// server timeouts, and throttling, as reported by apierrors.IsConflict,
+// IsServerTimeout, and IsTooManyRequests.
+func RetryIf(retryable func(error) bool) RetryOption {
+	return func(o *retryOptions) {
+		o.retryable = retryable
+	}
+}
+
+// isTransient returns true for the errors Retry retries by default.
+func isTransient(err error) bool {
+	return apierrors.IsConflict(err) || apierrors.IsServerTimeout(err) || apierrors.IsTooManyRequests(err)
+}
+
+// Retry returns an action that runs fn, and while it fails with a retryable
+// error, runs it again after the next delay of backoff, up to attempts times in
+// all, within the same Run. It gives up early, without waiting, if the delay
+// would pass the deadline of the action's context. The last error becomes the
+// error of the operchain.
+func (c *Chain) Retry(attempts int, backoff wait.Backoff, fn ActionE, opts ...RetryOption) Action {
+	return c.Try(c.RetryE(attempts, backoff, fn, opts...))
+}
+
+// RetryE is like Retry, but returns the error.
+func (c *Chain) RetryE(attempts int, backoff wait.Backoff, fn ActionE, opts ...RetryOption) ActionE {
+	o := &retryOptions{retryable: isTransient}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(ctx context.Context) error {
+		b := backoff
+		var err error
+		for attempt := 1; ; attempt++ {
+			if err = fn(ctx); err == nil || attempt >= attempts || !o.retryable(err) {
+				return err
+			}
+			delay := b.Step()
+			if delay <= 0 {
+				continue
+			}
+			if deadline, ok := ctx.Deadline(); ok && c.now().Add(delay).After(deadline) {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return err
+			case <-c.after(delay):
+			}
+		}
+	}
+}
+
+// retryOnConflict runs fn, and while it fails with a conflict, runs it again,
+// as retry.RetryOnConflict does with retry.DefaultRetry, but waiting on the
+// chain's Clock.
+func (c *Chain) retryOnConflict(ctx context.Context, fn func() error) error {
+	return c.RetryE(retry.DefaultRetry.Steps, retry.DefaultRetry, func(context.Context) error {
+		return fn()
+	}, RetryIf(apierrors.IsConflict))(ctx)
+}
+
+// retryOnConflict is Chain.retryOnConflict for code given no chain, such as
+// StateStores, waiting on the Clock of the chain running the action of ctx.
+// Given no chain, it is retry.RetryOnConflict.
+func retryOnConflict(ctx context.Context, fn func() error) error {
+	if c := chainFrom(ctx); c != nil {
+		return c.retryOnConflict(ctx, fn)
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, fn)
+}
+
+// RetryOnConflict returns an action that runs fn, and while it fails with a
+// conflict, reads the object in the given resource field again, so that
+// predicates evaluated later see the fresh copy, and runs fn again, as
+// retry.RetryOnConflict does with retry.DefaultRetry, but waiting on the
+// chain's Clock. fn should work on the object in the field, not a copy taken
+// before it runs.
+func (c *Chain) RetryOnConflict(fieldPtr interface{}, fn ActionE) Action {
+	return c.Try(c.RetryOnConflictE(fieldPtr, fn))
+}
+
+// RetryOnConflictE is like RetryOnConflict, but returns the error.
+func (c *Chain) RetryOnConflictE(fieldPtr interface{}, fn ActionE) ActionE {
+	checkField(fieldPtr)
+	return func(ctx context.Context) error {
+		reload := false
+		return c.retryOnConflict(ctx, func() error {
+			if reload {
+				if err := c.reload(ctx, fieldPtr); err != nil {
+					return err
+				}
+			}
+			reload = true
+			return fn(ctx)
+		})
+	}
+}
+
+// reload reads the object in the resource field again, and discards the values
+// of the predicates evaluated so far in the run.
+func (c *Chain) reload(ctx context.Context, fieldPtr interface{}) error {
+	obj := objectAt(fieldPtr)
+	if obj == nil {
+		return nil
+	}
+	fresh := obj.DeepCopyObject().(client.Object)
+	if err := c.reader().Get(ctx, client.ObjectKeyFromObject(obj), fresh); err != nil {
+		return fmt.Errorf("reload %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	reflect.ValueOf(fieldPtr).Elem().Set(reflect.ValueOf(fresh))
+	c.invalidateRun()
+	return nil
+}
+
+// RetryAfterError is an error that asks to be retried no sooner than After,
+// e.g. one built from the Retry-After header of an HTTP response of an
+// external service.
+type RetryAfterError struct {
+	// After is how long to wait before retrying.
+	After time.Duration
+	// Err is the error.
+	Err error
+}
+
+// Error returns the error and when to retry.
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%s (retry after %s)", e.Err, e.After)
+}
+
+// Unwrap returns the error.
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// RequeueFromError returns how long to wait before retrying after err, if err
+// or an error it wraps says so: an API error suggesting a client delay, such
+// as TooManyRequests with retryAfterSeconds, or a RetryAfterError.
+func RequeueFromError(err error) (time.Duration, bool) {
+	var retryAfter *RetryAfterError
+	if errors.As(err, &retryAfter) && retryAfter.After > 0 {
+		return retryAfter.After, true
+	}
+	if seconds, ok := apierrors.SuggestsClientDelay(err); ok && seconds > 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	return 0, false
+}
@@ -0,0 +1,179 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Test_If_Retry_Retries_Transient_Errors tests that Retry runs an action again
+// until it succeeds, and surfaces a non-retryable error immediately.
+func Test_If_Retry_Retries_Transient_Errors(t *testing.T) {
+	c := &Chain{}
+	backoff := wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 5}
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "demo", assert.AnError)
+	calls := 0
+	flaky := func(context.Context) error {
+		if calls++; calls < 3 {
+			return conflict
+		}
+		return nil
+	}
+	assert.NoError(t, c.RetryE(5, backoff, flaky)(context.Background()), "retried action failed")
+	assert.Equal(t, 3, calls, "action was not retried until it succeeded")
+
+	calls = 0
+	assert.Equal(t, conflict, c.RetryE(2, backoff, flaky)(context.Background()), "last error was not returned")
+	assert.Equal(t, 2, calls, "attempts were not limited")
+
+	calls = 0
+	failing := func(context.Context) error {
+		calls++
+		return assert.AnError
+	}
+	assert.Equal(t, assert.AnError, c.RetryE(5, backoff, failing)(context.Background()), "non-retryable error was not returned")
+	assert.Equal(t, 1, calls, "non-retryable error was retried")
+	calls = 0
+	_ = c.RetryE(5, backoff, failing, RetryIf(func(error) bool { return true }))(context.Background())
+	assert.Equal(t, 5, calls, "RetryIf was ignored")
+}
+
+// Test_If_Retry_Respects_The_Deadline tests that Retry gives up instead of
+// waiting past the deadline of its context.
+func Test_If_Retry_Respects_The_Deadline(t *testing.T) {
+	clock := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := &Chain{Clock: clock}
+	ctx, cancel := context.WithDeadline(context.Background(), clock.Now().Add(time.Minute))
+	defer cancel()
+	calls := 0
+	err := c.RetryE(5, wait.Backoff{Duration: time.Hour}, func(context.Context) error {
+		calls++
+		return apierrors.NewTooManyRequests("slow down", 1)
+	})(ctx)
+	assert.True(t, apierrors.IsTooManyRequests(err), "last error was not returned")
+	assert.Equal(t, 1, calls, "action was retried past the deadline")
+	assert.False(t, clock.HasWaiters(), "Retry waited past the deadline")
+}
+
+// Test_If_RetryOnConflict_Retries_With_A_Fresh_Copy tests that RetryOnConflict
+// reloads the resource field after a conflict, so that the retried update
+// succeeds, and that predicates see the fresh copy.
+func Test_If_RetryOnConflict_Retries_With_A_Fresh_Copy(t *testing.T) {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	cl := fake.NewClientBuilder().WithObjects(cm).Build()
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+	}
+	c := &Chain{Client: cl, Resources: &res, cache: pcache.New()}
+	assert.NoError(t, cl.Get(context.Background(), client.ObjectKeyFromObject(cm), cm))
+	res.ConfigMap = cm.DeepCopy()
+	// Someone else updates the object, so the loaded copy is stale.
+	cm.Data = map[string]string{"other": "value"}
+	assert.NoError(t, cl.Update(context.Background(), cm))
+	hasOther := Predicate(func() bool { return res.ConfigMap.Data["other"] == "value" })
+	assert.False(t, hasOther.Eval(c.cache), "stale copy had the other change")
+
+	attempts := 0
+	err := c.RetryOnConflictE(&res.ConfigMap, func(ctx context.Context) error {
+		attempts++
+		if res.ConfigMap.Data == nil {
+			res.ConfigMap.Data = map[string]string{}
+		}
+		res.ConfigMap.Data["mine"] = "value"
+		return c.Update(ctx, res.ConfigMap)
+	})(context.Background())
+	assert.NoError(t, err, "update was not retried with a fresh copy")
+	assert.Equal(t, 2, attempts, "update was not retried once")
+	assert.True(t, hasOther.Eval(c.cache), "predicate did not see the fresh copy")
+	assert.NoError(t, cl.Get(context.Background(), client.ObjectKeyFromObject(cm), cm))
+	assert.Equal(t, map[string]string{"other": "value", "mine": "value"}, cm.Data, "changes were lost")
+}
+
+// Test_If_Conflicts_Are_Retried_On_A_Fake_Clock tests that conflicts are
+// retried after waiting on the chain's Clock, and give up after the steps of
+// retry.DefaultRetry.
+func Test_If_Conflicts_Are_Retried_On_A_Fake_Clock(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := &Chain{Clock: fakeClock}
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "demo", assert.AnError)
+	attempts := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- c.retryOnConflict(context.Background(), func() error {
+			attempts++
+			return conflict
+		})
+	}()
+	steps := 0
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case err := <-done:
+			assert.True(t, apierrors.IsConflict(err), "the conflict was not returned")
+			assert.Equal(t, 5, attempts, "the conflict was not retried as by retry.DefaultRetry")
+			assert.Equal(t, 4, steps, "the retries did not wait on the fake clock")
+			return
+		case <-timeout:
+			t.Fatal("the retries did not finish")
+		default:
+		}
+		if fakeClock.HasWaiters() {
+			fakeClock.Step(time.Second)
+			steps++
+		}
+		runtime.Gosched()
+	}
+}
+
+// Test_If_RequeueFromError_Finds_The_Suggested_Delay tests that
+// RequeueFromError reads the delay of throttling API errors and of wrapped
+// RetryAfterErrors, and nothing from other errors.
+func Test_If_RequeueFromError_Finds_The_Suggested_Delay(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err   error
+		delay time.Duration
+		ok    bool
+	}{
+		"throttled":         {err: apierrors.NewTooManyRequests("slow down", 7), delay: 7 * time.Second, ok: true},
+		"wrapped":           {err: fmt.Errorf("create demo: %w", apierrors.NewTooManyRequests("slow down", 3)), delay: 3 * time.Second, ok: true},
+		"throttled no hint": {err: apierrors.NewTooManyRequests("slow down", 0)},
+		"retry after":       {err: fmt.Errorf("call bucket API: %w", &RetryAfterError{After: 90 * time.Second, Err: assert.AnError}), delay: 90 * time.Second, ok: true},
+		"other":             {err: assert.AnError},
+	} {
+		delay, ok := RequeueFromError(tc.err)
+		assert.Equal(t, tc.ok, ok, "wrong detection for %s", name)
+		assert.Equal(t, tc.delay, delay, "wrong delay for %s", name)
+	}
+}
+
+// Test_If_HonorRetryAfter_Requeues_Without_Error tests that a Run failing with
+// a throttling error requeues after the suggested delay and returns no error
+// when the chain honors Retry-After, and fails as usual otherwise.
+func Test_If_HonorRetryAfter_Requeues_Without_Error(t *testing.T) {
+	var res struct{}
+	c := &Chain{Resources: &res}
+	c.Rules = []Rule{{Do: c.Error(apierrors.NewTooManyRequests("slow down", 30))}}
+	_, err := c.Run(context.Background(), ctrl.Request{})
+	assert.Error(t, err, "throttling error was dropped without HonorRetryAfter")
+
+	c.HonorRetryAfter = true
+	result, err := c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err, "throttling error was returned")
+	assert.Equal(t, ctrl.Result{RequeueAfter: 30 * time.Second}, result, "Run did not requeue after the suggested delay")
+	assert.Error(t, c.LastReport().Err, "throttling error was not kept in the report")
+}
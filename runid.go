@@ -0,0 +1,57 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+)
+
+// RunIDAnnotation is the annotation of the events carrying the ID of the Run
+// that recorded them, with EventRunIDAnnotation.
+const RunIDAnnotation = "operchain.smxlong.github.io/run-id"
+
+// EventRunID says how events recorded by a Run carry its ID.
+type EventRunID int
+
+const (
+	// EventRunIDNone records events without the ID of the Run.
+	EventRunIDNone EventRunID = iota
+	// EventRunIDAnnotation records events with the ID of the Run in the
+	// RunIDAnnotation annotation.
+	EventRunIDAnnotation
+	// EventRunIDMessage appends the ID of the Run to the message of events.
+	EventRunIDMessage
+)
+
+// RunError is the error of a Run of a chain that wraps its errors with the ID
+// of the Run, as WrapErrorsWithRunID asks.
+type RunError struct {
+	// RunID is the ID of the Run.
+	RunID string
+	// Err is the error of the Run.
+	Err error
+}
+
+// Error returns the ID of the Run and the error.
+func (e *RunError) Error() string {
+	return fmt.Sprintf("run %s: %s", e.RunID, e.Err)
+}
+
+// Unwrap returns the error of the Run.
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// RunIDFrom returns the ID of the Run of the chain running an action with the
+// given context, or an empty string outside of a Run.
+func RunIDFrom(ctx context.Context) string {
+	l, _ := ctx.Value(runLogKey{}).(runLog)
+	return l.id
+}
+
+// newRunID returns the ID of a Run of a chain not run by another chain: eight
+// random hexadecimal digits, enough to tell apart the Runs of an object
+// interleaved in logs.
+func newRunID() string {
+	return fmt.Sprintf("%08x", rand.Uint32())
+}
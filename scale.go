@@ -0,0 +1,88 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// ScaleOf returns the scale subresource of the object in the given resource
+// field, e.g. a Deployment or any custom resource with a scale subresource, or
+// nil if the field is not loaded. It is read at most once per Run, so
+// predicates and the replicas function of Scale may call it freely; Scale keeps
+// it up to date.
+func (c *Chain) ScaleOf(fieldPtr interface{}) (*autoscalingv1.Scale, error) {
+	checkField(fieldPtr)
+	obj := objectAt(fieldPtr)
+	if obj == nil {
+		return nil, nil
+	}
+	c.lock.Lock()
+	scale, ok := c.scales[fieldPtr]
+	c.lock.Unlock()
+	if ok {
+		return scale, nil
+	}
+	scale = &autoscalingv1.Scale{}
+	if err := c.SubResource("scale").Get(c.ctx, obj, scale); err != nil {
+		return nil, fmt.Errorf("get scale of %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	c.setScale(fieldPtr, scale)
+	return scale, nil
+}
+
+// setScale records the scale subresource of the object in the resource field
+// for the rest of the Run.
+func (c *Chain) setScale(fieldPtr interface{}, scale *autoscalingv1.Scale) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.scales == nil {
+		c.scales = map[interface{}]*autoscalingv1.Scale{}
+	}
+	c.scales[fieldPtr] = scale
+}
+
+// Scale returns an action that sets the replica count of the object in the
+// given resource field to the result of replicas through its scale
+// subresource, so that it works for any scalable kind and touches no other
+// field. It does nothing if the field is not loaded or the object already has
+// that many replicas. A change is recorded in the run report and as a Scaled
+// event on the primary resource, and predicates evaluated later in the Run see
+// it.
+func (c *Chain) Scale(fieldPtr interface{}, replicas func() int32) Action {
+	return writes(c.Try(c.ScaleE(fieldPtr, replicas)), fieldTarget(fieldPtr, "spec/replicas"))
+}
+
+// ScaleE is like Scale, but returns the error.
+func (c *Chain) ScaleE(fieldPtr interface{}, replicas func() int32) ActionE {
+	checkField(fieldPtr)
+	return func(ctx context.Context) error {
+		scale, err := c.ScaleOf(fieldPtr)
+		if err != nil || scale == nil {
+			return err
+		}
+		obj := objectAt(fieldPtr)
+		from, to := scale.Spec.Replicas, replicas()
+		if from == to {
+			c.recordOperation(obj, controllerutil.OperationResultNone)
+			return nil
+		}
+		updated := scale.DeepCopy()
+		updated.Spec.Replicas = to
+		if err := c.SubResource("scale").Update(ctx, obj, client.WithSubResourceBody(updated)); err != nil {
+			return fmt.Errorf("scale %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+		}
+		c.setScale(fieldPtr, updated)
+		c.invalidateRun()
+		transition := fmt.Sprintf("replicas: %d -> %d", from, to)
+		c.recordDiff(obj, controllerutil.OperationResultUpdated, transition)
+		if primary := c.primary(); primary != nil {
+			c.event(primary, corev1.EventTypeNormal, "Scaled", fmt.Sprintf("Scaled %s from %d to %d replicas", c.describe(obj), from, to))
+		}
+		return nil
+	}
+}
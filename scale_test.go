@@ -0,0 +1,82 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// Test_If_Scale_Writes_Through_The_Scale_Subresource tests that Scale scales
+// up and down through the scale subresource, records the transitions, and does
+// nothing at the desired count.
+func Test_If_Scale_Writes_Through_The_Scale_Subresource(t *testing.T) {
+	// The fake client does not serve the scale subresource, so serve it from
+	// the Deployment's replicas as the API server would.
+	updates := 0
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}, Spec: appsv1.DeploymentSpec{Replicas: ptr.To(int32(1))}},
+	).WithInterceptorFuncs(interceptor.Funcs{
+		SubResourceGet: func(ctx context.Context, cl client.Client, subResource string, obj, sub client.Object, opts ...client.SubResourceGetOption) error {
+			d := &appsv1.Deployment{}
+			if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), d); err != nil {
+				return err
+			}
+			sub.(*autoscalingv1.Scale).Spec.Replicas = *d.Spec.Replicas
+			return nil
+		},
+		SubResourceUpdate: func(ctx context.Context, cl client.Client, subResource string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+			updates++
+			d := &appsv1.Deployment{}
+			if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), d); err != nil {
+				return err
+			}
+			body := (&client.SubResourceUpdateOptions{}).ApplyOptions(opts).SubResourceBody
+			d.Spec.Replicas = ptr.To(body.(*autoscalingv1.Scale).Spec.Replicas)
+			return cl.Update(ctx, d)
+		},
+	}).Build()
+	var res struct {
+		Widget     *Widget
+		Deployment *appsv1.Deployment
+	}
+	recorder := record.NewFakeRecorder(10)
+	desired := int32(3)
+	var seen []int32
+	c := &Chain{Recorder: recorder}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: c.Scale(&res.Deployment, func() int32 {
+			scale, err := c.ScaleOf(&res.Deployment)
+			assert.NoError(t, err, "ScaleOf returned an error")
+			seen = append(seen, scale.Spec.Replicas)
+			return desired
+		})},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	run := func() *RunReport {
+		report, err := c.RunWithReport(context.Background(), req)
+		assert.NoError(t, err, "Run returned an error")
+		return report
+	}
+	assert.Equal(t, "replicas: 1 -> 3", run().Operations[0].Diff, "scale-up was not reported")
+	assert.Equal(t, "Normal Scaled Scaled Deployment default/demo from 1 to 3 replicas", <-recorder.Events, "scale-up event was not recorded")
+	run()
+	assert.Equal(t, 1, updates, "scale at the desired count was written")
+	desired = 2
+	assert.Equal(t, "replicas: 3 -> 2", run().Operations[0].Diff, "scale-down was not reported")
+	assert.Equal(t, []int32{1, 3, 3}, seen, "current count was not available")
+	d := &appsv1.Deployment{}
+	assert.NoError(t, cl.Get(context.Background(), req.NamespacedName, d))
+	assert.Equal(t, int32(2), *d.Spec.Replicas, "deployment was not scaled")
+}
@@ -0,0 +1,100 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Simulate loads the resources of the request as a Run does and evaluates the
+// predicate of each rule, but runs no action, recording in the report which
+// rules would fire (see RuleReport.WouldFire). Unlike a dry run, no action is
+// invoked at all, so nothing is written, not even through the dry-run
+// client, and rules whose predicates depend on what earlier actions would do
+// see the resources as loaded. Predicates are cached as in a Run. A
+// simulation does not change the chain's LastReport, history, or health, and
+// runs no OnSuccess hooks.
+func (c *Chain) Simulate(ctx context.Context, req ctrl.Request) (*RunReport, error) {
+	c.reconcileLock.Lock()
+	defer c.reconcileLock.Unlock()
+	c.simulating = true
+	defer func() {
+		c.simulating = false
+	}()
+	return c.RunWithReport(ctx, req)
+}
+
+// SimulationSummary aggregates the simulations of SimulateAll.
+type SimulationSummary struct {
+	// Objects is the number of primary resources simulated.
+	Objects int `json:"objects"`
+	// Failed is the number of simulations that failed, e.g. to load
+	// resources.
+	Failed int `json:"failed,omitempty"`
+	// WouldFire is the number of primary resources each rule would fire for,
+	// by rule.
+	WouldFire map[string]int `json:"wouldFire,omitempty"`
+	// Reports are the reports of the simulations, in the order the primary
+	// resources were listed.
+	Reports []*RunReport `json:"reports,omitempty"`
+}
+
+// SimulateAll lists every primary resource with the reader and the options,
+// e.g. client.InNamespace, and Simulates the chain for each of them, e.g. to
+// see which rules a change of the chain would fire across a cluster. The
+// resources of the simulations are loaded by the chain's Client. A failed
+// simulation is counted in the summary; only a failure to list is an error.
+func (c *Chain) SimulateAll(ctx context.Context, reader client.Reader, opts ...client.ListOption) (*SimulationSummary, error) {
+	res, fields := c.primaryFields()
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("simulate all: chain has no primary resource")
+	}
+	summary := &SimulationSummary{WouldFire: map[string]int{}}
+	for _, i := range fields {
+		field := res.Field(i)
+		gvk, err := c.gvkFor(reflect.New(field.Type().Elem()).Interface().(client.Object))
+		if err != nil {
+			return nil, fmt.Errorf("simulate all: %w", err)
+		}
+		obj, err := c.Scheme().New(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err != nil {
+			return nil, fmt.Errorf("simulate all: %w", err)
+		}
+		list := obj.(client.ObjectList)
+		if err := reader.List(ctx, list, opts...); err != nil {
+			return nil, fmt.Errorf("simulate all: list %s: %w", gvk.Kind, err)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, fmt.Errorf("simulate all: %w", err)
+		}
+		kindCtx := ctx
+		if len(fields) > 1 {
+			kindCtx = WithKind(ctx, gvk.Kind)
+		}
+		for _, item := range items {
+			o, err := meta.Accessor(item)
+			if err != nil {
+				return nil, fmt.Errorf("simulate all: %w", err)
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: o.GetNamespace(), Name: o.GetName()}}
+			report, err := c.Simulate(kindCtx, req)
+			summary.Objects++
+			if err != nil {
+				summary.Failed++
+			}
+			for _, rule := range report.Rules {
+				if rule.WouldFire {
+					summary.WouldFire[rule.Name]++
+				}
+			}
+			summary.Reports = append(summary.Reports, report)
+		}
+	}
+	return summary, nil
+}
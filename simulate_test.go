@@ -0,0 +1,123 @@
+package operchain
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// simulateChain returns a chain creating the Secret of each ConfigMap, whose
+// actions count their calls in invoked, a client counting its writes in
+// writes, and the number of evaluations of a predicate shared by two rules.
+func simulateChain(objs ...client.Object) (c *Chain, cl client.Client, invoked, writes, evaluations *atomic.Int32) {
+	invoked, writes, evaluations = &atomic.Int32{}, &atomic.Int32{}, &atomic.Int32{}
+	count := func() { writes.Add(1) }
+	cl = fake.NewClientBuilder().WithObjects(objs...).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			count()
+			return c.Create(ctx, obj, opts...)
+		},
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			count()
+			return c.Update(ctx, obj, opts...)
+		},
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			count()
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			count()
+			return c.Delete(ctx, obj, opts...)
+		},
+	}).Build()
+	var res struct {
+		App    *corev1.ConfigMap `operchain:"primary"`
+		Secret *corev1.Secret
+	}
+	c = &Chain{}
+	shared := Named("appExists", Predicate(func() bool {
+		evaluations.Add(1)
+		return res.App != nil
+	}))
+	c.InitializeChain(cl, &res, []Rule{
+		{Name: "never", When: Named("never", False()), Do: func(context.Context) { invoked.Add(1) }},
+		{
+			Name: "create secret",
+			When: And(shared, Not(c.Exists(&res.Secret))),
+			Do: c.Ensure(&res.Secret, func() (client.Object, error) {
+				invoked.Add(1)
+				return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: res.App.Name, Namespace: res.App.Namespace}}, nil
+			}),
+		},
+		{Name: "stop", When: shared, Do: c.Stop()},
+		{Name: "after stop", When: shared, Do: func(context.Context) { invoked.Add(1) }},
+	})
+	return c, cl, invoked, writes, evaluations
+}
+
+// Test_If_Simulate_Records_Would_Fire_Without_Side_Effects tests that
+// Simulate evaluates every rule, even after one that would stop the Run,
+// flags the rules that would fire, caches shared predicates, and neither
+// invokes actions nor writes.
+func Test_If_Simulate_Records_Would_Fire_Without_Side_Effects(t *testing.T) {
+	app := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	c, cl, invoked, writes, evaluations := simulateChain(app)
+	key := types.NamespacedName{Namespace: "default", Name: "demo"}
+	report, err := c.Simulate(context.Background(), ctrl.Request{NamespacedName: key})
+	assert.NoError(t, err)
+	assert.True(t, report.Simulated, "report is not flagged as simulated")
+	assert.False(t, report.Rule("never").Report().WouldFire, "rule with a false predicate would fire")
+	for _, rule := range []string{"create secret", "stop", "after stop"} {
+		assert.True(t, report.Rule(rule).Report().WouldFire, "rule %q would not fire", rule)
+		assert.False(t, report.Rule(rule).Fired(), "rule %q fired", rule)
+	}
+	assert.Empty(t, report.Fired, "rules fired")
+	assert.False(t, report.Stopped, "simulation was stopped")
+	assert.Zero(t, invoked.Load(), "actions were invoked")
+	assert.Zero(t, writes.Load(), "client was written to")
+	assert.Empty(t, report.DryRun, "writes were attempted")
+	assert.Equal(t, int32(1), evaluations.Load(), "shared predicate was not cached")
+	assert.Nil(t, c.LastReport(), "simulation replaced the last report")
+	assert.Contains(t, report.ExecutionTrace(), "create secret: And(appExists, Not(Exists(Secret))) = true, would fire\n")
+	assert.True(t, apierrors.IsNotFound(cl.Get(context.Background(), key, &corev1.Secret{})), "Secret was created")
+
+	_, err = c.Run(context.Background(), ctrl.Request{NamespacedName: key})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), invoked.Load(), "Run after a simulation did not invoke the actions")
+	assert.NotNil(t, c.LastReport())
+}
+
+// Test_If_SimulateAll_Summarizes_Every_Primary tests that SimulateAll
+// simulates every listed primary resource and counts the rules that would
+// fire for them.
+func Test_If_SimulateAll_Summarizes_Every_Primary(t *testing.T) {
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default"}
+	}
+	c, cl, invoked, writes, _ := simulateChain(
+		&corev1.ConfigMap{ObjectMeta: meta("a")},
+		&corev1.ConfigMap{ObjectMeta: meta("b")},
+		&corev1.Secret{ObjectMeta: meta("b")},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "other"}},
+	)
+	summary, err := c.SimulateAll(context.Background(), cl, client.InNamespace("default"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, summary.Objects)
+	assert.Zero(t, summary.Failed)
+	assert.Equal(t, map[string]int{"create secret": 1, "stop": 2, "after stop": 2}, summary.WouldFire)
+	if assert.Len(t, summary.Reports, 2) {
+		assert.Equal(t, "a", summary.Reports[0].Request.Name)
+	}
+	assert.Zero(t, invoked.Load(), "actions were invoked")
+	assert.Zero(t, writes.Load(), "client was written to")
+}
@@ -0,0 +1,336 @@
+package operchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"sigs.k8s.io/yaml"
+)
+
+// GateLeaderOnly is the gate of a RuleSpec that makes the rule LeaderOnly.
+const GateLeaderOnly = "LeaderOnly"
+
+// ChainSpec is the declarative form of the rules of a chain, so that they can
+// be customized without recompiling, e.g. from a ConfigMap. It refers to the
+// predicates and actions of the chain's registries by name. Its YAML form is:
+//
+//	phases: [prepare, deploy]
+//	predicates:
+//	  widgetExists:
+//	    predicate: Exists
+//	    params: {field: Widget}
+//	rules:
+//	- name: wait-for-widget
+//	  phase: prepare
+//	  when: "!widgetExists"
+//	  do:
+//	  - action: Requeue
+//	    params: {after: 30s}
+//	  - action: Stop
+type ChainSpec struct {
+	// Phases are the phases of the rules, in the order they run. If empty,
+	// the rules have no phase and run in the order listed.
+	Phases []string `json:"phases,omitempty"`
+	// Predicates are predicates constructed with parameters, by the names
+	// the expressions of the rules refer to them with.
+	Predicates map[string]PredicateSpec `json:"predicates,omitempty"`
+	// Rules are the rules, which run by phase and, within a phase, in the
+	// order listed.
+	Rules []RuleSpec `json:"rules"`
+}
+
+// PredicateSpec is a registered predicate with parameters.
+type PredicateSpec struct {
+	// Predicate is the registered name of the predicate.
+	Predicate string `json:"predicate"`
+	// Params are its parameters.
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// RuleSpec is the declarative form of a Rule.
+type RuleSpec struct {
+	// Name is the name of the rule.
+	Name string `json:"name,omitempty"`
+	// Phase is the phase of the rule, one of the Phases of the ChainSpec.
+	Phase string `json:"phase,omitempty"`
+	// When is the expression of the predicate of the rule, as parsed by
+	// ParseExpression, over the Predicates of the ChainSpec and the
+	// registered predicates without parameters. If empty, the rule always
+	// runs.
+	When string `json:"when,omitempty"`
+	// Gates restrict where the rule runs: GateLeaderOnly makes it LeaderOnly.
+	Gates []string `json:"gates,omitempty"`
+	// Do are the actions of the rule, run in sequence.
+	Do []ActionSpec `json:"do"`
+}
+
+// ActionSpec is a registered action with parameters.
+type ActionSpec struct {
+	// Action is the registered name of the action.
+	Action string `json:"action"`
+	// Params are its parameters.
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// ParseChainSpec reads a ChainSpec in YAML from r and validates it, without
+// constructing its predicates and actions. Unknown fields are errors, as are
+// unknown phases and gates, missing actions, duplicate rule names, and
+// expressions that do not parse. Errors name the offending rule by index.
+func ParseChainSpec(r io.Reader) (*ChainSpec, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read chain spec: %w", err)
+	}
+	s, err := decodeChainSpec(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse chain spec: %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("invalid chain spec: %w", err)
+	}
+	return s, nil
+}
+
+// decodeChainSpec decodes the YAML of a ChainSpec, rejecting unknown fields.
+// The rules are decoded one by one, so that errors name the rule by index.
+func decodeChainSpec(data []byte) (*ChainSpec, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var raw struct {
+		Phases     []string                 `json:"phases"`
+		Predicates map[string]PredicateSpec `json:"predicates"`
+		Rules      []json.RawMessage        `json:"rules"`
+	}
+	if err := decodeStrict(data, &raw); err != nil {
+		return nil, err
+	}
+	s := &ChainSpec{Phases: raw.Phases, Predicates: raw.Predicates, Rules: make([]RuleSpec, len(raw.Rules))}
+	for i, rule := range raw.Rules {
+		if err := decodeStrict(rule, &s.Rules[i]); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return s, nil
+}
+
+// decodeStrict decodes the JSON data into v, rejecting unknown fields.
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// validate returns the errors of the spec.
+func (s *ChainSpec) validate() error {
+	var errs []error
+	phases := map[string]bool{}
+	for _, phase := range s.Phases {
+		if phase == "" || phases[phase] {
+			errs = append(errs, fmt.Errorf("phases: empty or duplicate phase %q", phase))
+		}
+		phases[phase] = true
+	}
+	for name, p := range s.Predicates {
+		if p.Predicate == "" {
+			errs = append(errs, fmt.Errorf("predicates: %s: missing predicate", name))
+		}
+	}
+	names := map[string]bool{}
+	for i, rule := range s.Rules {
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, fmt.Errorf("%s: %s", rule.describe(i), fmt.Sprintf(format, args...)))
+		}
+		if rule.Name != "" {
+			if names[rule.Name] {
+				fail("duplicate name")
+			}
+			names[rule.Name] = true
+		}
+		switch {
+		case len(s.Phases) > 0 && !phases[rule.Phase]:
+			fail("unknown phase %q", rule.Phase)
+		case len(s.Phases) == 0 && rule.Phase != "":
+			fail("phase %q, but the spec has no phases", rule.Phase)
+		}
+		if rule.When != "" {
+			if _, err := ParseExpression(rule.When); err != nil {
+				fail("when: %s", err)
+			}
+		}
+		for _, gate := range rule.Gates {
+			if gate != GateLeaderOnly {
+				fail("unknown gate %q", gate)
+			}
+		}
+		if len(rule.Do) == 0 {
+			fail("no actions")
+		}
+		for j, action := range rule.Do {
+			if action.Action == "" {
+				fail("do[%d]: missing action", j)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// describe identifies the rule with the index in errors.
+func (r *RuleSpec) describe(i int) string {
+	if r.Name == "" {
+		return fmt.Sprintf("rule %d", i)
+	}
+	return fmt.Sprintf("rule %d (%s)", i, r.Name)
+}
+
+// Build constructs the rules of the spec for the chain, looking up predicates
+// and actions in the chain's Registry and then in the DefaultRegistry, and
+// orders them by phase. Errors name the offending rule by index, such as
+// unknown predicates and actions, and invalid parameters. A constructor that
+// panics, e.g. on a parameter it does not validate, fails the Build with the
+// panic as the error of its rule.
+func (s *ChainSpec) Build(c *Chain) ([]Rule, error) {
+	resolver := &specResolver{chain: c, spec: s, resolved: map[string]*predicate{}}
+	byPhase := map[string][]Rule{}
+	var errs []error
+	for i := range s.Rules {
+		spec := &s.Rules[i]
+		rule, err := spec.build(c, resolver)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", spec.describe(i), err))
+			continue
+		}
+		rule.spec, rule.source = spec, s
+		byPhase[spec.Phase] = append(byPhase[spec.Phase], rule)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if len(s.Phases) == 0 {
+		return byPhase[""], nil
+	}
+	var rules []Rule
+	for _, phase := range s.Phases {
+		rules = append(rules, byPhase[phase]...)
+	}
+	return rules, nil
+}
+
+// build constructs the rule.
+func (r *RuleSpec) build(c *Chain, resolver PredicateResolver) (Rule, error) {
+	rule := Rule{Name: r.Name}
+	if r.When != "" {
+		when, err := CompileExpression(r.When, resolver)
+		if err != nil {
+			return Rule{}, fmt.Errorf("when: %w", err)
+		}
+		rule.When = when
+	}
+	for _, gate := range r.Gates {
+		if gate == GateLeaderOnly {
+			rule.LeaderOnly = true
+		}
+	}
+	actions := make([]Action, len(r.Do))
+	for j, spec := range r.Do {
+		action, err := lookupSpecAction(c, spec)
+		if err != nil {
+			return Rule{}, fmt.Errorf("do[%d]: %w", j, err)
+		}
+		actions[j] = action
+	}
+	rule.Do = actions[0]
+	if len(actions) > 1 {
+		rule.Do = Sequential(actions...)
+	}
+	return rule, nil
+}
+
+// lookupSpecAction constructs the action of the spec, as LookupAction does,
+// returning a panic of its constructor as an error.
+func lookupSpecAction(c *Chain, spec ActionSpec) (action Action, err error) {
+	defer recoverConstructor("action", spec.Action, &err)
+	return c.LookupAction(spec.Action, spec.Params)
+}
+
+// recoverConstructor recovers a panic of the constructor of the named
+// predicate or action, setting *err to it.
+func recoverConstructor(kind, name string, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%s %q: %v", kind, name, r)
+	}
+}
+
+// specResolver resolves the names of the expressions of a ChainSpec: the
+// Predicates of the spec, and the registered predicates without parameters.
+// Each name is constructed once, so that repeated references share a cached
+// value.
+type specResolver struct {
+	chain    *Chain
+	spec     *ChainSpec
+	resolved map[string]*predicate
+}
+
+// ResolvePredicate implements PredicateResolver. A panic of the constructor
+// of the predicate is returned as an error.
+func (r *specResolver) ResolvePredicate(name string) (p *predicate, err error) {
+	if p, ok := r.resolved[name]; ok {
+		return p, nil
+	}
+	ps, ok := r.spec.Predicates[name]
+	if !ok {
+		defer recoverConstructor("predicate", name, &err)
+		return r.chain.ResolvePredicate(name)
+	}
+	defer recoverConstructor("predicate", ps.Predicate, &err)
+	p, err = r.chain.LookupPredicate(ps.Predicate, ps.Params)
+	if err != nil {
+		return nil, err
+	}
+	r.resolved[name] = p
+	return p, nil
+}
+
+// LoadChainSpec reads a ChainSpec in YAML from r, as ParseChainSpec does, and
+// builds its rules for the chain, as Build does.
+func LoadChainSpec(r io.Reader, c *Chain) ([]Rule, error) {
+	s, err := ParseChainSpec(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.Build(c)
+}
+
+// Marshal returns the YAML of the spec.
+func (s *ChainSpec) Marshal() ([]byte, error) {
+	return yaml.Marshal(s)
+}
+
+// DescribeSpec returns the ChainSpec of the chain's rules, all of which must
+// have been built from ChainSpecs, in their order in the chain, e.g. to
+// re-emit their YAML with Marshal.
+func (c *Chain) DescribeSpec() (*ChainSpec, error) {
+	s := &ChainSpec{}
+	seenPhase := map[string]bool{}
+	for i, rule := range c.Rules {
+		if rule.spec == nil {
+			return nil, fmt.Errorf("rule %d was not built from a chain spec", i)
+		}
+		if rule.spec.Phase != "" && !seenPhase[rule.spec.Phase] {
+			seenPhase[rule.spec.Phase] = true
+			s.Phases = append(s.Phases, rule.spec.Phase)
+		}
+		for name, p := range rule.source.Predicates {
+			if s.Predicates == nil {
+				s.Predicates = map[string]PredicateSpec{}
+			}
+			s.Predicates[name] = p
+		}
+		s.Rules = append(s.Rules, *rule.spec)
+	}
+	return s, nil
+}
@@ -0,0 +1,124 @@
+package operchain
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// specChain returns a chain over a Widget whose Registry has the predicate
+// "ready", which is true while ready is, and the action "Count", counting its
+// calls.
+func specChain(ready *bool, count *int) *Chain {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	res := &struct {
+		Widget *Widget
+	}{}
+	c := &Chain{Registry: NewRegistry()}
+	c.Registry.RegisterPredicate("ready", func(c *Chain, params map[string]string) (*predicate, error) {
+		return Predicate(func() bool { return *ready }), nil
+	})
+	c.Registry.RegisterAction("Count", func(c *Chain, params map[string]string) (Action, error) {
+		return func(context.Context) { *count++ }, nil
+	})
+	c.InitializeChain(cl, res, nil)
+	return c
+}
+
+// Test_If_A_Chain_Spec_Builds_A_Working_Chain tests that the golden spec builds
+// rules that run against a fake client, and that the chain's spec re-emits
+// the golden YAML.
+func Test_If_A_Chain_Spec_Builds_A_Working_Chain(t *testing.T) {
+	ready, count := false, 0
+	c := specChain(&ready, &count)
+	golden, err := os.ReadFile("testdata/chainspec.yaml")
+	assert.NoError(t, err, "golden spec was not read")
+	rules, err := LoadChainSpec(strings.NewReader(string(golden)), c)
+	if !assert.NoError(t, err, "golden spec was not loaded") {
+		return
+	}
+	c.Rules = rules
+	assert.True(t, c.Rules[1].LeaderOnly, "the gate was not applied")
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	result, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 0, count, "the rule ran while not ready")
+	assert.Zero(t, result.RequeueAfter, "the rule requeued while not ready")
+
+	ready = true
+	report, err := c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 1, count, "the rule did not run")
+	assert.Equal(t, 30*time.Second, report.Result.RequeueAfter, "the rule did not requeue")
+	assert.Equal(t, "spec", report.RequeueReason, "the requeue reason was not passed")
+
+	spec, err := c.DescribeSpec()
+	assert.NoError(t, err, "the spec was not described")
+	out, err := spec.Marshal()
+	assert.NoError(t, err, "the spec was not marshaled")
+	assert.Equal(t, string(golden), string(out), "the spec did not round-trip")
+}
+
+// Test_If_Chain_Spec_Rules_Run_By_Phase tests that rules run by phase, and in
+// the order listed within a phase.
+func Test_If_Chain_Spec_Rules_Run_By_Phase(t *testing.T) {
+	ready, count := true, 0
+	c := specChain(&ready, &count)
+	rules, err := LoadChainSpec(strings.NewReader(`
+phases: [first, second]
+rules:
+- {name: c, phase: second, do: [{action: Count}]}
+- {name: a, phase: first, do: [{action: Count}]}
+- {name: b, phase: first, do: [{action: Count}]}
+`), c)
+	assert.NoError(t, err, "spec was not loaded")
+	var names []string
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names, "rules were not ordered by phase")
+	c.Rules = append(c.Rules, Rule{Name: "go"})
+	_, err = c.DescribeSpec()
+	assert.EqualError(t, err, "rule 0 was not built from a chain spec", "a chain without a spec was described")
+}
+
+// Test_If_Invalid_Chain_Specs_Are_Rejected_Precisely tests that invalid specs
+// are rejected with errors naming the rule and the problem, including
+// templates that do not parse and constructors that panic.
+func Test_If_Invalid_Chain_Specs_Are_Rejected_Precisely(t *testing.T) {
+	ready, count := true, 0
+	c := specChain(&ready, &count)
+	c.Registry.RegisterAction("Explode", func(*Chain, map[string]string) (Action, error) { panic("boom") })
+	c.Registry.RegisterPredicate("Shaky", func(*Chain, map[string]string) (*predicate, error) { panic("boom") })
+	for _, tc := range []struct {
+		spec string
+		err  string
+	}{
+		{"rules:\n- do: [{action: Stop}]\n  unless: ready\n", `parse chain spec: rule 0: json: unknown field "unless"`},
+		{"rules:\n- do: [{action: Stop}]\n- name: x\n  do: [{action: Launch}]\n", `rule 1 (x): do[0]: unknown action "Launch"`},
+		{"rules:\n- when: ready &&\n  do: [{action: Stop}]\n", "invalid chain spec: rule 0: when: "},
+		{"rules:\n- when: missing\n  do: [{action: Stop}]\n", `rule 0: when: `},
+		{"phases: [a]\nrules:\n- phase: b\n  do: [{action: Stop}]\n", `rule 0: unknown phase "b"`},
+		{"rules:\n- gates: [Sometimes]\n  do: [{action: Stop}]\n", `rule 0: unknown gate "Sometimes"`},
+		{"rules:\n- name: x\n", "rule 0 (x): no actions"},
+		{"rules:\n- do: [{action: Requeue, params: {after: soon}}]\n", `rule 0: do[0]: action "Requeue": parameter "after"`},
+		{"rules:\n- do: [{action: Event, params: {reason: Synced, message: \"{{.Nope\"}}]\n", `rule 0: do[0]: action "Event": parameter "message": template: message:`},
+		{"rules:\n- do: [{action: Explode}]\n", `rule 0: do[0]: action "Explode": boom`},
+		{"predicates:\n  shaky: {predicate: Shaky}\nrules:\n- when: shaky\n  do: [{action: Stop}]\n", `rule 0: when: expression "shaky": position 0: predicate "Shaky": boom`},
+	} {
+		_, err := LoadChainSpec(strings.NewReader(tc.spec), c)
+		if assert.Error(t, err, "invalid spec was loaded: %s", tc.spec) {
+			assert.Contains(t, err.Error(), tc.err, "error was not precise")
+		}
+	}
+}
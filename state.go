@@ -0,0 +1,302 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// StateStore keeps small durable state for an object, e.g. the last
+// notification sent or the migration step reached, outside of its spec and
+// status.
+type StateStore interface {
+	// Load returns the state of obj.
+	Load(ctx context.Context, cl client.Client, obj client.Object) (map[string]string, error)
+	// Update sets the keys of the state of obj to the given values, deleting
+	// those whose value is nil.
+	Update(ctx context.Context, cl client.Client, obj client.Object, changes map[string]*string) error
+}
+
+// DefaultStatePrefix is the prefix of the annotations of an AnnotationState
+// without one.
+const DefaultStatePrefix = "state.operchain.smxlong.github.io/"
+
+// DefaultStateMaxBytes is the size limit of an AnnotationState without one.
+const DefaultStateMaxBytes = 16 * 1024
+
+// AnnotationState is a StateStore that keeps the state in annotations of the
+// object itself. It is the default StateStore.
+type AnnotationState struct {
+	// Prefix is prepended to the keys to form the annotations. If empty,
+	// DefaultStatePrefix is used.
+	Prefix string
+	// MaxBytes limits the total size of the keys and values of the state. If
+	// zero, DefaultStateMaxBytes is used.
+	MaxBytes int
+}
+
+// StateTooLargeError is the error of an update that would make a state larger
+// than its store allows.
+type StateTooLargeError struct {
+	// Size is the size the state would have.
+	Size int
+	// MaxBytes is the limit.
+	MaxBytes int
+}
+
+// Error returns the size and the limit.
+func (e *StateTooLargeError) Error() string {
+	return fmt.Sprintf("state of %d bytes exceeds the limit of %d bytes", e.Size, e.MaxBytes)
+}
+
+// prefix returns the prefix of the state annotations.
+func (s AnnotationState) prefix() string {
+	if s.Prefix == "" {
+		return DefaultStatePrefix
+	}
+	return s.Prefix
+}
+
+// Load returns the state kept in the annotations of obj.
+func (s AnnotationState) Load(ctx context.Context, cl client.Client, obj client.Object) (map[string]string, error) {
+	state := map[string]string{}
+	for annotation, value := range obj.GetAnnotations() {
+		if key, ok := strings.CutPrefix(annotation, s.prefix()); ok {
+			state[key] = value
+		}
+	}
+	return state, nil
+}
+
+// Update patches the annotations of obj, retrying on conflicts with the
+// object read afresh.
+func (s AnnotationState) Update(ctx context.Context, cl client.Client, obj client.Object, changes map[string]*string) error {
+	maxBytes := s.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultStateMaxBytes
+	}
+	return retryOnConflict(ctx, func() error {
+		state, _ := s.Load(ctx, cl, obj)
+		applyChanges(state, changes)
+		size := 0
+		for key, value := range state {
+			size += len(key) + len(value)
+		}
+		if size > maxBytes {
+			return &StateTooLargeError{Size: size, MaxBytes: maxBytes}
+		}
+		modified := obj.DeepCopyObject().(client.Object)
+		annotations := modified.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		for key, value := range changes {
+			if value == nil {
+				delete(annotations, s.prefix()+key)
+			} else {
+				annotations[s.prefix()+key] = *value
+			}
+		}
+		modified.SetAnnotations(annotations)
+		err := cl.Patch(ctx, modified, client.MergeFromWithOptions(obj, client.MergeFromWithOptimisticLock{}))
+		if apierrors.IsConflict(err) {
+			if getErr := cl.Get(ctx, client.ObjectKeyFromObject(obj), obj); getErr != nil {
+				return getErr
+			}
+		}
+		if err != nil {
+			return err
+		}
+		reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(modified).Elem())
+		return nil
+	})
+}
+
+// ConfigMapState is a StateStore that keeps the state of each object in the
+// data of a ConfigMap of its own, e.g. in the operator's namespace, for state
+// too large or too private for annotations. The ConfigMaps are not deleted
+// with their objects.
+type ConfigMapState struct {
+	// Namespace is the namespace of the ConfigMaps.
+	Namespace string
+	// Name returns the name of the ConfigMap of obj. If nil, the name is
+	// "operchain-state-" followed by the UID of obj.
+	Name func(obj client.Object) string
+}
+
+// key returns the key of the ConfigMap of obj.
+func (s ConfigMapState) key(obj client.Object) client.ObjectKey {
+	if s.Name != nil {
+		return client.ObjectKey{Namespace: s.Namespace, Name: s.Name(obj)}
+	}
+	return client.ObjectKey{Namespace: s.Namespace, Name: "operchain-state-" + string(obj.GetUID())}
+}
+
+// Load returns the data of the ConfigMap of obj, which is empty if there is
+// none.
+func (s ConfigMapState) Load(ctx context.Context, cl client.Client, obj client.Object) (map[string]string, error) {
+	cm := &corev1.ConfigMap{}
+	if err := cl.Get(ctx, s.key(obj), cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	if cm.Data == nil {
+		return map[string]string{}, nil
+	}
+	return cm.Data, nil
+}
+
+// Update creates or updates the ConfigMap of obj, retrying on conflicts.
+func (s ConfigMapState) Update(ctx context.Context, cl client.Client, obj client.Object, changes map[string]*string) error {
+	key := s.key(obj)
+	return retryOnConflict(ctx, func() error {
+		cm := &corev1.ConfigMap{}
+		err := cl.Get(ctx, key, cm)
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}, Data: map[string]string{}}
+			applyChanges(cm.Data, changes)
+			err = cl.Create(ctx, cm)
+			if apierrors.IsAlreadyExists(err) {
+				// Retry as a conflict, to update the ConfigMap created
+				// concurrently.
+				return apierrors.NewConflict(corev1.Resource("configmaps"), key.Name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		applyChanges(cm.Data, changes)
+		return cl.Update(ctx, cm)
+	})
+}
+
+// applyChanges applies the changes to state.
+func applyChanges(state map[string]string, changes map[string]*string) {
+	for key, value := range changes {
+		if value == nil {
+			delete(state, key)
+		} else {
+			state[key] = *value
+		}
+	}
+}
+
+// stateStore returns the chain's StateStore.
+func (c *Chain) stateStore() StateStore {
+	if c.State == nil {
+		return AnnotationState{}
+	}
+	return c.State
+}
+
+// loadState returns the state of the primary resource, loading it on first
+// use in the Run. It is empty if the primary resource is not loaded.
+func (c *Chain) loadState() (map[string]string, error) {
+	c.lock.Lock()
+	state := c.state
+	c.lock.Unlock()
+	if state != nil {
+		return state, nil
+	}
+	primary := c.primary()
+	if primary == nil {
+		return map[string]string{}, nil
+	}
+	state, err := c.stateStore().Load(c.ctx, c.Client, primary)
+	if err != nil {
+		return nil, fmt.Errorf("load state of %s/%s: %w", primary.GetNamespace(), primary.GetName(), err)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.state = state
+	return state, nil
+}
+
+// updateState returns an action that applies the changes to the state of the
+// primary resource.
+func (c *Chain) updateState(changes map[string]*string) ActionE {
+	return func(ctx context.Context) error {
+		primary := c.primary()
+		if primary == nil {
+			return fmt.Errorf("update state: primary resource not loaded")
+		}
+		if err := c.stateStore().Update(ctx, c.Client, primary, changes); err != nil {
+			return fmt.Errorf("update state of %s/%s: %w", primary.GetNamespace(), primary.GetName(), err)
+		}
+		c.lock.Lock()
+		if c.state != nil {
+			applyChanges(c.state, changes)
+		}
+		c.lock.Unlock()
+		c.invalidateRun()
+		return nil
+	}
+}
+
+// StateSet returns an action that sets the key of the state of the primary
+// resource, kept by the chain's State, to value, which is either a string or
+// a func() string. Predicates evaluated later in the Run see the change.
+func (c *Chain) StateSet(key string, value interface{}) Action {
+	return c.Try(c.StateSetE(key, value))
+}
+
+// StateSetE is like StateSet, but returns the error.
+func (c *Chain) StateSetE(key string, value interface{}) ActionE {
+	get := stringFunc("state value", value)
+	return func(ctx context.Context) error {
+		v := get()
+		return c.updateState(map[string]*string{key: &v})(ctx)
+	}
+}
+
+// StateDelete returns an action that deletes the key of the state of the
+// primary resource.
+func (c *Chain) StateDelete(key string) Action {
+	return c.Try(c.updateState(map[string]*string{key: nil}))
+}
+
+// StateExists returns a predicate that is true when the state of the primary
+// resource has the key. The state is read at most once per Run; a failure to
+// read it fails the Run and makes the predicate false.
+func (c *Chain) StateExists(key string) *predicate {
+	return c.reactsTo(pcache.NewLeaf(fmt.Sprintf("StateExists(%s)", key), func(e *pcache.Evaluation) bool {
+		_, ok := c.stateValue(e, key)
+		return ok
+	}), nil, reactsToState)
+}
+
+// StateEquals returns a predicate that is true when the key of the state of
+// the primary resource has the given value, read as StateExists reads it.
+func (c *Chain) StateEquals(key, value string) *predicate {
+	return c.reactsTo(pcache.NewLeaf(fmt.Sprintf("StateEquals(%s, %s)", key, value), func(e *pcache.Evaluation) bool {
+		v, ok := c.stateValue(e, key)
+		return ok && v == value
+	}), nil, reactsToState)
+}
+
+// stateValue returns the value of the key of the state, and whether it is
+// set.
+func (c *Chain) stateValue(e *pcache.Evaluation, key string) (string, bool) {
+	state, err := c.loadState()
+	if err != nil {
+		e.Notef("%s", err)
+		c.doError(err)
+		return "", false
+	}
+	v, ok := state[key]
+	return v, ok
+}
@@ -0,0 +1,82 @@
+package operchain
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// stateChain returns a chain over a stored Widget with the given StateStore,
+// whose rules record the migration step reached, and the number of
+// ConfigMaps read.
+func stateChain(state StateStore) (*Chain, client.Client, *int) {
+	reads := 0
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).
+		WithObjects(&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", UID: "widget-uid"}}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if _, ok := obj.(*corev1.ConfigMap); ok {
+					reads++
+				}
+				return cl.Get(ctx, key, obj, opts...)
+			},
+		}).Build()
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{State: state}
+	c.InitializeChain(cl, &res, []Rule{
+		{When: Not(c.StateExists("step")), Do: c.StateSet("step", "1")},
+		{When: c.StateEquals("step", "1"), Do: c.StateSet("step", func() string { return "2: \"quoted\"\nline" })},
+		{When: c.StateEquals("step", "2: \"quoted\"\nline"), Do: c.StateDelete("notified")},
+	})
+	return c, cl, &reads
+}
+
+// Test_If_State_Round_Trips_Through_Each_Store tests that values set by one
+// rule are seen by the predicates of later rules and of later Runs, in either
+// store, and that a Run reads the ConfigMap store once.
+func Test_If_State_Round_Trips_Through_Each_Store(t *testing.T) {
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	for name, store := range map[string]StateStore{
+		"annotations": nil,
+		"configmap":   ConfigMapState{Namespace: "operator"},
+	} {
+		c, cl, reads := stateChain(store)
+		_, err := c.Run(context.Background(), req)
+		assert.NoError(t, err, "Run failed with %s", name)
+		if name == "configmap" {
+			// One read for the predicates, and one per update.
+			assert.Equal(t, 1+3, *reads, "Run read the state more than once")
+		}
+		state, err := c.stateStore().Load(context.Background(), cl, c.primary())
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"step": "2: \"quoted\"\nline"}, state, "state did not round-trip with %s", name)
+	}
+	c, _, _ := stateChain(nil)
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, "2: \"quoted\"\nline", c.primary().GetAnnotations()[DefaultStatePrefix+"step"], "state was not kept in an annotation")
+}
+
+// Test_If_AnnotationState_Guards_Its_Size tests that an update making the
+// state larger than allowed fails without writing.
+func Test_If_AnnotationState_Guards_Its_Size(t *testing.T) {
+	c, cl, _ := stateChain(AnnotationState{MaxBytes: 64})
+	c.Rules = []Rule{{Do: c.StateSet("blob", strings.Repeat("x", 100))}}
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	var tooLarge *StateTooLargeError
+	assert.ErrorAs(t, err, &tooLarge, "oversized state was not rejected")
+	stored := &Widget{}
+	assert.NoError(t, cl.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "demo"}, stored))
+	assert.Empty(t, stored.Annotations, "oversized state was written")
+}
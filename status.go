@@ -0,0 +1,126 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// UpdateStatus returns an action that updates the status of the object in the
+// given resource field. It gets a fresh copy of the object, through the
+// chain's APIReader if set so that the cache cannot serve a stale one, applies
+// mutate to it, and writes the status unless mutate left it semantically
+// unchanged. A write that conflicts is retried, with a small bounded backoff,
+// starting from another fresh copy. On success, the field holds the fresh
+// copy. It does nothing if the field is not loaded.
+func (c *Chain) UpdateStatus(fieldPtr interface{}, mutate func(obj client.Object) error) Action {
+	return writes(c.Try(c.UpdateStatusE(fieldPtr, mutate)), fieldTarget(fieldPtr, "status"))
+}
+
+// UpdateStatusE is like UpdateStatus, but returns the error.
+func (c *Chain) UpdateStatusE(fieldPtr interface{}, mutate func(obj client.Object) error) ActionE {
+	checkField(fieldPtr)
+	return func(ctx context.Context) error {
+		obj := objectAt(fieldPtr)
+		if obj == nil {
+			return nil
+		}
+		var fresh client.Object
+		result := controllerutil.OperationResultNone
+		err := c.retryOnConflict(ctx, func() error {
+			fresh = obj.DeepCopyObject().(client.Object)
+			if err := c.reader().Get(ctx, client.ObjectKeyFromObject(obj), fresh); err != nil {
+				return err
+			}
+			before := statusValue(fresh.DeepCopyObject().(client.Object))
+			if err := mutate(fresh); err != nil {
+				return err
+			}
+			if equality.Semantic.DeepEqual(before, statusValue(fresh)) {
+				result = controllerutil.OperationResultNone
+				return nil
+			}
+			result = controllerutil.OperationResultUpdatedStatusOnly
+			return c.Status().Update(ctx, fresh)
+		})
+		if err != nil {
+			return fmt.Errorf("update status of %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+		}
+		reflect.ValueOf(fieldPtr).Elem().Set(reflect.ValueOf(fresh))
+		c.recordOperation(fresh, result)
+		return nil
+	}
+}
+
+// statusValue returns the status of the object, for comparison.
+func statusValue(obj client.Object) interface{} {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.Object["status"]
+	}
+	if status := statusOf(obj); status.IsValid() {
+		return status.Interface()
+	}
+	return nil
+}
+
+// pendingStatus is a batched status update of the object in a resource field.
+type pendingStatus struct {
+	fieldPtr interface{}
+	mutates  []func(obj client.Object) error
+}
+
+// updateStatusLater applies mutate to the object in the given resource field
+// now, and to a fresh copy when writing its status: at the end of the Run if
+// the chain batches status writes, and otherwise immediately.
+func (c *Chain) updateStatusLater(ctx context.Context, fieldPtr interface{}, mutate func(obj client.Object) error) error {
+	if !c.BatchStatus {
+		return c.UpdateStatusE(fieldPtr, mutate)(ctx)
+	}
+	obj := objectAt(fieldPtr)
+	if obj == nil {
+		return nil
+	}
+	if err := mutate(obj); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, p := range c.pendingStatus {
+		if p.fieldPtr == fieldPtr {
+			p.mutates = append(p.mutates, mutate)
+			return nil
+		}
+	}
+	c.pendingStatus = append(c.pendingStatus, &pendingStatus{fieldPtr: fieldPtr, mutates: []func(client.Object) error{mutate}})
+	return nil
+}
+
+// flushStatus writes the batched status updates, one per object.
+func (c *Chain) flushStatus(ctx context.Context) error {
+	c.lock.Lock()
+	pending := c.pendingStatus
+	c.pendingStatus = nil
+	c.lock.Unlock()
+	var errs []error
+	for _, p := range pending {
+		mutates := p.mutates
+		err := c.UpdateStatusE(p.fieldPtr, func(obj client.Object) error {
+			for _, mutate := range mutates {
+				if err := mutate(obj); err != nil {
+					return err
+				}
+			}
+			return nil
+		})(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
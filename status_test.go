@@ -0,0 +1,96 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Test_If_UpdateStatus_Retries_A_Conflict tests that UpdateStatus retries a
+// conflicting status write from a fresh copy, and skips the write when the
+// status does not change.
+func Test_If_UpdateStatus_Retries_A_Conflict(t *testing.T) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", Generation: 3}}
+	conflicts, writes := 1, 0
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget).WithStatusSubresource(widget).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourceUpdate: func(ctx context.Context, cl client.Client, subResource string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+				writes++
+				if conflicts > 0 {
+					conflicts--
+					return apierrors.NewConflict(schema.GroupResource{Resource: "widgets"}, obj.GetName(), assert.AnError)
+				}
+				return cl.SubResource(subResource).Update(ctx, obj, opts...)
+			},
+		}).Build()
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: c.UpdateStatus(&res.Widget, func(obj client.Object) error {
+			obj.(*Widget).Status.ObservedGeneration = obj.GetGeneration()
+			return nil
+		})},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "conflict was not retried")
+	assert.Equal(t, 2, writes, "status was not written twice")
+	assert.Equal(t, int64(3), res.Widget.Status.ObservedGeneration, "field was not updated")
+	stored := &Widget{}
+	assert.NoError(t, cl.Get(context.Background(), client.ObjectKeyFromObject(widget), stored))
+	assert.Equal(t, int64(3), stored.Status.ObservedGeneration, "status was not written")
+
+	report, err := c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 2, writes, "unchanged status was written")
+	assert.Equal(t, controllerutil.OperationResultNone, report.Operations[0].Result)
+}
+
+// Test_If_UpdateStatus_Reads_Through_The_APIReader tests that UpdateStatus
+// reads the fresh copy through the APIReader, so that a stale cache does not
+// make every retry conflict again.
+func Test_If_UpdateStatus_Reads_Through_The_APIReader(t *testing.T) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", Generation: 3}}
+	api := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget).WithStatusSubresource(widget).Build()
+	stale := &Widget{}
+	assert.NoError(t, api.Get(context.Background(), client.ObjectKeyFromObject(widget), stale))
+	cached := interceptor.NewClient(api.(client.WithWatch), interceptor.Funcs{
+		Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			stale.DeepCopyInto(obj.(*Widget))
+			return nil
+		},
+	})
+	// Someone else updates the object, so the cache is stale.
+	updated := stale.DeepCopyObject().(*Widget)
+	updated.Labels = map[string]string{"other": "value"}
+	assert.NoError(t, api.Update(context.Background(), updated))
+
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{APIReader: api}
+	c.InitializeChain(cached, &res, []Rule{
+		{Do: c.UpdateStatus(&res.Widget, func(obj client.Object) error {
+			obj.(*Widget).Status.ObservedGeneration = obj.GetGeneration()
+			return nil
+		})},
+	})
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "the status was written from a stale copy")
+	stored := &Widget{}
+	assert.NoError(t, api.Get(context.Background(), client.ObjectKeyFromObject(widget), stored))
+	assert.Equal(t, int64(3), stored.Status.ObservedGeneration, "status was not written")
+	assert.Equal(t, "value", stored.Labels["other"], "the other update was lost")
+}
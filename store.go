@@ -0,0 +1,73 @@
+package operchain
+
+import (
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/smxlong/operchain/internal/store"
+)
+
+// DefaultMaxStoreEntries is the number of objects for which values are kept
+// across runs when Chain.MaxStoreEntries is zero.
+const DefaultMaxStoreEntries = 10000
+
+// store returns the chain's cross-run store, creating it on first use.
+func (c *Chain) store() *store.Store {
+	c.storeOnce.Do(func() {
+		max := c.MaxStoreEntries
+		if max == 0 {
+			max = DefaultMaxStoreEntries
+		}
+		c.crossRun = store.New(max, func(delta int) {
+			storeEntries.Add(float64(delta))
+		})
+	})
+	return c.crossRun
+}
+
+// Forget discards all values kept across runs for the object with the given
+// key. The chain calls it itself when a run finds the primary resource
+// deleted. For a chain serving several kinds, it discards the values of the
+// object of the kind of the current Run only.
+func (c *Chain) Forget(key types.NamespacedName) {
+	k := c.storeKey(c.kind, key)
+	c.store().Forget(k)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.setStreaking(k, false)
+}
+
+// storeKey returns the key of the values kept across runs for the object of
+// the kind with the given key: its namespace and name, qualified by its kind
+// for a chain serving several kinds, so that objects of different kinds with
+// the same name keep their own values, e.g. "Gadget default/demo".
+func (c *Chain) storeKey(kind string, key types.NamespacedName) string {
+	if _, fields := c.primaryFields(); len(fields) > 1 {
+		return kind + " " + key.String()
+	}
+	return key.String()
+}
+
+// storeGet returns the named value kept across runs for the current request.
+func (c *Chain) storeGet(name string) (interface{}, bool) {
+	return c.store().Get(c.storeKey(c.kind, c.req.NamespacedName), name)
+}
+
+// storeSet sets the named value kept across runs for the current request.
+func (c *Chain) storeSet(name string, value interface{}) {
+	c.store().Set(c.storeKey(c.kind, c.req.NamespacedName), name, value)
+}
+
+// storeDelete deletes the named value kept across runs for the current
+// request.
+func (c *Chain) storeDelete(name string) {
+	c.store().Delete(c.storeKey(c.kind, c.req.NamespacedName), name)
+}
+
+// forgetDeletedPrimary discards the values kept for the current request if
+// Resources has a primary resource and it was not found.
+func (c *Chain) forgetDeletedPrimary() {
+	field := c.primaryField()
+	if field.IsValid() && field.IsNil() {
+		c.Forget(c.req.NamespacedName)
+	}
+}
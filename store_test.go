@@ -0,0 +1,55 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_Store_Forgets_Deleted_Primaries tests that the chain forgets the
+// values kept for an object once a run finds it deleted.
+func Test_If_Store_Forgets_Deleted_Primaries(t *testing.T) {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	cl := fake.NewClientBuilder().WithObjects(cm).Build()
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+	}
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{When: c.Exists(&res.ConfigMap), Do: func(context.Context) { c.storeSet("seen", true) }},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	before := testutil.ToFloat64(storeEntries)
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err)
+	seen, _ := c.storeGet("seen")
+	assert.Equal(t, true, seen, "value was not stored")
+	assert.Equal(t, before+1, testutil.ToFloat64(storeEntries), "gauge was not incremented")
+
+	assert.NoError(t, cl.Delete(context.Background(), cm))
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Empty(t, c.store().Keys(), "deleted object was not forgotten")
+	assert.Equal(t, before, testutil.ToFloat64(storeEntries), "gauge was not decremented")
+}
+
+// Test_If_Store_Is_Bounded_By_MaxStoreEntries tests that the least recently
+// run object is evicted when MaxStoreEntries is exceeded.
+func Test_If_Store_Is_Bounded_By_MaxStoreEntries(t *testing.T) {
+	c := &Chain{MaxStoreEntries: 2}
+	c.InitializeChain(fake.NewClientBuilder().Build(), &struct{}{}, []Rule{
+		{Do: func(context.Context) { c.storeSet("seen", true) }},
+	})
+	for _, name := range []string{"a", "b", "a", "c"} {
+		_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"default/c", "default/a"}, c.store().Keys(), "wrong object was evicted")
+}
@@ -0,0 +1,78 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// failureStreakKey is the name of the failure streak in the cross-run store.
+const failureStreakKey = "failureStreak"
+
+// FailureStreakHook is called by a chain when the failure streak of an object
+// reaches the threshold it was registered with, with the context of the Run,
+// its request, the streak, and the error of the Run.
+type FailureStreakHook func(ctx context.Context, req ctrl.Request, streak int, lastErr error)
+
+// failureStreakHook is a FailureStreakHook with its threshold.
+type failureStreakHook struct {
+	threshold int
+	hook      FailureStreakHook
+}
+
+// OnFailureStreak registers hook to be called when the Runs for an object have
+// failed threshold times in a row, e.g. to page someone. It is called once per
+// streak, at the end of the Run that reaches the threshold; a Run that
+// succeeds ends the streak. Call it before the chain runs. It panics if
+// threshold is not positive.
+func (c *Chain) OnFailureStreak(threshold int, hook FailureStreakHook) {
+	if threshold < 1 {
+		panic(fmt.Sprintf("failure streak threshold must be positive, got %d", threshold))
+	}
+	c.streakHooks = append(c.streakHooks, failureStreakHook{threshold: threshold, hook: hook})
+}
+
+// FailureStreak returns the number of consecutive Runs for the current request
+// that failed, not counting the current Run. During a Run, rules may escalate
+// with it, e.g. by setting a Degraded condition once it is high enough. The
+// streak is kept across runs, so it survives requeues, but not across restarts
+// of the process: it starts over from zero.
+func (c *Chain) FailureStreak() int {
+	if v, ok := c.storeGet(failureStreakKey); ok {
+		return v.(int)
+	}
+	return 0
+}
+
+// FailureStreakAtLeast returns a predicate that is true if the Runs for the
+// current request have failed at least n times in a row before the current
+// Run, as counted by FailureStreak.
+func (c *Chain) FailureStreakAtLeast(n int) *predicate {
+	return pcache.NewLeaf(fmt.Sprintf("FailureStreakAtLeast(%d)", n), func(e *pcache.Evaluation) bool {
+		streak := c.FailureStreak()
+		e.Notef("streak %d", streak)
+		return streak >= n
+	})
+}
+
+// recordFailureStreak extends the failure streak of the current request if the
+// Run failed with err, calling the hooks whose threshold it reaches, or ends it
+// if the Run succeeded.
+func (c *Chain) recordFailureStreak(ctx context.Context, err error) {
+	if err == nil {
+		c.storeDelete(failureStreakKey)
+		c.recordHealthStreak(0)
+		return
+	}
+	streak := c.FailureStreak() + 1
+	c.storeSet(failureStreakKey, streak)
+	c.recordHealthStreak(streak)
+	for _, h := range c.streakHooks {
+		if streak == h.threshold {
+			h.hook(ctx, c.req, streak, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_A_Failure_Streak_Escalates_Once tests that the hook of a failure
+// streak is called once when the streak reaches its threshold, that the
+// streak is visible to predicates, and that a successful Run ends it.
+func Test_If_A_Failure_Streak_Escalates_Once(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+	}
+	broken := errors.New("broken")
+	failing := true
+	escalated := 0
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{When: c.FailureStreakAtLeast(3), Do: func(context.Context) { escalated++ }},
+		{When: Predicate(func() bool { return failing }), Do: c.Error(broken)},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	type call struct {
+		req    ctrl.Request
+		streak int
+		err    error
+	}
+	var calls []call
+	c.OnFailureStreak(3, func(ctx context.Context, req ctrl.Request, streak int, lastErr error) {
+		calls = append(calls, call{req, streak, lastErr})
+	})
+	for i := 0; i < 5; i++ {
+		_, err := c.Run(context.Background(), req)
+		assert.Error(t, err, "Run did not fail")
+	}
+	assert.Equal(t, []call{{req, 3, broken}}, calls, "hook was not called once at the threshold")
+	assert.Equal(t, 5, c.FailureStreak(), "streak was not counted")
+	assert.Equal(t, 2, escalated, "predicate did not see the streak")
+
+	failing = false
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 0, c.FailureStreak(), "success did not end the streak")
+
+	failing = true
+	for i := 0; i < 3; i++ {
+		_, _ = c.Run(context.Background(), req)
+	}
+	assert.Len(t, calls, 2, "hook was not called for a new streak")
+	assert.Panics(t, func() { c.OnFailureStreak(0, nil) }, "a threshold of zero was accepted")
+}
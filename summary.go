@@ -0,0 +1,217 @@
+package operchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefaultRunSummaryMaxBytes is the size limit of the summaries written by
+// RecordRunSummary without one.
+const DefaultRunSummaryMaxBytes = 1024
+
+// RunSummaryStateKey is the key of the state of the primary resource keeping
+// the complete summary written by RecordRunSummary, when the summary is
+// truncated and the chain's State is a ConfigMapState.
+const RunSummaryStateKey = "runSummary"
+
+// RunSummary is the compact summary of a Run written by RecordRunSummary, for
+// those who have only the YAML of the object to go on.
+type RunSummary struct {
+	// Time is when the Run ended, by the chain's Clock, to the second.
+	Time time.Time `json:"time"`
+	// RunID is the ID of the Run, as in its logs.
+	RunID string `json:"runID"`
+	// Fired are the rules whose actions ran, in order.
+	Fired []string `json:"fired,omitempty"`
+	// Omitted is the number of fired rules left out of Fired for lack of
+	// space.
+	Omitted int `json:"omitted,omitempty"`
+	// Error is the message of the error of the Run, redacted, if any.
+	Error string `json:"error,omitempty"`
+	// RequeueAfter is the requeue interval of the Run, if any.
+	RequeueAfter string `json:"requeueAfter,omitempty"`
+	// RequeueReason is the reason of the requeue interval, if any.
+	RequeueReason string `json:"requeueReason,omitempty"`
+	// Truncated is true if rules or the error were left out or shortened for
+	// lack of space.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// sameOutcome returns true if the summaries differ at most by their Time and
+// RunID.
+func (s RunSummary) sameOutcome(other RunSummary) bool {
+	s.Time, s.RunID = other.Time, other.RunID
+	a, _ := json.Marshal(s)
+	b, _ := json.Marshal(other)
+	return string(a) == string(b)
+}
+
+// runSummaryOptions holds the options of RecordRunSummary.
+type runSummaryOptions struct {
+	redact []*regexp.Regexp
+}
+
+// RunSummaryOption configures RecordRunSummary.
+type RunSummaryOption func(o *runSummaryOptions)
+
+// SummaryRedact replaces the matches of the patterns in the error of the
+// summary with "***", e.g. for errors quoting the data of objects.
+func SummaryRedact(patterns ...*regexp.Regexp) RunSummaryOption {
+	return func(o *runSummaryOptions) {
+		o.redact = append(o.redact, patterns...)
+	}
+}
+
+// RecordRunSummary returns an action that, at the end of the Run, once its
+// requeue and error are known, writes a RunSummary of it as JSON to the
+// annotation of the primary resource with the given key. Give it in a Finally
+// rule, so that it runs even if the Run stops or fails. The summary is
+// truncated to maxBytes, or DefaultRunSummaryMaxBytes if zero, leaving out
+// fired rules and then shortening the error; the complete summary is kept in
+// the state of the primary resource, under RunSummaryStateKey, if the
+// chain's State is a ConfigMapState. The write is skipped if the summary
+// differs from the one in the annotation only by its Time and RunID, so that
+// Runs with the same outcome do not update the object. A failed write makes
+// the Run fail.
+func (c *Chain) RecordRunSummary(annotationKey string, maxBytes int, opts ...RunSummaryOption) Action {
+	if !c.primaryField().IsValid() {
+		panic("run summary requires a primary resource")
+	}
+	if maxBytes < 0 {
+		panic("run summary size limit must not be negative")
+	}
+	if maxBytes == 0 {
+		maxBytes = DefaultRunSummaryMaxBytes
+	}
+	o := &runSummaryOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(ctx context.Context) {
+		c.atEnd(func(ctx context.Context) error {
+			return c.writeRunSummary(ctx, annotationKey, maxBytes, o)
+		})
+	}
+}
+
+// atEnd defers f to the end of the Run, after its requeue is known and its
+// batched status is written. An error of f makes the Run fail, if it has not
+// already.
+func (c *Chain) atEnd(f func(ctx context.Context) error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.deferred = append(c.deferred, f)
+}
+
+// runDeferred runs the functions deferred to the end of the Run, in order.
+func (c *Chain) runDeferred(ctx context.Context) {
+	c.lock.Lock()
+	deferred := c.deferred
+	c.deferred = nil
+	c.lock.Unlock()
+	for _, f := range deferred {
+		if err := f(ctx); err != nil && !c.failed() {
+			c.doError(err)
+		}
+	}
+}
+
+// recordFired records that the action of the current rule ran.
+func (c *Chain) recordFired() {
+	rule := c.currentRule()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.fired = append(c.fired, rule)
+}
+
+// runSummary returns the summary of the Run so far.
+func (c *Chain) runSummary(o *runSummaryOptions) RunSummary {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	s := RunSummary{
+		Time:  c.now().UTC().Truncate(time.Second),
+		RunID: c.runLog.id,
+		Fired: append([]string(nil), c.fired...),
+	}
+	if c.err != nil {
+		s.Error = c.err.Error()
+		for _, re := range o.redact {
+			s.Error = re.ReplaceAllString(s.Error, redactedValue)
+		}
+	}
+	if c.interval > 0 {
+		s.RequeueAfter = c.interval.String()
+		s.RequeueReason = c.requeueReason
+	}
+	return s
+}
+
+// truncateRunSummary returns the JSON of the summary, leaving out fired
+// rules and then shortening the error until it fits in maxBytes, and the
+// summary written.
+func truncateRunSummary(s RunSummary, maxBytes int) ([]byte, RunSummary, error) {
+	msg, keep := s.Error, len(s.Error)
+	for {
+		data, err := json.Marshal(s)
+		if err != nil || len(data) <= maxBytes {
+			return data, s, err
+		}
+		s.Truncated = true
+		switch {
+		case len(s.Fired) > 0:
+			s.Fired = s.Fired[:len(s.Fired)-1]
+			s.Omitted++
+		case s.Error != "":
+			keep = max(keep-(len(data)-maxBytes)-len("..."), 0)
+			for keep > 0 && !utf8.RuneStart(msg[keep]) {
+				keep--
+			}
+			s.Error = ""
+			if keep > 0 {
+				s.Error = msg[:keep] + "..."
+			}
+		default:
+			return nil, s, fmt.Errorf("run summary of %d bytes exceeds the limit of %d bytes", len(data), maxBytes)
+		}
+	}
+}
+
+// writeRunSummary writes the summary of the Run to the annotation of the
+// primary resource, unless its outcome is the same as the one there.
+func (c *Chain) writeRunSummary(ctx context.Context, annotationKey string, maxBytes int, o *runSummaryOptions) error {
+	primary := c.primary()
+	if primary == nil {
+		return nil
+	}
+	full := c.runSummary(o)
+	data, written, err := truncateRunSummary(full, maxBytes)
+	if err != nil {
+		return fmt.Errorf("record run summary %s: %w", c.describe(primary), err)
+	}
+	var current RunSummary
+	if value, ok := primary.GetAnnotations()[annotationKey]; ok && json.Unmarshal([]byte(value), &current) == nil && written.sameOutcome(current) {
+		log.FromContext(ctx).V(1).Info("run summary unchanged, not writing it", "annotation", annotationKey)
+		return nil
+	}
+	if store, ok := c.stateStore().(ConfigMapState); ok && written.Truncated {
+		complete, err := json.Marshal(full)
+		if err != nil {
+			return err
+		}
+		value := string(complete)
+		if err := store.Update(ctx, c.Client, primary, map[string]*string{RunSummaryStateKey: &value}); err != nil {
+			return fmt.Errorf("record run summary %s: %w", c.describe(primary), err)
+		}
+	}
+	fieldPtr := c.primaryField().Addr().Interface()
+	if err := c.setMetadataE(fieldPtr, annotations, annotationKey, func() string { return string(data) }, false)(ctx); err != nil {
+		return fmt.Errorf("record run summary %s: %w", c.describe(primary), err)
+	}
+	return nil
+}
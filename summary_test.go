@@ -0,0 +1,121 @@
+package operchain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// summaryKey is the annotation of the run summaries of the tests.
+const summaryKey = "test.operchain.io/run-summary"
+
+// summaryChain returns a chain over the Widget demo with the rules returned
+// by rulesFn, and a Finally rule recording the run summary.
+func summaryChain(rulesFn func(c *Chain) []Rule, maxBytes int, opts ...RunSummaryOption) (*Chain, client.Client) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", UID: "uid-demo"}},
+	).Build()
+	c := &Chain{Clock: clocktesting.NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))}
+	c.InitializeChain(cl, &struct{ Widget *Widget }{}, nil)
+	c.Rules = rulesFn(c)
+	c.Finally = []Rule{{Name: "summary", Do: c.RecordRunSummary(summaryKey, maxBytes, opts...)}}
+	return c, cl
+}
+
+// runSummaryOf runs the chain for the Widget demo and returns the report and
+// the summary in its annotation.
+func runSummaryOf(t *testing.T, c *Chain, cl client.Client) (*RunReport, string, RunSummary) {
+	report, _ := c.RunWithReport(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	w := &Widget{}
+	assert.NoError(t, cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "demo"}, w), "the Widget was not read")
+	value := w.Annotations[summaryKey]
+	var s RunSummary
+	assert.NoError(t, json.Unmarshal([]byte(value), &s), "the summary is not JSON")
+	return report, value, s
+}
+
+// Test_If_RecordRunSummary_Writes_The_Outcome_Once tests that the summary
+// records the fired rules, the error, and the requeue of the Run, and that a
+// Run with the same outcome does not write it again.
+func Test_If_RecordRunSummary_Writes_The_Outcome_Once(t *testing.T) {
+	c, cl := summaryChain(func(c *Chain) []Rule {
+		return []Rule{
+			{Name: "requeue", Do: c.Requeue(time.Minute)},
+			{Name: "skipped", When: False(), Do: func(context.Context) {}},
+			{Name: "fail", Do: c.Error(errors.New("boom"))},
+		}
+	}, 0)
+	report, _, s := runSummaryOf(t, c, cl)
+	assert.Equal(t, report.RunID, s.RunID, "the run ID was not recorded")
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), s.Time.UTC(), "the time was not recorded")
+	assert.Equal(t, []string{"requeue", "fail", "summary"}, s.Fired, "the fired rules were not recorded")
+	assert.Equal(t, "boom", s.Error, "the error was not recorded")
+	assert.Equal(t, "1m0s", s.RequeueAfter, "the requeue was not recorded")
+	assert.Equal(t, RequeueReasonUnspecified, s.RequeueReason, "the requeue reason was not recorded")
+	assert.False(t, s.Truncated, "the summary was truncated")
+
+	c.Clock.(*clocktesting.FakeClock).Step(time.Minute)
+	report, _, again := runSummaryOf(t, c, cl)
+	assert.Empty(t, report.Audit, "the unchanged summary was written")
+	assert.Equal(t, s, again, "the unchanged summary was replaced")
+}
+
+// Test_If_RecordRunSummary_Truncates_To_The_Limit tests that a summary too
+// large for the limit leaves out fired rules and shortens the error, and that
+// the complete summary is kept in a ConfigMapState.
+func Test_If_RecordRunSummary_Truncates_To_The_Limit(t *testing.T) {
+	c, cl := summaryChain(func(c *Chain) []Rule {
+		var rules []Rule
+		for i := 0; i < 20; i++ {
+			rules = append(rules, Rule{Name: fmt.Sprintf("a rule with a rather long name %d", i), Do: func(context.Context) {}})
+		}
+		return append(rules, Rule{Name: "fail", Do: c.Error(errors.New(strings.Repeat("é", 200)))})
+	}, 160)
+	c.State = ConfigMapState{Namespace: "operator"}
+	_, value, s := runSummaryOf(t, c, cl)
+	assert.LessOrEqual(t, len(value), 160, "the summary exceeds the limit")
+	assert.True(t, s.Truncated, "the summary was not marked truncated")
+	assert.Empty(t, s.Fired, "the fired rules were not left out")
+	assert.Equal(t, 22, s.Omitted, "the fired rules left out were not counted")
+	assert.True(t, strings.HasSuffix(s.Error, "..."), "the error was not shortened")
+	assert.True(t, strings.HasPrefix(s.Error, "éé"), "the error was not kept in part")
+
+	cm := &corev1.ConfigMap{}
+	assert.NoError(t, cl.Get(context.Background(), types.NamespacedName{Namespace: "operator", Name: "operchain-state-uid-demo"}, cm), "the complete summary was not kept")
+	var full RunSummary
+	assert.NoError(t, json.Unmarshal([]byte(cm.Data[RunSummaryStateKey]), &full), "the complete summary is not JSON")
+	assert.Len(t, full.Fired, 22, "the complete summary lacks fired rules")
+	assert.Equal(t, strings.Repeat("é", 200), full.Error, "the complete summary lacks the error")
+}
+
+// Test_If_RecordRunSummary_Redacts_The_Error tests that the matches of the
+// redaction patterns are replaced in the error of the summary.
+func Test_If_RecordRunSummary_Redacts_The_Error(t *testing.T) {
+	c, cl := summaryChain(func(c *Chain) []Rule {
+		return []Rule{{Name: "fail", Do: c.Error(errors.New("cannot connect with password=hunter2 to db"))}}
+	}, 0, SummaryRedact(regexp.MustCompile(`password=\S+`)))
+	_, value, s := runSummaryOf(t, c, cl)
+	assert.Equal(t, "cannot connect with *** to db", s.Error, "the error was not redacted")
+	assert.NotContains(t, value, "hunter2", "the secret was written")
+}
+
+// Test_If_RecordRunSummary_Requires_A_Primary_Resource tests that the action
+// cannot be constructed for a chain without a primary resource.
+func Test_If_RecordRunSummary_Requires_A_Primary_Resource(t *testing.T) {
+	c := &Chain{}
+	assert.Panics(t, func() { c.RecordRunSummary(summaryKey, 0) }, "the action was constructed")
+}
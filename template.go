@@ -0,0 +1,132 @@
+package operchain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// templateOptions holds the options of FromTemplate.
+type templateOptions struct {
+	apply applyOptions
+	owned bool
+}
+
+// TemplateOption configures FromTemplate.
+type TemplateOption func(o *templateOptions)
+
+// TemplateOwned makes the primary resource the controller owner of the
+// rendered objects.
+func TemplateOwned() TemplateOption {
+	return func(o *templateOptions) {
+		o.owned = true
+	}
+}
+
+// TemplateFieldOwner sets the field manager of the apply patches, overriding
+// the Chain's FieldOwner.
+func TemplateFieldOwner(owner string) TemplateOption {
+	return func(o *templateOptions) {
+		o.apply.fieldOwner = owner
+	}
+}
+
+// FromTemplate returns an action that renders tmpl, a text/template of YAML
+// documents separated by "---" lines, with the value returned by data, and
+// server-side applies each document as Apply does. The template is parsed
+// once, here; a template that does not parse makes Validate fail, as well as
+// the action. Errors in rendering or decoding name the template and the line.
+// Empty documents are skipped.
+func (c *Chain) FromTemplate(name, tmpl string, data func() interface{}, opts ...TemplateOption) Action {
+	return c.Try(c.FromTemplateE(name, tmpl, data, opts...))
+}
+
+// FromTemplateE is like FromTemplate, but returns the error.
+func (c *Chain) FromTemplateE(name, tmpl string, data func() interface{}, opts ...TemplateOption) ActionE {
+	o := &templateOptions{apply: applyOptions{force: true}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		err = fmt.Errorf("parse template: %w", err)
+		c.invalid = append(c.invalid, err)
+		return func(ctx context.Context) error { return err }
+	}
+	return func(ctx context.Context) error {
+		objs, err := renderDocuments(t, data())
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			if err := c.track(obj); err != nil {
+				return err
+			}
+			if o.owned {
+				if err := c.ownByPrimary(obj, true); err != nil {
+					return err
+				}
+			}
+			if err := c.sendApply(ctx, obj, &o.apply); err != nil {
+				return err
+			}
+			c.recordOperation(obj, OperationResultApplied)
+		}
+		return nil
+	}
+}
+
+// renderDocuments renders t with data and decodes the documents of the result.
+func renderDocuments(t *template.Template, data interface{}) ([]*unstructured.Unstructured, error) {
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("render template: %w", err)
+	}
+	var objs []*unstructured.Unstructured
+	for _, doc := range splitDocuments(out.String()) {
+		if strings.TrimSpace(doc.text) == "" {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(doc.text), &obj.Object); err != nil {
+			return nil, fmt.Errorf("decode template %s: document at line %d: %w", t.Name(), doc.line, err)
+		}
+		if obj.Object == nil {
+			continue
+		}
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("decode template %s: document at line %d: apiVersion and kind are required", t.Name(), doc.line)
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// document is a YAML document of a rendered template.
+type document struct {
+	// line is the line of the rendered template the document starts at.
+	line int
+	text string
+}
+
+// splitDocuments splits a YAML stream into its documents.
+func splitDocuments(stream string) []document {
+	docs := []document{{line: 1}}
+	var text strings.Builder
+	for i, line := range strings.SplitAfter(stream, "\n") {
+		if strings.TrimRight(line, " \t\r\n") == "---" {
+			docs[len(docs)-1].text = text.String()
+			text.Reset()
+			docs = append(docs, document{line: i + 2})
+			continue
+		}
+		text.WriteString(line)
+	}
+	docs[len(docs)-1].text = text.String()
+	return docs
+}
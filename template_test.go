@@ -0,0 +1,74 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// webTemplate renders a ConfigMap and a Service for a web application.
+const webTemplate = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}-config
+  namespace: {{ .Namespace }}
+data:
+  replicas: "{{ .Replicas }}"
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Name }}
+  namespace: {{ .Namespace }}
+spec:
+  ports:
+  - port: {{ .Port }}
+`
+
+// webData is the data of webTemplate.
+type webData struct {
+	Name, Namespace string
+	Replicas, Port  int
+}
+
+// Test_If_FromTemplate_Applies_Every_Document tests that FromTemplate renders
+// a two-document template and applies both objects, owned by the primary.
+func Test_If_FromTemplate_Applies_Every_Document(t *testing.T) {
+	var patches []recordedPatch
+	var res struct {
+		Widget *Widget
+	}
+	res.Widget = &Widget{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "widget-uid"}}
+	c := &Chain{Client: patchRecorder(&patches, nil), Resources: &res}
+	action := c.FromTemplateE("web", webTemplate, func() interface{} {
+		return webData{Name: "web", Namespace: "default", Replicas: 3, Port: 8080}
+	}, TemplateOwned(), TemplateFieldOwner("web-controller"))
+	assert.NoError(t, c.Validate(), "valid template failed validation")
+	assert.NoError(t, action(context.Background()), "FromTemplate failed")
+	owner := `"ownerReferences":[{"apiVersion":"test.operchain.io/v1","kind":"Widget","name":"web","uid":"widget-uid","controller":true,"blockOwnerDeletion":true}]`
+	if assert.Len(t, patches, 2, "not every document was applied") {
+		assert.Equal(t, types.ApplyPatchType, patches[0].Type, "document was not applied")
+		assert.Equal(t, "web-controller", patches[0].Options.FieldManager, "field owner was not used")
+		assert.JSONEq(t, `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"web-config","namespace":"default",`+owner+`},"data":{"replicas":"3"}}`, patches[0].Data, "wrong ConfigMap")
+		assert.JSONEq(t, `{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","namespace":"default",`+owner+`},"spec":{"ports":[{"port":8080}]}}`, patches[1].Data, "wrong Service")
+	}
+}
+
+// Test_If_FromTemplate_Reports_Template_Errors tests that a template that does
+// not parse fails Validate, and that render and decode errors name the
+// template and line.
+func Test_If_FromTemplate_Reports_Template_Errors(t *testing.T) {
+	c := &Chain{}
+	c.FromTemplate("broken", "kind: {{ .Kind ", nil)
+	assert.ErrorContains(t, c.Validate(), `template: broken:1:`, "unparsable template passed validation")
+
+	c = &Chain{}
+	render := c.FromTemplateE("render", "kind: ConfigMap\nname: {{ .Missing }}\n", func() interface{} { return map[string]string{} })
+	assert.NoError(t, c.Validate(), "parsable template failed validation")
+	assert.ErrorContains(t, render(context.Background()), `template: render:2:`, "render error did not name the template and line")
+	decode := c.FromTemplateE("decode", "apiVersion: v1\nkind: ConfigMap\n---\napiVersion: v1\nkind: [\n", func() interface{} { return nil })
+	assert.ErrorContains(t, decode(context.Background()), "decode template decode: document at line 4", "decode error did not name the template and line")
+}
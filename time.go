@@ -0,0 +1,144 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// now returns the current time according to the chain's Clock. The chain
+// takes the time only from now, since and after, never from the time package,
+// so that tests can control it with a fake clock.
+func (c *Chain) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
+
+// since returns the time elapsed since t according to the chain's Clock.
+func (c *Chain) since(t time.Time) time.Duration {
+	return c.now().Sub(t)
+}
+
+// after returns a channel that receives the time once d has passed on the
+// chain's Clock.
+func (c *Chain) after(d time.Duration) <-chan time.Time {
+	if c.Clock == nil {
+		return time.After(d)
+	}
+	return c.Clock.After(d)
+}
+
+// OlderThan returns a predicate that is true when the object in the given
+// resource field was created more than d ago. While it is false, it suggests
+// requeueing at the moment it becomes true.
+func (c *Chain) OlderThan(fieldPtr interface{}, d time.Duration) *predicate {
+	return c.OlderThanFunc(fieldPtr, d, func(obj client.Object) time.Time {
+		return obj.GetCreationTimestamp().Time
+	})
+}
+
+// OlderThanFunc is like OlderThan, but takes the object's timestamp from the
+// given function instead of its creationTimestamp. A zero timestamp evaluates
+// to false.
+func (c *Chain) OlderThanFunc(fieldPtr interface{}, d time.Duration, timestamp func(obj client.Object) time.Time) *predicate {
+	checkField(fieldPtr)
+	return c.olderThan(fmt.Sprintf("OlderThan(%s, %s)", c.fieldName(fieldPtr), d), fieldPtr, d, timestamp)
+}
+
+// DeletionOlderThan returns a predicate that is true when the object in the
+// given resource field has been terminating for more than d, e.g. because a
+// finalizer is stuck. While the deletion is more recent, it suggests requeueing
+// at the moment it becomes true.
+func (c *Chain) DeletionOlderThan(fieldPtr interface{}, d time.Duration) *predicate {
+	checkField(fieldPtr)
+	name := fmt.Sprintf("DeletionOlderThan(%s, %s)", c.fieldName(fieldPtr), d)
+	return c.olderThan(name, fieldPtr, d, func(obj client.Object) time.Time {
+		if ts := obj.GetDeletionTimestamp(); ts != nil {
+			return ts.Time
+		}
+		return time.Time{}
+	})
+}
+
+// olderThan returns a predicate with the given name that is true when the
+// timestamp of the object in the given resource field is more than d ago.
+func (c *Chain) olderThan(name string, fieldPtr interface{}, d time.Duration, timestamp func(obj client.Object) time.Time) *predicate {
+	return pcache.NewLeaf(name, func(e *pcache.Evaluation) bool {
+		obj := objectAt(fieldPtr)
+		if obj == nil {
+			e.Notef("object not loaded")
+			return false
+		}
+		ts := timestamp(obj)
+		if ts.IsZero() {
+			e.Notef("timestamp not set")
+			return false
+		}
+		return c.reached(e, ts.Add(d))
+	})
+}
+
+// After returns a predicate that is true once the time returned by t has been
+// reached. While it is false, it suggests requeueing at that time.
+func (c *Chain) After(t func() time.Time) *predicate {
+	return pcache.NewLeaf("After", func(e *pcache.Evaluation) bool {
+		return c.reached(e, t())
+	})
+}
+
+// reached returns true if the deadline has been reached, and otherwise
+// suggests requeueing when it will be.
+func (c *Chain) reached(e *pcache.Evaluation, deadline time.Time) bool {
+	remaining := deadline.Sub(c.now())
+	if remaining <= 0 {
+		return true
+	}
+	e.Notef("%s remaining", remaining)
+	e.SuggestRequeue(remaining)
+	return false
+}
+
+// Cooldown returns an action that runs fn at most once per period for the
+// request's object. When it is invoked sooner, it skips fn and requeues at
+// the moment the period ends. The time fn last ran is kept across runs under
+// the given key, in memory, so an operator restart forgets it and fn may then
+// run once sooner.
+func (c *Chain) Cooldown(key string, period time.Duration, fn Action) Action {
+	storeKey := "cooldown:" + key
+	return writesOf(func(ctx context.Context) {
+		now := c.now()
+		if last, ok := c.storeGet(storeKey); ok {
+			if remaining := last.(time.Time).Add(period).Sub(now); remaining > 0 {
+				c.doRequeue(remaining)
+				return
+			}
+		}
+		c.storeSet(storeKey, now)
+		fn(ctx)
+	}, fn)
+}
+
+// RequeueBefore returns an action that requeues margin before the time
+// returned by expiry, e.g. to rotate a certificate before it expires, or at
+// once if that moment has passed. It does nothing if expiry reports that the
+// time is unknown.
+func (c *Chain) RequeueBefore(expiry func() (time.Time, bool), margin time.Duration) Action {
+	return func(ctx context.Context) {
+		at, ok := expiry()
+		if !ok {
+			return
+		}
+		remaining := at.Add(-margin).Sub(c.now())
+		if remaining <= 0 {
+			// The smallest interval that requeues.
+			remaining = time.Nanosecond
+		}
+		c.doRequeue(remaining)
+	}
+}
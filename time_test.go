@@ -0,0 +1,211 @@
+package operchain
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	gotoken "go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Test_If_OlderThan_Suggests_Requeue_Until_True tests that OlderThan is false
+// and suggests the remaining time until the object is old enough.
+func Test_If_OlderThan_Suggests_Requeue_Until_True(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clocktesting.NewFakeClock(start.Add(5 * 24 * time.Hour))
+	var res struct {
+		Secret *corev1.Secret
+	}
+	c := &Chain{Resources: &res, Clock: clk}
+	p := c.OlderThan(&res.Secret, 20*24*time.Hour)
+	cache := pcache.New()
+	assert.False(t, p.Eval(cache), "predicate was true for an unloaded object")
+	assert.Zero(t, cache.SuggestedRequeue(), "requeue was suggested for an unloaded object")
+
+	res.Secret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(start)}}
+	cache = pcache.New()
+	assert.False(t, p.Eval(cache), "predicate was true for a young object")
+	assert.Equal(t, 15*24*time.Hour, cache.SuggestedRequeue(), "suggested requeue was not the remaining time")
+
+	clk.Step(15 * 24 * time.Hour)
+	cache = pcache.New()
+	assert.True(t, p.Eval(cache), "predicate was false for an old object")
+	assert.Zero(t, cache.SuggestedRequeue(), "requeue was suggested for a true predicate")
+}
+
+// Test_If_OlderThanFunc_Uses_The_Extracted_Timestamp tests that OlderThanFunc
+// uses the given timestamp instead of the creation timestamp.
+func Test_If_OlderThanFunc_Uses_The_Extracted_Timestamp(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var res struct {
+		Secret *corev1.Secret
+	}
+	c := &Chain{Resources: &res, Clock: clocktesting.NewFakeClock(now)}
+	p := c.OlderThanFunc(&res.Secret, time.Hour, func(obj client.Object) time.Time {
+		ts, _ := time.Parse(time.RFC3339, obj.GetAnnotations()["rotated-at"])
+		return ts
+	})
+	res.Secret = &corev1.Secret{}
+	assert.False(t, p.Eval(pcache.New()), "predicate was true without a timestamp")
+	res.Secret.Annotations = map[string]string{"rotated-at": now.Add(-2 * time.Hour).Format(time.RFC3339)}
+	assert.True(t, p.Eval(pcache.New()), "predicate was false for an old timestamp")
+}
+
+// Test_If_After_Folds_Suggestion_Into_Requeue tests that the requeue suggested
+// by a false After predicate is folded into the result of Run, using the
+// shortest interval.
+func Test_If_After_Folds_Suggestion_Into_Requeue(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &Chain{}
+	c.InitializeChain(fake.NewClientBuilder().Build(), &struct{}{}, []Rule{
+		{
+			When: c.After(func() time.Time { return now.Add(time.Hour) }),
+			Do:   c.Error(assert.AnError),
+		},
+		{
+			Do: c.Requeue(2 * time.Hour),
+		},
+	})
+	c.Clock = clocktesting.NewFakeClock(now)
+	result, err := c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, time.Hour, result.RequeueAfter, "requeue was not the suggested interval")
+
+	c.Clock = clocktesting.NewFakeClock(now.Add(time.Hour))
+	_, err = c.Run(context.Background(), ctrl.Request{})
+	assert.Equal(t, assert.AnError, err, "rule did not fire after the deadline")
+}
+
+// Test_If_PredicateWithRetry_Sets_RequeueAfter tests that the retry interval
+// of a false PredicateWithRetry becomes the requeue interval of Run.
+func Test_If_PredicateWithRetry_Sets_RequeueAfter(t *testing.T) {
+	propagated := false
+	dnsPropagated := Named("dnsPropagated", PredicateWithRetry(func() (bool, time.Duration) {
+		return propagated, 30 * time.Second
+	}))
+	c := &Chain{}
+	c.InitializeChain(fake.NewClientBuilder().Build(), &struct{}{}, []Rule{
+		{When: And(True(), dnsPropagated), Do: func(context.Context) {}},
+	})
+	result, err := c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 30*time.Second, result.RequeueAfter, "requeue was not the retry interval")
+
+	propagated = true
+	result, err = c.Run(context.Background(), ctrl.Request{})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Zero(t, result.RequeueAfter, "requeue was suggested by a true predicate")
+}
+
+// Test_If_DeletionOlderThan_Crosses_The_Threshold tests that DeletionOlderThan
+// is false for objects not being deleted, suggests requeueing until the
+// deletion is old enough, and is then true.
+func Test_If_DeletionOlderThan_Crosses_The_Threshold(t *testing.T) {
+	deleted := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clocktesting.NewFakeClock(deleted.Add(10 * time.Minute))
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{Resources: &res, Clock: clk}
+	p := c.DeletionOlderThan(&res.Widget, time.Hour)
+	res.Widget = &Widget{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(deleted.Add(-48 * time.Hour))}}
+	cache := pcache.New()
+	assert.False(t, p.Eval(cache), "predicate was true for an object not being deleted")
+	assert.Zero(t, cache.SuggestedRequeue(), "requeue was suggested for an object not being deleted")
+
+	ts := metav1.NewTime(deleted)
+	res.Widget.DeletionTimestamp = &ts
+	cache = pcache.New()
+	assert.False(t, p.Eval(cache), "predicate was true for a recent deletion")
+	assert.Equal(t, 50*time.Minute, cache.SuggestedRequeue(), "suggested requeue was not the expiry moment")
+
+	clk.Step(50 * time.Minute)
+	cache = pcache.New()
+	assert.True(t, p.Eval(cache), "predicate was false for a stuck deletion")
+}
+
+// Test_If_Cooldown_Runs_At_Most_Once_Per_Period tests that Cooldown skips its
+// action and requeues for the remaining time until the period ends, and runs
+// it again at the boundary instant.
+func Test_If_Cooldown_Runs_At_Most_Once_Per_Period(t *testing.T) {
+	clk := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := &Chain{Clock: clk}
+	c.req = ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: "demo"}}
+	snapshots := 0
+	action := c.Cooldown("snapshot", 10*time.Minute, func(context.Context) { snapshots++ })
+	action(context.Background())
+	assert.Equal(t, 1, snapshots, "action did not run")
+
+	clk.Step(10*time.Minute - time.Nanosecond)
+	action(context.Background())
+	assert.Equal(t, 1, snapshots, "action ran during the cooldown")
+	assert.Equal(t, time.Nanosecond, c.interval, "requeue was not at the end of the cooldown")
+
+	clk.Step(time.Nanosecond)
+	action(context.Background())
+	assert.Equal(t, 2, snapshots, "action did not run at the end of the cooldown")
+}
+
+// Test_If_Time_Comes_From_The_Chain_Clock tests that no code of the chain
+// takes the time from the time package rather than from now, since and
+// after, which use the chain's Clock, nor waits with the functions of the
+// retry and wait packages rather than retryOnConflict and Retry, except where
+// there is no chain.
+func Test_If_Time_Comes_From_The_Chain_Clock(t *testing.T) {
+	forbidden := map[string]bool{
+		"Now": true, "Since": true, "Until": true, "After": true, "AfterFunc": true,
+		"NewTimer": true, "NewTicker": true, "Tick": true, "Sleep": true,
+	}
+	// allowed maps the functions allowed to use the wall clock to whether
+	// they are methods.
+	allowed := map[string]bool{"time.go now": true, "time.go after": true, "retry.go retryOnConflict": false}
+	files, err := filepath.Glob("*.go")
+	assert.NoError(t, err)
+	fset := gotoken.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok {
+				if method, found := allowed[name+" "+fn.Name.Name]; found && method == (fn.Recv != nil) {
+					continue
+				}
+			}
+			ast.Inspect(decl, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+						if pkg, ok := sel.X.(*ast.Ident); ok && (pkg.Name == "retry" || pkg.Name == "wait") {
+							t.Errorf("%s: %s.%s waits on the wall clock; use retryOnConflict or Retry", fset.Position(sel.Pos()), pkg.Name, sel.Sel.Name)
+						}
+					}
+				}
+				sel, ok := n.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "time" && forbidden[sel.Sel.Name] {
+					t.Errorf("%s: time.%s bypasses the chain's Clock; use now, since or after", fset.Position(sel.Pos()), sel.Sel.Name)
+				}
+				return true
+			})
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package operchain
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// tracerName is the name of the tracer of chains, identifying the library.
+const tracerName = "github.com/smxlong/operchain"
+
+// noSpan is the span of the work of a chain that is not traced. It records
+// nothing.
+var noSpan = trace.SpanFromContext(context.Background())
+
+// WithTracing makes the chain trace its Runs with tp: a Run is a span with the
+// request as attributes, whose children are the loading of the resources and
+// each rule whose predicate was evaluated, with its outcome and the error of
+// its action. Actions get the span of their rule in their context, so that
+// their own traced calls join the trace. Chains run by the rules of a traced
+// chain are traced with its tracer unless they have their own.
+func WithTracing(tp trace.TracerProvider) Option {
+	return func(c *Chain) {
+		c.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// startRunSpan chooses the tracer of the Run, and starts the span of the Run
+// if there is one.
+func (c *Chain) startRunSpan(ctx context.Context, req ctrl.Request) (context.Context, trace.Span) {
+	c.runTracer = c.tracer
+	if _, nested := ctx.Value(runLogKey{}).(runLog); nested && c.runTracer == nil {
+		if parent := chainFrom(ctx); parent != nil {
+			c.runTracer = parent.runTracer
+		}
+	}
+	name := "Run"
+	if c.Name != "" {
+		name += " " + c.Name
+	}
+	return c.startSpan(ctx, name,
+		attribute.String("operchain.chain", c.Name),
+		attribute.String("operchain.request.namespace", req.Namespace),
+		attribute.String("operchain.request.name", req.Name),
+	)
+}
+
+// startSpan starts a span of the Run, or returns noSpan if the Run is not
+// traced.
+func (c *Chain) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if c.runTracer == nil {
+		return ctx, noSpan
+	}
+	return c.runTracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, in the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,76 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Test_If_WithTracing_Traces_The_Run tests that a traced chain records a span
+// of the Run, with children for loading the resources and for each evaluated
+// rule, that subchains and the spans of actions nest under their rule, and
+// that failures are recorded.
+func Test_If_WithTracing_Traces_The_Run(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	var res, subRes struct {
+		Widget *Widget
+	}
+	sub := &Chain{Name: "sub"}
+	sub.InitializeChain(cl, &subRes, []Rule{{Name: "inner", Do: func(context.Context) {}}})
+	c := &Chain{Name: "widgets"}
+	c.InitializeChain(cl, &res, []Rule{
+		{Name: "skipped", When: False(), Do: func(context.Context) {}},
+		{Name: "user", Do: func(ctx context.Context) {
+			_, span := tp.Tracer("user").Start(ctx, "call")
+			span.End()
+		}},
+		{Name: "nested", Do: c.Subchain(sub)},
+		{Name: "failing", Do: c.Error(errors.New("broken"))},
+	}, WithTracing(tp))
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.Error(t, err, "Run did not fail")
+
+	// The spans by name, keeping the first of those of the same name, which
+	// is the outer chain's.
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if _, ok := spans[span.Name()]; !ok {
+			spans[span.Name()] = span
+		}
+	}
+	parentOf := func(name string) string {
+		for parent, span := range spans {
+			if span.SpanContext().SpanID() == spans[name].Parent().SpanID() {
+				return parent
+			}
+		}
+		return ""
+	}
+	assert.Len(t, recorder.Ended(), 10, "wrong spans recorded")
+	assert.False(t, spans["Run widgets"].Parent().IsValid(), "Run is not the root span")
+	assert.Contains(t, spans["Run widgets"].Attributes(), attribute.String("operchain.request.name", "demo"), "request was not recorded")
+	for _, name := range []string{"loadResources", "skipped", "user", "nested", "failing"} {
+		assert.Equal(t, "Run widgets", parentOf(name), "%s is not a child of the Run", name)
+	}
+	assert.Contains(t, spans["skipped"].Attributes(), attribute.Bool("operchain.rule.fired", false), "outcome of predicate was not recorded")
+	assert.Contains(t, spans["user"].Attributes(), attribute.Bool("operchain.rule.fired", true), "outcome of predicate was not recorded")
+	assert.Equal(t, "user", parentOf("call"), "span of action did not join the trace")
+	assert.Equal(t, "nested", parentOf("Run sub"), "subchain did not nest")
+	assert.Equal(t, "Run sub", parentOf("inner"), "rule of subchain did not nest")
+	assert.Equal(t, codes.Error, spans["failing"].Status().Code, "error of rule was not recorded")
+	assert.Equal(t, codes.Error, spans["Run widgets"].Status().Code, "error of Run was not recorded")
+}
@@ -0,0 +1,190 @@
+package operchain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// TrackingLabel is the label that marks the objects written by a chain with
+// tracking enabled. Its value is derived from the chain's identity and the UID
+// of the primary resource, as described by TrackingID.
+const TrackingLabel = "operchain.smxlong.github.io/tracking-id"
+
+// Tracking configures the tracking of the objects a chain manages, so that
+// PruneTracked can delete those it no longer produces, including cluster-scoped
+// objects and objects in other namespaces, which cannot be owned by the
+// primary resource.
+type Tracking struct {
+	// Identity distinguishes the chain from other chains managing objects for
+	// the same primary resource. If empty, the field owner of Apply is used.
+	Identity string
+	// Kinds are the kinds of objects the chain may have written, which are
+	// listed to find the tracked objects.
+	Kinds []schema.GroupVersionKind
+	// Namespaces are the namespaces in which namespaced kinds are listed. If
+	// empty, the namespace of the request is used.
+	Namespaces []string
+}
+
+// trackedKey identifies an object produced by a Run, regardless of the version
+// of its kind.
+type trackedKey struct {
+	kind schema.GroupKind
+	key  client.ObjectKey
+}
+
+// TrackingID returns the value of TrackingLabel for a chain with the given
+// identity and a primary resource with the given UID: "v1-" followed by the
+// first 40 hex digits of the SHA-256 of the identity, a slash, and the UID.
+// The format is part of the API, so that objects written by one version of an
+// operator are recognized by later versions.
+func TrackingID(identity string, uid string) string {
+	sum := sha256.Sum256([]byte(identity + "/" + uid))
+	return "v1-" + hex.EncodeToString(sum[:])[:40]
+}
+
+// trackingID returns the value of TrackingLabel for the current Run.
+func (c *Chain) trackingID() (string, error) {
+	primary := c.primary()
+	if primary == nil {
+		return "", errors.New("primary resource not loaded")
+	}
+	identity := c.Tracking.Identity
+	if identity == "" {
+		identity = c.fieldOwner(&applyOptions{})
+	}
+	return TrackingID(identity, string(primary.GetUID())), nil
+}
+
+// track labels obj as managed by the chain and records that the Run produced
+// it. It does nothing if tracking is not enabled.
+func (c *Chain) track(obj client.Object) error {
+	if c.Tracking == nil {
+		return nil
+	}
+	id, err := c.trackingID()
+	if err != nil {
+		return fmt.Errorf("cannot track %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	gvk, err := c.gvkFor(obj)
+	if err != nil {
+		return fmt.Errorf("cannot track %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[TrackingLabel] = id
+	obj.SetLabels(labels)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.produced == nil {
+		c.produced = map[trackedKey]bool{}
+	}
+	c.produced[trackedKey{kind: gvk.GroupKind(), key: client.ObjectKeyFromObject(obj)}] = true
+	return nil
+}
+
+// TrackedObjects returns the metadata of the objects labeled as managed by the
+// chain for the primary resource, of the kinds and in the namespaces
+// configured by the chain's Tracking.
+func (c *Chain) TrackedObjects(ctx context.Context) ([]client.Object, error) {
+	if c.Tracking == nil {
+		return nil, errors.New("tracking is not enabled")
+	}
+	id, err := c.trackingID()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list tracked objects: %w", err)
+	}
+	namespaces := c.Tracking.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{c.req.Namespace}
+	}
+	var objs []client.Object
+	for _, gvk := range c.Tracking.Kinds {
+		prototype := &metav1.PartialObjectMetadata{}
+		prototype.SetGroupVersionKind(gvk)
+		namespaced, err := c.IsObjectNamespaced(prototype)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list tracked %s: %w", gvk.Kind, err)
+		}
+		scopes := namespaces
+		if !namespaced {
+			scopes = []string{""}
+		}
+		for _, ns := range scopes {
+			list := &metav1.PartialObjectMetadataList{}
+			list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+			if err := c.List(ctx, list, client.InNamespace(ns), client.MatchingLabels{TrackingLabel: id}); err != nil {
+				return nil, fmt.Errorf("cannot list tracked %s: %w", gvk.Kind, err)
+			}
+			for i := range list.Items {
+				list.Items[i].SetGroupVersionKind(gvk)
+				objs = append(objs, &list.Items[i])
+			}
+		}
+	}
+	return objs, nil
+}
+
+// PruneTracked returns an action that deletes the tracked objects, as listed
+// by TrackedObjects, that were not written by Apply, CreateOrUpdate, or
+// CreateIfNotExists earlier in the Run, so it belongs after the rules that
+// write them. Its options are those of Prune. Errors are aggregated, and do
+// not stop the remaining objects from being pruned.
+func (c *Chain) PruneTracked(opts ...PruneOption) Action {
+	return c.Try(c.PruneTrackedE(opts...))
+}
+
+// PruneTrackedE is like PruneTracked, but returns the error.
+func (c *Chain) PruneTrackedE(opts ...PruneOption) ActionE {
+	o := &pruneOptions{delete: deleteOptions{ignoreNotFound: true}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(ctx context.Context) error {
+		objs, err := c.TrackedObjects(ctx)
+		if err != nil {
+			return err
+		}
+		c.lock.Lock()
+		produced := c.produced
+		c.lock.Unlock()
+		var errs []error
+		pruned := false
+		for _, obj := range objs {
+			key := trackedKey{kind: obj.GetObjectKind().GroupVersionKind().GroupKind(), key: client.ObjectKeyFromObject(obj)}
+			if produced[key] || o.protected(obj) {
+				continue
+			}
+			if o.dryRun {
+				log.FromContext(ctx).Info("would prune", "object", c.describe(obj))
+				c.recordOperation(obj, OperationResultWouldDelete)
+				continue
+			}
+			deleted, err := c.deleteObject(ctx, obj, &o.delete)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if deleted {
+				pruned = true
+				if o.events {
+					c.event(c.primary(), corev1.EventTypeNormal, "Pruned", "Pruned "+c.describe(obj))
+				}
+			}
+		}
+		if pruned {
+			c.invalidateRun()
+		}
+		return errors.Join(errs...)
+	}
+}
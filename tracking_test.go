@@ -0,0 +1,81 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// Test_If_PruneTracked_Deletes_Objects_No_Longer_Applied tests that objects
+// applied by an earlier Run, including a cluster-scoped one, are pruned once
+// they are no longer applied, while those still applied are kept.
+func Test_If_PruneTracked_Deletes_Objects_No_Longer_Applied(t *testing.T) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", UID: "widget-uid"}}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion, rbacv1.SchemeGroupVersion})
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), meta.RESTScopeRoot)
+	// The fake client does not support apply patches, so create the object
+	// instead.
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithRESTMapper(mapper).WithObjects(widget).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				obj.SetResourceVersion("")
+				if err := cl.Create(ctx, obj); !apierrors.IsAlreadyExists(err) {
+					return err
+				}
+				return nil
+			},
+		}).Build()
+	var res struct {
+		Widget *Widget
+	}
+	desired := map[string]bool{"kept": true, "dropped": true, "role": true}
+	c := &Chain{Tracking: &Tracking{Identity: "widgets", Kinds: []schema.GroupVersionKind{
+		corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		rbacv1.SchemeGroupVersion.WithKind("ClusterRole"),
+	}}}
+	apply := func(obj client.Object) Rule {
+		return Rule{When: Predicate(func() bool { return desired[obj.GetName()] }), Do: c.Apply(obj)}
+	}
+	c.InitializeChain(cl, &res, []Rule{
+		apply(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "kept", Namespace: "default"}}),
+		apply(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "dropped", Namespace: "default"}}),
+		apply(&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "role"}}),
+		{Do: c.PruneTracked()},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	tracked, err := c.TrackedObjects(context.Background())
+	assert.NoError(t, err, "TrackedObjects returned an error")
+	assert.Len(t, tracked, 3, "applied objects were not tracked")
+
+	desired["dropped"], desired["role"] = false, false
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	err = cl.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "dropped"}, &corev1.ConfigMap{})
+	assert.True(t, apierrors.IsNotFound(err), "dropped object was not pruned")
+	err = cl.Get(context.Background(), client.ObjectKey{Name: "role"}, &rbacv1.ClusterRole{})
+	assert.True(t, apierrors.IsNotFound(err), "cluster-scoped object was not pruned")
+	assert.NoError(t, cl.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "kept"}, &corev1.ConfigMap{}), "applied object was pruned")
+}
+
+// Test_If_TrackingID_Is_Stable tests that the tracking label value does not
+// change, so that objects tracked by earlier versions are still recognized.
+func Test_If_TrackingID_Is_Stable(t *testing.T) {
+	assert.Equal(t, TrackingID("widgets", "widget-uid"), TrackingID("widgets", "widget-uid"))
+	assert.NotEqual(t, TrackingID("widgets", "widget-uid"), TrackingID("gadgets", "widget-uid"), "identity was ignored")
+	assert.Len(t, TrackingID("widgets", "widget-uid"), 43, "tracking ID is not a valid label value")
+}
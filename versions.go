@@ -0,0 +1,74 @@
+package operchain
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// JoinRules returns a new slice of the rules of the sets, in order, so that
+// rule sets, such as VersionedRules, can share rules without sharing the
+// arrays of their slices.
+func JoinRules(sets ...[]Rule) []Rule {
+	n := 0
+	for _, set := range sets {
+		n += len(set)
+	}
+	rules := make([]Rule, 0, n)
+	for _, set := range sets {
+		rules = append(rules, set...)
+	}
+	return rules
+}
+
+// eachRuleSet replaces Rules and each of the VersionedRules with the result
+// of f.
+func (c *Chain) eachRuleSet(f func(set []Rule) []Rule) {
+	c.Rules = f(c.Rules)
+	for version, set := range c.VersionedRules {
+		c.VersionedRules[version] = f(set)
+	}
+}
+
+// selectRules returns the rules of the Run: the VersionedRules of the version
+// of the primary resource, if there are any, or else Rules. The version of
+// the selected set is in the Run's report, and in the logs of its rules.
+func (c *Chain) selectRules(ctx context.Context) []Rule {
+	c.ruleSet = ""
+	primary := c.primary()
+	if len(c.VersionedRules) == 0 || primary == nil {
+		return c.Rules
+	}
+	version, rules, ok := c.versionedRules(primary)
+	if !ok {
+		log.FromContext(ctx).V(1).Info("no rule set for the version of the primary resource, running the default rules", "version", version)
+		return c.Rules
+	}
+	c.ruleSet = version
+	c.runLog.logger = c.runLog.logger.WithValues("ruleSet", version)
+	log.FromContext(ctx).V(1).Info("selected the rule set of the version of the primary resource", "ruleSet", version)
+	return rules
+}
+
+// versionedRules returns the version of the primary resource, and its
+// VersionedRules if there are any.
+func (c *Chain) versionedRules(primary client.Object) (string, []Rule, bool) {
+	if c.VersionSelector != nil {
+		version := c.VersionSelector(primary)
+		rules, ok := c.VersionedRules[version]
+		return version, rules, ok
+	}
+	gvk, err := c.gvkFor(primary)
+	if err != nil {
+		return "", nil, false
+	}
+	apiVersion := gvk.GroupVersion().String()
+	if rules, ok := c.VersionedRules[apiVersion]; ok {
+		return apiVersion, rules, true
+	}
+	if rules, ok := c.VersionedRules[gvk.Version]; ok {
+		return gvk.Version, rules, true
+	}
+	return apiVersion, nil, false
+}
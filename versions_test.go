@@ -0,0 +1,134 @@
+package operchain
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// storedVersionAnnotation is the annotation giving the version of a Widget
+// in the tests of VersionedRules.
+const storedVersionAnnotation = "test.operchain.io/stored-version"
+
+// Test_If_VersionedRules_Are_Selected_By_Version tests that Widgets stored at
+// two versions run the rule sets of their versions, sharing a rule, that a
+// Widget of another version runs the default Rules, and that the selection
+// is in the report and the logs of the rules.
+func Test_If_VersionedRules_Are_Selected_By_Version(t *testing.T) {
+	widget := func(name, version string) *Widget {
+		w := &Widget{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		if version != "" {
+			w.Annotations = map[string]string{storedVersionAnnotation: version}
+		}
+		return w
+	}
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		widget("old", "v1alpha1"), widget("new", "v1beta1"), widget("other", ""),
+	).Build()
+	var ran []string
+	record := func(name string) Rule {
+		return Rule{Name: name, Do: func(ctx context.Context) {
+			ran = append(ran, name)
+			log.FromContext(ctx).Info("ran")
+		}}
+	}
+	shared := []Rule{record("shared")}
+	c := &Chain{
+		VersionedRules: map[string][]Rule{
+			"v1alpha1": JoinRules(shared, []Rule{record("alpha")}),
+			"v1beta1":  JoinRules(shared, []Rule{record("beta")}),
+		},
+		VersionSelector: func(obj client.Object) string {
+			return obj.GetAnnotations()[storedVersionAnnotation]
+		},
+	}
+	var logs []string
+	c.Log = funcr.New(func(prefix, args string) {
+		logs = append(logs, args)
+	}, funcr.Options{})
+	c.InitializeChain(cl, &struct{ Widget *Widget }{}, []Rule{record("default")})
+	run := func(name string) *RunReport {
+		ran, logs = nil, nil
+		report, err := c.RunWithReport(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}})
+		assert.NoError(t, err, "Run returned an error")
+		return report
+	}
+
+	report := run("old")
+	assert.Equal(t, []string{"shared", "alpha"}, ran, "the v1alpha1 rules did not run")
+	assert.Equal(t, "v1alpha1", report.RuleSet, "the v1alpha1 rule set was not reported")
+	if assert.NotEmpty(t, logs, "the rules did not log") {
+		assert.Contains(t, logs[len(logs)-1], `"ruleSet"="v1alpha1"`, "the rule set was not logged")
+	}
+
+	report = run("new")
+	assert.Equal(t, []string{"shared", "beta"}, ran, "the v1beta1 rules did not run")
+	assert.Equal(t, "v1beta1", report.RuleSet, "the v1beta1 rule set was not reported")
+
+	report = run("other")
+	assert.Equal(t, []string{"default"}, ran, "the default rules did not run")
+	assert.Empty(t, report.RuleSet, "a rule set was reported for the default rules")
+	for _, line := range logs {
+		assert.False(t, strings.Contains(line, "ruleSet"), "a rule set was logged for the default rules")
+	}
+
+	report = run("missing")
+	assert.Equal(t, []string{"default"}, ran, "the default rules did not run without a primary resource")
+}
+
+// Test_If_VersionedRules_Match_The_APIVersion tests that without a
+// VersionSelector, the rule sets are keyed by the apiVersion of the primary
+// resource, or by its version alone.
+func Test_If_VersionedRules_Match_The_APIVersion(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var ran string
+	set := func(name string) []Rule {
+		return []Rule{{Do: func(context.Context) { ran = name }}}
+	}
+	c := &Chain{VersionedRules: map[string][]Rule{"v1": set("version"), "v2": set("other")}}
+	c.InitializeChain(cl, &struct{ Widget *Widget }{}, set("default"))
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	report, err := c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, "version", ran, "the rules of the version did not run")
+	assert.Equal(t, "v1", report.RuleSet, "the version was not reported")
+
+	c.VersionedRules["test.operchain.io/v1"] = set("apiVersion")
+	report, err = c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, "apiVersion", ran, "the rules of the apiVersion did not run")
+	assert.Equal(t, "test.operchain.io/v1", report.RuleSet, "the apiVersion was not reported")
+}
+
+// Test_If_WithFinalizer_Adds_Rules_To_Each_Rule_Set tests that the rules of
+// WithFinalizer lead every rule set, and that the shared rules of the sets
+// are not changed.
+func Test_If_WithFinalizer_Adds_Rules_To_Each_Rule_Set(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).Build()
+	shared := []Rule{{Name: "shared"}}
+	c := &Chain{VersionedRules: map[string][]Rule{"v1": JoinRules(shared, []Rule{{Name: "v1"}})}}
+	c.InitializeChain(cl, &struct{ Widget *Widget }{}, nil)
+	c.WithFinalizer("example.com/cleanup", &Chain{})
+	names := func(rules []Rule) []string {
+		var names []string
+		for _, rule := range rules {
+			names = append(names, rule.Name)
+		}
+		return names
+	}
+	want := []string{"add finalizer example.com/cleanup", "clean up example.com/cleanup", "stop while deleting"}
+	assert.Equal(t, want, names(c.Rules), "the finalizer rules were not added to the Rules")
+	assert.Equal(t, append(want, "shared", "v1"), names(c.VersionedRules["v1"]), "the finalizer rules were not added to the rule set")
+	assert.Equal(t, []string{"shared"}, names(shared), "the shared rules were changed")
+}
@@ -0,0 +1,139 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// WaitTimeoutError is the error of WaitUntil when its predicate stayed false
+// for longer than the timeout.
+type WaitTimeoutError struct {
+	// Predicate identifies the predicate waited for.
+	Predicate string
+	// Waited is how long the predicate has been false.
+	Waited time.Duration
+}
+
+// Error returns the predicate and how long it was waited for.
+func (e *WaitTimeoutError) Error() string {
+	return fmt.Sprintf("timed out waiting for %s after %s", e.Predicate, e.Waited)
+}
+
+// waitOptions holds the options of WaitUntil.
+type waitOptions struct {
+	keepRunning bool
+	timeout     time.Duration
+}
+
+// WaitOption configures WaitUntil.
+type WaitOption func(o *waitOptions)
+
+// WaitWithoutStopping makes WaitUntil only skip the rest of the Sequential it
+// runs in while waiting, and let the following rules run.
+func WaitWithoutStopping() WaitOption {
+	return func(o *waitOptions) {
+		o.keepRunning = true
+	}
+}
+
+// WaitTimeout makes WaitUntil fail the Run with a WaitTimeoutError once the
+// predicate has been false for longer than timeout, measured across runs from
+// the first Run that found it false. The predicate must then have a key or a
+// name, which identifies it across runs.
+func WaitTimeout(timeout time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WaitUntil returns an action that does nothing if p is true, and otherwise
+// requeues after requeueAfter, skips the rest of the Sequential it runs in, if
+// any, and stops the chain.
+func (c *Chain) WaitUntil(p *predicate, requeueAfter time.Duration, opts ...WaitOption) Action {
+	o := &waitOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	id := p.Key()
+	if id == "" {
+		id = p.Name()
+	}
+	if id == "" && o.timeout > 0 {
+		panic("predicates waited for with a timeout must have a key or a name")
+	}
+	key := "wait:" + id
+	return func(ctx context.Context) {
+		if p.Eval(c.cache) {
+			if o.timeout > 0 {
+				c.storeDelete(key)
+			}
+			return
+		}
+		if o.timeout > 0 {
+			now := c.now()
+			since, ok := c.storeGet(key)
+			if !ok {
+				since = now
+				c.storeSet(key, now)
+			}
+			if waited := now.Sub(since.(time.Time)); waited > o.timeout {
+				c.fail(ctx, &WaitTimeoutError{Predicate: id, Waited: waited})
+			}
+		}
+		c.doRequeue(requeueAfter)
+		skipSequence(ctx)
+		if !o.keepRunning {
+			c.doStop()
+		}
+	}
+}
+
+// WaitForDeletion returns an action that makes sure an object is gone before
+// the chain proceeds. The object is given either as a pointer to a resource
+// field, or as a client.Object identifying it by name and namespace, which is
+// read afresh. If the object exists, the action deletes it unless it is
+// already being deleted, and then requeues after requeueAfter, skips the rest
+// of the Sequential it runs in, if any, and stops the chain, until a later Run
+// finds the object gone. An object that never existed counts as gone.
+func (c *Chain) WaitForDeletion(target interface{}, requeueAfter time.Duration) Action {
+	return c.Try(c.WaitForDeletionE(target, requeueAfter))
+}
+
+// WaitForDeletionE is like WaitForDeletion, but returns the error.
+func (c *Chain) WaitForDeletionE(target interface{}, requeueAfter time.Duration) ActionE {
+	key, isObject := target.(client.Object)
+	if !isObject {
+		checkField(target)
+	}
+	return func(ctx context.Context) error {
+		var obj client.Object
+		if isObject {
+			obj = key.DeepCopyObject().(client.Object)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(key), obj); err != nil {
+				if apierrors.IsNotFound(err) {
+					return nil
+				}
+				return fmt.Errorf("get %s/%s: %w", key.GetNamespace(), key.GetName(), err)
+			}
+		} else if obj = objectAt(target); obj == nil {
+			return nil
+		}
+		if obj.GetDeletionTimestamp().IsZero() {
+			deleted, err := c.deleteObject(ctx, obj, &deleteOptions{uid: true, ignoreNotFound: true})
+			if err != nil {
+				return err
+			}
+			if deleted {
+				c.invalidateRun()
+			}
+		}
+		c.doRequeue(requeueAfter)
+		skipSequence(ctx)
+		c.doStop()
+		return nil
+	}
+}
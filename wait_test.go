@@ -0,0 +1,135 @@
+package operchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// waitChain returns a chain that waits for ready with the given options inside
+// a Sequential, and counts the actions run after the wait in the Sequential and
+// in a later rule.
+func waitChain(ready *bool, opts ...WaitOption) (*Chain, *int, *int) {
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}},
+	).Build()
+	var res struct {
+		Widget *Widget
+	}
+	inSequence, later := 0, 0
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: Sequential(
+			c.WaitUntil(Named("DatabaseReady", Predicate(func() bool { return *ready })), time.Minute, opts...),
+			func(context.Context) { inSequence++ },
+		)},
+		{Do: func(context.Context) { later++ }},
+	})
+	return c, &inSequence, &later
+}
+
+// Test_If_WaitUntil_Stops_And_Requeues_While_False tests that WaitUntil stops
+// the chain and requeues while its predicate is false, and does nothing once
+// it is true.
+func Test_If_WaitUntil_Stops_And_Requeues_While_False(t *testing.T) {
+	ready := false
+	c, inSequence, later := waitChain(&ready)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	result, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, time.Minute, result.RequeueAfter, "waiting did not requeue")
+	assert.Equal(t, 0, *inSequence+*later, "actions ran while waiting")
+
+	ready = true
+	result, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Zero(t, result.RequeueAfter, "Run requeued after waiting")
+	assert.Equal(t, 2, *inSequence+*later, "actions did not run after waiting")
+}
+
+// Test_If_WaitUntil_Can_Skip_Only_The_Sequence tests that WaitUntil without
+// stopping skips the rest of its Sequential but lets later rules run.
+func Test_If_WaitUntil_Can_Skip_Only_The_Sequence(t *testing.T) {
+	ready := false
+	c, inSequence, later := waitChain(&ready, WaitWithoutStopping())
+	_, err := c.Run(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}})
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 0, *inSequence, "sequence was not skipped")
+	assert.Equal(t, 1, *later, "later rule did not run")
+}
+
+// Test_If_WaitUntil_Times_Out_Across_Runs tests that waiting for longer than
+// the timeout since the predicate was first found false fails the Run.
+func Test_If_WaitUntil_Times_Out_Across_Runs(t *testing.T) {
+	clk := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ready := false
+	c, _, _ := waitChain(&ready, WaitTimeout(10*time.Minute))
+	c.Clock = clk
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "first wait failed")
+	clk.Step(10 * time.Minute)
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "wait failed before the timeout")
+	clk.Step(time.Second)
+	_, err = c.Run(context.Background(), req)
+	var timeout *WaitTimeoutError
+	if assert.True(t, errors.As(err, &timeout), "wait did not time out") {
+		assert.Equal(t, "DatabaseReady", timeout.Predicate, "timeout did not name the predicate")
+	}
+
+	ready = true
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	ready = false
+	_, err = c.Run(context.Background(), req)
+	assert.NoError(t, err, "wait did not start over once the predicate was true")
+}
+
+// Test_If_WaitForDeletion_Waits_Until_The_Object_Is_Gone tests that
+// WaitForDeletion deletes the object, waits while it terminates, and proceeds
+// once it is gone or if it never existed.
+func Test_If_WaitForDeletion_Waits_Until_The_Object_Is_Gone(t *testing.T) {
+	old := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", Finalizers: []string{"example.com/cleanup"}}}
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+		&Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}, old,
+	).Build()
+	var res struct {
+		Widget    *Widget
+		ConfigMap *corev1.ConfigMap
+	}
+	replaced := 0
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: c.WaitForDeletion(&res.ConfigMap, 5*time.Second)},
+		{Do: c.WaitForDeletion(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "never", Namespace: "default"}}, 5*time.Second)},
+		{Do: func(context.Context) { replaced++ }},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	for i, state := range []string{"exists", "terminating"} {
+		result, err := c.Run(context.Background(), req)
+		assert.NoError(t, err, "Run returned an error while %s", state)
+		assert.Equal(t, 5*time.Second, result.RequeueAfter, "Run did not requeue while %s", state)
+		assert.Equal(t, 0, replaced, "replacement ran while %s", state)
+		if i == 0 {
+			assert.NoError(t, cl.Get(context.Background(), req.NamespacedName, old))
+			assert.False(t, old.DeletionTimestamp.IsZero(), "object was not deleted")
+		}
+	}
+	assert.NoError(t, cl.Get(context.Background(), req.NamespacedName, old))
+	old.Finalizers = nil
+	assert.NoError(t, cl.Update(context.Background(), old))
+	result, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error once gone")
+	assert.Zero(t, result.RequeueAfter, "Run requeued once gone")
+	assert.Equal(t, 1, replaced, "replacement did not run once gone")
+}
@@ -0,0 +1,131 @@
+package operchain
+
+import (
+	"reflect"
+	"slices"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlpredicate "sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/smxlong/operchain/internal/pcache"
+)
+
+// Tags declaring which changes of the primary resource, other than those of
+// its spec, a predicate reacts to, for RecommendedWatchPredicates. The
+// predicates of the chain that read the metadata or status of a resource field
+// declare it themselves; predicates built with Predicate are assumed to read
+// only the spec unless tagged with WithTags.
+const (
+	// ReactsToStatus marks a predicate reading the status of the primary
+	// resource.
+	ReactsToStatus = "operchain:reacts-to-status"
+	// ReactsToAnnotations marks a predicate reading the annotations of the
+	// primary resource.
+	ReactsToAnnotations = "operchain:reacts-to-annotations"
+	// ReactsToLabels marks a predicate reading the labels of the primary
+	// resource.
+	ReactsToLabels = "operchain:reacts-to-labels"
+)
+
+// reaction records what part of the object in a resource field a predicate
+// reads. A nil field is the primary resource.
+type reaction struct {
+	field interface{}
+	tags  []string
+}
+
+// reactsTo records in p that it reads the given parts, as ReactsTo tags, of
+// the object in the given resource field, and returns p.
+func (c *Chain) reactsTo(p *predicate, fieldPtr interface{}, tags ...string) *predicate {
+	return pcache.WithMeta(p, reaction{field: fieldPtr, tags: tags})
+}
+
+// reactsToPath returns the ReactsTo tags of a field path.
+func reactsToPath(fields []string) []string {
+	switch {
+	case len(fields) > 0 && fields[0] == "status":
+		return []string{ReactsToStatus}
+	case len(fields) > 1 && fields[0] == "metadata" && fields[1] == "annotations":
+		return []string{ReactsToAnnotations}
+	case len(fields) > 1 && fields[0] == "metadata" && fields[1] == "labels":
+		return []string{ReactsToLabels}
+	}
+	return nil
+}
+
+// primaryReactions returns the set of ReactsTo tags of the predicates of the
+// chain's rules, VersionedRules, and Finally rules concerning the primary
+// resource.
+func (c *Chain) primaryReactions() map[string]bool {
+	res, primaries := c.primaryFields()
+	isPrimary := func(field interface{}) bool {
+		for _, i := range primaries {
+			if reflect.ValueOf(field).Pointer() == res.Field(i).Addr().Pointer() {
+				return true
+			}
+		}
+		return false
+	}
+	tags := map[string]bool{}
+	var visit func(p *predicate)
+	visit = func(p *predicate) {
+		for _, tag := range p.Tags() {
+			tags[tag] = true
+		}
+		if r, ok := p.Meta().(reaction); ok && (r.field == nil || isPrimary(r.field)) {
+			for _, tag := range r.tags {
+				tags[tag] = true
+			}
+		}
+		for _, child := range p.Children() {
+			visit(child)
+		}
+	}
+	sets := [][]Rule{c.Rules, c.Finally}
+	for _, rules := range c.VersionedRules {
+		sets = append(sets, rules)
+	}
+	for _, rules := range sets {
+		for _, rule := range rules {
+			if rule.When != nil {
+				visit(rule.When)
+			}
+		}
+	}
+	if tags[reactsToState] {
+		if _, ok := c.stateStore().(AnnotationState); ok {
+			tags[ReactsToAnnotations] = true
+		}
+	}
+	return tags
+}
+
+// reactsToState marks the state predicates, which read the annotations of the
+// primary resource when the state is kept in them.
+const reactsToState = "operchain:reacts-to-state"
+
+// RecommendedWatchPredicates returns the event predicates recommended for the
+// watch of the type of obj, for ControllerOptions.WatchPredicates. For the
+// type of a primary resource, unless a predicate of the chain's rules reacts
+// to its status, they pass the updates that change its generation, and those
+// that change its annotations or labels if a predicate reacts to them, so
+// that the chain's own status writes do not trigger reconciles. Other types
+// are not filtered.
+func (c *Chain) RecommendedWatchPredicates(obj client.Object) []ctrlpredicate.Predicate {
+	res, primaries := c.primaryFields()
+	if !slices.ContainsFunc(primaries, func(i int) bool { return reflect.TypeOf(obj) == res.Field(i).Type() }) {
+		return nil
+	}
+	tags := c.primaryReactions()
+	if tags[ReactsToStatus] {
+		return nil
+	}
+	predicates := []ctrlpredicate.Predicate{ctrlpredicate.GenerationChangedPredicate{}}
+	if tags[ReactsToAnnotations] {
+		predicates = append(predicates, ctrlpredicate.AnnotationChangedPredicate{})
+	}
+	if tags[ReactsToLabels] {
+		predicates = append(predicates, ctrlpredicate.LabelChangedPredicate{})
+	}
+	return []ctrlpredicate.Predicate{ctrlpredicate.Or(predicates...)}
+}
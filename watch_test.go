@@ -0,0 +1,99 @@
+package operchain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	ctrlpredicate "sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// passesUpdate returns true if the predicates pass the update from old to new.
+func passesUpdate(predicates []ctrlpredicate.Predicate, old, new client.Object) bool {
+	return ctrlpredicate.And(predicates...).Update(event.UpdateEvent{ObjectOld: old, ObjectNew: new})
+}
+
+// Test_If_RecommendedWatchPredicates_Filter_Status_Writes tests that the
+// predicates recommended for the primary resource of a chain reacting to its
+// spec and annotations drop status-only updates.
+func Test_If_RecommendedWatchPredicates_Filter_Status_Writes(t *testing.T) {
+	var res struct {
+		Widget *Widget
+		Secret *corev1.Secret
+	}
+	c := &Chain{}
+	c.InitializeChain(nil, &res, []Rule{
+		{When: c.GenerationChanged(&res.Widget), Do: c.SetObservedGeneration(&res.Widget)},
+		{When: c.ConditionTrue(&res.Secret, "Ready"), Do: c.Stop()},
+	}, WithPauseSupport("example.com/paused"))
+	predicates := c.RecommendedWatchPredicates(&Widget{})
+	assert.Len(t, predicates, 1, "predicates were not recommended")
+	old := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "w", Generation: 1}}
+	status := old.DeepCopyObject().(*Widget)
+	status.Status.ObservedGeneration = 1
+	assert.False(t, passesUpdate(predicates, old, status), "status write passed")
+	spec := old.DeepCopyObject().(*Widget)
+	spec.Generation = 2
+	assert.True(t, passesUpdate(predicates, old, spec), "spec change was dropped")
+	paused := old.DeepCopyObject().(*Widget)
+	paused.Annotations = map[string]string{"example.com/paused": "true"}
+	assert.True(t, passesUpdate(predicates, old, paused), "annotation change was dropped")
+	labeled := old.DeepCopyObject().(*Widget)
+	labeled.Labels = map[string]string{"team": "a"}
+	assert.False(t, passesUpdate(predicates, old, labeled), "label change passed")
+	assert.Nil(t, c.RecommendedWatchPredicates(&corev1.Secret{}), "secondary resource was filtered")
+}
+
+// Test_If_RecommendedWatchPredicates_Keep_Status_Writes tests that nothing is
+// filtered for a chain with a rule reacting to the status of the primary
+// resource, declared by the chain's predicates or by a tag.
+func Test_If_RecommendedWatchPredicates_Keep_Status_Writes(t *testing.T) {
+	var res struct {
+		Widget *Widget
+	}
+	c := &Chain{}
+	c.InitializeChain(nil, &res, []Rule{
+		{When: Not(c.ConditionTrue(&res.Widget, "Ready")), Do: c.Stop()},
+	})
+	assert.Nil(t, c.RecommendedWatchPredicates(&Widget{}), "status of primary was filtered")
+
+	c = &Chain{}
+	c.InitializeChain(nil, &res, nil)
+	c.Finally = []Rule{{When: WithTags(Predicate(func() bool { return true }), ReactsToStatus), Do: c.Stop()}}
+	assert.Nil(t, c.RecommendedWatchPredicates(&Widget{}), "tagged status reaction was ignored")
+
+	c = &Chain{}
+	c.InitializeChain(nil, &res, []Rule{
+		{When: c.FieldEquals(&res.Widget, "metadata.labels[team]", "a"), Do: c.Stop()},
+	})
+	predicates := c.RecommendedWatchPredicates(&Widget{})
+	old := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "w", Generation: 1}}
+	labeled := old.DeepCopyObject().(*Widget)
+	labeled.Labels = map[string]string{"team": "a"}
+	assert.True(t, passesUpdate(predicates, old, labeled), "label change was dropped")
+}
+
+// Test_If_SetupWithManager_Asks_For_The_Predicates_Of_Each_Watch tests that
+// SetupWithManager asks WatchPredicates for the predicates of every watched
+// type.
+func Test_If_SetupWithManager_Asks_For_The_Predicates_Of_Each_Watch(t *testing.T) {
+	var res struct {
+		Widget     *Widget
+		Secret     *corev1.Secret
+		ConfigMaps []corev1.ConfigMap
+	}
+	c := &Chain{Resources: &res}
+	var watched []string
+	_, err := c.SetupWithManager(newTestManager(t), ControllerOptions{
+		WatchPredicates: func(obj client.Object) []ctrlpredicate.Predicate {
+			watched = append(watched, fmt.Sprintf("%T", obj))
+			return c.RecommendedWatchPredicates(obj)
+		},
+	})
+	assert.NoError(t, err, "SetupWithManager failed")
+	assert.Equal(t, []string{"*operchain.Widget", "*v1.Secret", "*v1.ConfigMap"}, watched, "watches were not filtered")
+}
@@ -0,0 +1,84 @@
+package operchain
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// widgetGroupVersion is the group and version of the Widget test resource.
+var widgetGroupVersion = schema.GroupVersion{Group: "test.operchain.io", Version: "v1"}
+
+// newTestScheme returns a scheme with the built-in and Widget types
+// registered.
+func newTestScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	scheme.AddKnownTypes(widgetGroupVersion, &Widget{}, &WidgetList{})
+	metav1.AddToGroupVersion(scheme, widgetGroupVersion)
+	return scheme
+}
+
+// Widget is a custom resource used by the tests.
+type Widget struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WidgetSpec   `json:"spec,omitempty"`
+	Status WidgetStatus `json:"status,omitempty"`
+}
+
+// WidgetSpec is the spec of a Widget.
+type WidgetSpec struct {
+	Size   int64 `json:"size,omitempty"`
+	Paused bool  `json:"paused,omitempty"`
+}
+
+// WidgetStatus is the status of a Widget.
+type WidgetStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// WidgetList is a list of Widgets.
+type WidgetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []Widget `json:"items"`
+}
+
+// DeepCopyInto copies the Widget into out.
+func (w *Widget) DeepCopyInto(out *Widget) {
+	*out = *w
+	out.TypeMeta = w.TypeMeta
+	w.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if w.Status.Conditions != nil {
+		out.Status.Conditions = make([]metav1.Condition, len(w.Status.Conditions))
+		for i := range w.Status.Conditions {
+			w.Status.Conditions[i].DeepCopyInto(&out.Status.Conditions[i])
+		}
+	}
+}
+
+// DeepCopyObject implements runtime.Object.
+func (w *Widget) DeepCopyObject() runtime.Object {
+	out := &Widget{}
+	w.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (l *WidgetList) DeepCopyObject() runtime.Object {
+	out := &WidgetList{}
+	out.TypeMeta = l.TypeMeta
+	l.ListMeta.DeepCopyInto(&out.ListMeta)
+	if l.Items != nil {
+		out.Items = make([]Widget, len(l.Items))
+		for i := range l.Items {
+			l.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+	return out
+}
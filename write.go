@@ -0,0 +1,138 @@
+package operchain
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// writeOptions holds the options of the actions that write objects.
+type writeOptions struct {
+	ownedByPrimary bool
+}
+
+// WriteOption configures an action that writes an object.
+type WriteOption func(o *writeOptions)
+
+// OwnedByPrimary makes the primary resource the controller owner of the
+// written object, so that it is garbage collected with the primary resource.
+func OwnedByPrimary() WriteOption {
+	return func(o *writeOptions) {
+		o.ownedByPrimary = true
+	}
+}
+
+// newWriteOptions applies the given options.
+func newWriteOptions(opts []WriteOption) *writeOptions {
+	o := &writeOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// CreateOrUpdate returns an action that makes the object look like the desired
+// state, as controllerutil.CreateOrUpdate does: it fetches the object by the
+// name and namespace of obj, applies mutate, and creates the object if it does
+// not exist or updates it if mutate changed it. The result is recorded in the
+// run report. If the chain tracks its objects, obj is labeled for
+// PruneTracked. An update that conflicts is retried once; other errors become
+// the error of the operchain.
+func (c *Chain) CreateOrUpdate(obj client.Object, mutate func() error, opts ...WriteOption) Action {
+	return writes(c.Try(c.CreateOrUpdateE(obj, mutate, opts...)), objectOrFieldTarget(obj, ""))
+}
+
+// CreateOrUpdateE is like CreateOrUpdate, but returns the error.
+func (c *Chain) CreateOrUpdateE(obj client.Object, mutate func() error, opts ...WriteOption) ActionE {
+	o := newWriteOptions(opts)
+	return func(ctx context.Context) error {
+		var rendered *ObjectDiff
+		f := func() error {
+			// obj holds the live object, if it exists.
+			var live client.Object
+			if obj.GetResourceVersion() != "" {
+				live = obj.DeepCopyObject().(client.Object)
+			}
+			if err := mutate(); err != nil {
+				return err
+			}
+			if err := c.track(obj); err != nil {
+				return err
+			}
+			if err := c.setOwner(obj, o); err != nil {
+				return err
+			}
+			rendered = c.renderDiff(ctx, live, obj)
+			return nil
+		}
+		result, err := controllerutil.CreateOrUpdate(ctx, c.Client, obj, f)
+		if apierrors.IsConflict(err) {
+			result, err = controllerutil.CreateOrUpdate(ctx, c.Client, obj, f)
+		}
+		if err != nil {
+			return fmt.Errorf("create or update %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+		}
+		if result == controllerutil.OperationResultNone {
+			rendered = nil
+		}
+		c.recordWrite(obj, result, "", rendered)
+		return nil
+	}
+}
+
+// setOwner sets the owner of the object according to the options.
+func (c *Chain) setOwner(obj client.Object, o *writeOptions) error {
+	if !o.ownedByPrimary {
+		return nil
+	}
+	return c.ownByPrimary(obj, true)
+}
+
+// CreateIfNotExists returns an action that creates the object returned by
+// factory unless an object with its name and namespace already exists. An
+// existing object is never updated, even if it differs. factory is called on
+// every run to obtain the object's name and namespace, so it should be cheap.
+// The created object is stored in the first Resources field of its type that
+// is empty or holds the object with the same name, so that later rules see it.
+// An object created concurrently by someone else counts as existing.
+// If the chain tracks its objects, the object is labeled for PruneTracked when
+// it is created, and is never pruned while factory returns it.
+func (c *Chain) CreateIfNotExists(factory func() client.Object, opts ...WriteOption) Action {
+	return c.Try(c.CreateIfNotExistsE(factory, opts...))
+}
+
+// CreateIfNotExistsE is like CreateIfNotExists, but returns the error.
+func (c *Chain) CreateIfNotExistsE(factory func() client.Object, opts ...WriteOption) ActionE {
+	o := newWriteOptions(opts)
+	return func(ctx context.Context) error {
+		obj := factory()
+		if err := c.track(obj); err != nil {
+			return err
+		}
+		existing := obj.DeepCopyObject().(client.Object)
+		err := c.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+		if err == nil {
+			c.recordOperation(obj, controllerutil.OperationResultNone)
+			return nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("get %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+		}
+		if err := c.setOwner(obj, o); err != nil {
+			return err
+		}
+		if err := c.Create(ctx, obj); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				c.recordOperation(obj, controllerutil.OperationResultNone)
+				return nil
+			}
+			return fmt.Errorf("create %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+		}
+		c.recordOperation(obj, controllerutil.OperationResultCreated)
+		c.setMatchingField(obj)
+		return nil
+	}
+}
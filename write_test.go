@@ -0,0 +1,130 @@
+package operchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Test_If_CreateOrUpdate_Creates_Skips_And_Updates tests the create, no-op,
+// and update paths of CreateOrUpdate, and that each is recorded in the report.
+func Test_If_CreateOrUpdate_Creates_Skips_And_Updates(t *testing.T) {
+	widget := &Widget{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", UID: "widget-uid"}}
+	cl := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(widget).Build()
+	var res struct {
+		Widget *Widget
+	}
+	size := "1"
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo-config", Namespace: "default"}}
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: c.CreateOrUpdate(cm, func() error {
+			cm.Data = map[string]string{"size": size}
+			return nil
+		}, OwnedByPrimary())},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	results := []controllerutil.OperationResult{}
+	for _, s := range []string{"1", "1", "2"} {
+		size = s
+		report, err := c.RunWithReport(context.Background(), req)
+		assert.NoError(t, err, "Run returned an error")
+		if assert.Len(t, report.Operations, 1, "operation was not recorded") {
+			assert.Equal(t, "ConfigMap", report.Operations[0].Kind)
+			results = append(results, report.Operations[0].Result)
+		}
+	}
+	assert.Equal(t, []controllerutil.OperationResult{
+		controllerutil.OperationResultCreated,
+		controllerutil.OperationResultNone,
+		controllerutil.OperationResultUpdated,
+	}, results)
+	stored := &corev1.ConfigMap{}
+	assert.NoError(t, cl.Get(context.Background(), client.ObjectKeyFromObject(cm), stored))
+	assert.Equal(t, "2", stored.Data["size"], "object was not updated")
+	assert.True(t, metav1.IsControlledBy(stored, widget), "owner was not set")
+}
+
+// Test_If_CreateOrUpdate_Retries_A_Conflict tests that CreateOrUpdate retries
+// an update that conflicts once before succeeding.
+func Test_If_CreateOrUpdate_Retries_A_Conflict(t *testing.T) {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "demo-config", Namespace: "default"}}
+	conflicts := 1
+	cl := fake.NewClientBuilder().WithObjects(cm.DeepCopy()).WithInterceptorFuncs(interceptor.Funcs{
+		Update: func(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if conflicts > 0 {
+				conflicts--
+				return apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, obj.GetName(), assert.AnError)
+			}
+			return cl.Update(ctx, obj, opts...)
+		},
+	}).Build()
+	c := &Chain{Client: cl}
+	err := c.CreateOrUpdateE(cm, func() error {
+		cm.Data = map[string]string{"key": "value"}
+		return nil
+	})(context.Background())
+	assert.NoError(t, err, "conflict was not retried")
+	assert.Zero(t, conflicts, "update did not conflict")
+}
+
+// Test_If_CreateIfNotExists_Never_Updates tests that CreateIfNotExists creates
+// the object once, stores it in the Resources, and leaves it alone afterwards.
+func Test_If_CreateIfNotExists_Never_Updates(t *testing.T) {
+	cl := fake.NewClientBuilder().Build()
+	var res struct {
+		ConfigMap *corev1.ConfigMap
+		Secret    *corev1.Secret
+	}
+	password := "first"
+	c := &Chain{}
+	c.InitializeChain(cl, &res, []Rule{
+		{Do: c.CreateIfNotExists(func() client.Object {
+			return &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "bootstrap", Namespace: "default"},
+				StringData: map[string]string{"password": password},
+			}
+		})},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "demo"}}
+	_, err := c.Run(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	if assert.NotNil(t, res.Secret, "created object was not stored in the Resources") {
+		assert.Equal(t, "bootstrap", res.Secret.Name)
+	}
+	password = "second"
+	report, err := c.RunWithReport(context.Background(), req)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, controllerutil.OperationResultNone, report.Operations[0].Result, "existing object was written")
+	stored := &corev1.Secret{}
+	assert.NoError(t, cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "bootstrap"}, stored))
+	assert.Equal(t, "first", stored.StringData["password"], "existing object was updated")
+}
+
+// Test_If_CreateIfNotExists_Swallows_AlreadyExists tests that an object created
+// between the Get and the Create counts as existing.
+func Test_If_CreateIfNotExists_Swallows_AlreadyExists(t *testing.T) {
+	cl := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			// Someone else creates the object first.
+			_ = cl.Create(ctx, obj.DeepCopyObject().(client.Object))
+			return cl.Create(ctx, obj, opts...)
+		},
+	}).Build()
+	c := &Chain{Client: cl}
+	err := c.CreateIfNotExistsE(func() client.Object {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "bootstrap", Namespace: "default"}}
+	})(context.Background())
+	assert.NoError(t, err, "AlreadyExists was not swallowed")
+}